@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -8,6 +9,7 @@ import (
 
 	"github.com/jacky-htg/erp-pkg/db/postgres"
 	"github.com/jacky-htg/inventory-service/internal/config"
+	"github.com/jacky-htg/inventory-service/internal/model"
 	"github.com/jacky-htg/inventory-service/internal/schema"
 	_ "github.com/lib/pq"
 )
@@ -65,6 +67,31 @@ func run(log *log.Logger) error {
 		}
 		log.Println("Seed data complete")
 		return nil
+
+	case "rebuild-stock-balances":
+		ctx := context.Background()
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("begin transaction: %v", err)
+		}
+
+		var stockBalance model.StockBalance
+		drifts, err := stockBalance.Rebuild(ctx, tx)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("rebuilding stock balances: %v", err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("commit stock balances: %v", err)
+		}
+
+		for _, drift := range drifts {
+			log.Printf("drift : company %s branch %s warehouse %s shelve %s product %s : balance %d, inventories %d",
+				drift.CompanyID, drift.BranchID, drift.WarehouseID, drift.ShelveID, drift.ProductID, drift.Qty, drift.Expected)
+		}
+		log.Printf("Stock balances rebuilt, %d drift found", len(drifts))
+		return nil
 	}
 
 	return nil
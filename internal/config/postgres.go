@@ -0,0 +1,15 @@
+package config
+
+import (
+	"fmt"
+	"os"
+)
+
+// PostgresDSN connection string of the database from the POSTGRES_ environment, the same settings postgres.Open
+// connects with. A connection opened outside of the pool, e.g. the listener of the notifications, uses it so both
+// always reach the same database.
+func PostgresDSN() string {
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		os.Getenv("POSTGRES_HOST"), os.Getenv("POSTGRES_PORT"), os.Getenv("POSTGRES_USER"),
+		os.Getenv("POSTGRES_PASSWORD"), os.Getenv("POSTGRES_DB"))
+}
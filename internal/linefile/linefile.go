@@ -0,0 +1,32 @@
+package linefile
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// File append lines to the file of the path, the writes of concurrent callers do not interleave
+type File struct {
+	Path string
+	mu   sync.Mutex
+}
+
+// Append write the line and a line break at the end of the file, the file is created when it does not exist
+func (u *File) Append(line []byte) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	f, err := os.OpenFile(u.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("open file %s: %v", u.Path, err)
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	if err != nil {
+		return fmt.Errorf("write file %s: %v", u.Path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// AccountMapping struct, the accounts debited and credited by the journal of a transaction type
+type AccountMapping struct {
+	Pb inventories.AccountMapping
+}
+
+// Get func
+func (u *AccountMapping) Get(ctx context.Context, db *sql.DB) error {
+	query := `
+		SELECT id, company_id, type, debit_account_id, credit_account_id, created_at, created_by, updated_at, updated_by
+		FROM account_mappings WHERE id = $1
+	`
+
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare statement Get account mapping: %v", err)
+	}
+	defer stmt.Close()
+
+	var companyID string
+	var createdAt, updatedAt time.Time
+	err = stmt.QueryRowContext(ctx, u.Pb.GetId()).Scan(
+		&u.Pb.Id, &companyID, &u.Pb.Type, &u.Pb.DebitAccountId, &u.Pb.CreditAccountId,
+		&createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy,
+	)
+
+	if err == sql.ErrNoRows {
+		return status.Errorf(codes.NotFound, "Query Raw get account mapping: %v", err)
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw get account mapping: %v", err)
+	}
+
+	if companyID != ctx.Value(app.Ctx("companyID")).(string) {
+		return status.Error(codes.Unauthenticated, "its not your company data")
+	}
+
+	u.Pb.CreatedAt = createdAt.String()
+	u.Pb.UpdatedAt = updatedAt.String()
+
+	return nil
+}
+
+// getByType mapping of the transaction type in the company, a type without mapping is not journalized
+func (u *AccountMapping) getByType(ctx context.Context, tx *sql.Tx, companyID string) (bool, error) {
+	err := tx.QueryRowContext(ctx, `
+		SELECT id, debit_account_id, credit_account_id FROM account_mappings WHERE company_id = $1 AND type = $2`,
+		companyID, u.Pb.GetType(),
+	).Scan(&u.Pb.Id, &u.Pb.DebitAccountId, &u.Pb.CreditAccountId)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, status.Errorf(codes.Internal, "Query Raw get account mapping by type: %v", err)
+	}
+
+	return true, nil
+}
+
+// Upsert AccountMapping, a company has a single mapping per transaction type. The journals of the type waiting
+// for a mapping are sent with it.
+func (u *AccountMapping) Upsert(ctx context.Context, tx *sql.Tx) error {
+	now := time.Now().UTC()
+	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+
+	query := `
+		INSERT INTO account_mappings (id, company_id, type, debit_account_id, credit_account_id, created_at, created_by, updated_at, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $6, $7)
+		ON CONFLICT (company_id, type)
+		DO UPDATE SET debit_account_id = EXCLUDED.debit_account_id, credit_account_id = EXCLUDED.credit_account_id,
+			updated_at = EXCLUDED.updated_at, updated_by = EXCLUDED.updated_by
+		RETURNING id, created_at, created_by
+	`
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare upsert account mapping: %v", err)
+	}
+	defer stmt.Close()
+
+	var createdAt time.Time
+	err = stmt.QueryRowContext(ctx,
+		uuid.New().String(),
+		ctx.Value(app.Ctx("companyID")).(string),
+		u.Pb.GetType(),
+		u.Pb.GetDebitAccountId(),
+		u.Pb.GetCreditAccountId(),
+		now,
+		u.Pb.GetUpdatedBy(),
+	).Scan(&u.Pb.Id, &createdAt, &u.Pb.CreatedBy)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec upsert account mapping: %v", err)
+	}
+
+	u.Pb.CreatedAt = createdAt.String()
+	u.Pb.UpdatedAt = now.String()
+
+	return mapUnmappedJournals(ctx, tx, ctx.Value(app.Ctx("companyID")).(string), u.Pb.GetType(), u.Pb.GetDebitAccountId(), u.Pb.GetCreditAccountId())
+}
+
+// Delete AccountMapping
+func (u *AccountMapping) Delete(ctx context.Context, db *sql.DB) error {
+	stmt, err := db.PrepareContext(ctx, `DELETE FROM account_mappings WHERE company_id = $1 AND id = $2`)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare delete account mapping: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, ctx.Value(app.Ctx("companyID")).(string), u.Pb.GetId())
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec delete account mapping: %v", err)
+	}
+
+	return nil
+}
+
+// ListQuery builder, the mappings of a company are few and listed by type
+func (u *AccountMapping) ListQuery(ctx context.Context) (string, []interface{}) {
+	query := `
+		SELECT id, company_id, type, debit_account_id, credit_account_id, created_at, created_by, updated_at, updated_by
+		FROM account_mappings WHERE company_id = $1 ORDER BY type
+	`
+
+	return query, []interface{}{ctx.Value(app.Ctx("companyID")).(string)}
+}
@@ -0,0 +1,202 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// decision of an approval
+const (
+	ApprovalApproved string = "APPROVED"
+	ApprovalRejected string = "REJECTED"
+)
+
+type approvalDocument struct {
+	aggregate  string
+	table      string
+	dateColumn string
+	details    string
+	foreignKey string
+}
+
+// ApprovalDocuments the document types an approval rule can be set on
+var ApprovalDocuments = map[string]approvalDocument{
+	"GR": {"receive", "receives", "receive_date", "receive_details", "receive_id"},
+	"DO": {"delivery", "deliveries", "delivery_date", "delivery_details", "delivery_id"},
+	"RR": {"receive_return", "receive_returns", "return_date", "receive_return_details", "receive_return_id"},
+	"DR": {"delivery_return", "delivery_returns", "return_date", "delivery_return_details", "delivery_return_id"},
+}
+
+// Approval struct, a decision on a draft document. A decision holds for the version of the document it is made on,
+// the document changed afterward needs a new decision before it is posted.
+type Approval struct {
+	Pb                inventories.Approval
+	BranchID          string
+	DocumentDate      time.Time
+	DocumentStatus    string
+	DocumentQty       int32
+	DocumentUpdatedBy string
+	documentUpdatedAt time.Time
+}
+
+// GetDocument the document to decide on, the row is locked until the transaction ends so it is not changed or posted
+// in between
+func (u *Approval) GetDocument(ctx context.Context, tx *sql.Tx) error {
+	document, ok := ApprovalDocuments[u.Pb.GetDocumentType()]
+	if !ok {
+		return status.Errorf(codes.InvalidArgument, "invalid document type %s", u.Pb.GetDocumentType())
+	}
+
+	query := `
+		SELECT company_id, branch_id, code, ` + document.dateColumn + `, status, updated_at, updated_by,
+			(SELECT COALESCE(SUM(qty), 0) FROM ` + document.details + ` WHERE ` + document.foreignKey + ` = ` + document.table + `.id)
+		FROM ` + document.table + ` WHERE id = $1
+		FOR UPDATE
+	`
+
+	var companyID string
+	err := tx.QueryRowContext(ctx, query, u.Pb.GetDocumentId()).Scan(
+		&companyID, &u.BranchID, &u.Pb.DocumentCode, &u.DocumentDate, &u.DocumentStatus,
+		&u.documentUpdatedAt, &u.DocumentUpdatedBy, &u.DocumentQty,
+	)
+
+	if err == sql.ErrNoRows {
+		return status.Errorf(codes.NotFound, "Query Raw get approval document: %v", err)
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw get approval document: %v", err)
+	}
+
+	if companyID != ctx.Value(app.Ctx("companyID")).(string) {
+		return status.Error(codes.Unauthenticated, "its not your company data")
+	}
+
+	return nil
+}
+
+// Rule of the company applied to the document, nil when the document is posted without approval. GetDocument is
+// called first.
+func (u *Approval) Rule(ctx context.Context, tx *sql.Tx) (*ApprovalRule, error) {
+	rule := ApprovalRule{}
+	rule.Pb.DocumentType = u.Pb.GetDocumentType()
+
+	found, err := rule.getByType(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !found || u.DocumentQty <= rule.Pb.GetMinQty() {
+		return nil, nil
+	}
+
+	return &rule, nil
+}
+
+// Create Approval, the decision of the user login on the document loaded by GetDocument
+func (u *Approval) Create(ctx context.Context, tx *sql.Tx) error {
+	now := time.Now().UTC()
+	u.Pb.Id = uuid.New().String()
+	u.Pb.DecidedBy = ctx.Value(app.Ctx("userID")).(string)
+
+	query := `
+		INSERT INTO approvals (id, company_id, document_type, document_id, document_updated_at, decision, remark, decided_at, decided_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare insert approval: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx,
+		u.Pb.GetId(),
+		ctx.Value(app.Ctx("companyID")).(string),
+		u.Pb.GetDocumentType(),
+		u.Pb.GetDocumentId(),
+		u.documentUpdatedAt,
+		u.Pb.GetDecision(),
+		u.Pb.GetRemark(),
+		now,
+		u.Pb.GetDecidedBy(),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec insert approval: %v", err)
+	}
+
+	u.Pb.DecidedAt = now.String()
+
+	action := EventApproved
+	if u.Pb.GetDecision() == ApprovalRejected {
+		action = EventRejected
+	}
+
+	err = writeEvent(ctx, tx, ApprovalDocuments[u.Pb.GetDocumentType()].aggregate, action, u.Pb.GetDocumentId(), documentEvent{
+		ID:       u.Pb.GetDocumentId(),
+		Code:     u.Pb.GetDocumentCode(),
+		BranchID: u.BranchID,
+		Date:     u.DocumentDate.Format("2006-01-02T15:04:05.000Z"),
+		Status:   u.Pb.GetDecision(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CheckApproved the document can be posted: no rule applies to it or its current version is approved
+func (u *Approval) CheckApproved(ctx context.Context, tx *sql.Tx) error {
+	err := u.GetDocument(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	rule, err := u.Rule(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	if rule == nil {
+		return nil
+	}
+
+	var decision string
+	err = tx.QueryRowContext(ctx, `
+		SELECT decision FROM approvals
+		WHERE company_id = $1 AND document_id = $2 AND document_updated_at = $3
+		ORDER BY decided_at DESC LIMIT 1`,
+		ctx.Value(app.Ctx("companyID")).(string), u.Pb.GetDocumentId(), u.documentUpdatedAt,
+	).Scan(&decision)
+
+	if err == sql.ErrNoRows {
+		return status.Errorf(codes.FailedPrecondition, "%s %s needs approval before it is posted", ApprovalDocuments[u.Pb.GetDocumentType()].aggregate, u.Pb.GetDocumentCode())
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw get approval decision: %v", err)
+	}
+
+	if decision != ApprovalApproved {
+		return status.Errorf(codes.FailedPrecondition, "%s %s is rejected, change it to request a new approval", ApprovalDocuments[u.Pb.GetDocumentType()].aggregate, u.Pb.GetDocumentCode())
+	}
+
+	return nil
+}
+
+// ListQuery builder, the decisions of a document the latest first
+func (u *Approval) ListQuery(ctx context.Context) (string, []interface{}) {
+	query := `
+		SELECT id, document_type, document_id, decision, remark, decided_at, decided_by
+		FROM approvals WHERE company_id = $1 AND document_id = $2 ORDER BY decided_at DESC
+	`
+
+	return query, []interface{}{ctx.Value(app.Ctx("companyID")).(string), u.Pb.GetDocumentId()}
+}
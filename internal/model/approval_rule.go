@@ -0,0 +1,145 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// scope of the users who can approve, a wider scope excludes the users of a single branch or region
+const (
+	ApproverBranch  string = "BRANCH"
+	ApproverRegion  string = "REGION"
+	ApproverCompany string = "COMPANY"
+)
+
+// ApprovalRule struct, a document of the type needs approval before it is posted when its total qty is above min qty
+type ApprovalRule struct {
+	Pb inventories.ApprovalRule
+}
+
+// Get func
+func (u *ApprovalRule) Get(ctx context.Context, db *sql.DB) error {
+	query := `
+		SELECT id, company_id, document_type, min_qty, approver_scope, created_at, created_by, updated_at, updated_by
+		FROM approval_rules WHERE id = $1
+	`
+
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare statement Get approval rule: %v", err)
+	}
+	defer stmt.Close()
+
+	var companyID string
+	var createdAt, updatedAt time.Time
+	err = stmt.QueryRowContext(ctx, u.Pb.GetId()).Scan(
+		&u.Pb.Id, &companyID, &u.Pb.DocumentType, &u.Pb.MinQty, &u.Pb.ApproverScope,
+		&createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy,
+	)
+
+	if err == sql.ErrNoRows {
+		return status.Errorf(codes.NotFound, "Query Raw get approval rule: %v", err)
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw get approval rule: %v", err)
+	}
+
+	if companyID != ctx.Value(app.Ctx("companyID")).(string) {
+		return status.Error(codes.Unauthenticated, "its not your company data")
+	}
+
+	u.Pb.CreatedAt = createdAt.String()
+	u.Pb.UpdatedAt = updatedAt.String()
+
+	return nil
+}
+
+// getByType rule of the document type in the company, a type without rule is posted without approval
+func (u *ApprovalRule) getByType(ctx context.Context, tx *sql.Tx) (bool, error) {
+	err := tx.QueryRowContext(ctx, `
+		SELECT id, min_qty, approver_scope FROM approval_rules WHERE company_id = $1 AND document_type = $2`,
+		ctx.Value(app.Ctx("companyID")).(string), u.Pb.GetDocumentType(),
+	).Scan(&u.Pb.Id, &u.Pb.MinQty, &u.Pb.ApproverScope)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, status.Errorf(codes.Internal, "Query Raw get approval rule by type: %v", err)
+	}
+
+	return true, nil
+}
+
+// Upsert ApprovalRule, a company has a single rule per document type
+func (u *ApprovalRule) Upsert(ctx context.Context, tx *sql.Tx) error {
+	now := time.Now().UTC()
+	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+
+	query := `
+		INSERT INTO approval_rules (id, company_id, document_type, min_qty, approver_scope, created_at, created_by, updated_at, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $6, $7)
+		ON CONFLICT (company_id, document_type)
+		DO UPDATE SET min_qty = EXCLUDED.min_qty, approver_scope = EXCLUDED.approver_scope,
+			updated_at = EXCLUDED.updated_at, updated_by = EXCLUDED.updated_by
+		RETURNING id, created_at, created_by
+	`
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare upsert approval rule: %v", err)
+	}
+	defer stmt.Close()
+
+	var createdAt time.Time
+	err = stmt.QueryRowContext(ctx,
+		uuid.New().String(),
+		ctx.Value(app.Ctx("companyID")).(string),
+		u.Pb.GetDocumentType(),
+		u.Pb.GetMinQty(),
+		u.Pb.GetApproverScope(),
+		now,
+		u.Pb.GetUpdatedBy(),
+	).Scan(&u.Pb.Id, &createdAt, &u.Pb.CreatedBy)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec upsert approval rule: %v", err)
+	}
+
+	u.Pb.CreatedAt = createdAt.String()
+	u.Pb.UpdatedAt = now.String()
+
+	return nil
+}
+
+// Delete ApprovalRule
+func (u *ApprovalRule) Delete(ctx context.Context, db *sql.DB) error {
+	stmt, err := db.PrepareContext(ctx, `DELETE FROM approval_rules WHERE company_id = $1 AND id = $2`)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare delete approval rule: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, ctx.Value(app.Ctx("companyID")).(string), u.Pb.GetId())
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec delete approval rule: %v", err)
+	}
+
+	return nil
+}
+
+// ListQuery builder
+func (u *ApprovalRule) ListQuery(ctx context.Context) (string, []interface{}) {
+	query := `
+		SELECT id, company_id, document_type, min_qty, approver_scope, created_at, created_by, updated_at, updated_by
+		FROM approval_rules WHERE company_id = $1 ORDER BY document_type
+	`
+
+	return query, []interface{}{ctx.Value(app.Ctx("companyID")).(string)}
+}
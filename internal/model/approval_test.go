@@ -0,0 +1,115 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// draftReceiveReturn a draft receive return of one unit of the product, under a rule of min qty on receive returns
+func (u testProduct) draftReceiveReturn(t *testing.T, db *sql.DB, minQty int32) string {
+	t.Helper()
+
+	id := uuid.New().String()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO approval_rules (id, company_id, document_type, min_qty, approver_scope, created_by, updated_by)
+		VALUES ($1, $2, 'RR', $3, $4, $5, $5)`,
+		uuid.New().String(), u.companyID, minQty, ApproverBranch, u.userID)
+	if err == nil {
+		_, err = tx.Exec(`
+			INSERT INTO receive_returns (id, company_id, branch_id, branch_name, receive_id, code, return_date, remark, created_by, updated_by, status)
+			VALUES ($1, $2, $3, 'Test', $4, 'RR24000000001', $5, '', $6, $6, $7)`,
+			id, u.companyID, u.branchID, uuid.New().String(), time.Now().UTC(), u.userID, DocumentDraft)
+	}
+	if err == nil {
+		_, err = tx.Exec(`INSERT INTO receive_return_details (id, receive_return_id, product_id, shelve_id, qty) VALUES ($1, $2, $3, $4, 1)`,
+			uuid.New().String(), id, u.productID, u.shelveID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		t.Fatalf("seed receive return: %v", err)
+	}
+
+	return id
+}
+
+func checkApproved(ctx context.Context, db *sql.DB, documentID string) error {
+	return inTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		approval := Approval{Pb: inventories.Approval{DocumentType: "RR", DocumentId: documentID}}
+		return approval.CheckApproved(ctx, tx)
+	})
+}
+
+func TestCheckApprovedVersion(t *testing.T) {
+	db := openTestDB(t)
+	product := newTestProduct(t, db)
+	documentID := product.draftReceiveReturn(t, db, 0)
+
+	steps := []struct {
+		name     string
+		decision string
+		change   bool
+		code     codes.Code
+	}{
+		{"without decision", "", false, codes.FailedPrecondition},
+		{"approved", ApprovalApproved, false, codes.OK},
+		{"changed after the approval", "", true, codes.FailedPrecondition},
+		{"rejected", ApprovalRejected, false, codes.FailedPrecondition},
+		{"approved after the rejection", ApprovalApproved, false, codes.OK},
+	}
+
+	for _, step := range steps {
+		if step.change {
+			_, err := db.Exec(`UPDATE receive_returns SET updated_at = updated_at + INTERVAL '1 second' WHERE id = $1`, documentID)
+			if err != nil {
+				t.Fatalf("%s: change document: %v", step.name, err)
+			}
+		}
+
+		if len(step.decision) > 0 {
+			err := inTx(product.ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+				approval := Approval{Pb: inventories.Approval{DocumentType: "RR", DocumentId: documentID, Decision: step.decision}}
+				err := approval.GetDocument(ctx, tx)
+				if err != nil {
+					return err
+				}
+
+				return approval.Create(ctx, tx)
+			})
+			if err != nil {
+				t.Fatalf("%s: decide: %v", step.name, err)
+			}
+		}
+
+		err := checkApproved(product.ctx, db, documentID)
+		if status.Code(err) != step.code {
+			t.Errorf("%s: check approved = %v, want %v", step.name, err, step.code)
+		}
+	}
+}
+
+func TestCheckApprovedUpToMinQty(t *testing.T) {
+	db := openTestDB(t)
+	product := newTestProduct(t, db)
+	documentID := product.draftReceiveReturn(t, db, 1)
+
+	// a document up to the min qty of the rule is posted without approval
+	err := checkApproved(product.ctx, db, documentID)
+	if err != nil {
+		t.Errorf("check approved = %v, want no approval needed", err)
+	}
+}
@@ -0,0 +1,188 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type auditEntity struct {
+	table      string
+	details    string
+	foreignKey string
+}
+
+// AuditEntities the entities of the audit trail, the image of a document carries its details
+var AuditEntities = map[string]auditEntity{
+	"product":         {table: "products"},
+	"brand":           {table: "brands"},
+	"shelve":          {table: "shelves"},
+	"warehouse":       {table: "warehouses"},
+	"receive":         {"receives", "receive_details", "receive_id"},
+	"delivery":        {"deliveries", "delivery_details", "delivery_id"},
+	"receive_return":  {"receive_returns", "receive_return_details", "receive_return_id"},
+	"delivery_return": {"delivery_returns", "delivery_return_details", "delivery_return_id"},
+	"mutation":        {"shelve_mutations", "shelve_mutation_details", "shelve_mutation_id"},
+	"transfer":        {"transfers", "transfer_details", "transfer_id"},
+	"stock_opname":    {"stock_opnames", "stock_opname_shelves", "stock_opname_id"},
+}
+
+// Audit struct, an entry of the audit trail. The images are the json of the entity rows before and after the mutation,
+// a created entity has no before image and a deleted entity has no after image.
+type Audit struct {
+	Pb     inventories.Audit
+	before []byte
+}
+
+// image of the entity as json, nil when the entity does not exist
+func (u *Audit) image(ctx context.Context, tx *sql.Tx) ([]byte, error) {
+	entity, ok := AuditEntities[u.Pb.GetEntity()]
+	if !ok {
+		return nil, status.Errorf(codes.Internal, "unknown audit entity %s", u.Pb.GetEntity())
+	}
+
+	query := `SELECT to_jsonb(t) FROM ` + entity.table + ` t WHERE t.id = $1`
+	if len(entity.details) > 0 {
+		query = `
+			SELECT to_jsonb(t) || jsonb_build_object('details', COALESCE(
+				(SELECT jsonb_agg(to_jsonb(d) ORDER BY d.id) FROM ` + entity.details + ` d WHERE d.` + entity.foreignKey + ` = t.id),
+				'[]'::jsonb))
+			FROM ` + entity.table + ` t WHERE t.id = $1
+		`
+	}
+
+	var image []byte
+	err := tx.QueryRowContext(ctx, query, u.Pb.GetEntityId()).Scan(&image)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Query Raw audit image: %v", err)
+	}
+
+	return image, nil
+}
+
+// Begin the audit of a mutation in its transaction, taking the before image. An entity to create has no id yet.
+func (u *Audit) Begin(ctx context.Context, tx *sql.Tx) error {
+	if len(u.Pb.GetEntityId()) == 0 {
+		return nil
+	}
+
+	before, err := u.image(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	u.before = before
+	return nil
+}
+
+// Create Audit once the mutation is done, taking the after image. The entry is committed or rolled back with the
+// mutation.
+func (u *Audit) Create(ctx context.Context, tx *sql.Tx) error {
+	after, err := u.image(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	u.Pb.Id = uuid.New().String()
+	u.Pb.CompanyId = ctx.Value(app.Ctx("companyID")).(string)
+	u.Pb.CreatedBy = ctx.Value(app.Ctx("userID")).(string)
+	u.Pb.Method, _ = grpc.Method(ctx)
+	u.Pb.Before = string(u.before)
+	u.Pb.After = string(after)
+
+	var beforeImage, afterImage interface{}
+	if len(u.before) > 0 {
+		beforeImage = u.Pb.GetBefore()
+	}
+	if len(after) > 0 {
+		afterImage = u.Pb.GetAfter()
+	}
+
+	query := `
+		INSERT INTO audits (id, company_id, entity, entity_id, method, before_image, after_image, created_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare insert audit: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx,
+		u.Pb.GetId(),
+		u.Pb.GetCompanyId(),
+		u.Pb.GetEntity(),
+		u.Pb.GetEntityId(),
+		u.Pb.GetMethod(),
+		beforeImage,
+		afterImage,
+		now,
+		u.Pb.GetCreatedBy(),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec insert audit: %v", err)
+	}
+
+	u.Pb.CreatedAt = now.String()
+
+	return nil
+}
+
+// ListQuery builder, the entries of the period the latest first
+func (u *Audit) ListQuery(ctx context.Context, db *sql.DB, in *inventories.ListAuditRequest, startDate, endDate time.Time) (string, []interface{}, *inventories.AuditPaginationResponse, error) {
+	var paginationResponse inventories.AuditPaginationResponse
+	query := `SELECT id, company_id, entity, entity_id, method, COALESCE(before_image::text, ''), COALESCE(after_image::text, ''),
+			created_at, created_by
+		FROM audits`
+	where := []string{"company_id = $1", "created_at >= $2", "created_at <= $3"}
+	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string), startDate, endDate}
+
+	if len(in.GetEntity()) > 0 {
+		paramQueries = append(paramQueries, in.GetEntity())
+		where = append(where, fmt.Sprintf("entity = $%d", len(paramQueries)))
+	}
+
+	if len(in.GetEntityId()) > 0 {
+		paramQueries = append(paramQueries, in.GetEntityId())
+		where = append(where, fmt.Sprintf("entity_id = $%d", len(paramQueries)))
+	}
+
+	if len(in.GetUserId()) > 0 {
+		paramQueries = append(paramQueries, in.GetUserId())
+		where = append(where, fmt.Sprintf("created_by = $%d", len(paramQueries)))
+	}
+
+	{
+		qCount := `SELECT COUNT(*) FROM audits WHERE ` + strings.Join(where, " AND ")
+		var count int
+		err := db.QueryRowContext(ctx, qCount, paramQueries...).Scan(&count)
+		if err != nil && err != sql.ErrNoRows {
+			return query, paramQueries, &paginationResponse, status.Error(codes.Internal, err.Error())
+		}
+
+		paginationResponse.Count = uint32(count)
+	}
+
+	query += ` WHERE ` + strings.Join(where, " AND ") + ` ORDER BY created_at DESC`
+
+	if in.GetPagination().GetLimit() > 0 {
+		query += fmt.Sprintf(` LIMIT $%d OFFSET $%d`, (len(paramQueries) + 1), (len(paramQueries) + 2))
+		paramQueries = append(paramQueries, in.GetPagination().GetLimit(), in.GetPagination().GetOffset())
+	}
+
+	return query, paramQueries, &paginationResponse, nil
+}
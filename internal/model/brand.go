@@ -90,7 +90,7 @@ func (u *Brand) GetByCode(ctx context.Context, db *sql.DB) error {
 }
 
 // Create Brand
-func (u *Brand) Create(ctx context.Context, db *sql.DB) error {
+func (u *Brand) Create(ctx context.Context, tx *sql.Tx) error {
 	u.Pb.Id = uuid.New().String()
 	now := time.Now().UTC()
 	u.Pb.CreatedBy = ctx.Value(app.Ctx("userID")).(string)
@@ -100,7 +100,7 @@ func (u *Brand) Create(ctx context.Context, db *sql.DB) error {
 		INSERT INTO brands (id, company_id, code, name, created_at, created_by, updated_at, updated_by) 
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 	`
-	stmt, err := db.PrepareContext(ctx, query)
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare insert brand: %v", err)
 	}
@@ -127,7 +127,7 @@ func (u *Brand) Create(ctx context.Context, db *sql.DB) error {
 }
 
 // Update Brand
-func (u *Brand) Update(ctx context.Context, db *sql.DB) error {
+func (u *Brand) Update(ctx context.Context, tx *sql.Tx) error {
 	now := time.Now().UTC()
 	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
 
@@ -138,7 +138,7 @@ func (u *Brand) Update(ctx context.Context, db *sql.DB) error {
 		updated_by= $3
 		WHERE id = $4
 	`
-	stmt, err := db.PrepareContext(ctx, query)
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare update brand: %v", err)
 	}
@@ -160,8 +160,8 @@ func (u *Brand) Update(ctx context.Context, db *sql.DB) error {
 }
 
 // Delete Brand
-func (u *Brand) Delete(ctx context.Context, db *sql.DB) error {
-	stmt, err := db.PrepareContext(ctx, `DELETE FROM brands WHERE company_id = $1 AND id = $2`)
+func (u *Brand) Delete(ctx context.Context, tx *sql.Tx) error {
+	stmt, err := tx.PrepareContext(ctx, `DELETE FROM brands WHERE company_id = $1 AND id = $2`)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare delete brand: %v", err)
 	}
@@ -0,0 +1,182 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ClosingPeriod struct, a month of a company locked by closing stock
+type ClosingPeriod struct {
+	Year  int
+	Month int
+}
+
+// Create ClosingPeriod
+func (u *ClosingPeriod) Create(ctx context.Context, tx *sql.Tx) error {
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO closing_periods (company_id, year, month, closed_at, closed_by)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (company_id, year, month) DO NOTHING
+	`)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare insert closing period: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx,
+		ctx.Value(app.Ctx("companyID")).(string),
+		u.Year,
+		u.Month,
+		time.Now().UTC(),
+		ctx.Value(app.Ctx("userID")).(string),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec insert closing period: %v", err)
+	}
+
+	return nil
+}
+
+// IsNext check the period is the one to be closed, periods must be closed in order and can not be in the future
+func (u *ClosingPeriod) IsNext(ctx context.Context, tx *sql.Tx) error {
+	now := time.Now().UTC()
+	if u.Year*100+u.Month > now.Year()*100+int(now.Month()) {
+		return status.Error(codes.FailedPrecondition, fmt.Sprintf("period %d-%02d has not begun", u.Year, u.Month))
+	}
+
+	// the transactions still running finish before the period is checked and closed
+	err := lockClosing(ctx, tx, false)
+	if err != nil {
+		return err
+	}
+
+	var lastYear, lastMonth int
+	err = tx.QueryRowContext(ctx, `
+		SELECT year, month FROM closing_periods
+		WHERE company_id = $1
+		ORDER BY year DESC, month DESC LIMIT 1`,
+		ctx.Value(app.Ctx("companyID")).(string),
+	).Scan(&lastYear, &lastMonth)
+
+	if err == sql.ErrNoRows {
+		// the first closing must not leave earlier transactions out of the saldo
+		var hasEarlier bool
+		err = tx.QueryRowContext(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM inventories WHERE company_id = $1 AND transaction_date < $2
+			)`,
+			ctx.Value(app.Ctx("companyID")).(string),
+			time.Date(u.Year, time.Month(u.Month), 1, 0, 0, 0, 0, time.UTC),
+		).Scan(&hasEarlier)
+		if err != nil {
+			return status.Errorf(codes.Internal, "Query Raw check earlier transaction: %v", err)
+		}
+
+		if hasEarlier {
+			return status.Error(codes.FailedPrecondition, fmt.Sprintf("there are transactions before %d-%02d, please close the earlier period first", u.Year, u.Month))
+		}
+
+		return nil
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw get last closing period: %v", err)
+	}
+
+	if u.Year*100+u.Month <= lastYear*100+lastMonth {
+		return status.Error(codes.FailedPrecondition, fmt.Sprintf("period %d-%02d already closed", u.Year, u.Month))
+	}
+
+	next := time.Date(lastYear, time.Month(lastMonth)+1, 1, 0, 0, 0, 0, time.UTC)
+	if u.Year != next.Year() || u.Month != int(next.Month()) {
+		return status.Error(codes.FailedPrecondition, fmt.Sprintf("please close period %d-%02d first", next.Year(), int(next.Month())))
+	}
+
+	return nil
+}
+
+// Delete ClosingPeriod, unlock the period and every later period
+func (u *ClosingPeriod) Delete(ctx context.Context, tx *sql.Tx) error {
+	err := lockClosing(ctx, tx, false)
+	if err != nil {
+		return err
+	}
+
+	var isClosed bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM closing_periods WHERE company_id = $1 AND year = $2 AND month = $3
+		)`,
+		ctx.Value(app.Ctx("companyID")).(string), u.Year, u.Month,
+	).Scan(&isClosed)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw check closing period: %v", err)
+	}
+
+	if !isClosed {
+		return status.Error(codes.FailedPrecondition, fmt.Sprintf("period %d-%02d is not closed", u.Year, u.Month))
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `DELETE FROM closing_periods WHERE company_id = $1 AND (year * 100 + month) >= $2`)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare delete closing period: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, ctx.Value(app.Ctx("companyID")).(string), u.Year*100+u.Month)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec delete closing period: %v", err)
+	}
+
+	return nil
+}
+
+// lockClosing serialize the closing of the company with its transactions. A transaction takes the lock shared so
+// transactions do not wait for each other, a closing or reopening takes it exclusive.
+func lockClosing(ctx context.Context, tx *sql.Tx, shared bool) error {
+	lock := `SELECT pg_advisory_xact_lock(hashtext($1))`
+	if shared {
+		lock = `SELECT pg_advisory_xact_lock_shared(hashtext($1))`
+	}
+
+	_, err := tx.ExecContext(ctx, lock, "closing"+ctx.Value(app.Ctx("companyID")).(string))
+	if err != nil {
+		return status.Errorf(codes.Internal, "lock closing period: %v", err)
+	}
+
+	return nil
+}
+
+// IsOpen check the period of the date, it is closed when the month or any later month has been closed. The period can
+// not be closed until the transaction ends.
+func (u *ClosingPeriod) IsOpen(ctx context.Context, tx *sql.Tx, date time.Time) error {
+	err := lockClosing(ctx, tx, true)
+	if err != nil {
+		return err
+	}
+
+	var closed bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM closing_periods
+			WHERE company_id = $1 AND (year * 100 + month) >= $2
+		)`,
+		ctx.Value(app.Ctx("companyID")).(string),
+		date.Year()*100+int(date.Month()),
+	).Scan(&closed)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw check closing period: %v", err)
+	}
+
+	if closed {
+		return status.Error(codes.FailedPrecondition, fmt.Sprintf("period %d-%02d already closed", date.Year(), int(date.Month())))
+	}
+
+	return nil
+}
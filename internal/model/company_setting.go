@@ -0,0 +1,87 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CompanySetting struct
+type CompanySetting struct {
+	Pb inventories.CompanySetting
+}
+
+// Get func, a company without setting gets the default setting
+func (u *CompanySetting) Get(ctx context.Context, db *sql.DB) error {
+	query := `
+		SELECT company_id, receive_tolerance_percent, costing_method, created_at, created_by, updated_at, updated_by
+		FROM company_settings WHERE company_id = $1
+	`
+
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare statement Get company setting: %v", err)
+	}
+	defer stmt.Close()
+
+	var createdAt, updatedAt time.Time
+	err = stmt.QueryRowContext(ctx, ctx.Value(app.Ctx("companyID")).(string)).Scan(
+		&u.Pb.CompanyId, &u.Pb.ReceiveTolerancePercent, &u.Pb.CostingMethod, &createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy,
+	)
+
+	if err == sql.ErrNoRows {
+		u.Pb = inventories.CompanySetting{CompanyId: ctx.Value(app.Ctx("companyID")).(string), CostingMethod: CostingFIFO}
+		return nil
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw get company setting: %v", err)
+	}
+
+	u.Pb.CreatedAt = createdAt.String()
+	u.Pb.UpdatedAt = updatedAt.String()
+
+	return nil
+}
+
+// Upsert CompanySetting
+func (u *CompanySetting) Upsert(ctx context.Context, tx *sql.Tx) error {
+	now := time.Now().UTC()
+	u.Pb.CompanyId = ctx.Value(app.Ctx("companyID")).(string)
+	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+
+	query := `
+		INSERT INTO company_settings (company_id, receive_tolerance_percent, costing_method, created_at, created_by, updated_at, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $4, $5)
+		ON CONFLICT (company_id)
+		DO UPDATE SET receive_tolerance_percent = EXCLUDED.receive_tolerance_percent, costing_method = EXCLUDED.costing_method, updated_at = EXCLUDED.updated_at, updated_by = EXCLUDED.updated_by
+		RETURNING created_at, created_by
+	`
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare upsert company setting: %v", err)
+	}
+	defer stmt.Close()
+
+	var createdAt time.Time
+	err = stmt.QueryRowContext(ctx,
+		u.Pb.GetCompanyId(),
+		u.Pb.GetReceiveTolerancePercent(),
+		u.Pb.GetCostingMethod(),
+		now,
+		u.Pb.GetUpdatedBy(),
+	).Scan(&createdAt, &u.Pb.CreatedBy)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec upsert company setting: %v", err)
+	}
+
+	u.Pb.CreatedAt = createdAt.String()
+	u.Pb.UpdatedAt = now.String()
+
+	return nil
+}
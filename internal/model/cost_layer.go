@@ -0,0 +1,404 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// costing method of a company, moving average keeps a single layer per product in a branch
+const (
+	CostingFIFO    string = "FIFO"
+	CostingAverage string = "AVG"
+)
+
+// costingMethod of the company, a company without setting is costed FIFO
+func costingMethod(ctx context.Context, tx *sql.Tx, companyID string) (string, error) {
+	var method string
+	err := tx.QueryRowContext(ctx, `SELECT costing_method FROM company_settings WHERE company_id = $1`, companyID).Scan(&method)
+	if err == sql.ErrNoRows {
+		return CostingFIFO, nil
+	}
+
+	if err != nil {
+		return method, status.Errorf(codes.Internal, "Query Raw get costing method: %v", err)
+	}
+
+	return method, nil
+}
+
+// applyCost cost the inventory movement against the cost layers of its product in the branch, a negative sign
+// reverts the movement. An in movement settles the pending layers first and adds a layer of the rest at its unit cost,
+// an out movement consumes the layers and keeps the consumed cost on the movement.
+func applyCost(ctx context.Context, tx *sql.Tx, inventory *Inventory, sign int32) error {
+	// a mutation moves the stock inside the branch, the cost stays in its layers
+	if inventory.Type == "MU" {
+		return nil
+	}
+
+	method, err := costingMethod(ctx, tx, inventory.CompanyID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, "cost"+inventory.CompanyID+inventory.BranchID+inventory.ProductID)
+	if err != nil {
+		return status.Errorf(codes.Internal, "lock cost layers: %v", err)
+	}
+
+	switch {
+	case sign > 0 && inventory.IsIn:
+		unitCost := inventory.UnitCost
+		// only a receive carries its own cost, other in movements without cost come in at the average cost
+		if unitCost == 0 && inventory.Type != "GR" {
+			unitCost, err = averageCost(ctx, tx, inventory)
+			if err != nil {
+				return err
+			}
+		}
+
+		inventory.Cost = unitCost * float64(inventory.Qty)
+		var settled int32
+		settled, err = settlePendingCostLayers(ctx, tx, inventory, unitCost)
+		if err != nil {
+			return err
+		}
+
+		if inventory.Qty > settled {
+			err = addCostLayer(ctx, tx, inventory, inventory.Qty-settled, unitCost)
+		}
+
+	case sign > 0:
+		inventory.Cost, err = consumeCostLayers(ctx, tx, inventory, method)
+
+	case inventory.IsIn:
+		err = removeCostLayer(ctx, tx, inventory, method)
+
+	default:
+		err = restoreCostLayers(ctx, tx, inventory)
+	}
+	if err != nil {
+		return err
+	}
+
+	if method == CostingAverage {
+		err = mergeCostLayers(ctx, tx, inventory)
+		if err != nil {
+			return err
+		}
+	}
+
+	if sign < 0 {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE inventories SET cost = $1 WHERE id = $2`, inventory.Cost, inventory.ID)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec update inventory cost: %v", err)
+	}
+
+	return nil
+}
+
+// averageCost of the remaining layers of the product in the branch
+func averageCost(ctx context.Context, tx *sql.Tx, inventory *Inventory) (float64, error) {
+	var unitCost float64
+	err := tx.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(qty * unit_cost) / NULLIF(SUM(qty), 0), 0) FROM cost_layers
+		WHERE company_id = $1 AND branch_id = $2 AND product_id = $3 AND qty > 0`,
+		inventory.CompanyID, inventory.BranchID, inventory.ProductID,
+	).Scan(&unitCost)
+	if err != nil {
+		return unitCost, status.Errorf(codes.Internal, "Query Raw average cost: %v", err)
+	}
+
+	return unitCost, nil
+}
+
+// addCostLayer of the qty of the movement, a negative qty is a pending layer of an out movement not covered by the layers
+func addCostLayer(ctx context.Context, tx *sql.Tx, inventory *Inventory, qty int32, unitCost float64) error {
+	now := time.Now().UTC()
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO cost_layers (id, company_id, branch_id, product_id, inventory_id, layer_date, qty, unit_cost, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9)`,
+		uuid.New().String(), inventory.CompanyID, inventory.BranchID, inventory.ProductID, inventory.ID,
+		inventory.TransactionDate, qty, unitCost, now,
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec insert cost layer: %v", err)
+	}
+
+	return nil
+}
+
+// consumeCostLayers take the qty from the layers, the oldest layer first. Qty not covered by any layer, a stock older
+// than the costing, is taken at the cost of the last layer, or at zero without layer, and is kept as a pending layer.
+// The pending layer is settled by the next in movement, which corrects the cost of the out movement.
+func consumeCostLayers(ctx context.Context, tx *sql.Tx, inventory *Inventory, method string) (float64, error) {
+	if method == CostingAverage {
+		err := mergeCostLayers(ctx, tx, inventory)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, qty, unit_cost FROM cost_layers
+		WHERE company_id = $1 AND branch_id = $2 AND product_id = $3 AND qty > 0
+		ORDER BY layer_date, created_at`,
+		inventory.CompanyID, inventory.BranchID, inventory.ProductID,
+	)
+	if err != nil {
+		return 0, status.Errorf(codes.Internal, "Query Raw cost layers: %v", err)
+	}
+
+	type layer struct {
+		id       string
+		qty      int32
+		unitCost float64
+	}
+	var layers []layer
+	for rows.Next() {
+		var l layer
+		err = rows.Scan(&l.id, &l.qty, &l.unitCost)
+		if err != nil {
+			rows.Close()
+			return 0, status.Errorf(codes.Internal, "scan cost layers: %v", err)
+		}
+		layers = append(layers, l)
+	}
+
+	if rows.Err() != nil {
+		rows.Close()
+		return 0, status.Errorf(codes.Internal, "rows cost layers: %v", rows.Err())
+	}
+	rows.Close()
+
+	var cost, lastUnitCost float64
+	remaining := inventory.Qty
+	for _, l := range layers {
+		if remaining == 0 {
+			break
+		}
+
+		take := l.qty
+		if take > remaining {
+			take = remaining
+		}
+
+		cost += float64(take) * l.unitCost
+		lastUnitCost = l.unitCost
+		remaining -= take
+
+		if take == l.qty {
+			_, err = tx.ExecContext(ctx, `DELETE FROM cost_layers WHERE id = $1`, l.id)
+		} else {
+			_, err = tx.ExecContext(ctx, `UPDATE cost_layers SET qty = qty - $1, updated_at = $2 WHERE id = $3`, take, time.Now().UTC(), l.id)
+		}
+		if err != nil {
+			return 0, status.Errorf(codes.Internal, "Exec consume cost layer: %v", err)
+		}
+	}
+
+	if remaining > 0 {
+		cost += float64(remaining) * lastUnitCost
+		err = addCostLayer(ctx, tx, inventory, -remaining, lastUnitCost)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return cost, nil
+}
+
+// settlePendingCostLayers cover the pending layers of the product in the branch with the in movement, the oldest
+// first. The out movement of a settled layer is corrected to the unit cost of the in movement and its transaction
+// journals the correction. The settled qty is returned.
+func settlePendingCostLayers(ctx context.Context, tx *sql.Tx, inventory *Inventory, unitCost float64) (int32, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT cost_layers.id, -cost_layers.qty, cost_layers.unit_cost, cost_layers.inventory_id, inventories.transaction_id
+		FROM cost_layers
+		JOIN inventories ON cost_layers.inventory_id = inventories.id
+		WHERE cost_layers.company_id = $1 AND cost_layers.branch_id = $2 AND cost_layers.product_id = $3 AND cost_layers.qty < 0
+		ORDER BY cost_layers.layer_date, cost_layers.created_at`,
+		inventory.CompanyID, inventory.BranchID, inventory.ProductID,
+	)
+	if err != nil {
+		return 0, status.Errorf(codes.Internal, "Query Raw pending cost layers: %v", err)
+	}
+
+	type pending struct {
+		id            string
+		qty           int32
+		unitCost      float64
+		inventoryID   string
+		transactionID string
+	}
+	var layers []pending
+	for rows.Next() {
+		var l pending
+		err = rows.Scan(&l.id, &l.qty, &l.unitCost, &l.inventoryID, &l.transactionID)
+		if err != nil {
+			rows.Close()
+			return 0, status.Errorf(codes.Internal, "scan pending cost layers: %v", err)
+		}
+		layers = append(layers, l)
+	}
+
+	if rows.Err() != nil {
+		rows.Close()
+		return 0, status.Errorf(codes.Internal, "rows pending cost layers: %v", rows.Err())
+	}
+	rows.Close()
+
+	var settled int32
+	for _, l := range layers {
+		if settled == inventory.Qty {
+			break
+		}
+
+		take := l.qty
+		if take > inventory.Qty-settled {
+			take = inventory.Qty - settled
+		}
+		settled += take
+
+		if take == l.qty {
+			_, err = tx.ExecContext(ctx, `DELETE FROM cost_layers WHERE id = $1`, l.id)
+		} else {
+			_, err = tx.ExecContext(ctx, `UPDATE cost_layers SET qty = qty + $1, updated_at = $2 WHERE id = $3`, take, time.Now().UTC(), l.id)
+		}
+		if err != nil {
+			return 0, status.Errorf(codes.Internal, "Exec settle cost layer: %v", err)
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE inventories SET cost = cost + $1 WHERE id = $2`,
+			float64(take)*(unitCost-l.unitCost), l.inventoryID)
+		if err != nil {
+			return 0, status.Errorf(codes.Internal, "Exec settle inventory cost: %v", err)
+		}
+
+		journal := Journal{TransactionID: l.transactionID}
+		err = journal.Post(ctx, tx)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return settled, nil
+}
+
+// restoreCostLayers revert an out movement, the qty still pending is dropped with its pending layer and
+// the consumed cost of the rest goes back to the layers
+func restoreCostLayers(ctx context.Context, tx *sql.Tx, inventory *Inventory) error {
+	var pendingQty int32
+	var pendingCost float64
+	err := tx.QueryRowContext(ctx, `
+		WITH dropped AS (
+			DELETE FROM cost_layers WHERE inventory_id = $1 AND qty < 0
+			RETURNING qty, unit_cost
+		)
+		SELECT COALESCE(-SUM(qty), 0), COALESCE(-SUM(qty * unit_cost), 0) FROM dropped`,
+		inventory.ID,
+	).Scan(&pendingQty, &pendingCost)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec drop pending cost layer: %v", err)
+	}
+
+	qty := inventory.Qty - pendingQty
+	if qty <= 0 {
+		return nil
+	}
+
+	return addCostLayer(ctx, tx, inventory, qty, (inventory.Cost-pendingCost)/float64(qty))
+}
+
+// removeCostLayer revert an in movement. FIFO takes back the layer of the movement, which must not be consumed yet.
+// Moving average takes the qty and its cost out of the average.
+func removeCostLayer(ctx context.Context, tx *sql.Tx, inventory *Inventory, method string) error {
+	if method == CostingAverage {
+		err := mergeCostLayers(ctx, tx, inventory)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE cost_layers SET
+				unit_cost = case when qty > $1 then (qty * unit_cost - $2) / (qty - $1) else unit_cost end,
+				qty = qty - $1,
+				updated_at = $3
+			WHERE company_id = $4 AND branch_id = $5 AND product_id = $6 AND qty > 0`,
+			inventory.Qty, inventory.Cost, time.Now().UTC(), inventory.CompanyID, inventory.BranchID, inventory.ProductID,
+		)
+		if err != nil {
+			return status.Errorf(codes.Internal, "Exec remove average cost: %v", err)
+		}
+
+		return nil
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE cost_layers SET qty = qty - $1, updated_at = $2
+		WHERE inventory_id = $3 AND qty >= $1`,
+		inventory.Qty, time.Now().UTC(), inventory.ID,
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec remove cost layer: %v", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return status.Errorf(codes.Internal, "rows affected remove cost layer: %v", err)
+	}
+
+	if affected == 0 {
+		return status.Error(codes.FailedPrecondition, "the cost of the movement is already consumed")
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM cost_layers WHERE inventory_id = $1 AND qty = 0`, inventory.ID)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec delete cost layer: %v", err)
+	}
+
+	return nil
+}
+
+// mergeCostLayers fold the layers of the product in the branch into a single layer at their average cost,
+// the pending layers stay until they are settled
+func mergeCostLayers(ctx context.Context, tx *sql.Tx, inventory *Inventory) error {
+	_, err := tx.ExecContext(ctx, `
+		WITH merged AS (
+			DELETE FROM cost_layers WHERE company_id = $1 AND branch_id = $2 AND product_id = $3 AND qty > 0
+			RETURNING layer_date, qty, unit_cost
+		)
+		INSERT INTO cost_layers (id, company_id, branch_id, product_id, layer_date, qty, unit_cost, created_at, updated_at)
+		SELECT $4, $1, $2, $3, MIN(layer_date), SUM(qty), SUM(qty * unit_cost) / SUM(qty), $5, $5
+		FROM merged
+		HAVING SUM(qty) > 0`,
+		inventory.CompanyID, inventory.BranchID, inventory.ProductID, uuid.New().String(), time.Now().UTC(),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec merge cost layers: %v", err)
+	}
+
+	return nil
+}
+
+// deliveredUnitCost the unit cost the delivery consumed for the product, a serial unit takes the cost of its own barcode
+func deliveredUnitCost(ctx context.Context, tx *sql.Tx, deliveryID string, productID string, barcode string) (float64, error) {
+	var unitCost float64
+	err := tx.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(cost) / NULLIF(SUM(qty), 0), 0) FROM inventories
+		WHERE transaction_id = $1 AND type = 'DO' AND in_out = false AND product_id = $2 AND ($3 = '' OR barcode = $3)`,
+		deliveryID, productID, barcode,
+	).Scan(&unitCost)
+	if err != nil {
+		return unitCost, status.Errorf(codes.Internal, "Query Raw delivered unit cost: %v", err)
+	}
+
+	return unitCost, nil
+}
@@ -22,9 +22,25 @@ type Delivery struct {
 
 // Get func
 func (u *Delivery) Get(ctx context.Context, db *sql.DB) error {
+	return u.get(ctx, db)
+}
+
+// GetForUpdate the delivery read again in the transaction with its details, the row is locked until the transaction ends
+func (u *Delivery) GetForUpdate(ctx context.Context, tx *sql.Tx) error {
+	err := lockDocument(ctx, tx, "deliveries", u.Pb.GetId())
+	if err != nil {
+		return err
+	}
+
+	u.Pb.Details = nil
+	return u.get(ctx, tx)
+}
+
+// get the delivery with its details
+func (u *Delivery) get(ctx context.Context, db preparer) error {
 	query := `
 		SELECT deliveries.id, deliveries.company_id, deliveries.branch_id, deliveries.branch_name, deliveries.sales_order_id, deliveries.code, 
-		deliveries.delivery_date, deliveries.remark, deliveries.created_at, deliveries.created_by, deliveries.updated_at, deliveries.updated_by,
+		deliveries.delivery_date, deliveries.remark, deliveries.status, deliveries.created_at, deliveries.created_by, deliveries.updated_at, deliveries.updated_by,
 		json_agg(DISTINCT jsonb_build_object(
 			'id', delivery_details.id,
 			'delivery_id', delivery_details.delivery_id,
@@ -33,13 +49,20 @@ func (u *Delivery) Get(ctx context.Context, db *sql.DB) error {
 			'product_code', products.code,
 			'shelve_id', delivery_details.shelve_id,
 			'shelve_code', shelves.code,
-			'barcode', delivery_details.barcode
+			'barcode', delivery_details.barcode,
+			'qty', delivery_details.qty,
+			'cost', delivery_details.cost,
+			'lot_id', delivery_details.lot_id,
+			'lot_code', lots.code,
+			'lot_expired_date', lots.expired_date
 		)) as details
 		FROM deliveries 
 		JOIN delivery_details ON deliveries.id = delivery_details.delivery_id
 		JOIN products ON delivery_details.product_id = products.id
 		JOIN shelves ON delivery_details.shelve_id = shelves.id
+		LEFT JOIN lots ON delivery_details.lot_id = lots.id
 		WHERE deliveries.id = $1
+		GROUP BY deliveries.id
 	`
 
 	stmt, err := db.PrepareContext(ctx, query)
@@ -52,7 +75,7 @@ func (u *Delivery) Get(ctx context.Context, db *sql.DB) error {
 	var companyID, details string
 	err = stmt.QueryRowContext(ctx, u.Pb.GetId()).Scan(
 		&u.Pb.Id, &companyID, &u.Pb.BranchId, &u.Pb.BranchName, &u.Pb.SalesOrderId, &u.Pb.Code, &dateDelivery, &u.Pb.Remark,
-		&createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy, &details,
+		&u.Pb.Status, &createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy, &details,
 	)
 
 	if err == sql.ErrNoRows {
@@ -72,14 +95,19 @@ func (u *Delivery) Get(ctx context.Context, db *sql.DB) error {
 	u.Pb.UpdatedAt = updatedAt.String()
 
 	detailDeliverys := []struct {
-		ID          string
-		DeliveryID  string
-		ProductID   string
-		ProductName string
-		ProductCode string
-		ShelveID    string
-		ShelveCode  string
-		Barcode     string
+		ID             string
+		DeliveryID     string
+		ProductID      string
+		ProductName    string
+		ProductCode    string
+		ShelveID       string
+		ShelveCode     string
+		Qty            int32   `json:"qty"`
+		Cost           float64 `json:"cost"`
+		LotID          string  `json:"lot_id"`
+		LotCode        string  `json:"lot_code"`
+		LotExpiredDate string  `json:"lot_expired_date"`
+		Barcode        string
 	}{}
 	err = json.Unmarshal([]byte(details), &detailDeliverys)
 	if err != nil {
@@ -87,7 +115,7 @@ func (u *Delivery) Get(ctx context.Context, db *sql.DB) error {
 	}
 
 	for _, detail := range detailDeliverys {
-		u.Pb.Details = append(u.Pb.Details, &inventories.DeliveryDetail{
+		pbDetail := &inventories.DeliveryDetail{
 			Barcode: detail.Barcode,
 			Id:      detail.ID,
 			Product: &inventories.Product{
@@ -100,7 +128,17 @@ func (u *Delivery) Get(ctx context.Context, db *sql.DB) error {
 				Id:   detail.ShelveID,
 				Code: detail.ShelveCode,
 			},
-		})
+			Qty:  detail.Qty,
+			Cost: detail.Cost,
+		}
+		if len(detail.LotID) > 0 {
+			pbDetail.Lot = &inventories.Lot{
+				Id:          detail.LotID,
+				Code:        detail.LotCode,
+				ExpiredDate: detail.LotExpiredDate,
+			}
+		}
+		u.Pb.Details = append(u.Pb.Details, pbDetail)
 	}
 
 	return nil
@@ -156,9 +194,10 @@ func (u *Delivery) getCode(ctx context.Context, tx *sql.Tx) (string, error) {
 		(count + 1)), nil
 }
 
-// Create Delivery
+// Create Delivery as a draft, the stock leaves when it is posted
 func (u *Delivery) Create(ctx context.Context, tx *sql.Tx) error {
 	u.Pb.Id = uuid.New().String()
+	u.Pb.Status = DocumentDraft
 	now := time.Now().UTC()
 	u.Pb.CreatedBy = ctx.Value(app.Ctx("userID")).(string)
 	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
@@ -173,8 +212,8 @@ func (u *Delivery) Create(ctx context.Context, tx *sql.Tx) error {
 	}
 
 	query := `
-		INSERT INTO deliveries (id, company_id, branch_id, branch_name, sales_order_id, code, delivery_date, remark, created_at, created_by, updated_at, updated_by) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		INSERT INTO deliveries (id, company_id, branch_id, branch_name, sales_order_id, code, delivery_date, remark, status, created_at, created_by, updated_at, updated_by) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 	`
 	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
@@ -191,6 +230,7 @@ func (u *Delivery) Create(ctx context.Context, tx *sql.Tx) error {
 		u.Pb.GetCode(),
 		dateDelivery,
 		u.Pb.GetRemark(),
+		u.Pb.GetStatus(),
 		now,
 		u.Pb.GetCreatedBy(),
 		now,
@@ -203,6 +243,11 @@ func (u *Delivery) Create(ctx context.Context, tx *sql.Tx) error {
 	u.Pb.CreatedAt = now.String()
 	u.Pb.UpdatedAt = u.Pb.CreatedAt
 
+	err = writeDocumentEvent(ctx, tx, "delivery", EventCreated, u.Pb, u.Pb.GetDeliveryDate())
+	if err != nil {
+		return err
+	}
+
 	for _, detail := range u.Pb.GetDetails() {
 		deliveryDetailModel := DeliveryDetail{}
 		deliveryDetailModel.Pb = inventories.DeliveryDetail{
@@ -210,6 +255,8 @@ func (u *Delivery) Create(ctx context.Context, tx *sql.Tx) error {
 			Barcode:    detail.GetBarcode(),
 			Product:    detail.GetProduct(),
 			Shelve:     detail.GetShelve(),
+			Qty:        detail.GetQty(),
+			Lot:        detail.GetLot(),
 		}
 		deliveryDetailModel.PbDelivery = inventories.Delivery{
 			Id:           u.Pb.Id,
@@ -249,7 +296,7 @@ func (u *Delivery) Update(ctx context.Context, tx *sql.Tx) error {
 		remark = $3, 
 		updated_at = $4, 
 		updated_by= $5
-		WHERE id = $6
+		WHERE id = $6 AND status = $7
 	`
 	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
@@ -257,43 +304,164 @@ func (u *Delivery) Update(ctx context.Context, tx *sql.Tx) error {
 	}
 	defer stmt.Close()
 
-	_, err = stmt.ExecContext(ctx,
+	res, err := stmt.ExecContext(ctx,
 		u.Pb.GetSalesOrderId(),
 		dateDelivery,
 		u.Pb.GetRemark(),
 		now,
 		u.Pb.GetUpdatedBy(),
 		u.Pb.GetId(),
+		DocumentDraft,
 	)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Exec update delivery: %v", err)
 	}
 
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return status.Errorf(codes.Internal, "rows affected update delivery: %v", err)
+	}
+
+	if affected == 0 {
+		return status.Error(codes.FailedPrecondition, "only a draft delivery can be updated")
+	}
+
 	u.Pb.UpdatedAt = now.String()
 
+	err = writeDocumentEvent(ctx, tx, "delivery", EventUpdated, u.Pb, u.Pb.GetDeliveryDate())
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
-// Delete Delivery
-func (u *Delivery) Delete(ctx context.Context, db *sql.DB) error {
-	stmt, err := db.PrepareContext(ctx, `DELETE FROM deliveries WHERE id = $1`)
+// Post Delivery, the details leave the stock
+func (u *Delivery) Post(ctx context.Context, tx *sql.Tx) error {
+	now := time.Now().UTC()
+	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+
+	var dateDelivery time.Time
+	err := tx.QueryRowContext(ctx, `
+		UPDATE deliveries SET
+		status = $1,
+		updated_at = $2,
+		updated_by = $3
+		WHERE id = $4 AND company_id = $5 AND status = $6
+		RETURNING delivery_date`,
+		DocumentPosted, now, u.Pb.GetUpdatedBy(), u.Pb.GetId(), ctx.Value(app.Ctx("companyID")).(string), DocumentDraft,
+	).Scan(&dateDelivery)
+
+	if err == sql.ErrNoRows {
+		return status.Error(codes.FailedPrecondition, "only a draft delivery can be posted")
+	}
+
 	if err != nil {
-		return status.Errorf(codes.Internal, "Prepare delete delivery: %v", err)
+		return status.Errorf(codes.Internal, "Exec post delivery: %v", err)
 	}
-	defer stmt.Close()
 
-	_, err = stmt.ExecContext(ctx, u.Pb.GetId())
+	u.Pb.Status = DocumentPosted
+	u.Pb.DeliveryDate = dateDelivery.Format("2006-01-02T15:04:05.000Z")
+	u.Pb.UpdatedAt = now.String()
+
+	err = writeDocumentEvent(ctx, tx, "delivery", EventPosted, u.Pb, u.Pb.GetDeliveryDate())
 	if err != nil {
-		return status.Errorf(codes.Internal, "Exec delete delivery: %v", err)
+		return err
+	}
+
+	for _, detail := range u.Pb.GetDetails() {
+		deliveryDetailModel := DeliveryDetail{}
+		deliveryDetailModel.Pb = inventories.DeliveryDetail{
+			Id:         detail.GetId(),
+			DeliveryId: u.Pb.GetId(),
+			Barcode:    detail.GetBarcode(),
+			Product:    detail.GetProduct(),
+			Shelve:     detail.GetShelve(),
+			Qty:        detail.GetQty(),
+			Lot:        detail.GetLot(),
+		}
+		deliveryDetailModel.PbDelivery = inventories.Delivery{
+			Id:           u.Pb.Id,
+			BranchId:     u.Pb.BranchId,
+			BranchName:   u.Pb.BranchName,
+			SalesOrderId: u.Pb.SalesOrderId,
+			Code:         u.Pb.Code,
+			DeliveryDate: u.Pb.DeliveryDate,
+			Remark:       u.Pb.Remark,
+			Status:       u.Pb.Status,
+		}
+		err = deliveryDetailModel.Post(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		detail.Cost = deliveryDetailModel.Pb.GetCost()
 	}
 
 	return nil
 }
 
+// Cancel Delivery, a posted delivery is brought back into the stock by reversing its inventories at the cancel time
+func (u *Delivery) Cancel(ctx context.Context, tx *sql.Tx) error {
+	now := time.Now().UTC()
+	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+
+	var returns int
+	err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM delivery_returns WHERE company_id = $1 AND delivery_id = $2 AND status <> $3`,
+		ctx.Value(app.Ctx("companyID")).(string), u.Pb.GetId(), DocumentCancelled,
+	).Scan(&returns)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw delivery returns: %v", err)
+	}
+
+	if returns > 0 {
+		return status.Error(codes.FailedPrecondition, "delivery has returns, cancel the returns first")
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE deliveries SET
+		status = $1,
+		updated_at = $2,
+		updated_by = $3
+		WHERE id = $4 AND company_id = $5 AND status = $6`,
+		DocumentCancelled, now, u.Pb.GetUpdatedBy(), u.Pb.GetId(), ctx.Value(app.Ctx("companyID")).(string), u.Pb.GetStatus(),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec cancel delivery: %v", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return status.Errorf(codes.Internal, "rows affected cancel delivery: %v", err)
+	}
+
+	if affected == 0 {
+		return status.Error(codes.FailedPrecondition, "delivery status has changed")
+	}
+
+	if u.Pb.GetStatus() == DocumentPosted {
+		err = reverseTransaction(ctx, tx, u.Pb.GetId(), now)
+		if err != nil {
+			return err
+		}
+	}
+
+	u.Pb.Status = DocumentCancelled
+	u.Pb.UpdatedAt = now.String()
+
+	return writeDocumentEvent(ctx, tx, "delivery", EventCancelled, u.Pb, u.Pb.GetDeliveryDate())
+}
+
+// CheckOutstanding check the products of the delivery against the qty ordered on its sales order, it is called
+// after the details are written so the delivery is counted with every other delivery of the sales order.
+func (u *Delivery) CheckOutstanding(ctx context.Context, tx *sql.Tx, ordered map[string]int32) error {
+	return deliveryOrder.checkOutstanding(ctx, tx, u.Pb.GetSalesOrderId(), u.Pb.GetId(), ordered, 0)
+}
+
 // ListQuery builder
 func (u *Delivery) ListQuery(ctx context.Context, db *sql.DB, in *inventories.ListDeliveryRequest) (string, []interface{}, *inventories.DeliveryPaginationResponse, error) {
 	var paginationResponse inventories.DeliveryPaginationResponse
-	query := `SELECT id, company_id, branch_id, branch_name, sales_order_id, code, delivery_date, remark, created_at, created_by, updated_at, updated_by FROM deliveries`
+	query := `SELECT id, company_id, branch_id, branch_name, sales_order_id, code, delivery_date, remark, status, created_at, created_by, updated_at, updated_by FROM deliveries`
 
 	where := []string{"company_id = $1"}
 	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string)}
@@ -308,6 +476,11 @@ func (u *Delivery) ListQuery(ctx context.Context, db *sql.DB, in *inventories.Li
 		where = append(where, fmt.Sprintf(`sales_order_id = $%d`, len(paramQueries)))
 	}
 
+	if len(in.GetStatus()) > 0 {
+		paramQueries = append(paramQueries, in.GetStatus())
+		where = append(where, fmt.Sprintf(`status = $%d`, len(paramQueries)))
+	}
+
 	if len(in.GetPagination().GetSearch()) > 0 {
 		paramQueries = append(paramQueries, in.GetPagination().GetSearch())
 		where = append(where, fmt.Sprintf(`(code ILIKE $%d OR remark ILIKE $%d)`, len(paramQueries), len(paramQueries)))
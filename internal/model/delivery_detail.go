@@ -22,7 +22,7 @@ type DeliveryDetail struct {
 func (u *DeliveryDetail) Get(ctx context.Context, tx *sql.Tx) error {
 	query := `
 		SELECT delivery_details.id, deliveries.company_id, delivery_details.delivery_id, delivery_details.product_id, 
-		delivery_details.shelve_id, delivery_details.barcode 
+		delivery_details.shelve_id, delivery_details.barcode, delivery_details.qty, COALESCE(delivery_details.lot_id, '') 
 		FROM delivery_details 
 		JOIN deliveries ON delivery_details.delivery_id = deliveries.id
 		WHERE delivery_details.id = $1 AND delivery_details.delivery_id = $2
@@ -36,9 +36,9 @@ func (u *DeliveryDetail) Get(ctx context.Context, tx *sql.Tx) error {
 
 	var pbProduct inventories.Product
 	var pbShelve inventories.Shelve
-	var companyID string
+	var companyID, lotID string
 	err = stmt.QueryRowContext(ctx, u.Pb.GetId(), u.Pb.GetDeliveryId()).Scan(
-		&u.Pb.Id, &companyID, &u.Pb.DeliveryId, &pbProduct.Id, &pbShelve.Id, &u.Pb.Barcode,
+		&u.Pb.Id, &companyID, &u.Pb.DeliveryId, &pbProduct.Id, &pbShelve.Id, &u.Pb.Barcode, &u.Pb.Qty, &lotID,
 	)
 
 	if err == sql.ErrNoRows {
@@ -55,6 +55,9 @@ func (u *DeliveryDetail) Get(ctx context.Context, tx *sql.Tx) error {
 
 	u.Pb.Product = &pbProduct
 	u.Pb.Shelve = &pbShelve
+	if len(lotID) > 0 {
+		u.Pb.Lot = &inventories.Lot{Id: lotID}
+	}
 
 	return nil
 }
@@ -62,9 +65,19 @@ func (u *DeliveryDetail) Get(ctx context.Context, tx *sql.Tx) error {
 // Create DeliveryDetail
 func (u *DeliveryDetail) Create(ctx context.Context, tx *sql.Tx) error {
 	u.Pb.Id = uuid.New().String()
+	if len(u.Pb.GetBarcode()) > 0 {
+		err := u.checkUnit(ctx, tx)
+		if err != nil {
+			return err
+		}
+	} else {
+		// quantity tracked products have no unit barcode, the line is its own barcode
+		u.Pb.Barcode = u.Pb.GetId()
+	}
+
 	query := `
-		INSERT INTO delivery_details (id, delivery_id, product_id, shelve_id, barcode) 
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO delivery_details (id, delivery_id, product_id, shelve_id, barcode, qty, lot_id) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 	`
 	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
@@ -78,11 +91,25 @@ func (u *DeliveryDetail) Create(ctx context.Context, tx *sql.Tx) error {
 		u.Pb.GetProduct().GetId(),
 		u.Pb.GetShelve().GetId(),
 		u.Pb.GetBarcode(),
+		u.Pb.GetQty(),
+		nullLot(u.Pb.GetLot().GetId()),
 	)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Exec insert delivery detail: %v", err)
 	}
 
+	return nil
+}
+
+// Post DeliveryDetail, the unit is checked again as it may have moved since the draft was written
+func (u *DeliveryDetail) Post(ctx context.Context, tx *sql.Tx) error {
+	if u.Pb.GetBarcode() != u.Pb.GetId() {
+		err := u.checkUnit(ctx, tx)
+		if err != nil {
+			return err
+		}
+	}
+
 	transactionDate, err := time.Parse("2006-01-02T15:04:05.000Z", u.PbDelivery.GetDeliveryDate())
 	if err != nil {
 		return status.Errorf(codes.Internal, "convert transactiondate inventory: %v", err)
@@ -98,13 +125,15 @@ func (u *DeliveryDetail) Create(ctx context.Context, tx *sql.Tx) error {
 		TransactionCode: u.PbDelivery.GetCode(),
 		TransactionID:   u.PbDelivery.GetId(),
 		Type:            "DO",
+		Qty:             u.Pb.GetQty(),
+		LotID:           u.Pb.GetLot().GetId(),
 	}
 	err = inventory.Create(ctx, tx)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return u.updateCost(ctx, tx, inventory.Cost)
 }
 
 // Delete DeliveryDetail
@@ -120,14 +149,47 @@ func (u *DeliveryDetail) Delete(ctx context.Context, tx *sql.Tx) error {
 		return status.Errorf(codes.Internal, "Exec delete delivery detail: %v", err)
 	}
 
-	inventory := Inventory{
-		Barcode:       u.Pb.GetBarcode(),
-		TransactionID: u.Pb.GetDeliveryId(),
+	return nil
+}
+
+// ListBySalesOrderId qty delivered per product on the sales order
+func (u *DeliveryDetail) ListBySalesOrderId(ctx context.Context, tx *sql.Tx, salesOrderId string, ids []string) ([]*inventories.OutstandingDetail, error) {
+	return deliveryOrder.listFulfilled(ctx, tx, salesOrderId, ids)
+}
+
+// updateCost keep the cost of the movement on the delivery detail
+func (u *DeliveryDetail) updateCost(ctx context.Context, tx *sql.Tx, cost float64) error {
+	_, err := tx.ExecContext(ctx, `UPDATE delivery_details SET cost = $1 WHERE id = $2`, cost, u.Pb.GetId())
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec update delivery detail cost: %v", err)
 	}
-	err = inventory.Get(ctx, tx)
+
+	u.Pb.Cost = cost
+
+	return nil
+}
+
+// checkUnit the unit can leave for the sales order of the delivery, it is not reserved for another sales order and the
+// branch keeps the qty reserved for the others. The reservation lock of the product is taken before the unit is locked,
+// the same order a reservation takes them
+func (u *DeliveryDetail) checkUnit(ctx context.Context, tx *sql.Tx) error {
+	reservationModel := Reservation{}
+	reservationModel.Pb = inventories.Reservation{
+		BranchId:     u.PbDelivery.GetBranchId(),
+		Barcode:      u.Pb.GetBarcode(),
+		ProductId:    u.Pb.GetProduct().GetId(),
+		SalesOrderId: u.PbDelivery.GetSalesOrderId(),
+	}
+	err := reservationModel.IsReservedByOther(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	err = reservationModel.CheckAvailable(ctx, tx, 1)
 	if err != nil {
 		return err
 	}
 
-	return inventory.Delete(ctx, tx)
+	unit := UnitStatus{Barcode: u.Pb.GetBarcode()}
+	return unit.CheckOut(ctx, tx, u.Pb.GetProduct().GetId(), u.PbDelivery.GetBranchId(), u.Pb.GetShelve().GetId(), u.PbDelivery.GetSalesOrderId(), true)
 }
@@ -23,9 +23,25 @@ type DeliveryReturn struct {
 
 // Get func
 func (u *DeliveryReturn) Get(ctx context.Context, db *sql.DB) error {
+	return u.get(ctx, db)
+}
+
+// GetForUpdate the delivery return read again in the transaction with its details, the row is locked until the transaction ends
+func (u *DeliveryReturn) GetForUpdate(ctx context.Context, tx *sql.Tx) error {
+	err := lockDocument(ctx, tx, "delivery_returns", u.Pb.GetId())
+	if err != nil {
+		return err
+	}
+
+	u.Pb.Details = nil
+	return u.get(ctx, tx)
+}
+
+// get the delivery return with its details
+func (u *DeliveryReturn) get(ctx context.Context, db preparer) error {
 	query := `
 		SELECT delivery_returns.id, delivery_returns.company_id, delivery_returns.branch_id, delivery_returns.branch_name, delivery_returns.delivery_id, delivery_returns.code, 
-		delivery_returns.return_date, delivery_returns.remark, delivery_returns.created_at, delivery_returns.created_by, delivery_returns.updated_at, delivery_returns.updated_by,
+		delivery_returns.return_date, delivery_returns.remark, delivery_returns.status, delivery_returns.created_at, delivery_returns.created_by, delivery_returns.updated_at, delivery_returns.updated_by,
 		json_agg(DISTINCT jsonb_build_object(
 			'id', delivery_return_details.id,
 			'delivery_return_id', delivery_return_details.delivery_return_id,
@@ -33,13 +49,21 @@ func (u *DeliveryReturn) Get(ctx context.Context, db *sql.DB) error {
 			'product_name', products.name,
 			'product_code', products.code,
 			'shelve_id', delivery_return_details.shelve_id,
-			'shelve_code', shelves.code
+			'shelve_code', shelves.code,
+			'barcode', delivery_return_details.barcode,
+			'qty', delivery_return_details.qty,
+			'cost', delivery_return_details.cost,
+			'lot_id', delivery_return_details.lot_id,
+			'lot_code', lots.code,
+			'lot_expired_date', lots.expired_date
 		)) as details
 		FROM delivery_returns 
 		JOIN delivery_return_details ON delivery_returns.id = delivery_return_details.delivery_return_id
 		JOIN products ON delivery_return_details.product_id = products.id
 		JOIN shelves ON delivery_return_details.shelve_id = shelves.id
+		LEFT JOIN lots ON delivery_return_details.lot_id = lots.id
 		WHERE delivery_returns.id = $1
+		GROUP BY delivery_returns.id
 	`
 
 	stmt, err := db.PrepareContext(ctx, query)
@@ -49,10 +73,10 @@ func (u *DeliveryReturn) Get(ctx context.Context, db *sql.DB) error {
 	defer stmt.Close()
 
 	var dateReturn, createdAt, updatedAt time.Time
-	var companyID, details string
+	var companyID, deliveryID, details string
 	err = stmt.QueryRowContext(ctx, u.Pb.GetId()).Scan(
-		&u.Pb.Id, &companyID, &u.Pb.BranchId, &u.Pb.BranchName, &u.Pb.Delivery.Id, &u.Pb.Code, &dateReturn, &u.Pb.Remark,
-		&createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy, &details,
+		&u.Pb.Id, &companyID, &u.Pb.BranchId, &u.Pb.BranchName, &deliveryID, &u.Pb.Code, &dateReturn, &u.Pb.Remark,
+		&u.Pb.Status, &createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy, &details,
 	)
 
 	if err == sql.ErrNoRows {
@@ -67,6 +91,7 @@ func (u *DeliveryReturn) Get(ctx context.Context, db *sql.DB) error {
 		return status.Error(codes.Unauthenticated, "its not your company")
 	}
 
+	u.Pb.Delivery = &inventories.Delivery{Id: deliveryID}
 	u.Pb.ReturnDate = dateReturn.String()
 	u.Pb.CreatedAt = createdAt.String()
 	u.Pb.UpdatedAt = updatedAt.String()
@@ -79,6 +104,12 @@ func (u *DeliveryReturn) Get(ctx context.Context, db *sql.DB) error {
 		ProductCode      string
 		ShelveID         string
 		ShelveCode       string
+		Barcode          string  `json:"barcode"`
+		Qty              int32   `json:"qty"`
+		Cost             float64 `json:"cost"`
+		LotID            string  `json:"lot_id"`
+		LotCode          string  `json:"lot_code"`
+		LotExpiredDate   string  `json:"lot_expired_date"`
 	}{}
 	err = json.Unmarshal([]byte(details), &detailDeliveryReturns)
 	if err != nil {
@@ -86,7 +117,7 @@ func (u *DeliveryReturn) Get(ctx context.Context, db *sql.DB) error {
 	}
 
 	for _, detail := range detailDeliveryReturns {
-		u.Pb.Details = append(u.Pb.Details, &inventories.DeliveryReturnDetail{
+		pbDetail := &inventories.DeliveryReturnDetail{
 			Id: detail.ID,
 			Product: &inventories.Product{
 				Id:   detail.ProductID,
@@ -98,15 +129,27 @@ func (u *DeliveryReturn) Get(ctx context.Context, db *sql.DB) error {
 				Id:   detail.ShelveID,
 				Code: detail.ShelveCode,
 			},
-		})
+			Barcode: detail.Barcode,
+			Qty:     detail.Qty,
+			Cost:    detail.Cost,
+		}
+		if len(detail.LotID) > 0 {
+			pbDetail.Lot = &inventories.Lot{
+				Id:          detail.LotID,
+				Code:        detail.LotCode,
+				ExpiredDate: detail.LotExpiredDate,
+			}
+		}
+		u.Pb.Details = append(u.Pb.Details, pbDetail)
 	}
 
 	return nil
 }
 
-// Create DeliveryReturn
+// Create DeliveryReturn as a draft, the stock moves when it is posted
 func (u *DeliveryReturn) Create(ctx context.Context, tx *sql.Tx) error {
 	u.Pb.Id = uuid.New().String()
+	u.Pb.Status = DocumentDraft
 	now := time.Now().UTC()
 	u.Pb.CreatedBy = ctx.Value(app.Ctx("userID")).(string)
 	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
@@ -121,8 +164,8 @@ func (u *DeliveryReturn) Create(ctx context.Context, tx *sql.Tx) error {
 	}
 
 	query := `
-		INSERT INTO delivery_returns (id, company_id, branch_id, branch_name, delivery_id, code, return_date, remark, created_at, created_by, updated_at, updated_by) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		INSERT INTO delivery_returns (id, company_id, branch_id, branch_name, delivery_id, code, return_date, remark, status, created_at, created_by, updated_at, updated_by) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 	`
 	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
@@ -139,6 +182,7 @@ func (u *DeliveryReturn) Create(ctx context.Context, tx *sql.Tx) error {
 		u.Pb.GetCode(),
 		dateReturn,
 		u.Pb.GetRemark(),
+		u.Pb.GetStatus(),
 		now,
 		u.Pb.GetCreatedBy(),
 		now,
@@ -151,12 +195,20 @@ func (u *DeliveryReturn) Create(ctx context.Context, tx *sql.Tx) error {
 	u.Pb.CreatedAt = now.String()
 	u.Pb.UpdatedAt = u.Pb.CreatedAt
 
+	err = writeDocumentEvent(ctx, tx, "delivery_return", EventCreated, u.Pb, u.Pb.GetReturnDate())
+	if err != nil {
+		return err
+	}
+
 	for _, detail := range u.Pb.GetDetails() {
 		deliveryReturnDetailModel := DeliveryReturnDetail{}
 		deliveryReturnDetailModel.Pb = inventories.DeliveryReturnDetail{
 			DeliveryReturnId: u.Pb.GetId(),
 			Product:          detail.GetProduct(),
 			Shelve:           detail.GetShelve(),
+			Barcode:          detail.GetBarcode(),
+			Qty:              detail.GetQty(),
+			Lot:              detail.GetLot(),
 		}
 		deliveryReturnDetailModel.PbDeliveryReturn = inventories.DeliveryReturn{
 			Id:         u.Pb.Id,
@@ -196,7 +248,7 @@ func (u *DeliveryReturn) Update(ctx context.Context, tx *sql.Tx) error {
 		remark = $3, 
 		updated_at = $4, 
 		updated_by= $5
-		WHERE id = $6
+		WHERE id = $6 AND status = $7
 	`
 	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
@@ -204,43 +256,146 @@ func (u *DeliveryReturn) Update(ctx context.Context, tx *sql.Tx) error {
 	}
 	defer stmt.Close()
 
-	_, err = stmt.ExecContext(ctx,
+	res, err := stmt.ExecContext(ctx,
 		u.Pb.GetDelivery().GetId(),
 		dateReturn,
 		u.Pb.GetRemark(),
 		now,
 		u.Pb.GetUpdatedBy(),
 		u.Pb.GetId(),
+		DocumentDraft,
 	)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Exec update delivery return: %v", err)
 	}
 
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return status.Errorf(codes.Internal, "rows affected update delivery return: %v", err)
+	}
+
+	if affected == 0 {
+		return status.Error(codes.FailedPrecondition, "only a draft delivery return can be updated")
+	}
+
 	u.Pb.UpdatedAt = now.String()
 
+	err = writeDocumentEvent(ctx, tx, "delivery_return", EventUpdated, u.Pb, u.Pb.GetReturnDate())
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
-// Delete DeliveryReturn
-func (u *DeliveryReturn) Delete(ctx context.Context, db *sql.DB) error {
-	stmt, err := db.PrepareContext(ctx, `DELETE FROM delivery_returns WHERE id = $1`)
+// Post DeliveryReturn, the returned details come back into the stock
+func (u *DeliveryReturn) Post(ctx context.Context, tx *sql.Tx) error {
+	now := time.Now().UTC()
+	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+
+	var dateReturn time.Time
+	err := tx.QueryRowContext(ctx, `
+		UPDATE delivery_returns SET
+		status = $1,
+		updated_at = $2,
+		updated_by = $3
+		WHERE id = $4 AND company_id = $5 AND status = $6
+		RETURNING return_date`,
+		DocumentPosted, now, u.Pb.GetUpdatedBy(), u.Pb.GetId(), ctx.Value(app.Ctx("companyID")).(string), DocumentDraft,
+	).Scan(&dateReturn)
+
+	if err == sql.ErrNoRows {
+		return status.Error(codes.FailedPrecondition, "only a draft delivery return can be posted")
+	}
+
 	if err != nil {
-		return status.Errorf(codes.Internal, "Prepare delete delivery return: %v", err)
+		return status.Errorf(codes.Internal, "Exec post delivery return: %v", err)
 	}
-	defer stmt.Close()
 
-	_, err = stmt.ExecContext(ctx, u.Pb.GetId())
+	u.Pb.Status = DocumentPosted
+	u.Pb.ReturnDate = dateReturn.Format("2006-01-02T15:04:05.000Z")
+	u.Pb.UpdatedAt = now.String()
+
+	err = writeDocumentEvent(ctx, tx, "delivery_return", EventPosted, u.Pb, u.Pb.GetReturnDate())
 	if err != nil {
-		return status.Errorf(codes.Internal, "Exec delete delivery return: %v", err)
+		return err
+	}
+
+	for _, detail := range u.Pb.GetDetails() {
+		deliveryReturnDetailModel := DeliveryReturnDetail{}
+		deliveryReturnDetailModel.Pb = inventories.DeliveryReturnDetail{
+			Id:               detail.GetId(),
+			DeliveryReturnId: u.Pb.GetId(),
+			Product:          detail.GetProduct(),
+			Shelve:           detail.GetShelve(),
+			Barcode:          detail.GetBarcode(),
+			Qty:              detail.GetQty(),
+			Lot:              detail.GetLot(),
+		}
+		deliveryReturnDetailModel.PbDeliveryReturn = inventories.DeliveryReturn{
+			Id:         u.Pb.Id,
+			BranchId:   u.Pb.BranchId,
+			BranchName: u.Pb.BranchName,
+			Delivery:   u.Pb.Delivery,
+			Code:       u.Pb.Code,
+			ReturnDate: u.Pb.ReturnDate,
+			Remark:     u.Pb.Remark,
+			Status:     u.Pb.Status,
+		}
+		err = deliveryReturnDetailModel.Post(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		detail.Cost = deliveryReturnDetailModel.Pb.GetCost()
 	}
 
 	return nil
 }
 
+// Cancel DeliveryReturn, the inventories of a posted delivery return are reversed at the cancel time
+func (u *DeliveryReturn) Cancel(ctx context.Context, tx *sql.Tx) error {
+	now := time.Now().UTC()
+	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE delivery_returns SET
+		status = $1,
+		updated_at = $2,
+		updated_by = $3
+		WHERE id = $4 AND company_id = $5 AND status = $6`,
+		DocumentCancelled, now, u.Pb.GetUpdatedBy(), u.Pb.GetId(), ctx.Value(app.Ctx("companyID")).(string), u.Pb.GetStatus(),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec cancel delivery return: %v", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return status.Errorf(codes.Internal, "rows affected cancel delivery return: %v", err)
+	}
+
+	if affected == 0 {
+		return status.Error(codes.FailedPrecondition, "delivery return status has changed")
+	}
+
+	if u.Pb.GetStatus() == DocumentPosted {
+		err = reverseTransaction(ctx, tx, u.Pb.GetId(), now)
+		if err != nil {
+			return err
+		}
+	}
+
+	u.Pb.Status = DocumentCancelled
+	u.Pb.UpdatedAt = now.String()
+
+	return writeDocumentEvent(ctx, tx, "delivery_return", EventCancelled, u.Pb, u.Pb.GetReturnDate())
+}
+
 // ListQuery builder
 func (u *DeliveryReturn) ListQuery(ctx context.Context, db *sql.DB, in *inventories.ListDeliveryReturnRequest) (string, []interface{}, *inventories.DeliveryReturnPaginationResponse, error) {
 	var paginationResponse inventories.DeliveryReturnPaginationResponse
-	query := `SELECT id, company_id, branch_id, branch_name, delivery_id, code, return_date, remark, created_at, created_by, updated_at, updated_by FROM delivery_returns`
+	query := `SELECT id, company_id, branch_id, branch_name, delivery_id, code, return_date, remark, status, created_at, created_by, updated_at, updated_by FROM delivery_returns`
 
 	where := []string{"company_id = $1"}
 	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string)}
@@ -255,6 +410,11 @@ func (u *DeliveryReturn) ListQuery(ctx context.Context, db *sql.DB, in *inventor
 		where = append(where, fmt.Sprintf(`delivery_id = $%d`, len(paramQueries)))
 	}
 
+	if len(in.GetStatus()) > 0 {
+		paramQueries = append(paramQueries, in.GetStatus())
+		where = append(where, fmt.Sprintf(`status = $%d`, len(paramQueries)))
+	}
+
 	if len(in.GetPagination().GetSearch()) > 0 {
 		paramQueries = append(paramQueries, in.GetPagination().GetSearch())
 		where = append(where, fmt.Sprintf(`(code ILIKE $%d OR remark ILIKE $%d)`, len(paramQueries), len(paramQueries)))
@@ -22,7 +22,7 @@ type DeliveryReturnDetail struct {
 func (u *DeliveryReturnDetail) Get(ctx context.Context, tx *sql.Tx) error {
 	query := `
 		SELECT delivery_return_details.id, delivery_returns.company_id, delivery_return_details.delivery_return_id, delivery_return_details.product_id, 
-		delivery_return_details.shelve_id 
+		delivery_return_details.shelve_id, COALESCE(delivery_return_details.barcode, ''), delivery_return_details.qty, COALESCE(delivery_return_details.lot_id, '') 
 		FROM delivery_return_details 
 		JOIN delivery_returns ON delivery_return_details.delivery_return_id = delivery_returns.id
 		WHERE delivery_return_details.id = $1 AND delivery_return_details.delivery_return_id = $2
@@ -36,9 +36,9 @@ func (u *DeliveryReturnDetail) Get(ctx context.Context, tx *sql.Tx) error {
 
 	var pbProduct inventories.Product
 	var pbShelve inventories.Shelve
-	var companyID string
+	var companyID, lotID string
 	err = stmt.QueryRowContext(ctx, u.Pb.GetId(), u.Pb.GetDeliveryReturnId()).Scan(
-		&u.Pb.Id, &companyID, &u.Pb.DeliveryReturnId, &pbProduct.Id, &pbShelve.Id,
+		&u.Pb.Id, &companyID, &u.Pb.DeliveryReturnId, &pbProduct.Id, &pbShelve.Id, &u.Pb.Barcode, &u.Pb.Qty, &lotID,
 	)
 
 	if err == sql.ErrNoRows {
@@ -55,6 +55,9 @@ func (u *DeliveryReturnDetail) Get(ctx context.Context, tx *sql.Tx) error {
 
 	u.Pb.Product = &pbProduct
 	u.Pb.Shelve = &pbShelve
+	if len(lotID) > 0 {
+		u.Pb.Lot = &inventories.Lot{Id: lotID}
+	}
 
 	return nil
 }
@@ -62,9 +65,24 @@ func (u *DeliveryReturnDetail) Get(ctx context.Context, tx *sql.Tx) error {
 // Create DeliveryReturnDetail
 func (u *DeliveryReturnDetail) Create(ctx context.Context, tx *sql.Tx) error {
 	u.Pb.Id = uuid.New().String()
+	if len(u.Pb.GetBarcode()) > 0 {
+		unit := UnitStatus{Barcode: u.Pb.GetBarcode()}
+		err := unit.CheckReturn(ctx, tx, u.Pb.GetProduct().GetId(), u.PbDeliveryReturn.GetBranchId(), u.PbDeliveryReturn.GetDelivery().GetId())
+		if err != nil {
+			return err
+		}
+
+		if len(u.Pb.GetLot().GetId()) == 0 && len(unit.LotID) > 0 {
+			u.Pb.Lot = &inventories.Lot{Id: unit.LotID}
+		}
+	} else {
+		// quantity tracked products have no unit barcode, the line is its own barcode
+		u.Pb.Barcode = u.Pb.GetId()
+	}
+
 	query := `
-		INSERT INTO delivery_return_details (id, delivery_return_id, product_id, shelve_id) 
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO delivery_return_details (id, delivery_return_id, product_id, shelve_id, barcode, qty, lot_id) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 	`
 	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
@@ -77,17 +95,41 @@ func (u *DeliveryReturnDetail) Create(ctx context.Context, tx *sql.Tx) error {
 		u.Pb.GetDeliveryReturnId(),
 		u.Pb.GetProduct().GetId(),
 		u.Pb.GetShelve().GetId(),
+		u.Pb.GetBarcode(),
+		u.Pb.GetQty(),
+		nullLot(u.Pb.GetLot().GetId()),
 	)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Exec insert delivery return detail: %v", err)
 	}
 
+	return nil
+}
+
+// Post DeliveryReturnDetail, the unit is checked again as it may have come back since the draft was written
+func (u *DeliveryReturnDetail) Post(ctx context.Context, tx *sql.Tx) error {
+	var unitBarcode string
+	if u.Pb.GetBarcode() != u.Pb.GetId() {
+		unitBarcode = u.Pb.GetBarcode()
+		unit := UnitStatus{Barcode: unitBarcode}
+		err := unit.CheckReturn(ctx, tx, u.Pb.GetProduct().GetId(), u.PbDeliveryReturn.GetBranchId(), u.PbDeliveryReturn.GetDelivery().GetId())
+		if err != nil {
+			return err
+		}
+	}
+
 	transactionDate, err := time.Parse("2006-01-02T15:04:05.000Z", u.PbDeliveryReturn.GetReturnDate())
 	if err != nil {
 		return status.Errorf(codes.Internal, "convert transactiondate inventory: %v", err)
 	}
+
+	// the returned goods come back at the cost they were delivered
+	unitCost, err := deliveredUnitCost(ctx, tx, u.PbDeliveryReturn.GetDelivery().GetId(), u.Pb.GetProduct().GetId(), unitBarcode)
+	if err != nil {
+		return err
+	}
 	inventory := Inventory{
-		Barcode:         u.Pb.GetId(),
+		Barcode:         u.Pb.GetBarcode(),
 		BranchID:        u.PbDeliveryReturn.GetBranchId(),
 		CompanyID:       ctx.Value(app.Ctx("companyID")).(string),
 		IsIn:            true,
@@ -97,13 +139,16 @@ func (u *DeliveryReturnDetail) Create(ctx context.Context, tx *sql.Tx) error {
 		TransactionCode: u.PbDeliveryReturn.GetCode(),
 		TransactionID:   u.PbDeliveryReturn.GetId(),
 		Type:            "DR",
+		Qty:             u.Pb.GetQty(),
+		UnitCost:        unitCost,
+		LotID:           u.Pb.GetLot().GetId(),
 	}
 	err = inventory.Create(ctx, tx)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return u.updateCost(ctx, tx, inventory.Cost)
 }
 
 // Update DeliveryReturnDetail
@@ -111,8 +156,10 @@ func (u *DeliveryReturnDetail) Update(ctx context.Context, tx *sql.Tx) error {
 	query := `
 		UPDATE delivery_return_details SET
 		product_id = $1, 
-		shelve_id = $2
-		WHERE id = $3
+		shelve_id = $2,
+		qty = $3,
+		lot_id = $4
+		WHERE id = $5
 	`
 	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
@@ -123,28 +170,14 @@ func (u *DeliveryReturnDetail) Update(ctx context.Context, tx *sql.Tx) error {
 	_, err = stmt.ExecContext(ctx,
 		u.Pb.GetProduct().GetId(),
 		u.Pb.GetShelve().GetId(),
+		u.Pb.GetQty(),
+		nullLot(u.Pb.GetLot().GetId()),
 		u.Pb.GetId(),
 	)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Exec update delivery return detail: %v", err)
 	}
 
-	inventory := Inventory{
-		Barcode:       u.Pb.GetId(),
-		TransactionID: u.PbDeliveryReturn.GetId(),
-	}
-	err = inventory.Get(ctx, tx)
-	if err != nil {
-		return err
-	}
-
-	inventory.ProductID = u.Pb.GetProduct().GetId()
-	inventory.ShelveID = u.Pb.GetShelve().GetId()
-	err = inventory.Update(ctx, tx)
-	if err != nil {
-		return err
-	}
-
 	return nil
 }
 
@@ -161,14 +194,17 @@ func (u *DeliveryReturnDetail) Delete(ctx context.Context, tx *sql.Tx) error {
 		return status.Errorf(codes.Internal, "Exec delete delivery return detail: %v", err)
 	}
 
-	inventory := Inventory{
-		Barcode:       u.Pb.GetId(),
-		TransactionID: u.Pb.GetDeliveryReturnId(),
-	}
-	err = inventory.Get(ctx, tx)
+	return nil
+}
+
+// updateCost keep the cost of the movement on the delivery return detail
+func (u *DeliveryReturnDetail) updateCost(ctx context.Context, tx *sql.Tx, cost float64) error {
+	_, err := tx.ExecContext(ctx, `UPDATE delivery_return_details SET cost = $1 WHERE id = $2`, cost, u.Pb.GetId())
 	if err != nil {
-		return err
+		return status.Errorf(codes.Internal, "Exec update delivery return detail cost: %v", err)
 	}
 
-	return inventory.Delete(ctx, tx)
+	u.Pb.Cost = cost
+
+	return nil
 }
@@ -0,0 +1,204 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-pkg/util"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Document status of receives, deliveries and their returns. A draft does not move the stock, the inventories are
+// written when it is posted and a posted document is cancelled by reversing its inventories.
+const (
+	DocumentDraft     = "DRAFT"
+	DocumentPosted    = "POSTED"
+	DocumentCancelled = "CANCELLED"
+)
+
+// preparer a database or a transaction a document is read from
+type preparer interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// lockDocument lock the row of the document until the transaction ends, an update or a post of the document waits for it
+func lockDocument(ctx context.Context, tx *sql.Tx, table string, id string) error {
+	_, err := tx.ExecContext(ctx, `SELECT id FROM `+table+` WHERE id = $1 FOR UPDATE`, id)
+	if err != nil {
+		return status.Errorf(codes.Internal, "lock %s: %v", table, err)
+	}
+
+	return nil
+}
+
+// orderDocument a document fulfilling the order of another service, a receive of a purchase or a delivery of a sales order
+type orderDocument struct {
+	table       string
+	detailTable string
+	foreignKey  string
+	orderColumn string
+	order       string
+	fulfilled   string
+}
+
+var (
+	receiveOrder  = orderDocument{"receives", "receive_details", "receive_id", "purchase_id", "purchase", "received"}
+	deliveryOrder = orderDocument{"deliveries", "delivery_details", "delivery_id", "sales_order_id", "sales order", "delivered"}
+)
+
+// checkOutstanding check the products of the document against the qty ordered, the qty fulfilled by all documents of
+// the order that are not cancelled can not be more than the ordered qty and its tolerance
+func (d orderDocument) checkOutstanding(ctx context.Context, tx *sql.Tx, orderID string, documentID string, ordered map[string]int32, tolerancePercent float64) error {
+	// serialize the documents of an order, two documents can not both take the remaining qty
+	_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, orderID)
+	if err != nil {
+		return status.Errorf(codes.Internal, "lock %s: %v", d.order, err)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %[2]s.product_id, products.code, SUM(%[2]s.qty)
+		FROM %[2]s
+		JOIN %[1]s ON %[2]s.%[3]s = %[1]s.id
+		JOIN products ON %[2]s.product_id = products.id
+		WHERE %[1]s.company_id = $1 AND %[1]s.%[4]s = $2 AND %[1]s.status <> $4
+			AND %[2]s.product_id IN (SELECT product_id FROM %[2]s WHERE %[3]s = $3)
+		GROUP BY %[2]s.product_id, products.code
+	`, d.table, d.detailTable, d.foreignKey, d.orderColumn)
+	rows, err := tx.QueryContext(ctx, query, ctx.Value(app.Ctx("companyID")).(string), orderID, documentID, DocumentCancelled)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw %s %s: %v", d.fulfilled, d.order, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var productID, productCode string
+		var fulfilled int32
+		err = rows.Scan(&productID, &productCode, &fulfilled)
+		if err != nil {
+			return status.Errorf(codes.Internal, "scan %s %s: %v", d.fulfilled, d.order, err)
+		}
+
+		qty, ok := ordered[productID]
+		if !ok {
+			return status.Errorf(codes.InvalidArgument, "product %s is not on the %s", productCode, d.order)
+		}
+
+		allowed := qty + int32(math.Floor(float64(qty)*tolerancePercent/100))
+		if fulfilled > allowed {
+			return status.Errorf(codes.InvalidArgument, "product %s is over %s, %d %s of %d ordered", productCode, d.fulfilled, fulfilled, d.fulfilled, qty)
+		}
+	}
+
+	if rows.Err() != nil {
+		return status.Errorf(codes.Internal, "rows %s %s: %v", d.fulfilled, d.order, rows.Err())
+	}
+
+	return nil
+}
+
+// listFulfilled qty fulfilled per product on the order by the documents of the company that are not cancelled,
+// limited to the products of ids when it is given
+func (d orderDocument) listFulfilled(ctx context.Context, tx *sql.Tx, orderID string, ids []string) ([]*inventories.OutstandingDetail, error) {
+	var output []*inventories.OutstandingDetail
+	query := fmt.Sprintf(`
+	with fulfilled as (
+		select %[2]s.product_id, SUM(%[2]s.qty) quantity
+		from %[2]s 
+		join %[1]s ON %[2]s.%[3]s = %[1]s.id
+		where %[1]s.company_id = $1 and %[1]s.%[4]s = $2 and %[1]s.status <> $3
+		group by %[2]s.product_id
+	)
+	select products.id, products.code, products.name, coalesce(fulfilled.quantity, 0)
+	from products
+	left join fulfilled on products.id = fulfilled.product_id
+	`, d.table, d.detailTable, d.foreignKey, d.orderColumn)
+	where := []string{"products.company_id = $1"}
+	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string), orderID, DocumentCancelled}
+
+	if len(ids) > 0 {
+		productIds := make([]interface{}, len(ids))
+		for i, productId := range ids {
+			productIds[i] = productId
+		}
+		var iCond string
+		paramQueries, iCond = util.ConvertWhereIn("products.id", paramQueries, productIds)
+		where = append(where, iCond)
+	}
+
+	query += ` WHERE ` + strings.Join(where, " AND ")
+
+	rows, err := tx.QueryContext(ctx, query, paramQueries...)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Query Raw %s %s: %v", d.fulfilled, d.order, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var detail inventories.OutstandingDetail
+		err = rows.Scan(&detail.ProductId, &detail.ProductCode, &detail.ProductName, &detail.Quantity)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "scan %s %s: %v", d.fulfilled, d.order, err)
+		}
+
+		output = append(output, &detail)
+	}
+
+	if rows.Err() != nil {
+		return nil, status.Errorf(codes.Internal, "rows %s %s: %v", d.fulfilled, d.order, rows.Err())
+	}
+
+	return output, nil
+}
+
+// reverseTransaction reverse every movement of the transaction at the cancel date
+func reverseTransaction(ctx context.Context, tx *sql.Tx, transactionID string, cancelDate time.Time) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, company_id, branch_id, product_id, barcode, transaction_id, transaction_code, transaction_date, type, in_out,
+			shelve_id, qty, COALESCE(lot_id, ''), cost
+		FROM inventories
+		WHERE company_id = $1 AND transaction_id = $2
+		ORDER BY created_at
+		FOR UPDATE`,
+		ctx.Value(app.Ctx("companyID")).(string), transactionID,
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw inventories to reverse: %v", err)
+	}
+
+	var movements []Inventory
+	for rows.Next() {
+		var inventory Inventory
+		err = rows.Scan(&inventory.ID, &inventory.CompanyID, &inventory.BranchID, &inventory.ProductID, &inventory.Barcode,
+			&inventory.TransactionID, &inventory.TransactionCode, &inventory.TransactionDate, &inventory.Type, &inventory.IsIn,
+			&inventory.ShelveID, &inventory.Qty, &inventory.LotID, &inventory.Cost,
+		)
+		if err != nil {
+			rows.Close()
+			return status.Errorf(codes.Internal, "scan inventories to reverse: %v", err)
+		}
+
+		movements = append(movements, inventory)
+	}
+
+	if rows.Err() != nil {
+		rows.Close()
+		return status.Errorf(codes.Internal, "rows inventories to reverse: %v", rows.Err())
+	}
+	rows.Close()
+
+	for _, movement := range movements {
+		err = movement.Reverse(ctx, tx, cancelDate)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
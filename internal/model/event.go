@@ -0,0 +1,159 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// status of an event in the outbox
+const (
+	EventPending   string = "PENDING"
+	EventPublished string = "PUBLISHED"
+)
+
+// actions of the event topics, a topic is the aggregate and the action, e.g. inventory.created or receive.updated
+const (
+	EventCreated   string = "created"
+	EventUpdated   string = "updated"
+	EventDeleted   string = "deleted"
+	EventReceived  string = "received"
+	EventApproved  string = "approved"
+	EventRejected  string = "rejected"
+	EventPosted    string = "posted"
+	EventCancelled string = "cancelled"
+)
+
+// Event struct, an entry of the event outbox
+type Event struct {
+	ID          string
+	CompanyID   string
+	Topic       string
+	AggregateID string
+	Payload     []byte
+	Attempts    int32
+	CreatedAt   time.Time
+}
+
+// inventoryEvent payload of an inventory movement, an update carries the movement it replaces
+type inventoryEvent struct {
+	ID              string          `json:"id"`
+	BranchID        string          `json:"branch_id"`
+	ShelveID        string          `json:"shelve_id"`
+	ProductID       string          `json:"product_id"`
+	Barcode         string          `json:"barcode,omitempty"`
+	LotID           string          `json:"lot_id,omitempty"`
+	TransactionID   string          `json:"transaction_id,omitempty"`
+	TransactionCode string          `json:"transaction_code,omitempty"`
+	TransactionType string          `json:"transaction_type"`
+	TransactionDate string          `json:"transaction_date"`
+	IsIn            bool            `json:"in"`
+	Qty             int32           `json:"qty"`
+	Cost            float64         `json:"cost"`
+	Previous        *inventoryEvent `json:"previous,omitempty"`
+}
+
+// documentEvent payload of a document header
+type documentEvent struct {
+	ID       string `json:"id"`
+	Code     string `json:"code"`
+	BranchID string `json:"branch_id"`
+	Date     string `json:"date"`
+	Status   string `json:"status,omitempty"`
+}
+
+func newInventoryEvent(inventory *Inventory) *inventoryEvent {
+	return &inventoryEvent{
+		ID:              inventory.ID,
+		BranchID:        inventory.BranchID,
+		ShelveID:        inventory.ShelveID,
+		ProductID:       inventory.ProductID,
+		Barcode:         inventory.Barcode,
+		LotID:           inventory.LotID,
+		TransactionID:   inventory.TransactionID,
+		TransactionCode: inventory.TransactionCode,
+		TransactionType: inventory.Type,
+		TransactionDate: inventory.TransactionDate.Format("2006-01-02T15:04:05.000Z"),
+		IsIn:            inventory.IsIn,
+		Qty:             inventory.Qty,
+		Cost:            inventory.Cost,
+	}
+}
+
+// writeEvent into the outbox in the transaction of the change, the event is published only if the change is committed
+func writeEvent(ctx context.Context, tx *sql.Tx, aggregate string, action string, aggregateID string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return status.Errorf(codes.Internal, "marshal event payload: %v", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO event_outbox (id, company_id, topic, aggregate_id, payload, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		uuid.New().String(), ctx.Value(app.Ctx("companyID")).(string), aggregate+"."+action, aggregateID, body,
+		EventPending, time.Now().UTC(),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec insert event outbox: %v", err)
+	}
+
+	return nil
+}
+
+// eventDocument the header of a document written as an event, the status is written when the document has one
+type eventDocument interface {
+	GetId() string
+	GetCode() string
+	GetBranchId() string
+}
+
+// writeDocumentEvent into the outbox, the event of a document header is keyed by the id of the document
+func writeDocumentEvent(ctx context.Context, tx *sql.Tx, aggregate string, action string, document eventDocument, date string) error {
+	payload := documentEvent{
+		ID:       document.GetId(),
+		Code:     document.GetCode(),
+		BranchID: document.GetBranchId(),
+		Date:     date,
+	}
+	if withStatus, ok := document.(interface{ GetStatus() string }); ok {
+		payload.Status = withStatus.GetStatus()
+	}
+
+	return writeEvent(ctx, tx, aggregate, action, document.GetId(), payload)
+}
+
+// Pending events of the outbox, the oldest first. The rows are not locked while the publisher is called, an event read
+// by two relays may be delivered twice and the consumers drop the duplicate by its id.
+func (u *Event) Pending(ctx context.Context, db *sql.DB, limit int) ([]Event, error) {
+	var events []Event
+	err := eventOutbox.list(ctx, db, `id, company_id, topic, aggregate_id, payload, attempts, created_at`, limit,
+		func(rows *sql.Rows) error {
+			var event Event
+			err := rows.Scan(&event.ID, &event.CompanyID, &event.Topic, &event.AggregateID, &event.Payload, &event.Attempts, &event.CreatedAt)
+			if err != nil {
+				return err
+			}
+
+			events = append(events, event)
+			return nil
+		},
+	)
+
+	return events, err
+}
+
+// MarkPublished the event is delivered by the publisher
+func (u *Event) MarkPublished(ctx context.Context, db *sql.DB) error {
+	return eventOutbox.markDone(ctx, db, u.ID)
+}
+
+// MarkFailed the event stays pending and is retried on the next run
+func (u *Event) MarkFailed(ctx context.Context, db *sql.DB, cause error) error {
+	return eventOutbox.markFailed(ctx, db, u.ID, cause)
+}
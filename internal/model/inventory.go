@@ -7,6 +7,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -24,6 +25,10 @@ type Inventory struct {
 	Type            string
 	IsIn            bool
 	ShelveID        string
+	Qty             int32
+	LotID           string
+	UnitCost        float64
+	Cost            float64
 }
 
 // CheckBarcode func
@@ -32,16 +37,17 @@ func (u *Inventory) CheckBarcode(ctx context.Context, db *sql.DB) error {
 		return status.Error(codes.NotFound, "branch or barcode empty on check barcode")
 	}
 
-	query := `SELECT branch_id FROM inventories WHERE company_id = $1 AND barcode = $2 ORDER BY transaction_date DESC LIMIT 1`
+	query := `SELECT branch_id, shelve_id, COALESCE(lot_id, ''), in_out FROM inventories WHERE company_id = $1 AND barcode = $2 ORDER BY transaction_date DESC, created_at DESC LIMIT 1`
 	rows, err := db.QueryContext(ctx, query, ctx.Value(app.Ctx("companyID")).(string), u.Barcode)
 	if err != nil {
 		return status.Error(codes.Internal, err.Error())
 	}
 	defer rows.Close()
 
-	var branchID string
+	var branchID, shelveID, lotID string
+	var isIn bool
 	for rows.Next() {
-		err = rows.Scan(&branchID)
+		err = rows.Scan(&branchID, &shelveID, &lotID, &isIn)
 		if err != nil {
 			return status.Errorf(codes.Internal, "scan check barcode: %v", err)
 		}
@@ -55,13 +61,62 @@ func (u *Inventory) CheckBarcode(ctx context.Context, db *sql.DB) error {
 		return status.Error(codes.Unauthenticated, "barcode not your own")
 	}
 
+	if !isIn {
+		return status.Error(codes.FailedPrecondition, "barcode is not in stock")
+	}
+
+	if len(u.ShelveID) > 0 && shelveID != u.ShelveID {
+		return status.Error(codes.InvalidArgument, "barcode not in the shelve")
+	}
+
+	u.LotID = lotID
+
+	return nil
+}
+
+// CheckQty func, the shelve must have enough stock of the product, or of the lot when it is given, and the branch must
+// keep the stock reserved for the other sales orders. The balance of the shelve is locked until the transaction ends,
+// a concurrent outbound or reservation of the product waits for it.
+func (u *Inventory) CheckQty(ctx context.Context, tx *sql.Tx, salesOrderID string) error {
+	companyID := ctx.Value(app.Ctx("companyID")).(string)
+
+	reservationModel := Reservation{}
+	reservationModel.Pb = inventories.Reservation{BranchId: u.BranchID, ProductId: u.ProductID, SalesOrderId: salesOrderID}
+	err := reservationModel.CheckAvailable(ctx, tx, u.Qty)
+	if err != nil {
+		return err
+	}
+
+	var stock int32
+	err = tx.QueryRowContext(ctx, `
+		SELECT qty FROM stock_balances
+		WHERE company_id = $1 AND branch_id = $2 AND shelve_id = $3 AND product_id = $4
+		FOR UPDATE`, companyID, u.BranchID, u.ShelveID, u.ProductID).Scan(&stock)
+	if err != nil && err != sql.ErrNoRows {
+		return status.Errorf(codes.Internal, "Query Raw check qty: %v", err)
+	}
+
+	if len(u.LotID) > 0 {
+		err = tx.QueryRowContext(ctx, `
+			SELECT COALESCE(SUM(CASE WHEN in_out THEN qty ELSE -qty END), 0) FROM inventories
+			WHERE company_id = $1 AND branch_id = $2 AND shelve_id = $3 AND lot_id = $4`,
+			companyID, u.BranchID, u.ShelveID, u.LotID).Scan(&stock)
+		if err != nil {
+			return status.Errorf(codes.Internal, "Query Raw check lot qty: %v", err)
+		}
+	}
+
+	if stock < u.Qty {
+		return status.Errorf(codes.FailedPrecondition, "insufficient stock, available %d", stock)
+	}
+
 	return nil
 }
 
 // Get func
 func (u *Inventory) Get(ctx context.Context, tx *sql.Tx) error {
 	query := `
-		SELECT id, company_id, branch_id, product_id, barcode, transaction_id, transaction_code, transaction_date, type, in_out, shelve_id 
+		SELECT id, company_id, branch_id, product_id, barcode, transaction_id, transaction_code, transaction_date, type, in_out, shelve_id, qty, COALESCE(lot_id, ''), cost 
 		FROM inventories
 		WHERE company_id = $1 AND barcode = $2 AND transaction_id = $3
 	`
@@ -75,7 +130,7 @@ func (u *Inventory) Get(ctx context.Context, tx *sql.Tx) error {
 	err = stmt.QueryRowContext(ctx, ctx.Value(app.Ctx("companyID")).(string), u.Barcode, u.TransactionID).Scan(
 		&u.ID, &u.CompanyID, &u.BranchID, &u.ProductID, &u.Barcode,
 		&u.TransactionID, &u.TransactionCode, &u.TransactionDate,
-		&u.Type, &u.IsIn, &u.ShelveID,
+		&u.Type, &u.IsIn, &u.ShelveID, &u.Qty, &u.LotID, &u.Cost,
 	)
 
 	if err == sql.ErrNoRows {
@@ -89,17 +144,51 @@ func (u *Inventory) Get(ctx context.Context, tx *sql.Tx) error {
 	return nil
 }
 
-// Create Inventory
+// GetByInOut func, used by transactions that write a paired out/in row for the same barcode
+func (u *Inventory) GetByInOut(ctx context.Context, tx *sql.Tx) error {
+	query := `
+		SELECT id, company_id, branch_id, product_id, barcode, transaction_id, transaction_code, transaction_date, type, in_out, shelve_id, qty, COALESCE(lot_id, ''), cost 
+		FROM inventories
+		WHERE company_id = $1 AND barcode = $2 AND transaction_id = $3 AND in_out = $4
+	`
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare statement Get inventory by in out: %v", err)
+	}
+	defer stmt.Close()
+
+	err = stmt.QueryRowContext(ctx, ctx.Value(app.Ctx("companyID")).(string), u.Barcode, u.TransactionID, u.IsIn).Scan(
+		&u.ID, &u.CompanyID, &u.BranchID, &u.ProductID, &u.Barcode,
+		&u.TransactionID, &u.TransactionCode, &u.TransactionDate,
+		&u.Type, &u.IsIn, &u.ShelveID, &u.Qty, &u.LotID, &u.Cost,
+	)
+
+	if err == sql.ErrNoRows {
+		return status.Errorf(codes.NotFound, "Query Raw get inventory by in out: %v", err)
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw get inventory by in out: %v", err)
+	}
+
+	return nil
+}
+
+// Create Inventory, a movement without qty is a single serialized unit
 func (u *Inventory) Create(ctx context.Context, tx *sql.Tx) error {
 	u.ID = uuid.New().String()
 	now := time.Now().UTC()
+	if u.Qty == 0 {
+		u.Qty = 1
+	}
 
 	query := `
 		INSERT INTO inventories (
 			id, company_id, branch_id, product_id, barcode, 
 			transaction_id, transaction_code, transaction_date, 
-			type, in_out, shelve_id, created_at, updated_at) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			type, in_out, shelve_id, qty, lot_id, created_at, updated_at) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
 	`
 	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
@@ -119,6 +208,8 @@ func (u *Inventory) Create(ctx context.Context, tx *sql.Tx) error {
 		u.Type,
 		u.IsIn,
 		u.ShelveID,
+		u.Qty,
+		nullLot(u.LotID),
 		now,
 		now,
 	)
@@ -126,11 +217,45 @@ func (u *Inventory) Create(ctx context.Context, tx *sql.Tx) error {
 		return status.Errorf(codes.Internal, "Exec insert inventory: %v", err)
 	}
 
-	return nil
+	u.CompanyID = ctx.Value(app.Ctx("companyID")).(string)
+	err = applyStockBalance(ctx, tx, u, 1)
+	if err != nil {
+		return err
+	}
+
+	err = applyCost(ctx, tx, u, 1)
+	if err != nil {
+		return err
+	}
+
+	return writeEvent(ctx, tx, "inventory", EventCreated, u.ID, newInventoryEvent(u))
 }
 
-// Update Inventory
+// Update Inventory, the balance of the previous movement is reverted before the new one is applied
 func (u *Inventory) Update(ctx context.Context, tx *sql.Tx) error {
+	var previous Inventory
+	err := tx.QueryRowContext(ctx, `
+		SELECT id, company_id, branch_id, shelve_id, product_id, barcode, COALESCE(lot_id, ''), transaction_id, transaction_code,
+			type, transaction_date, in_out, qty, cost
+		FROM inventories WHERE id = $1 FOR UPDATE`, u.ID).Scan(
+		&previous.ID, &previous.CompanyID, &previous.BranchID, &previous.ShelveID, &previous.ProductID, &previous.Barcode,
+		&previous.LotID, &previous.TransactionID, &previous.TransactionCode,
+		&previous.Type, &previous.TransactionDate, &previous.IsIn, &previous.Qty, &previous.Cost,
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw get previous inventory: %v", err)
+	}
+
+	err = applyStockBalance(ctx, tx, &previous, -1)
+	if err != nil {
+		return err
+	}
+
+	err = applyCost(ctx, tx, &previous, -1)
+	if err != nil {
+		return err
+	}
+
 	query := `
 		UPDATE inventories SET
 		branch_id = $1, 
@@ -142,8 +267,10 @@ func (u *Inventory) Update(ctx context.Context, tx *sql.Tx) error {
 		type = $7, 
 		in_out = $8, 
 		shelve_id = $9, 
-		updated_at= $10
-		WHERE id = $4
+		qty = $10, 
+		lot_id = $11, 
+		updated_at= $12
+		WHERE id = $13
 	`
 	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
@@ -161,6 +288,8 @@ func (u *Inventory) Update(ctx context.Context, tx *sql.Tx) error {
 		u.Type,
 		u.IsIn,
 		u.ShelveID,
+		u.Qty,
+		nullLot(u.LotID),
 		time.Now().UTC(),
 		u.ID,
 	)
@@ -168,21 +297,136 @@ func (u *Inventory) Update(ctx context.Context, tx *sql.Tx) error {
 		return status.Errorf(codes.Internal, "Exec update inventory: %v", err)
 	}
 
-	return nil
+	// an in movement without a new unit cost keeps its previous one
+	if u.IsIn && u.UnitCost == 0 && previous.IsIn && previous.Qty > 0 {
+		u.UnitCost = previous.Cost / float64(previous.Qty)
+	}
+
+	u.CompanyID = previous.CompanyID
+	err = applyStockBalance(ctx, tx, u, 1)
+	if err != nil {
+		return err
+	}
+
+	err = applyCost(ctx, tx, u, 1)
+	if err != nil {
+		return err
+	}
+
+	payload := newInventoryEvent(u)
+	payload.Previous = newInventoryEvent(&previous)
+	return writeEvent(ctx, tx, "inventory", EventUpdated, u.ID, payload)
 }
 
-// Delete Inventory
+// Delete Inventory, the balance of the deleted movement is reverted
 func (u *Inventory) Delete(ctx context.Context, tx *sql.Tx) error {
-	stmt, err := tx.PrepareContext(ctx, `DELETE FROM inventories WHERE id = $1`)
+	stmt, err := tx.PrepareContext(ctx, `
+		DELETE FROM inventories WHERE id = $1
+		RETURNING id, company_id, branch_id, shelve_id, product_id, barcode, COALESCE(lot_id, ''), transaction_id, transaction_code,
+			type, transaction_date, in_out, qty, cost`)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare delete inventory: %v", err)
 	}
 	defer stmt.Close()
 
-	_, err = stmt.ExecContext(ctx, u.ID)
+	var deleted Inventory
+	err = stmt.QueryRowContext(ctx, u.ID).Scan(
+		&deleted.ID, &deleted.CompanyID, &deleted.BranchID, &deleted.ShelveID, &deleted.ProductID, &deleted.Barcode,
+		&deleted.LotID, &deleted.TransactionID, &deleted.TransactionCode, &deleted.Type, &deleted.TransactionDate, &deleted.IsIn, &deleted.Qty, &deleted.Cost,
+	)
+	if err == sql.ErrNoRows {
+		return status.Errorf(codes.NotFound, "Exec delete inventory: %v", err)
+	}
+
 	if err != nil {
 		return status.Errorf(codes.Internal, "Exec delete inventory: %v", err)
 	}
 
-	return nil
+	err = applyStockBalance(ctx, tx, &deleted, -1)
+	if err != nil {
+		return err
+	}
+
+	err = applyCost(ctx, tx, &deleted, -1)
+	if err != nil {
+		return err
+	}
+
+	return writeEvent(ctx, tx, "inventory", EventDeleted, deleted.ID, newInventoryEvent(&deleted))
+}
+
+// Reverse Inventory, the movement is offset by an opposite movement at the transaction date and at the same cost.
+// The movement itself is kept, a reversal that takes the stock out needs the stock still on the shelve.
+func (u *Inventory) Reverse(ctx context.Context, tx *sql.Tx, transactionDate time.Time) error {
+	reversal := *u
+	reversal.ID = uuid.New().String()
+	reversal.IsIn = !u.IsIn
+	reversal.TransactionDate = transactionDate
+
+	if !reversal.IsIn {
+		unit := UnitStatus{Barcode: u.Barcode}
+		err := unit.Get(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		if !unit.InStock || unit.BranchID != u.BranchID || unit.ShelveID != u.ShelveID {
+			return status.Errorf(codes.FailedPrecondition, "barcode %s of %s has moved", u.Barcode, u.TransactionCode)
+		}
+
+		var stock int32
+		err = tx.QueryRowContext(ctx, `
+			SELECT qty FROM stock_balances WHERE company_id = $1 AND branch_id = $2 AND shelve_id = $3 AND product_id = $4
+			FOR UPDATE`,
+			u.CompanyID, u.BranchID, u.ShelveID, u.ProductID,
+		).Scan(&stock)
+		if err != nil && err != sql.ErrNoRows {
+			return status.Errorf(codes.Internal, "Query Raw stock to reverse: %v", err)
+		}
+
+		if stock < u.Qty {
+			return status.Errorf(codes.FailedPrecondition, "insufficient stock to reverse %s, available %d", u.TransactionCode, stock)
+		}
+	}
+
+	now := time.Now().UTC()
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO inventories (
+			id, company_id, branch_id, product_id, barcode, 
+			transaction_id, transaction_code, transaction_date, 
+			type, in_out, shelve_id, qty, lot_id, cost, created_at, updated_at) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)`,
+		reversal.ID,
+		reversal.CompanyID,
+		reversal.BranchID,
+		reversal.ProductID,
+		reversal.Barcode,
+		reversal.TransactionID,
+		reversal.TransactionCode,
+		reversal.TransactionDate,
+		reversal.Type,
+		reversal.IsIn,
+		reversal.ShelveID,
+		reversal.Qty,
+		nullLot(reversal.LotID),
+		reversal.Cost,
+		now,
+		now,
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec insert reverse inventory: %v", err)
+	}
+
+	err = applyStockBalance(ctx, tx, &reversal, 1)
+	if err != nil {
+		return err
+	}
+
+	// the cost layers go back to what they were before the movement
+	err = applyCost(ctx, tx, u, -1)
+	if err != nil {
+		return err
+	}
+
+	return writeEvent(ctx, tx, "inventory", EventCreated, reversal.ID, newInventoryEvent(&reversal))
 }
@@ -0,0 +1,198 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// status of a journal in the outbox, an unmapped journal waits for the account mapping of its type
+const (
+	JournalPending  string = "PENDING"
+	JournalSent     string = "SENT"
+	JournalUnmapped string = "UNMAPPED"
+)
+
+// JournalTypes the transaction types journalized, true when the stock of the type comes in. The amount of a journal is
+// the cost moved in the direction of its type, an adjustment (OP) is the net of its in and out movements.
+var JournalTypes = map[string]bool{
+	"GR": true,
+	"DR": true,
+	"OP": true,
+	"DO": false,
+	"RR": false,
+}
+
+// Journal struct, an entry of the journal outbox. A negative amount reverts the accounts of the mapping.
+type Journal struct {
+	ID              string
+	CompanyID       string
+	BranchID        string
+	TransactionID   string
+	TransactionCode string
+	TransactionType string
+	TransactionDate time.Time
+	DebitAccountID  string
+	CreditAccountID string
+	Amount          float64
+	Attempts        int32
+}
+
+// Post the journal of the transaction into the outbox in the transaction of the document. Only the difference between
+// the cost of the movements and the amount already posted is written, so a changed document posts its correction and
+// a document without change posts nothing.
+func (u *Journal) Post(ctx context.Context, tx *sql.Tx) error {
+	companyID := ctx.Value(app.Ctx("companyID")).(string)
+	rows, err := tx.QueryContext(ctx, `
+		WITH current AS (
+			SELECT branch_id, type, MAX(transaction_code) code, MAX(transaction_date) transaction_date,
+				SUM(case when in_out then cost else -cost end) amount
+			FROM inventories
+			WHERE company_id = $1 AND transaction_id = $2 AND type IN ('GR', 'DR', 'OP', 'DO', 'RR')
+			GROUP BY branch_id, type
+		), posted AS (
+			SELECT branch_id, transaction_type type, MAX(transaction_code) code, MAX(transaction_date) transaction_date,
+				SUM(amount) amount
+			FROM journal_outbox
+			WHERE company_id = $1 AND transaction_id = $2
+			GROUP BY branch_id, transaction_type
+		)
+		SELECT COALESCE(current.branch_id, posted.branch_id), COALESCE(current.type, posted.type),
+			COALESCE(current.code, posted.code), COALESCE(current.transaction_date, posted.transaction_date),
+			COALESCE(current.amount, 0), COALESCE(posted.amount, 0)
+		FROM current
+		FULL JOIN posted ON current.branch_id = posted.branch_id AND current.type = posted.type`,
+		companyID, u.TransactionID,
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw journal of transaction: %v", err)
+	}
+
+	var journals []Journal
+	for rows.Next() {
+		var journal Journal
+		var current, posted float64
+		err = rows.Scan(&journal.BranchID, &journal.TransactionType, &journal.TransactionCode, &journal.TransactionDate, &current, &posted)
+		if err != nil {
+			rows.Close()
+			return status.Errorf(codes.Internal, "scan journal of transaction: %v", err)
+		}
+
+		var changed bool
+		journal.Amount, changed = journalAmount(journal.TransactionType, current, posted)
+		if !changed {
+			continue
+		}
+
+		journals = append(journals, journal)
+	}
+
+	if rows.Err() != nil {
+		rows.Close()
+		return status.Errorf(codes.Internal, "rows journal of transaction: %v", rows.Err())
+	}
+	rows.Close()
+
+	for _, journal := range journals {
+		mapping := AccountMapping{Pb: inventories.AccountMapping{Type: journal.TransactionType}}
+		found, err := mapping.getByType(ctx, tx, companyID)
+		if err != nil {
+			return err
+		}
+
+		// a journal without mapping is kept, it is sent once the mapping of its type is set
+		journalStatus := JournalUnmapped
+		if found {
+			journalStatus = JournalPending
+		}
+
+		journal.ID = uuid.New().String()
+		journal.CompanyID = companyID
+		journal.TransactionID = u.TransactionID
+		journal.DebitAccountID = mapping.Pb.GetDebitAccountId()
+		journal.CreditAccountID = mapping.Pb.GetCreditAccountId()
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO journal_outbox (id, company_id, branch_id, transaction_id, transaction_code, transaction_type,
+				transaction_date, debit_account_id, credit_account_id, amount, status, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+			journal.ID, journal.CompanyID, journal.BranchID, journal.TransactionID, journal.TransactionCode,
+			journal.TransactionType, journal.TransactionDate,
+			sql.NullString{String: journal.DebitAccountID, Valid: found}, sql.NullString{String: journal.CreditAccountID, Valid: found},
+			journal.Amount, journalStatus, time.Now().UTC(),
+		)
+		if err != nil {
+			return status.Errorf(codes.Internal, "Exec insert journal outbox: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// journalAmount the amount to post for the net cost of the movements of the type and the amount already posted, false
+// when nothing has changed since the last post
+func journalAmount(transactionType string, current float64, posted float64) (float64, bool) {
+	if !JournalTypes[transactionType] {
+		current = -current
+	}
+
+	amount := current - posted
+	if math.Abs(amount) < 0.00005 {
+		return 0, false
+	}
+
+	return amount, true
+}
+
+// Pending journals of the outbox, the oldest first. The rows are not locked while the ledger is called, a journal
+// read by two relays is booked once by the ledger as its id is the idempotency key.
+func (u *Journal) Pending(ctx context.Context, db *sql.DB, limit int) ([]Journal, error) {
+	var journals []Journal
+	err := journalOutbox.list(ctx, db, `id, company_id, branch_id, transaction_id, transaction_code, transaction_type,
+		transaction_date, debit_account_id, credit_account_id, amount, attempts`, limit,
+		func(rows *sql.Rows) error {
+			var journal Journal
+			err := rows.Scan(&journal.ID, &journal.CompanyID, &journal.BranchID, &journal.TransactionID, &journal.TransactionCode,
+				&journal.TransactionType, &journal.TransactionDate, &journal.DebitAccountID, &journal.CreditAccountID,
+				&journal.Amount, &journal.Attempts)
+			if err != nil {
+				return err
+			}
+
+			journals = append(journals, journal)
+			return nil
+		},
+	)
+
+	return journals, err
+}
+
+// MarkSent the journal is accepted by the ledger
+func (u *Journal) MarkSent(ctx context.Context, db *sql.DB) error {
+	return journalOutbox.markDone(ctx, db, u.ID)
+}
+
+// MarkFailed the journal stays pending and is retried on the next run
+func (u *Journal) MarkFailed(ctx context.Context, db *sql.DB, cause error) error {
+	return journalOutbox.markFailed(ctx, db, u.ID, cause)
+}
+
+// mapUnmappedJournals the unmapped journals of the type take the accounts of the mapping and become pending
+func mapUnmappedJournals(ctx context.Context, tx *sql.Tx, companyID string, transactionType string, debitAccountID string, creditAccountID string) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE journal_outbox SET debit_account_id = $1, credit_account_id = $2, status = $3
+		WHERE company_id = $4 AND transaction_type = $5 AND status = $6`,
+		debitAccountID, creditAccountID, JournalPending, companyID, transactionType, JournalUnmapped,
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec map unmapped journals: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package model
+
+import "testing"
+
+func TestJournalAmount(t *testing.T) {
+	tests := []struct {
+		name            string
+		transactionType string
+		current         float64
+		posted          float64
+		amount          float64
+		changed         bool
+	}{
+		{"receive posted first", "GR", 1500, 0, 1500, true},
+		{"receive without change", "GR", 1500, 1500, 0, false},
+		{"receive with more cost", "GR", 1800, 1500, 300, true},
+		{"receive cancelled", "GR", 0, 1500, -1500, true},
+		{"delivery posted first", "DO", -900, 0, 900, true},
+		{"delivery with less cost", "DO", -600, 900, -300, true},
+		{"delivery cancelled", "DO", 0, 900, -900, true},
+		{"adjustment out", "OP", -250, 0, -250, true},
+		{"rounding left behind", "RR", -100.00001, 100, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount, changed := journalAmount(tt.transactionType, tt.current, tt.posted)
+			if changed != tt.changed {
+				t.Fatalf("changed = %v, want %v", changed, tt.changed)
+			}
+
+			if changed && amount != tt.amount {
+				t.Errorf("amount = %v, want %v", amount, tt.amount)
+			}
+		})
+	}
+}
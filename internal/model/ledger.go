@@ -0,0 +1,50 @@
+package model
+
+import (
+	"context"
+	"math"
+
+	"github.com/jacky-htg/erp-proto/go/pb/ledgers"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Ledger struct
+type Ledger struct {
+	JournalClient ledgers.JournalServiceClient
+}
+
+// Post the journal to the general ledger service. The outbox id is the reference of the journal and the idempotency key
+// of the call, the ledger ignores a key it already booked so a journal resent after a lost response is booked once.
+func (u *Ledger) Post(ctx context.Context, journal *Journal) error {
+	ctx = metadata.AppendToOutgoingContext(ctx, "idempotency-key", journal.ID)
+
+	debit, credit := journal.DebitAccountID, journal.CreditAccountID
+	if journal.Amount < 0 {
+		debit, credit = credit, debit
+	}
+	amount := math.Abs(journal.Amount)
+
+	_, err := u.JournalClient.Create(ctx, &ledgers.Journal{
+		CompanyId:       journal.CompanyID,
+		BranchId:        journal.BranchID,
+		ReferenceId:     journal.ID,
+		Code:            journal.TransactionCode,
+		TransactionDate: journal.TransactionDate.Format("2006-01-02T15:04:05.000Z"),
+		Note:            "Inventory " + journal.TransactionType + " " + journal.TransactionCode,
+		Details: []*ledgers.JournalDetail{
+			{AccountId: debit, Debit: amount},
+			{AccountId: credit, Credit: amount},
+		},
+	})
+	if err != nil {
+		if s, ok := status.FromError(err); !ok || s.Code() == codes.Unknown {
+			err = status.Errorf(codes.Internal, "Error when calling ledger.Create service: %s", err)
+		}
+
+		return err
+	}
+
+	return nil
+}
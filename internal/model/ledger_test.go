@@ -0,0 +1,98 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jacky-htg/erp-proto/go/pb/ledgers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fakeJournalClient keep the journals created on the ledger, the other calls of the client are not used
+type fakeJournalClient struct {
+	ledgers.JournalServiceClient
+	err      error
+	journals []*ledgers.Journal
+	keys     []string
+}
+
+func (u *fakeJournalClient) Create(ctx context.Context, in *ledgers.Journal, opts ...grpc.CallOption) (*ledgers.Journal, error) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	u.keys = append(u.keys, md.Get("idempotency-key")...)
+	if u.err != nil {
+		return nil, u.err
+	}
+
+	u.journals = append(u.journals, in)
+	return in, nil
+}
+
+func TestLedgerPost(t *testing.T) {
+	journal := Journal{
+		ID:              "journal-1",
+		CompanyID:       "company-1",
+		BranchID:        "branch-1",
+		TransactionCode: "GR2400000001",
+		TransactionType: "GR",
+		TransactionDate: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		DebitAccountID:  "inventory",
+		CreditAccountID: "payable",
+	}
+
+	tests := []struct {
+		name   string
+		amount float64
+		debit  string
+		credit string
+	}{
+		{"positive amount books the mapping", 1500, "inventory", "payable"},
+		{"negative amount reverts the mapping", -300, "payable", "inventory"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeJournalClient{}
+			ledger := Ledger{JournalClient: client}
+			journal.Amount = tt.amount
+
+			err := ledger.Post(context.Background(), &journal)
+			if err != nil {
+				t.Fatalf("post: %v", err)
+			}
+
+			if len(client.keys) != 1 || client.keys[0] != journal.ID {
+				t.Errorf("idempotency key = %v, want %s", client.keys, journal.ID)
+			}
+
+			details := client.journals[0].GetDetails()
+			if details[0].GetAccountId() != tt.debit || details[1].GetAccountId() != tt.credit {
+				t.Errorf("accounts = %s/%s, want %s/%s", details[0].GetAccountId(), details[1].GetAccountId(), tt.debit, tt.credit)
+			}
+
+			if details[0].GetDebit() <= 0 || details[0].GetDebit() != details[1].GetCredit() {
+				t.Errorf("debit %v and credit %v must be the same positive amount", details[0].GetDebit(), details[1].GetCredit())
+			}
+		})
+	}
+}
+
+func TestLedgerPostError(t *testing.T) {
+	client := &fakeJournalClient{err: errors.New("connection refused")}
+	ledger := Ledger{JournalClient: client}
+
+	err := ledger.Post(context.Background(), &Journal{ID: "journal-1", Amount: 100})
+	if status.Code(err) != codes.Internal {
+		t.Errorf("code = %v, want %v", status.Code(err), codes.Internal)
+	}
+
+	client.err = status.Error(codes.Unavailable, "ledger is down")
+	err = ledger.Post(context.Background(), &Journal{ID: "journal-1", Amount: 100})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("code = %v, want %v", status.Code(err), codes.Unavailable)
+	}
+}
@@ -0,0 +1,128 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Lot struct
+type Lot struct {
+	Pb inventories.Lot
+}
+
+// Get func
+func (u *Lot) Get(ctx context.Context, db *sql.DB) error {
+	query := `
+		SELECT id, company_id, product_id, code, expired_date, created_at, created_by, updated_at, updated_by
+		FROM lots WHERE id = $1
+	`
+
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare statement Get lot: %v", err)
+	}
+	defer stmt.Close()
+
+	var companyID string
+	var expiredDate sql.NullTime
+	var createdAt, updatedAt time.Time
+	err = stmt.QueryRowContext(ctx, u.Pb.GetId()).Scan(
+		&u.Pb.Id, &companyID, &u.Pb.ProductId, &u.Pb.Code, &expiredDate, &createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy,
+	)
+
+	if err == sql.ErrNoRows {
+		return status.Errorf(codes.NotFound, "Query Raw get lot: %v", err)
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw get lot: %v", err)
+	}
+
+	if companyID != ctx.Value(app.Ctx("companyID")).(string) {
+		return status.Error(codes.Unauthenticated, "its not your company data")
+	}
+
+	if expiredDate.Valid {
+		u.Pb.ExpiredDate = expiredDate.Time.String()
+	}
+	u.Pb.CreatedAt = createdAt.String()
+	u.Pb.UpdatedAt = updatedAt.String()
+
+	return nil
+}
+
+// GetOrCreate lot by product and code, a received lot number is registered on its first receive
+func (u *Lot) GetOrCreate(ctx context.Context, tx *sql.Tx) error {
+	var expiredDate sql.NullTime
+	if len(u.Pb.GetExpiredDate()) > 0 {
+		date, err := time.Parse("2006-01-02T15:04:05.000Z", u.Pb.GetExpiredDate())
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "convert lot expired date: %v", err)
+		}
+		expiredDate = sql.NullTime{Time: date, Valid: true}
+	}
+
+	var existingExpiredDate sql.NullTime
+	err := tx.QueryRowContext(ctx, `SELECT id, expired_date FROM lots WHERE company_id = $1 AND product_id = $2 AND code = $3`,
+		ctx.Value(app.Ctx("companyID")).(string), u.Pb.GetProductId(), u.Pb.GetCode(),
+	).Scan(&u.Pb.Id, &existingExpiredDate)
+
+	if err == nil {
+		if expiredDate.Valid && existingExpiredDate.Valid && !expiredDate.Time.Equal(existingExpiredDate.Time) {
+			return status.Errorf(codes.InvalidArgument, "lot %s already registered with other expired date", u.Pb.GetCode())
+		}
+
+		return nil
+	}
+
+	if err != sql.ErrNoRows {
+		return status.Errorf(codes.Internal, "Query Raw get lot by code: %v", err)
+	}
+
+	u.Pb.Id = uuid.New().String()
+	now := time.Now().UTC()
+	u.Pb.CreatedBy = ctx.Value(app.Ctx("userID")).(string)
+	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+
+	query := `
+		INSERT INTO lots (id, company_id, product_id, code, expired_date, created_at, created_by, updated_at, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare insert lot: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx,
+		u.Pb.GetId(),
+		ctx.Value(app.Ctx("companyID")).(string),
+		u.Pb.GetProductId(),
+		u.Pb.GetCode(),
+		expiredDate,
+		now,
+		u.Pb.GetCreatedBy(),
+		now,
+		u.Pb.GetUpdatedBy(),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec insert lot: %v", err)
+	}
+
+	u.Pb.CreatedAt = now.String()
+	u.Pb.UpdatedAt = now.String()
+
+	return nil
+}
+
+// nullLot lot reference of a detail or an inventory, empty when the product is not received by lot
+func nullLot(lotID string) sql.NullString {
+	return sql.NullString{String: lotID, Valid: len(lotID) > 0}
+}
@@ -0,0 +1,145 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/inventory-service/internal/schema"
+
+	// postgres driver
+	_ "github.com/lib/pq"
+)
+
+// openTestDB the migrated test database, the tests on the database are skipped when POSTGRES_TEST_DSN is not set
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if len(dsn) == 0 {
+		t.Skip("POSTGRES_TEST_DSN is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	err = schema.Migrate(db)
+	if err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+
+	return db
+}
+
+// testProduct a serialized product of a new company and a shelve of its branch, ctx is of a user of the company
+type testProduct struct {
+	ctx       context.Context
+	companyID string
+	userID    string
+	branchID  string
+	shelveID  string
+	productID string
+}
+
+func newTestProduct(t *testing.T, db *sql.DB) testProduct {
+	t.Helper()
+
+	companyID, userID := uuid.New().String(), uuid.New().String()
+	u := testProduct{
+		companyID: companyID,
+		userID:    userID,
+		branchID:  uuid.New().String(),
+		shelveID:  uuid.New().String(),
+		productID: uuid.New().String(),
+	}
+	u.ctx = context.WithValue(context.WithValue(context.Background(), app.Ctx("companyID"), companyID), app.Ctx("userID"), userID)
+
+	categoryID, productCategoryID, brandID, warehouseID := uuid.New().String(), uuid.New().String(), uuid.New().String(), uuid.New().String()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		`INSERT INTO categories (id, name) VALUES ($3, $3)`,
+		`INSERT INTO product_categories (id, company_id, category_id, name, created_by, updated_by) VALUES ($4, $1, $3, 'Test', $2, $2)`,
+		`INSERT INTO brands (id, company_id, code, name, created_by, updated_by) VALUES ($5, $1, 'TEST', 'Test', $2, $2)`,
+		`INSERT INTO products (id, company_id, brand_id, product_category_id, code, name, minimum_stock, created_by, updated_by)
+			VALUES ($6, $1, $5, $4, 'TEST', 'Test', 0, $2, $2)`,
+		`INSERT INTO warehouses (id, company_id, branch_id, branch_name, code, name, pic_name, pic_phone, created_by, updated_by)
+			VALUES ($7, $1, $8, 'Test', 'TEST', 'Test', 'Test', '0', $2, $2)`,
+		`INSERT INTO shelves (id, warehouse_id, code, capacity, created_by, updated_by) VALUES ($9, $7, 'TEST', 100, $2, $2)`,
+	} {
+		_, err = tx.Exec(query, companyID, userID, categoryID, productCategoryID, brandID, u.productID, warehouseID, u.branchID, u.shelveID)
+		if err != nil {
+			t.Fatalf("seed %s: %v", query, err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		t.Fatalf("commit seed: %v", err)
+	}
+
+	return u
+}
+
+// receive units of the product on the shelve, the barcodes of the units are returned
+func (u testProduct) receive(t *testing.T, db *sql.DB, units int) []string {
+	t.Helper()
+
+	var barcodes []string
+	err := inTx(u.ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		for i := 0; i < units; i++ {
+			inventory := Inventory{
+				BranchID:        u.branchID,
+				ProductID:       u.productID,
+				Barcode:         uuid.New().String(),
+				TransactionID:   uuid.New().String(),
+				TransactionCode: "GR24000000001",
+				TransactionDate: time.Now().UTC(),
+				Type:            "GR",
+				IsIn:            true,
+				ShelveID:        u.shelveID,
+				Qty:             1,
+			}
+			err := inventory.Create(ctx, tx)
+			if err != nil {
+				return err
+			}
+
+			barcodes = append(barcodes, inventory.Barcode)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("receive units: %v", err)
+	}
+
+	return barcodes
+}
+
+// inTx run fn in a transaction, committed when fn succeeds
+func inTx(ctx context.Context, db *sql.DB, fn func(ctx context.Context, tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	err = fn(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
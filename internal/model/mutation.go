@@ -0,0 +1,304 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-pkg/util"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Mutation struct
+type Mutation struct {
+	Pb inventories.Mutation
+}
+
+// Get func
+func (u *Mutation) Get(ctx context.Context, db *sql.DB) error {
+	query := `
+		SELECT shelve_mutations.id, shelve_mutations.company_id, shelve_mutations.branch_id, shelve_mutations.branch_name, shelve_mutations.code,
+		shelve_mutations.mutation_date, shelve_mutations.remark, shelve_mutations.created_at, shelve_mutations.created_by, shelve_mutations.updated_at, shelve_mutations.updated_by,
+		json_agg(DISTINCT jsonb_build_object(
+			'id', shelve_mutation_details.id,
+			'mutation_id', shelve_mutation_details.shelve_mutation_id,
+			'product_id', shelve_mutation_details.product_id,
+			'product_name', products.name,
+			'product_code', products.code,
+			'barcode', shelve_mutation_details.barcode,
+			'from_shelve_id', shelve_mutation_details.from_shelve_id,
+			'from_shelve_code', from_shelves.code,
+			'to_shelve_id', shelve_mutation_details.to_shelve_id,
+			'to_shelve_code', to_shelves.code
+		)) as details
+		FROM shelve_mutations
+		JOIN shelve_mutation_details ON shelve_mutations.id = shelve_mutation_details.shelve_mutation_id
+		JOIN products ON shelve_mutation_details.product_id = products.id
+		JOIN shelves from_shelves ON shelve_mutation_details.from_shelve_id = from_shelves.id
+		JOIN shelves to_shelves ON shelve_mutation_details.to_shelve_id = to_shelves.id
+		WHERE shelve_mutations.id = $1
+		GROUP BY shelve_mutations.id
+	`
+
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare statement Get mutation: %v", err)
+	}
+	defer stmt.Close()
+
+	var dateMutation, createdAt, updatedAt time.Time
+	var companyID, details string
+	err = stmt.QueryRowContext(ctx, u.Pb.GetId()).Scan(
+		&u.Pb.Id, &companyID, &u.Pb.BranchId, &u.Pb.BranchName, &u.Pb.Code, &dateMutation, &u.Pb.Remark,
+		&createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy, &details,
+	)
+
+	if err == sql.ErrNoRows {
+		return status.Errorf(codes.NotFound, "Query Raw get mutation: %v", err)
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw get mutation: %v", err)
+	}
+
+	if companyID != ctx.Value(app.Ctx("companyID")).(string) {
+		return status.Error(codes.Unauthenticated, "its not your company")
+	}
+
+	u.Pb.MutationDate = dateMutation.String()
+	u.Pb.CreatedAt = createdAt.String()
+	u.Pb.UpdatedAt = updatedAt.String()
+
+	detailMutations := []struct {
+		ID             string
+		MutationID     string `json:"mutation_id"`
+		ProductID      string `json:"product_id"`
+		ProductName    string `json:"product_name"`
+		ProductCode    string `json:"product_code"`
+		Barcode        string
+		FromShelveID   string `json:"from_shelve_id"`
+		FromShelveCode string `json:"from_shelve_code"`
+		ToShelveID     string `json:"to_shelve_id"`
+		ToShelveCode   string `json:"to_shelve_code"`
+	}{}
+	err = json.Unmarshal([]byte(details), &detailMutations)
+	if err != nil {
+		return status.Errorf(codes.Internal, "unmarshal detailMutations: %v", err)
+	}
+
+	for _, detail := range detailMutations {
+		u.Pb.Details = append(u.Pb.Details, &inventories.MutationDetail{
+			Id:         detail.ID,
+			MutationId: detail.MutationID,
+			Barcode:    detail.Barcode,
+			Product: &inventories.Product{
+				Id:   detail.ProductID,
+				Code: detail.ProductCode,
+				Name: detail.ProductName,
+			},
+			FromShelve: &inventories.Shelve{
+				Id:   detail.FromShelveID,
+				Code: detail.FromShelveCode,
+			},
+			ToShelve: &inventories.Shelve{
+				Id:   detail.ToShelveID,
+				Code: detail.ToShelveCode,
+			},
+		})
+	}
+
+	return nil
+}
+
+// Create Mutation
+func (u *Mutation) Create(ctx context.Context, tx *sql.Tx) error {
+	u.Pb.Id = uuid.New().String()
+	now := time.Now().UTC()
+	u.Pb.CreatedBy = ctx.Value(app.Ctx("userID")).(string)
+	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+	dateMutation, err := time.Parse("2006-01-02T15:04:05.000Z", u.Pb.GetMutationDate())
+	if err != nil {
+		return status.Errorf(codes.Internal, "convert Date: %v", err)
+	}
+
+	u.Pb.Code, err = util.GetCode(ctx, tx, "shelve_mutations", "MU")
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO shelve_mutations (id, company_id, branch_id, branch_name, code, mutation_date, remark, created_at, created_by, updated_at, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare insert mutation: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx,
+		u.Pb.GetId(),
+		ctx.Value(app.Ctx("companyID")).(string),
+		u.Pb.GetBranchId(),
+		u.Pb.GetBranchName(),
+		u.Pb.GetCode(),
+		dateMutation,
+		u.Pb.GetRemark(),
+		now,
+		u.Pb.GetCreatedBy(),
+		now,
+		u.Pb.GetUpdatedBy(),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec insert mutation: %v", err)
+	}
+
+	u.Pb.CreatedAt = now.String()
+	u.Pb.UpdatedAt = u.Pb.CreatedAt
+
+	err = writeDocumentEvent(ctx, tx, "mutation", EventCreated, u.Pb, u.Pb.GetMutationDate())
+	if err != nil {
+		return err
+	}
+
+	for _, detail := range u.Pb.GetDetails() {
+		mutationDetailModel := MutationDetail{}
+		mutationDetailModel.Pb = inventories.MutationDetail{
+			MutationId: u.Pb.GetId(),
+			Barcode:    detail.GetBarcode(),
+			Product:    detail.GetProduct(),
+			FromShelve: detail.GetFromShelve(),
+			ToShelve:   detail.GetToShelve(),
+		}
+		mutationDetailModel.PbMutation = inventories.Mutation{
+			Id:           u.Pb.Id,
+			BranchId:     u.Pb.BranchId,
+			BranchName:   u.Pb.BranchName,
+			Code:         u.Pb.Code,
+			MutationDate: u.Pb.MutationDate,
+			Remark:       u.Pb.Remark,
+			CreatedAt:    u.Pb.CreatedAt,
+			CreatedBy:    u.Pb.CreatedBy,
+			UpdatedAt:    u.Pb.UpdatedAt,
+			UpdatedBy:    u.Pb.UpdatedBy,
+		}
+		err = mutationDetailModel.Create(ctx, tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Update Mutation
+func (u *Mutation) Update(ctx context.Context, tx *sql.Tx) error {
+	now := time.Now().UTC()
+	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+	dateMutation, err := time.Parse("2006-01-02T15:04:05.000Z", u.Pb.GetMutationDate())
+	if err != nil {
+		return status.Errorf(codes.Internal, "convert mutation date: %v", err)
+	}
+
+	query := `
+		UPDATE shelve_mutations SET
+		mutation_date = $1,
+		remark = $2,
+		updated_at = $3,
+		updated_by= $4
+		WHERE id = $5
+	`
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare update mutation: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx,
+		dateMutation,
+		u.Pb.GetRemark(),
+		now,
+		u.Pb.GetUpdatedBy(),
+		u.Pb.GetId(),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec update mutation: %v", err)
+	}
+
+	// the movements of the mutation follow the date of the document
+	_, err = tx.ExecContext(ctx, `UPDATE inventories SET transaction_date = $1 WHERE company_id = $2 AND transaction_id = $3`,
+		dateMutation, ctx.Value(app.Ctx("companyID")).(string), u.Pb.GetId())
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec update mutation inventories date: %v", err)
+	}
+
+	u.Pb.UpdatedAt = now.String()
+
+	err = writeDocumentEvent(ctx, tx, "mutation", EventUpdated, u.Pb, u.Pb.GetMutationDate())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListQuery builder
+func (u *Mutation) ListQuery(ctx context.Context, db *sql.DB, in *inventories.ListMutationRequest) (string, []interface{}, *inventories.MutationPaginationResponse, error) {
+	var paginationResponse inventories.MutationPaginationResponse
+	query := `SELECT id, company_id, branch_id, branch_name, code, mutation_date, remark, created_at, created_by, updated_at, updated_by FROM shelve_mutations`
+
+	where := []string{"company_id = $1"}
+	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string)}
+
+	if len(in.GetBranchId()) > 0 {
+		paramQueries = append(paramQueries, in.GetBranchId())
+		where = append(where, fmt.Sprintf(`branch_id = $%d`, len(paramQueries)))
+	}
+
+	if len(in.GetPagination().GetSearch()) > 0 {
+		paramQueries = append(paramQueries, "%"+in.GetPagination().GetSearch()+"%")
+		where = append(where, fmt.Sprintf(`(code ILIKE $%d OR remark ILIKE $%d)`, len(paramQueries), len(paramQueries)))
+	}
+
+	{
+		qCount := `SELECT COUNT(*) FROM shelve_mutations`
+		if len(where) > 0 {
+			qCount += " WHERE " + strings.Join(where, " AND ")
+		}
+		var count int
+		err := db.QueryRowContext(ctx, qCount, paramQueries...).Scan(&count)
+		if err != nil && err != sql.ErrNoRows {
+			return query, paramQueries, &paginationResponse, status.Error(codes.Internal, err.Error())
+		}
+
+		paginationResponse.Count = uint32(count)
+	}
+
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+
+	if len(in.GetPagination().GetOrderBy()) == 0 || !(in.GetPagination().GetOrderBy() == "code") {
+		if in.GetPagination() == nil {
+			in.Pagination = &inventories.Pagination{OrderBy: "created_at"}
+		} else {
+			in.GetPagination().OrderBy = "created_at"
+		}
+	}
+
+	query += ` ORDER BY ` + in.GetPagination().GetOrderBy() + ` ` + in.GetPagination().GetSort().String()
+
+	if in.GetPagination().GetLimit() > 0 {
+		query += fmt.Sprintf(` LIMIT $%d OFFSET $%d`, (len(paramQueries) + 1), (len(paramQueries) + 2))
+		paramQueries = append(paramQueries, in.GetPagination().GetLimit(), in.GetPagination().GetOffset())
+	}
+
+	return query, paramQueries, &paginationResponse, nil
+}
@@ -0,0 +1,155 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MutationDetail struct
+type MutationDetail struct {
+	Pb         inventories.MutationDetail
+	PbMutation inventories.Mutation
+}
+
+// Get func
+func (u *MutationDetail) Get(ctx context.Context, tx *sql.Tx) error {
+	query := `
+		SELECT shelve_mutation_details.id, shelve_mutations.company_id, shelve_mutation_details.shelve_mutation_id, shelve_mutation_details.product_id,
+		shelve_mutation_details.barcode, shelve_mutation_details.from_shelve_id, shelve_mutation_details.to_shelve_id
+		FROM shelve_mutation_details
+		JOIN shelve_mutations ON shelve_mutation_details.shelve_mutation_id = shelve_mutations.id
+		WHERE shelve_mutation_details.id = $1 AND shelve_mutation_details.shelve_mutation_id = $2
+	`
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare statement Get mutation detail: %v", err)
+	}
+	defer stmt.Close()
+
+	var pbProduct inventories.Product
+	var pbFromShelve, pbToShelve inventories.Shelve
+	var companyID string
+	err = stmt.QueryRowContext(ctx, u.Pb.GetId(), u.Pb.GetMutationId()).Scan(
+		&u.Pb.Id, &companyID, &u.Pb.MutationId, &pbProduct.Id, &u.Pb.Barcode, &pbFromShelve.Id, &pbToShelve.Id,
+	)
+
+	if err == sql.ErrNoRows {
+		return status.Errorf(codes.NotFound, "Query Raw get mutation detail: %v", err)
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw get mutation detail: %v", err)
+	}
+
+	if companyID != ctx.Value(app.Ctx("companyID")).(string) {
+		return status.Error(codes.Unauthenticated, "its not your company")
+	}
+
+	u.Pb.Product = &pbProduct
+	u.Pb.FromShelve = &pbFromShelve
+	u.Pb.ToShelve = &pbToShelve
+
+	return nil
+}
+
+// Create MutationDetail
+func (u *MutationDetail) Create(ctx context.Context, tx *sql.Tx) error {
+	u.Pb.Id = uuid.New().String()
+	unit := UnitStatus{Barcode: u.Pb.GetBarcode()}
+	err := unit.CheckOut(ctx, tx, u.Pb.GetProduct().GetId(), u.PbMutation.GetBranchId(), u.Pb.GetFromShelve().GetId(), "", false)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO shelve_mutation_details (id, shelve_mutation_id, product_id, barcode, from_shelve_id, to_shelve_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare insert mutation detail: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx,
+		u.Pb.GetId(),
+		u.Pb.GetMutationId(),
+		u.Pb.GetProduct().GetId(),
+		u.Pb.GetBarcode(),
+		u.Pb.GetFromShelve().GetId(),
+		u.Pb.GetToShelve().GetId(),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec insert mutation detail: %v", err)
+	}
+
+	transactionDate, err := time.Parse("2006-01-02T15:04:05.000Z", u.PbMutation.GetMutationDate())
+	if err != nil {
+		return status.Errorf(codes.Internal, "convert transactiondate inventory: %v", err)
+	}
+
+	// the barcode leaves the origin shelve and enters the destination shelve in the same transaction
+	inventoryOut := Inventory{
+		Barcode:         u.Pb.GetBarcode(),
+		BranchID:        u.PbMutation.GetBranchId(),
+		CompanyID:       ctx.Value(app.Ctx("companyID")).(string),
+		IsIn:            false,
+		ProductID:       u.Pb.GetProduct().GetId(),
+		ShelveID:        u.Pb.GetFromShelve().GetId(),
+		TransactionDate: transactionDate,
+		TransactionCode: u.PbMutation.GetCode(),
+		TransactionID:   u.PbMutation.GetId(),
+		Type:            "MU",
+		LotID:           unit.LotID,
+	}
+	err = inventoryOut.Create(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	inventoryIn := inventoryOut
+	inventoryIn.IsIn = true
+	inventoryIn.ShelveID = u.Pb.GetToShelve().GetId()
+	return inventoryIn.Create(ctx, tx)
+}
+
+// Delete MutationDetail
+func (u *MutationDetail) Delete(ctx context.Context, tx *sql.Tx) error {
+	stmt, err := tx.PrepareContext(ctx, `DELETE FROM shelve_mutation_details WHERE id = $1 AND shelve_mutation_id = $2`)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare delete mutation detail: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, u.Pb.GetId(), u.Pb.GetMutationId())
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec delete mutation detail: %v", err)
+	}
+
+	for _, isIn := range []bool{false, true} {
+		inventory := Inventory{
+			Barcode:       u.Pb.GetBarcode(),
+			TransactionID: u.Pb.GetMutationId(),
+			IsIn:          isIn,
+		}
+		err = inventory.GetByInOut(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		err = inventory.Delete(ctx, tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// outbox table of entries written in the transaction of a change and relayed outside of the service. The rows are
+// not locked while an entry is relayed, an entry is marked only while it is still pending.
+type outbox struct {
+	table      string
+	pending    string
+	done       string
+	doneColumn string
+}
+
+var journalOutbox = outbox{table: "journal_outbox", pending: JournalPending, done: JournalSent, doneColumn: "sent_at"}
+var eventOutbox = outbox{table: "event_outbox", pending: EventPending, done: EventPublished, doneColumn: "published_at"}
+
+// list the pending entries of the outbox, the oldest first, scan is called for each row
+func (u outbox) list(ctx context.Context, db *sql.DB, columns string, limit int, scan func(rows *sql.Rows) error) error {
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE status = $1 ORDER BY created_at LIMIT $2`, columns, u.table)
+	rows, err := db.QueryContext(ctx, query, u.pending, limit)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw pending %s: %v", u.table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		err = scan(rows)
+		if err != nil {
+			return status.Errorf(codes.Internal, "scan pending %s: %v", u.table, err)
+		}
+	}
+
+	if rows.Err() != nil {
+		return status.Errorf(codes.Internal, "rows pending %s: %v", u.table, rows.Err())
+	}
+
+	return nil
+}
+
+// markDone the entry is accepted outside of the service
+func (u outbox) markDone(ctx context.Context, db *sql.DB, id string) error {
+	query := fmt.Sprintf(`
+		UPDATE %s SET status = $1, attempts = attempts + 1, last_error = NULL, %s = $2 WHERE id = $3 AND status = $4`,
+		u.table, u.doneColumn)
+	_, err := db.ExecContext(ctx, query, u.done, time.Now().UTC(), id, u.pending)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec mark %s done: %v", u.table, err)
+	}
+
+	return nil
+}
+
+// markFailed the entry stays pending and is retried on the next run
+func (u outbox) markFailed(ctx context.Context, db *sql.DB, id string, cause error) error {
+	query := fmt.Sprintf(`UPDATE %s SET attempts = attempts + 1, last_error = $1 WHERE id = $2 AND status = $3`, u.table)
+	_, err := db.ExecContext(ctx, query, cause.Error(), id, u.pending)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec mark %s failed: %v", u.table, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,216 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Pick struct
+type Pick struct {
+	Method string
+	Pb     inventories.SuggestPicksResponse
+}
+
+// Suggest picks of a product in a branch. FEFO takes the units expiring soonest first,
+// FIFO takes the units received earliest first. When the branch has not enough stock
+// the picks cover what is available and the rest is reported as shortage. The stock reserved
+// for the other sales orders is not available.
+func (u *Pick) Suggest(ctx context.Context, db *sql.DB, in *inventories.SuggestPicksRequest, trackingMode string) error {
+	reservationModel := Reservation{}
+	reservationModel.Pb = inventories.Reservation{BranchId: in.GetBranchId(), ProductId: in.GetProductId(), SalesOrderId: in.GetSalesOrderId()}
+	reserved, err := reservationModel.reservedByOther(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	var stock int32
+	err = db.QueryRowContext(ctx, `SELECT COALESCE(stock_branch($1, $2, $3), 0)`,
+		ctx.Value(app.Ctx("companyID")).(string), in.GetBranchId(), in.GetProductId(),
+	).Scan(&stock)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw branch stock: %v", err)
+	}
+
+	qty := in.GetQty()
+	if stock-reserved < qty {
+		qty = stock - reserved
+	}
+
+	if qty < 0 {
+		qty = 0
+	}
+
+	if trackingMode == TrackingQuantity {
+		err = u.suggestQuantity(ctx, db, in, qty)
+	} else {
+		err = u.suggestSerial(ctx, db, in, qty)
+	}
+	if err != nil {
+		return err
+	}
+
+	u.Pb.Shortage += in.GetQty() - qty
+
+	return nil
+}
+
+// suggestSerial one pick per barcode, the barcodes in the branch are the ones whose latest movement is an in movement.
+// A barcode reserved for another sales order is not suggested.
+func (u *Pick) suggestSerial(ctx context.Context, db *sql.DB, in *inventories.SuggestPicksRequest, qty int32) error {
+	order := `received.transaction_date NULLS LAST, latest.barcode`
+	if u.Method == PickFEFO {
+		order = `COALESCE(lots.expired_date, receive_details.expired_date) NULLS LAST, ` + order
+	}
+
+	query := `
+		WITH latest AS (
+			SELECT DISTINCT ON (inventories.barcode) inventories.barcode, inventories.branch_id,
+				inventories.shelve_id, inventories.in_out, inventories.lot_id
+			FROM inventories
+			WHERE inventories.company_id = $1 AND inventories.product_id = $2
+			ORDER BY inventories.barcode, inventories.transaction_date DESC, inventories.created_at DESC
+		), received AS (
+			SELECT inventories.barcode, MIN(inventories.transaction_date) transaction_date
+			FROM inventories
+			WHERE inventories.company_id = $1 AND inventories.product_id = $2 AND inventories.type = 'GR'
+			GROUP BY inventories.barcode
+		)
+		SELECT latest.barcode, latest.shelve_id, shelves.code, COALESCE(latest.lot_id, ''), COALESCE(lots.code, ''),
+			COALESCE(lots.expired_date, receive_details.expired_date), received.transaction_date
+		FROM latest
+		JOIN shelves ON latest.shelve_id = shelves.id
+		LEFT JOIN lots ON latest.lot_id = lots.id
+		LEFT JOIN receive_details ON latest.barcode = receive_details.id
+		LEFT JOIN received ON latest.barcode = received.barcode
+		WHERE latest.in_out AND latest.branch_id = $3 AND NOT EXISTS (
+			SELECT 1 FROM reservations
+			WHERE reservations.company_id = $1 AND reservations.barcode = latest.barcode AND reservations.status = $5
+				AND reservations.expired_at > $6 AND reservations.sales_order_id <> $7
+		)
+		ORDER BY ` + order + `
+		LIMIT $4
+	`
+
+	rows, err := db.QueryContext(ctx, query, ctx.Value(app.Ctx("companyID")).(string), in.GetProductId(), in.GetBranchId(), qty,
+		ReservationActive, time.Now().UTC(), in.GetSalesOrderId())
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw suggest picks: %v", err)
+	}
+	defer rows.Close()
+
+	remaining := qty
+	for rows.Next() {
+		var pbPick inventories.Pick
+		var pbShelve inventories.Shelve
+		var lotID, lotCode string
+		var expiredDate, receiveDate sql.NullTime
+		err = rows.Scan(&pbPick.Barcode, &pbShelve.Id, &pbShelve.Code, &lotID, &lotCode, &expiredDate, &receiveDate)
+		if err != nil {
+			return status.Errorf(codes.Internal, "scan suggest picks: %v", err)
+		}
+
+		pbPick.Shelve = &pbShelve
+		pbPick.Qty = 1
+		setPickDates(&pbPick, lotID, lotCode, expiredDate, receiveDate)
+		u.Pb.Picks = append(u.Pb.Picks, &pbPick)
+		remaining--
+	}
+
+	if rows.Err() != nil {
+		return status.Errorf(codes.Internal, "rows suggest picks: %v", rows.Err())
+	}
+
+	u.Pb.Shortage = remaining
+
+	return nil
+}
+
+// suggestQuantity picks per shelve and lot, the qty is taken from the balances in pick order
+func (u *Pick) suggestQuantity(ctx context.Context, db *sql.DB, in *inventories.SuggestPicksRequest, qty int32) error {
+	order := `MIN(case when inventories.type = 'GR' then inventories.transaction_date end) NULLS LAST, shelves.code`
+	if u.Method == PickFEFO {
+		order = `lots.expired_date NULLS LAST, ` + order
+	}
+
+	query := `
+		SELECT inventories.shelve_id, shelves.code, COALESCE(inventories.lot_id, ''), COALESCE(lots.code, ''), lots.expired_date,
+			MIN(case when inventories.type = 'GR' then inventories.transaction_date end),
+			SUM(
+				case
+					when inventories.in_out then inventories.qty
+					else -inventories.qty
+				end
+			) qty
+		FROM inventories
+		JOIN shelves ON inventories.shelve_id = shelves.id
+		LEFT JOIN lots ON inventories.lot_id = lots.id
+		WHERE inventories.company_id = $1 AND inventories.product_id = $2 AND inventories.branch_id = $3
+		GROUP BY inventories.shelve_id, shelves.code, inventories.lot_id, lots.code, lots.expired_date
+		HAVING SUM(
+			case
+				when inventories.in_out then inventories.qty
+				else -inventories.qty
+			end
+		) > 0
+		ORDER BY ` + order
+
+	rows, err := db.QueryContext(ctx, query, ctx.Value(app.Ctx("companyID")).(string), in.GetProductId(), in.GetBranchId())
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw suggest picks: %v", err)
+	}
+	defer rows.Close()
+
+	remaining := qty
+	for rows.Next() && remaining > 0 {
+		var pbPick inventories.Pick
+		var pbShelve inventories.Shelve
+		var lotID, lotCode string
+		var expiredDate, receiveDate sql.NullTime
+		var balance int32
+		err = rows.Scan(&pbShelve.Id, &pbShelve.Code, &lotID, &lotCode, &expiredDate, &receiveDate, &balance)
+		if err != nil {
+			return status.Errorf(codes.Internal, "scan suggest picks: %v", err)
+		}
+
+		if balance > remaining {
+			balance = remaining
+		}
+
+		pbPick.Shelve = &pbShelve
+		pbPick.Qty = balance
+		setPickDates(&pbPick, lotID, lotCode, expiredDate, receiveDate)
+		u.Pb.Picks = append(u.Pb.Picks, &pbPick)
+		remaining -= balance
+	}
+
+	if rows.Err() != nil {
+		return status.Errorf(codes.Internal, "rows suggest picks: %v", rows.Err())
+	}
+
+	u.Pb.Shortage = remaining
+
+	return nil
+}
+
+func setPickDates(pbPick *inventories.Pick, lotID string, lotCode string, expiredDate sql.NullTime, receiveDate sql.NullTime) {
+	if len(lotID) > 0 {
+		pbPick.Lot = &inventories.Lot{Id: lotID, Code: lotCode}
+	}
+
+	if expiredDate.Valid {
+		pbPick.ExpiredDate = expiredDate.Time.String()
+		if pbPick.Lot != nil {
+			pbPick.Lot.ExpiredDate = pbPick.ExpiredDate
+		}
+	}
+
+	if receiveDate.Valid {
+		pbPick.ReceiveDate = receiveDate.Time.String()
+	}
+}
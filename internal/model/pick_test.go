@@ -0,0 +1,47 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+)
+
+func TestSuggestLeavesStockReservedForOtherOrders(t *testing.T) {
+	db := openTestDB(t)
+	product := newTestProduct(t, db)
+	product.receive(t, db, 3)
+
+	err := inTx(product.ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		return product.reserve(ctx, tx, uuid.New().String(), "", 2)
+	})
+	if err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+
+	for _, trackingMode := range []string{TrackingSerial, TrackingQuantity} {
+		t.Run(trackingMode, func(t *testing.T) {
+			pick := Pick{Method: PickFIFO}
+			err := pick.Suggest(product.ctx, db, &inventories.SuggestPicksRequest{
+				BranchId:     product.branchID,
+				ProductId:    product.productID,
+				SalesOrderId: uuid.New().String(),
+				Qty:          2,
+			}, trackingMode)
+			if err != nil {
+				t.Fatalf("suggest: %v", err)
+			}
+
+			var picked int32
+			for _, p := range pick.Pb.GetPicks() {
+				picked += p.GetQty()
+			}
+
+			if picked != 1 || pick.Pb.GetShortage() != 1 {
+				t.Errorf("picked %d with shortage %d, want 1 and 1", picked, pick.Pb.GetShortage())
+			}
+		})
+	}
+}
@@ -15,6 +15,12 @@ import (
 	"google.golang.org/grpc/status"
 )
 
+// Product tracking mode, serialized products move one barcode per unit, quantity products move a qty per line
+const (
+	TrackingSerial   = "SERIAL"
+	TrackingQuantity = "QUANTITY"
+)
+
 // Product struct
 type Product struct {
 	Pb             inventories.Product
@@ -27,7 +33,7 @@ func (u *Product) Get(ctx context.Context, db *sql.DB) error {
 		SELECT products.id, products.company_id, 
 			brands.id, brands.code, brands.name,
 			product_categories.id, product_categories.name,
-			products.code, products.name, products.minimum_stock, 
+			products.code, products.name, products.minimum_stock, products.tracking_mode, 
 			products.created_at, products.created_by, products.updated_at, products.updated_by 
 		FROM products 
 		JOIN brands ON products.brand_id = brands.id AND products.company_id = brands.company_id
@@ -49,7 +55,7 @@ func (u *Product) Get(ctx context.Context, db *sql.DB) error {
 		&u.Pb.Id, &companyID,
 		&pbBrand.Id, &pbBrand.Code, &pbBrand.Name,
 		&pbProductCategory.Id, &pbProductCategory.Name,
-		&u.Pb.Code, &u.Pb.Name, &u.Pb.MinimumStock,
+		&u.Pb.Code, &u.Pb.Name, &u.Pb.MinimumStock, &u.Pb.TrackingMode,
 		&createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy,
 	)
 
@@ -80,7 +86,7 @@ func (u *Product) GetByCode(ctx context.Context, db *sql.DB) error {
 		SELECT products.id, products.company_id, 
 			brands.id, brands.code, brands.name,
 			product_categories.id, product_categories.name,
-			products.code, products.name, products.minimum_stock, 
+			products.code, products.name, products.minimum_stock, products.tracking_mode, 
 			products.created_at, products.created_by, products.updated_at, products.updated_by 
 		FROM products 
 		JOIN brands ON products.brand_id = brands.id AND products.company_id = brands.company_id
@@ -102,7 +108,7 @@ func (u *Product) GetByCode(ctx context.Context, db *sql.DB) error {
 		&u.Pb.Id, &companyID,
 		&pbBrand.Id, &pbBrand.Code, &pbBrand.Name,
 		&pbProductCategory.Id, &pbProductCategory.Name,
-		&u.Pb.Code, &u.Pb.Name, &u.Pb.MinimumStock,
+		&u.Pb.Code, &u.Pb.Name, &u.Pb.MinimumStock, &u.Pb.TrackingMode,
 		&createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy,
 	)
 
@@ -124,17 +130,17 @@ func (u *Product) GetByCode(ctx context.Context, db *sql.DB) error {
 }
 
 // Create Product
-func (u *Product) Create(ctx context.Context, db *sql.DB) error {
+func (u *Product) Create(ctx context.Context, tx *sql.Tx) error {
 	u.Pb.Id = uuid.New().String()
 	now := time.Now().UTC()
 	u.Pb.CreatedBy = ctx.Value(app.Ctx("userID")).(string)
 	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
 
 	query := `
-		INSERT INTO products (id, company_id, brand_id, product_category_id, code, name, minimum_stock, created_at, created_by, updated_at, updated_by) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		INSERT INTO products (id, company_id, brand_id, product_category_id, code, name, minimum_stock, tracking_mode, created_at, created_by, updated_at, updated_by) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 	`
-	stmt, err := db.PrepareContext(ctx, query)
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare insert product: %v", err)
 	}
@@ -148,6 +154,7 @@ func (u *Product) Create(ctx context.Context, db *sql.DB) error {
 		u.Pb.GetCode(),
 		u.Pb.GetName(),
 		u.Pb.GetMinimumStock(),
+		u.Pb.GetTrackingMode(),
 		now,
 		u.Pb.GetCreatedBy(),
 		now,
@@ -164,7 +171,7 @@ func (u *Product) Create(ctx context.Context, db *sql.DB) error {
 }
 
 // Update Product
-func (u *Product) Update(ctx context.Context, db *sql.DB) error {
+func (u *Product) Update(ctx context.Context, tx *sql.Tx) error {
 	now := time.Now().UTC()
 	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
 
@@ -178,7 +185,7 @@ func (u *Product) Update(ctx context.Context, db *sql.DB) error {
 		updated_by= $6
 		WHERE id = $7
 	`
-	stmt, err := db.PrepareContext(ctx, query)
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare update product: %v", err)
 	}
@@ -203,8 +210,8 @@ func (u *Product) Update(ctx context.Context, db *sql.DB) error {
 }
 
 // Delete Product
-func (u *Product) Delete(ctx context.Context, db *sql.DB) error {
-	stmt, err := db.PrepareContext(ctx, `DELETE FROM products WHERE company_id = $1 AND id = $2`)
+func (u *Product) Delete(ctx context.Context, tx *sql.Tx) error {
+	stmt, err := tx.PrepareContext(ctx, `DELETE FROM products WHERE company_id = $1 AND id = $2`)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare delete product: %v", err)
 	}
@@ -225,7 +232,7 @@ func (u *Product) ListQuery(ctx context.Context, db *sql.DB, in *inventories.Lis
 		SELECT products.id, products.company_id, 
 			brands.id, brands.code, brands.name,
 			product_categories.id, product_categories.name,
-			products.code, products.name, products.minimum_stock, 
+			products.code, products.name, products.minimum_stock, products.tracking_mode, 
 			products.created_at, products.created_by, products.updated_at, products.updated_by 
 		FROM products 
 		JOIN brands ON products.brand_id = brands.id AND products.company_id = brands.company_id
@@ -294,23 +301,33 @@ func (u *Product) ListQuery(ctx context.Context, db *sql.DB, in *inventories.Lis
 	return query, paramQueries, &paginationResponse, nil
 }
 
+// transactionSelect and transactionJoin are the columns and joins of an inventory movement, shared by product track and stock card
+const transactionSelect string = `
+	inventories.branch_id, warehouses.branch_name, shelves.warehouse_id, warehouses.name, inventories.shelve_id, 
+	shelves.code, inventories.product_id, inventories.barcode, inventories.transaction_code,
+	inventories.type, inventories.transaction_date, inventories.in_out, inventories.qty,
+	COALESCE(inventories.lot_id, ''), COALESCE(lots.code, '')
+`
+
+const transactionJoin string = `
+	FROM inventories
+	JOIN shelves ON inventories.shelve_id = shelves.id
+	JOIN warehouses ON shelves.warehouse_id = warehouses.id 
+	LEFT JOIN lots ON inventories.lot_id = lots.id
+`
+
 // Track Product History
 func (u *Product) Track(ctx context.Context, db *sql.DB) error {
-	query := `
-		SELECT
-			inventories.branch_id, warehouses.branch_name, shelves.warehouse_id, warehouses.name, inventories.shelve_id, 
-			shelves.code, inventories.product_id, inventories.barcode, inventories.transaction_code,
-			inventories.type, inventories.transaction_date, inventories.in_out
-		FROM inventories
-		JOIN shelves ON inventories.shelve_id = shelves.id
-		JOIN warehouses ON shelves.warehouse_id = warehouses.id 
-	`
+	query := `SELECT ` + transactionSelect + transactionJoin
 	where := []string{"inventories.company_id = $1", "inventories.product_id = $2"}
 	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string), u.Pb.Id}
 
 	if len(where) > 0 {
 		query += ` WHERE ` + strings.Join(where, " AND ")
 	}
+
+	// history is grouped per lot, movements without lot come last
+	query += ` ORDER BY lots.expired_date, lots.code, inventories.transaction_date, inventories.created_at`
 	rows, err := db.QueryContext(ctx, query, paramQueries...)
 	if err != nil {
 		return status.Error(codes.Internal, err.Error())
@@ -322,7 +339,8 @@ func (u *Product) Track(ctx context.Context, db *sql.DB) error {
 		err = rows.Scan(
 			&pbTransaction.BranchId, &pbTransaction.BranchName, &pbTransaction.WarehouseId, &pbTransaction.WarehouseName, &pbTransaction.ShelveId,
 			&pbTransaction.ShelveCode, &pbTransaction.ProductId, *&pbTransaction.Barcode, &pbTransaction.TransactionCode,
-			&pbTransaction.TransactionType, &pbTransaction.TransactionDate, &pbTransaction.IsIn,
+			&pbTransaction.TransactionType, &pbTransaction.TransactionDate, &pbTransaction.IsIn, &pbTransaction.Qty,
+			&pbTransaction.LotId, &pbTransaction.LotCode,
 		)
 
 		if err != nil {
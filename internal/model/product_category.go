@@ -14,6 +14,12 @@ import (
 	"google.golang.org/grpc/status"
 )
 
+// pick method of a product category
+const (
+	PickFIFO string = "FIFO"
+	PickFEFO string = "FEFO"
+)
+
 // ProductCategory struct
 type ProductCategory struct {
 	Pb inventories.ProductCategory
@@ -22,7 +28,7 @@ type ProductCategory struct {
 // Get func
 func (u *ProductCategory) Get(ctx context.Context, db *sql.DB) error {
 	query := `
-		SELECT id, company_id, category_id, name, created_at, created_by, updated_at, updated_by 
+		SELECT id, company_id, category_id, name, pick_method, created_at, created_by, updated_at, updated_by 
 		FROM product_categories WHERE id = $1
 	`
 
@@ -36,7 +42,7 @@ func (u *ProductCategory) Get(ctx context.Context, db *sql.DB) error {
 	var pbCategory inventories.Category
 	var createdAt, updatedAt time.Time
 	err = stmt.QueryRowContext(ctx, u.Pb.GetId()).Scan(
-		&u.Pb.Id, &companyID, &pbCategory.Id, &u.Pb.Name, &createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy,
+		&u.Pb.Id, &companyID, &pbCategory.Id, &u.Pb.Name, &u.Pb.PickMethod, &createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy,
 	)
 
 	if err == sql.ErrNoRows {
@@ -66,8 +72,8 @@ func (u *ProductCategory) Create(ctx context.Context, db *sql.DB) error {
 	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
 
 	query := `
-		INSERT INTO product_categories (id, company_id, category_id, name, created_at, created_by, updated_at, updated_by) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO product_categories (id, company_id, category_id, name, pick_method, created_at, created_by, updated_at, updated_by) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 	`
 	stmt, err := db.PrepareContext(ctx, query)
 	if err != nil {
@@ -80,6 +86,7 @@ func (u *ProductCategory) Create(ctx context.Context, db *sql.DB) error {
 		ctx.Value(app.Ctx("companyID")).(string),
 		u.Pb.GetCategory().GetId(),
 		u.Pb.GetName(),
+		u.Pb.GetPickMethod(),
 		now,
 		u.Pb.GetCreatedBy(),
 		now,
@@ -104,9 +111,10 @@ func (u *ProductCategory) Update(ctx context.Context, db *sql.DB) error {
 		UPDATE product_categories SET
 		category_id = $1, 
 		name = $2, 
-		updated_at = $3, 
-		updated_by= $4
-		WHERE id = $5
+		pick_method = $3, 
+		updated_at = $4, 
+		updated_by= $5
+		WHERE id = $6
 	`
 	stmt, err := db.PrepareContext(ctx, query)
 	if err != nil {
@@ -117,6 +125,7 @@ func (u *ProductCategory) Update(ctx context.Context, db *sql.DB) error {
 	_, err = stmt.ExecContext(ctx,
 		u.Pb.GetCategory().GetId(),
 		u.Pb.GetName(),
+		u.Pb.GetPickMethod(),
 		now,
 		u.Pb.GetUpdatedBy(),
 		u.Pb.GetId(),
@@ -152,7 +161,7 @@ func (u *ProductCategory) ListQuery(ctx context.Context, db *sql.DB, in *invento
 	query := `
 		SELECT product_categories.id, product_categories.company_id, 
 			product_categories.category_id, categories.name category_name, 
-			product_categories.name, product_categories.created_at, product_categories.created_by, 
+			product_categories.name, product_categories.pick_method, product_categories.created_at, product_categories.created_by, 
 			product_categories.updated_at, product_categories.updated_by 
 		FROM product_categories JOIN categories ON product_categories.category_id = categories.id`
 	where := []string{"product_categories.company_id = $1"}
@@ -2,10 +2,16 @@ package model
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
 
+	"github.com/jacky-htg/erp-pkg/app"
 	"github.com/jacky-htg/erp-proto/go/pb/inventories"
 	"github.com/jacky-htg/erp-proto/go/pb/purchases"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
@@ -17,8 +23,8 @@ type Purchase struct {
 func (u *Purchase) Outstanding(ctx context.Context) (*inventories.OutstandingResponse, error) {
 	var output inventories.OutstandingResponse
 	out, err := u.PurchaseClient.GetOutstandingPurchaseDetails(ctx, &purchases.OutstandingPurchaseRequest{Id: u.Id})
-	if s, ok := status.FromError(err); !ok {
-		if s.Code() == codes.Unknown {
+	if err != nil {
+		if s, ok := status.FromError(err); !ok || s.Code() == codes.Unknown {
 			err = status.Errorf(codes.Internal, "Error when calling purchase.GetOutstandingPurchaseDetails service: %s", err)
 		}
 
@@ -28,8 +34,65 @@ func (u *Purchase) Outstanding(ctx context.Context) (*inventories.OutstandingRes
 		output.Detail = append(output.Detail, &inventories.OutstandingDetail{
 			ProductId: v.ProductId,
 			Quantity:  uint32(v.Quantity),
+			UnitCost:  v.GetPrice(),
 		})
 	}
 
 	return &output, nil
 }
+
+// OpenByBranch ids of the purchases of the branch that are not fully received
+func (u *Purchase) OpenByBranch(ctx context.Context, branchID string) ([]string, error) {
+	var ids []string
+	out, err := u.PurchaseClient.GetOpenPurchases(ctx, &purchases.OpenPurchaseRequest{BranchId: branchID})
+	if err != nil {
+		if s, ok := status.FromError(err); !ok || s.Code() == codes.Unknown {
+			err = status.Errorf(codes.Internal, "Error when calling purchase.GetOpenPurchases service: %s", err)
+		}
+
+		return ids, err
+	}
+
+	for _, v := range out.GetPurchases() {
+		ids = append(ids, v.GetId())
+	}
+
+	return ids, nil
+}
+
+// CreateDraft purchase of the branch for the suggested lines, the id of the draft is kept on u.Id. The branch, the day
+// and the lines are the idempotency key of the call, a plan retried after a failure gets back the drafts it already
+// created instead of new ones.
+func (u *Purchase) CreateDraft(ctx context.Context, branchID string, remark string, lines []*inventories.ReplenishmentLine) error {
+	now := time.Now().UTC()
+	in := purchases.Purchase{
+		BranchId:     branchID,
+		PurchaseDate: now.Format("2006-01-02T15:04:05.000Z"),
+		Remark:       remark,
+		Status:       "DRAFT",
+	}
+
+	key := sha256.New()
+	fmt.Fprintf(key, "%s|%s|%s", ctx.Value(app.Ctx("companyID")).(string), branchID, now.Format("2006-01-02"))
+	for _, line := range lines {
+		in.Details = append(in.Details, &purchases.PurchaseDetail{
+			ProductId: line.GetProduct().GetId(),
+			Quantity:  line.GetQty(),
+		})
+		fmt.Fprintf(key, "|%s:%d", line.GetProduct().GetId(), line.GetQty())
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, "idempotency-key", hex.EncodeToString(key.Sum(nil)))
+
+	out, err := u.PurchaseClient.Create(ctx, &in)
+	if err != nil {
+		if s, ok := status.FromError(err); !ok || s.Code() == codes.Unknown {
+			err = status.Errorf(codes.Internal, "Error when calling purchase.Create service: %s", err)
+		}
+
+		return err
+	}
+
+	u.Id = out.GetId()
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package model
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// fakePurchaseClient keep the idempotency keys of the purchases created, the other calls of the client are not used
+type fakePurchaseClient struct {
+	purchases.PurchaseServiceClient
+	keys []string
+}
+
+func (u *fakePurchaseClient) Create(ctx context.Context, in *purchases.Purchase, opts ...grpc.CallOption) (*purchases.Purchase, error) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	u.keys = append(u.keys, md.Get("idempotency-key")...)
+	return in, nil
+}
+
+func TestCreateDraftIdempotencyKey(t *testing.T) {
+	ctx := context.WithValue(context.Background(), app.Ctx("companyID"), "company-1")
+	lines := func(qty int32) []*inventories.ReplenishmentLine {
+		return []*inventories.ReplenishmentLine{{Product: &inventories.Product{Id: "product-1"}, Qty: qty}}
+	}
+
+	client := &fakePurchaseClient{}
+	purchase := Purchase{PurchaseClient: client}
+	for _, draft := range []struct {
+		branchID string
+		lines    []*inventories.ReplenishmentLine
+	}{
+		{"branch-1", lines(10)},
+		{"branch-1", lines(10)},
+		{"branch-1", lines(12)},
+		{"branch-2", lines(10)},
+	} {
+		err := purchase.CreateDraft(ctx, draft.branchID, "Replenishment", draft.lines)
+		if err != nil {
+			t.Fatalf("create draft: %v", err)
+		}
+	}
+
+	if len(client.keys) != 4 {
+		t.Fatalf("got %d idempotency keys, want 4", len(client.keys))
+	}
+
+	// a retried draft is the same call, other lines or another branch is a new draft
+	if client.keys[0] != client.keys[1] {
+		t.Errorf("retried draft key %s, want %s", client.keys[1], client.keys[0])
+	}
+
+	if client.keys[0] == client.keys[2] || client.keys[0] == client.keys[3] {
+		t.Errorf("keys %v, want a new key for other lines and another branch", client.keys)
+	}
+}
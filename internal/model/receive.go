@@ -22,9 +22,25 @@ type Receive struct {
 
 // Get func
 func (u *Receive) Get(ctx context.Context, db *sql.DB) error {
+	return u.get(ctx, db)
+}
+
+// GetForUpdate the receive read again in the transaction with its details, the row is locked until the transaction ends
+func (u *Receive) GetForUpdate(ctx context.Context, tx *sql.Tx) error {
+	err := lockDocument(ctx, tx, "receives", u.Pb.GetId())
+	if err != nil {
+		return err
+	}
+
+	u.Pb.Details = nil
+	return u.get(ctx, tx)
+}
+
+// get the receive with its details
+func (u *Receive) get(ctx context.Context, db preparer) error {
 	query := `
 		SELECT receives.id, receives.company_id, receives.branch_id, receives.branch_name, receives.purchase_id, receives.code, 
-		receives.receive_date, receives.remark, receives.created_at, receives.created_by, receives.updated_at, receives.updated_by,
+		receives.receive_date, receives.remark, receives.status, receives.created_at, receives.created_by, receives.updated_at, receives.updated_by,
 		json_agg(DISTINCT jsonb_build_object(
 			'id', receive_details.id,
 			'receive_id', receive_details.receive_id,
@@ -33,12 +49,18 @@ func (u *Receive) Get(ctx context.Context, db *sql.DB) error {
 			'product_code', products.code,
 			'shelve_id', receive_details.shelve_id,
 			'shelve_code', shelves.code,
-			'expired_date', receive_details.expired_date
+			'expired_date', receive_details.expired_date,
+			'qty', receive_details.qty,
+			'unit_cost', receive_details.unit_cost,
+			'lot_id', receive_details.lot_id,
+			'lot_code', lots.code,
+			'lot_expired_date', lots.expired_date
 		)) as details
 		FROM receives 
 		JOIN receive_details ON receives.id = receive_details.receive_id
 		JOIN products ON receive_details.product_id = products.id
 		JOIN shelves ON receive_details.shelve_id = shelves.id
+		LEFT JOIN lots ON receive_details.lot_id = lots.id
 		WHERE receives.id = $1
 		GROUP BY receives.id
 	`
@@ -53,7 +75,7 @@ func (u *Receive) Get(ctx context.Context, db *sql.DB) error {
 	var companyID, details string
 	err = stmt.QueryRowContext(ctx, u.Pb.GetId()).Scan(
 		&u.Pb.Id, &companyID, &u.Pb.BranchId, &u.Pb.BranchName, &u.Pb.PurchaseId, &u.Pb.Code, &dateReceive, &u.Pb.Remark,
-		&createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy, &details,
+		&u.Pb.Status, &createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy, &details,
 	)
 
 	if err == sql.ErrNoRows {
@@ -73,14 +95,19 @@ func (u *Receive) Get(ctx context.Context, db *sql.DB) error {
 	u.Pb.UpdatedAt = updatedAt.String()
 
 	detailReceives := []struct {
-		ID          string
-		ReceiveID   string `json:"receive_id"`
-		ProductID   string `json:"product_id"`
-		ProductName string `json:"product_name"`
-		ProductCode string `json:"product_code"`
-		ShelveID    string `json:"shelve_id"`
-		ShelveCode  string `json:"shelve_code"`
-		ExpiredDate string `json:"expired_date"`
+		ID             string
+		ReceiveID      string  `json:"receive_id"`
+		ProductID      string  `json:"product_id"`
+		ProductName    string  `json:"product_name"`
+		ProductCode    string  `json:"product_code"`
+		ShelveID       string  `json:"shelve_id"`
+		ShelveCode     string  `json:"shelve_code"`
+		Qty            int32   `json:"qty"`
+		UnitCost       float64 `json:"unit_cost"`
+		LotID          string  `json:"lot_id"`
+		LotCode        string  `json:"lot_code"`
+		LotExpiredDate string  `json:"lot_expired_date"`
+		ExpiredDate    string  `json:"expired_date"`
 	}{}
 	err = json.Unmarshal([]byte(details), &detailReceives)
 	if err != nil {
@@ -88,7 +115,7 @@ func (u *Receive) Get(ctx context.Context, db *sql.DB) error {
 	}
 
 	for _, detail := range detailReceives {
-		u.Pb.Details = append(u.Pb.Details, &inventories.ReceiveDetail{
+		pbDetail := &inventories.ReceiveDetail{
 			ExpiredDate: detail.ExpiredDate,
 			Id:          detail.ID,
 			Product: &inventories.Product{
@@ -101,7 +128,17 @@ func (u *Receive) Get(ctx context.Context, db *sql.DB) error {
 				Id:   detail.ShelveID,
 				Code: detail.ShelveCode,
 			},
-		})
+			Qty:      detail.Qty,
+			UnitCost: detail.UnitCost,
+		}
+		if len(detail.LotID) > 0 {
+			pbDetail.Lot = &inventories.Lot{
+				Id:          detail.LotID,
+				Code:        detail.LotCode,
+				ExpiredDate: detail.LotExpiredDate,
+			}
+		}
+		u.Pb.Details = append(u.Pb.Details, pbDetail)
 	}
 
 	return nil
@@ -157,9 +194,10 @@ func (u *Receive) getCode(ctx context.Context, tx *sql.Tx) (string, error) {
 		(count + 1)), nil
 }
 
-// Create Receive
+// Create Receive as a draft, the stock is received when it is posted
 func (u *Receive) Create(ctx context.Context, tx *sql.Tx) error {
 	u.Pb.Id = uuid.New().String()
+	u.Pb.Status = DocumentDraft
 	now := time.Now().UTC()
 	u.Pb.CreatedBy = ctx.Value(app.Ctx("userID")).(string)
 	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
@@ -174,8 +212,8 @@ func (u *Receive) Create(ctx context.Context, tx *sql.Tx) error {
 	}
 
 	query := `
-		INSERT INTO receives (id, company_id, branch_id, branch_name, purchase_id, code, receive_date, remark, created_at, created_by, updated_at, updated_by) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		INSERT INTO receives (id, company_id, branch_id, branch_name, purchase_id, code, receive_date, remark, status, created_at, created_by, updated_at, updated_by) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 	`
 	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
@@ -192,6 +230,7 @@ func (u *Receive) Create(ctx context.Context, tx *sql.Tx) error {
 		u.Pb.GetCode(),
 		dateReceive,
 		u.Pb.GetRemark(),
+		u.Pb.GetStatus(),
 		now,
 		u.Pb.GetCreatedBy(),
 		now,
@@ -204,6 +243,11 @@ func (u *Receive) Create(ctx context.Context, tx *sql.Tx) error {
 	u.Pb.CreatedAt = now.String()
 	u.Pb.UpdatedAt = u.Pb.CreatedAt
 
+	err = writeDocumentEvent(ctx, tx, "receive", EventCreated, u.Pb, u.Pb.GetReceiveDate())
+	if err != nil {
+		return err
+	}
+
 	for _, detail := range u.Pb.GetDetails() {
 		receiveDetailModel := ReceiveDetail{}
 		receiveDetailModel.Pb = inventories.ReceiveDetail{
@@ -211,6 +255,9 @@ func (u *Receive) Create(ctx context.Context, tx *sql.Tx) error {
 			ExpiredDate: detail.GetExpiredDate(),
 			Product:     detail.GetProduct(),
 			Shelve:      detail.GetShelve(),
+			Qty:         detail.GetQty(),
+			UnitCost:    detail.GetUnitCost(),
+			Lot:         detail.GetLot(),
 		}
 		receiveDetailModel.PbReceive = inventories.Receive{
 			Id:          u.Pb.Id,
@@ -250,7 +297,7 @@ func (u *Receive) Update(ctx context.Context, tx *sql.Tx) error {
 		remark = $3, 
 		updated_at = $4, 
 		updated_by= $5
-		WHERE id = $6
+		WHERE id = $6 AND status = $7
 	`
 	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
@@ -258,45 +305,166 @@ func (u *Receive) Update(ctx context.Context, tx *sql.Tx) error {
 	}
 	defer stmt.Close()
 
-	_, err = stmt.ExecContext(ctx,
+	res, err := stmt.ExecContext(ctx,
 		u.Pb.GetPurchaseId(),
 		dateReceive,
 		u.Pb.GetRemark(),
 		now,
 		u.Pb.GetUpdatedBy(),
 		u.Pb.GetId(),
+		DocumentDraft,
 	)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Exec update receive: %v", err)
 	}
 
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return status.Errorf(codes.Internal, "rows affected update receive: %v", err)
+	}
+
+	if affected == 0 {
+		return status.Error(codes.FailedPrecondition, "only a draft receive can be updated")
+	}
+
 	u.Pb.UpdatedAt = now.String()
 
+	err = writeDocumentEvent(ctx, tx, "receive", EventUpdated, u.Pb, u.Pb.GetReceiveDate())
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
-// Delete Receive
-func (u *Receive) Delete(ctx context.Context, db *sql.DB) error {
-	stmt, err := db.PrepareContext(ctx, `DELETE FROM receives WHERE id = $1`)
+// Post Receive, the details are received into the stock
+func (u *Receive) Post(ctx context.Context, tx *sql.Tx) error {
+	now := time.Now().UTC()
+	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+
+	var dateReceive time.Time
+	err := tx.QueryRowContext(ctx, `
+		UPDATE receives SET
+		status = $1,
+		updated_at = $2,
+		updated_by = $3
+		WHERE id = $4 AND company_id = $5 AND status = $6
+		RETURNING receive_date`,
+		DocumentPosted, now, u.Pb.GetUpdatedBy(), u.Pb.GetId(), ctx.Value(app.Ctx("companyID")).(string), DocumentDraft,
+	).Scan(&dateReceive)
+
+	if err == sql.ErrNoRows {
+		return status.Error(codes.FailedPrecondition, "only a draft receive can be posted")
+	}
+
 	if err != nil {
-		return status.Errorf(codes.Internal, "Prepare delete receive: %v", err)
+		return status.Errorf(codes.Internal, "Exec post receive: %v", err)
 	}
-	defer stmt.Close()
 
-	_, err = stmt.ExecContext(ctx, u.Pb.GetId())
+	u.Pb.Status = DocumentPosted
+	u.Pb.ReceiveDate = dateReceive.Format("2006-01-02T15:04:05.000Z")
+	u.Pb.UpdatedAt = now.String()
+
+	err = writeDocumentEvent(ctx, tx, "receive", EventPosted, u.Pb, u.Pb.GetReceiveDate())
 	if err != nil {
-		return status.Errorf(codes.Internal, "Exec delete receive: %v", err)
+		return err
+	}
+
+	for _, detail := range u.Pb.GetDetails() {
+		receiveDetailModel := ReceiveDetail{}
+		receiveDetailModel.Pb = inventories.ReceiveDetail{
+			Id:          detail.GetId(),
+			ReceiveId:   u.Pb.GetId(),
+			ExpiredDate: detail.GetExpiredDate(),
+			Product:     detail.GetProduct(),
+			Shelve:      detail.GetShelve(),
+			Qty:         detail.GetQty(),
+			UnitCost:    detail.GetUnitCost(),
+			Lot:         detail.GetLot(),
+		}
+		receiveDetailModel.PbReceive = inventories.Receive{
+			Id:          u.Pb.Id,
+			BranchId:    u.Pb.BranchId,
+			BranchName:  u.Pb.BranchName,
+			PurchaseId:  u.Pb.PurchaseId,
+			Code:        u.Pb.Code,
+			ReceiveDate: u.Pb.ReceiveDate,
+			Remark:      u.Pb.Remark,
+			Status:      u.Pb.Status,
+		}
+		err = receiveDetailModel.Post(ctx, tx)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// Cancel Receive, a posted receive is taken out of the stock by reversing its inventories at the cancel time
+func (u *Receive) Cancel(ctx context.Context, tx *sql.Tx) error {
+	now := time.Now().UTC()
+	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+
+	var returns int
+	err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM receive_returns WHERE company_id = $1 AND receive_id = $2 AND status <> $3`,
+		ctx.Value(app.Ctx("companyID")).(string), u.Pb.GetId(), DocumentCancelled,
+	).Scan(&returns)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw receive returns: %v", err)
+	}
+
+	if returns > 0 {
+		return status.Error(codes.FailedPrecondition, "receive has returns, cancel the returns first")
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE receives SET
+		status = $1,
+		updated_at = $2,
+		updated_by = $3
+		WHERE id = $4 AND company_id = $5 AND status = $6`,
+		DocumentCancelled, now, u.Pb.GetUpdatedBy(), u.Pb.GetId(), ctx.Value(app.Ctx("companyID")).(string), u.Pb.GetStatus(),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec cancel receive: %v", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return status.Errorf(codes.Internal, "rows affected cancel receive: %v", err)
+	}
+
+	if affected == 0 {
+		return status.Error(codes.FailedPrecondition, "receive status has changed")
+	}
+
+	if u.Pb.GetStatus() == DocumentPosted {
+		err = reverseTransaction(ctx, tx, u.Pb.GetId(), now)
+		if err != nil {
+			return err
+		}
+	}
+
+	u.Pb.Status = DocumentCancelled
+	u.Pb.UpdatedAt = now.String()
+
+	return writeDocumentEvent(ctx, tx, "receive", EventCancelled, u.Pb, u.Pb.GetReceiveDate())
+}
+
+// CheckOutstanding check the products of the receive against the qty ordered on its purchase, it is called
+// after the details are written so the receive is counted with every other receive of the purchase.
+// A product over the ordered qty is rejected unless it is within the tolerance percent.
+func (u *Receive) CheckOutstanding(ctx context.Context, tx *sql.Tx, ordered map[string]int32, tolerancePercent float64) error {
+	return receiveOrder.checkOutstanding(ctx, tx, u.Pb.GetPurchaseId(), u.Pb.GetId(), ordered, tolerancePercent)
+}
+
 // ListQuery builder
 func (u *Receive) ListQuery(ctx context.Context, db *sql.DB, in *inventories.ListReceiveRequest) (string, []interface{}, *inventories.ReceivePaginationResponse, error) {
 	var paginationResponse inventories.ReceivePaginationResponse
 	query := `
 		SELECT 
-			id, company_id, branch_id, branch_name, purchase_id, code, receive_date, remark, created_at, created_by, updated_at, updated_by FROM receives`
+			id, company_id, branch_id, branch_name, purchase_id, code, receive_date, remark, status, created_at, created_by, updated_at, updated_by FROM receives`
 
 	where := []string{"company_id = $1"}
 	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string)}
@@ -311,6 +479,11 @@ func (u *Receive) ListQuery(ctx context.Context, db *sql.DB, in *inventories.Lis
 		where = append(where, fmt.Sprintf(`purchase_id = $%d`, len(paramQueries)))
 	}
 
+	if len(in.GetStatus()) > 0 {
+		paramQueries = append(paramQueries, in.GetStatus())
+		where = append(where, fmt.Sprintf(`status = $%d`, len(paramQueries)))
+	}
+
 	if len(in.GetPagination().GetSearch()) > 0 {
 		paramQueries = append(paramQueries, "%"+in.GetPagination().GetSearch()+"%")
 		where = append(where, fmt.Sprintf(`(code ILIKE $%d OR remark ILIKE $%d)`, len(paramQueries), len(paramQueries)))
@@ -3,12 +3,10 @@ package model
 import (
 	"context"
 	"database/sql"
-	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jacky-htg/erp-pkg/app"
-	"github.com/jacky-htg/erp-pkg/util"
 	"github.com/jacky-htg/erp-proto/go/pb/inventories"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -24,7 +22,7 @@ type ReceiveDetail struct {
 func (u *ReceiveDetail) Get(ctx context.Context, tx *sql.Tx) error {
 	query := `
 		SELECT receive_details.id, receives.company_id, receive_details.receive_id, receive_details.product_id, 
-		receive_details.shelve_id, receive_details.expired_date 
+		receive_details.shelve_id, receive_details.expired_date, receive_details.qty, receive_details.unit_cost, COALESCE(receive_details.lot_id, '') 
 		FROM receive_details 
 		JOIN receives ON receive_details.receive_id = receives.id
 		WHERE receive_details.id = $1 AND receive_details.receive_id = $2
@@ -38,9 +36,9 @@ func (u *ReceiveDetail) Get(ctx context.Context, tx *sql.Tx) error {
 
 	var pbProduct inventories.Product
 	var pbShelve inventories.Shelve
-	var companyID string
+	var companyID, lotID string
 	err = stmt.QueryRowContext(ctx, u.Pb.GetId(), u.Pb.GetReceiveId()).Scan(
-		&u.Pb.Id, &companyID, &u.Pb.ReceiveId, &pbProduct.Id, &pbShelve.Id, &u.Pb.ExpiredDate,
+		&u.Pb.Id, &companyID, &u.Pb.ReceiveId, &pbProduct.Id, &pbShelve.Id, &u.Pb.ExpiredDate, &u.Pb.Qty, &u.Pb.UnitCost, &lotID,
 	)
 
 	if err == sql.ErrNoRows {
@@ -57,72 +55,41 @@ func (u *ReceiveDetail) Get(ctx context.Context, tx *sql.Tx) error {
 
 	u.Pb.Product = &pbProduct
 	u.Pb.Shelve = &pbShelve
+	if len(lotID) > 0 {
+		u.Pb.Lot = &inventories.Lot{Id: lotID}
+	}
 
 	return nil
 }
 
 // Get func
 func (u *ReceiveDetail) ListByPurchaseId(ctx context.Context, tx *sql.Tx, purchaseId string, ids []string) ([]*inventories.OutstandingDetail, error) {
-	var output []*inventories.OutstandingDetail
-	query := `
-	with receive_details as (
-		select receive_details.product_id, COUNT(receive_details.product_id) quantity
-		from receive_details 
-		join receives ON receive_details.receive_id = receives.id
-		where receives.purchase_id = $1
-		group by receive_details.product_id
-	)
-	select products.id, products.code, products.name, coalesce(receive_details.quantity, 0)
-	from products
-	left join receive_details on products.id = receive_details.product_id
-	`
-	where := []string{}
-	paramQueries := []interface{}{purchaseId}
+	return receiveOrder.listFulfilled(ctx, tx, purchaseId, ids)
+}
 
-	if len(ids) > 0 {
-		productIds := make([]interface{}, len(ids))
-		for i, productId := range ids {
-			productIds[i] = productId
+// registerLot resolve the lot number of the detail, a new lot number is registered with the detail expired date.
+// A detail referring an existing lot by id is kept as is.
+func (u *ReceiveDetail) registerLot(ctx context.Context, tx *sql.Tx) error {
+	if len(u.Pb.GetLot().GetCode()) == 0 {
+		if len(u.Pb.GetLot().GetId()) == 0 {
+			u.Pb.Lot = nil
 		}
-		var iCond string
-		paramQueries, iCond = util.ConvertWhereIn("products.id", paramQueries, productIds)
-		where = append(where, iCond)
-	}
-
-	if len(where) > 0 {
-		query += ` WHERE ` + strings.Join(where, " AND ")
+		return nil
 	}
 
-	stmt, err := tx.PrepareContext(ctx, query)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "Prepare statement ListByPurchaseId: %v", err)
-	}
-	defer stmt.Close()
-
-	row, err := stmt.QueryContext(ctx, paramQueries...)
+	lot := Lot{Pb: inventories.Lot{
+		ProductId:   u.Pb.GetProduct().GetId(),
+		Code:        u.Pb.GetLot().GetCode(),
+		ExpiredDate: u.Pb.GetExpiredDate(),
+	}}
+	err := lot.GetOrCreate(ctx, tx)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "QueryContext ListByPurchaseId: %v", err)
-	}
-
-	for row.Next() {
-		var detail inventories.OutstandingDetail
-		err = row.Scan(&detail.ProductId, &detail.ProductCode, &detail.ProductName, &detail.Quantity)
-		if err == sql.ErrNoRows {
-			return nil, status.Errorf(codes.NotFound, "Query Raw ListByPurchaseId: %v", err)
-		}
-
-		if err != nil {
-			return nil, status.Errorf(codes.Internal, "Query Raw ListByPurchaseId: %v", err)
-		}
-
-		output = append(output, &detail)
+		return err
 	}
 
-	if row.Err() != nil {
-		return nil, status.Error(codes.Internal, row.Err().Error())
-	}
+	u.Pb.Lot = &lot.Pb
 
-	return output, nil
+	return nil
 }
 
 // Create ReceiveDetail
@@ -133,9 +100,14 @@ func (u *ReceiveDetail) Create(ctx context.Context, tx *sql.Tx) error {
 		return status.Errorf(codes.Internal, "convert expired date: %v", err)
 	}
 
+	err = u.registerLot(ctx, tx)
+	if err != nil {
+		return err
+	}
+
 	query := `
-		INSERT INTO receive_details (id, receive_id, product_id, shelve_id, expired_date) 
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO receive_details (id, receive_id, product_id, shelve_id, expired_date, qty, unit_cost, lot_id) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 	`
 	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
@@ -149,11 +121,19 @@ func (u *ReceiveDetail) Create(ctx context.Context, tx *sql.Tx) error {
 		u.Pb.GetProduct().GetId(),
 		u.Pb.GetShelve().GetId(),
 		expirdDate,
+		u.Pb.GetQty(),
+		u.Pb.GetUnitCost(),
+		nullLot(u.Pb.GetLot().GetId()),
 	)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Exec insert receive detail: %v", err)
 	}
 
+	return nil
+}
+
+// Post ReceiveDetail, the received qty goes into the shelve
+func (u *ReceiveDetail) Post(ctx context.Context, tx *sql.Tx) error {
 	transactionDate, err := time.Parse("2006-01-02T15:04:05.000Z", u.PbReceive.GetReceiveDate())
 	if err != nil {
 		return status.Errorf(codes.Internal, "convert transactiondate inventory: %v", err)
@@ -169,6 +149,9 @@ func (u *ReceiveDetail) Create(ctx context.Context, tx *sql.Tx) error {
 		TransactionCode: u.PbReceive.GetCode(),
 		TransactionID:   u.PbReceive.GetId(),
 		Type:            "GR",
+		Qty:             u.Pb.GetQty(),
+		UnitCost:        u.Pb.GetUnitCost(),
+		LotID:           u.Pb.GetLot().GetId(),
 	}
 	err = inventory.Create(ctx, tx)
 	if err != nil {
@@ -180,12 +163,20 @@ func (u *ReceiveDetail) Create(ctx context.Context, tx *sql.Tx) error {
 
 // Update ReceiveDetail
 func (u *ReceiveDetail) Update(ctx context.Context, tx *sql.Tx) error {
+	err := u.registerLot(ctx, tx)
+	if err != nil {
+		return err
+	}
+
 	query := `
 		UPDATE receive_details SET
 		product_id = $1, 
 		shelve_id = $2, 
-		expired_date= $3
-		WHERE id = $4
+		expired_date= $3,
+		qty = $4,
+		unit_cost = $5,
+		lot_id = $6
+		WHERE id = $7
 	`
 	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
@@ -197,28 +188,15 @@ func (u *ReceiveDetail) Update(ctx context.Context, tx *sql.Tx) error {
 		u.Pb.GetProduct().GetId(),
 		u.Pb.GetShelve().GetId(),
 		u.Pb.GetExpiredDate(),
+		u.Pb.GetQty(),
+		u.Pb.GetUnitCost(),
+		nullLot(u.Pb.GetLot().GetId()),
 		u.Pb.GetId(),
 	)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Exec update receive detail: %v", err)
 	}
 
-	inventory := Inventory{
-		Barcode:       u.Pb.GetId(),
-		TransactionID: u.PbReceive.GetId(),
-	}
-	err = inventory.Get(ctx, tx)
-	if err != nil {
-		return err
-	}
-
-	inventory.ProductID = u.Pb.GetProduct().GetId()
-	inventory.ShelveID = u.Pb.GetShelve().GetId()
-	err = inventory.Update(ctx, tx)
-	if err != nil {
-		return err
-	}
-
 	return nil
 }
 
@@ -235,14 +213,5 @@ func (u *ReceiveDetail) Delete(ctx context.Context, tx *sql.Tx) error {
 		return status.Errorf(codes.Internal, "Exec delete receive detail: %v", err)
 	}
 
-	inventory := Inventory{
-		Barcode:       u.Pb.GetId(),
-		TransactionID: u.Pb.GetReceiveId(),
-	}
-	err = inventory.Get(ctx, tx)
-	if err != nil {
-		return err
-	}
-
-	return inventory.Delete(ctx, tx)
+	return nil
 }
@@ -23,9 +23,25 @@ type ReceiveReturn struct {
 
 // Get func
 func (u *ReceiveReturn) Get(ctx context.Context, db *sql.DB) error {
+	return u.get(ctx, db)
+}
+
+// GetForUpdate the receive return read again in the transaction with its details, the row is locked until the transaction ends
+func (u *ReceiveReturn) GetForUpdate(ctx context.Context, tx *sql.Tx) error {
+	err := lockDocument(ctx, tx, "receive_returns", u.Pb.GetId())
+	if err != nil {
+		return err
+	}
+
+	u.Pb.Details = nil
+	return u.get(ctx, tx)
+}
+
+// get the receive return with its details
+func (u *ReceiveReturn) get(ctx context.Context, db preparer) error {
 	query := `
 		SELECT receive_returns.id, receive_returns.company_id, receive_returns.branch_id, receive_returns.branch_name, receive_returns.receive_id, receive_returns.code, 
-		receive_returns.return_date, receive_returns.remark, receive_returns.created_at, receive_returns.created_by, receive_returns.updated_at, receive_returns.updated_by,
+		receive_returns.return_date, receive_returns.remark, receive_returns.status, receive_returns.created_at, receive_returns.created_by, receive_returns.updated_at, receive_returns.updated_by,
 		json_agg(DISTINCT jsonb_build_object(
 			'id', receive_return_details.id,
 			'receive_return_id', receive_return_details.receive_return_id,
@@ -33,13 +49,21 @@ func (u *ReceiveReturn) Get(ctx context.Context, db *sql.DB) error {
 			'product_name', products.name,
 			'product_code', products.code,
 			'shelve_id', receive_return_details.shelve_id,
-			'shelve_code', shelves.code
+			'shelve_code', shelves.code,
+			'barcode', receive_return_details.barcode,
+			'qty', receive_return_details.qty,
+			'cost', receive_return_details.cost,
+			'lot_id', receive_return_details.lot_id,
+			'lot_code', lots.code,
+			'lot_expired_date', lots.expired_date
 		)) as details
 		FROM receive_returns 
 		JOIN receive_return_details ON receive_returns.id = receive_return_details.receive_return_id
 		JOIN products ON receive_return_details.product_id = products.id
 		JOIN shelves ON receive_return_details.shelve_id = shelves.id
+		LEFT JOIN lots ON receive_return_details.lot_id = lots.id
 		WHERE receive_returns.id = $1
+		GROUP BY receive_returns.id
 	`
 
 	stmt, err := db.PrepareContext(ctx, query)
@@ -49,10 +73,10 @@ func (u *ReceiveReturn) Get(ctx context.Context, db *sql.DB) error {
 	defer stmt.Close()
 
 	var dateReturn, createdAt, updatedAt time.Time
-	var companyID, details string
+	var companyID, receiveID, details string
 	err = stmt.QueryRowContext(ctx, u.Pb.GetId()).Scan(
-		&u.Pb.Id, &companyID, &u.Pb.BranchId, &u.Pb.BranchName, &u.Pb.Receive.Id, &u.Pb.Code, &dateReturn, &u.Pb.Remark,
-		&createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy, &details,
+		&u.Pb.Id, &companyID, &u.Pb.BranchId, &u.Pb.BranchName, &receiveID, &u.Pb.Code, &dateReturn, &u.Pb.Remark,
+		&u.Pb.Status, &createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy, &details,
 	)
 
 	if err == sql.ErrNoRows {
@@ -67,6 +91,7 @@ func (u *ReceiveReturn) Get(ctx context.Context, db *sql.DB) error {
 		return status.Error(codes.Unauthenticated, "its not your company")
 	}
 
+	u.Pb.Receive = &inventories.Receive{Id: receiveID}
 	u.Pb.ReturnDate = dateReturn.String()
 	u.Pb.CreatedAt = createdAt.String()
 	u.Pb.UpdatedAt = updatedAt.String()
@@ -79,6 +104,12 @@ func (u *ReceiveReturn) Get(ctx context.Context, db *sql.DB) error {
 		ProductCode     string
 		ShelveID        string
 		ShelveCode      string
+		Barcode         string  `json:"barcode"`
+		Qty             int32   `json:"qty"`
+		Cost            float64 `json:"cost"`
+		LotID           string  `json:"lot_id"`
+		LotCode         string  `json:"lot_code"`
+		LotExpiredDate  string  `json:"lot_expired_date"`
 	}{}
 	err = json.Unmarshal([]byte(details), &detailReceiveReturns)
 	if err != nil {
@@ -86,7 +117,7 @@ func (u *ReceiveReturn) Get(ctx context.Context, db *sql.DB) error {
 	}
 
 	for _, detail := range detailReceiveReturns {
-		u.Pb.Details = append(u.Pb.Details, &inventories.ReceiveReturnDetail{
+		pbDetail := &inventories.ReceiveReturnDetail{
 			Id: detail.ID,
 			Product: &inventories.Product{
 				Id:   detail.ProductID,
@@ -98,15 +129,27 @@ func (u *ReceiveReturn) Get(ctx context.Context, db *sql.DB) error {
 				Id:   detail.ShelveID,
 				Code: detail.ShelveCode,
 			},
-		})
+			Barcode: detail.Barcode,
+			Qty:     detail.Qty,
+			Cost:    detail.Cost,
+		}
+		if len(detail.LotID) > 0 {
+			pbDetail.Lot = &inventories.Lot{
+				Id:          detail.LotID,
+				Code:        detail.LotCode,
+				ExpiredDate: detail.LotExpiredDate,
+			}
+		}
+		u.Pb.Details = append(u.Pb.Details, pbDetail)
 	}
 
 	return nil
 }
 
-// Create ReceiveReturn
+// Create ReceiveReturn as a draft, the stock moves when it is posted
 func (u *ReceiveReturn) Create(ctx context.Context, tx *sql.Tx) error {
 	u.Pb.Id = uuid.New().String()
+	u.Pb.Status = DocumentDraft
 	now := time.Now().UTC()
 	u.Pb.CreatedBy = ctx.Value(app.Ctx("userID")).(string)
 	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
@@ -121,8 +164,8 @@ func (u *ReceiveReturn) Create(ctx context.Context, tx *sql.Tx) error {
 	}
 
 	query := `
-		INSERT INTO receive_returns (id, company_id, branch_id, branch_name, receive_id, code, return_date, remark, created_at, created_by, updated_at, updated_by) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		INSERT INTO receive_returns (id, company_id, branch_id, branch_name, receive_id, code, return_date, remark, status, created_at, created_by, updated_at, updated_by) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 	`
 	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
@@ -139,6 +182,7 @@ func (u *ReceiveReturn) Create(ctx context.Context, tx *sql.Tx) error {
 		u.Pb.GetCode(),
 		dateReturn,
 		u.Pb.GetRemark(),
+		u.Pb.GetStatus(),
 		now,
 		u.Pb.GetCreatedBy(),
 		now,
@@ -151,12 +195,20 @@ func (u *ReceiveReturn) Create(ctx context.Context, tx *sql.Tx) error {
 	u.Pb.CreatedAt = now.String()
 	u.Pb.UpdatedAt = u.Pb.CreatedAt
 
+	err = writeDocumentEvent(ctx, tx, "receive_return", EventCreated, u.Pb, u.Pb.GetReturnDate())
+	if err != nil {
+		return err
+	}
+
 	for _, detail := range u.Pb.GetDetails() {
 		receiveReturnDetailModel := ReceiveReturnDetail{}
 		receiveReturnDetailModel.Pb = inventories.ReceiveReturnDetail{
 			ReceiveReturnId: u.Pb.GetId(),
 			Product:         detail.GetProduct(),
 			Shelve:          detail.GetShelve(),
+			Barcode:         detail.GetBarcode(),
+			Qty:             detail.GetQty(),
+			Lot:             detail.GetLot(),
 		}
 		receiveReturnDetailModel.PbReceiveReturn = inventories.ReceiveReturn{
 			Id:         u.Pb.Id,
@@ -196,7 +248,7 @@ func (u *ReceiveReturn) Update(ctx context.Context, tx *sql.Tx) error {
 		remark = $3, 
 		updated_at = $4, 
 		updated_by= $5
-		WHERE id = $6
+		WHERE id = $6 AND status = $7
 	`
 	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
@@ -204,43 +256,146 @@ func (u *ReceiveReturn) Update(ctx context.Context, tx *sql.Tx) error {
 	}
 	defer stmt.Close()
 
-	_, err = stmt.ExecContext(ctx,
+	res, err := stmt.ExecContext(ctx,
 		u.Pb.GetReceive().GetId(),
 		dateReturn,
 		u.Pb.GetRemark(),
 		now,
 		u.Pb.GetUpdatedBy(),
 		u.Pb.GetId(),
+		DocumentDraft,
 	)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Exec update receive return: %v", err)
 	}
 
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return status.Errorf(codes.Internal, "rows affected update receive return: %v", err)
+	}
+
+	if affected == 0 {
+		return status.Error(codes.FailedPrecondition, "only a draft receive return can be updated")
+	}
+
 	u.Pb.UpdatedAt = now.String()
 
+	err = writeDocumentEvent(ctx, tx, "receive_return", EventUpdated, u.Pb, u.Pb.GetReturnDate())
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
-// Delete ReceiveReturn
-func (u *ReceiveReturn) Delete(ctx context.Context, db *sql.DB) error {
-	stmt, err := db.PrepareContext(ctx, `DELETE FROM receive_returns WHERE id = $1`)
+// Post ReceiveReturn, the details go back to the supplier
+func (u *ReceiveReturn) Post(ctx context.Context, tx *sql.Tx) error {
+	now := time.Now().UTC()
+	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+
+	var dateReturn time.Time
+	err := tx.QueryRowContext(ctx, `
+		UPDATE receive_returns SET
+		status = $1,
+		updated_at = $2,
+		updated_by = $3
+		WHERE id = $4 AND company_id = $5 AND status = $6
+		RETURNING return_date`,
+		DocumentPosted, now, u.Pb.GetUpdatedBy(), u.Pb.GetId(), ctx.Value(app.Ctx("companyID")).(string), DocumentDraft,
+	).Scan(&dateReturn)
+
+	if err == sql.ErrNoRows {
+		return status.Error(codes.FailedPrecondition, "only a draft receive return can be posted")
+	}
+
 	if err != nil {
-		return status.Errorf(codes.Internal, "Prepare delete receive return: %v", err)
+		return status.Errorf(codes.Internal, "Exec post receive return: %v", err)
 	}
-	defer stmt.Close()
 
-	_, err = stmt.ExecContext(ctx, u.Pb.GetId())
+	u.Pb.Status = DocumentPosted
+	u.Pb.ReturnDate = dateReturn.Format("2006-01-02T15:04:05.000Z")
+	u.Pb.UpdatedAt = now.String()
+
+	err = writeDocumentEvent(ctx, tx, "receive_return", EventPosted, u.Pb, u.Pb.GetReturnDate())
 	if err != nil {
-		return status.Errorf(codes.Internal, "Exec delete receive return: %v", err)
+		return err
+	}
+
+	for _, detail := range u.Pb.GetDetails() {
+		receiveReturnDetailModel := ReceiveReturnDetail{}
+		receiveReturnDetailModel.Pb = inventories.ReceiveReturnDetail{
+			Id:              detail.GetId(),
+			ReceiveReturnId: u.Pb.GetId(),
+			Product:         detail.GetProduct(),
+			Shelve:          detail.GetShelve(),
+			Barcode:         detail.GetBarcode(),
+			Qty:             detail.GetQty(),
+			Lot:             detail.GetLot(),
+		}
+		receiveReturnDetailModel.PbReceiveReturn = inventories.ReceiveReturn{
+			Id:         u.Pb.Id,
+			BranchId:   u.Pb.BranchId,
+			BranchName: u.Pb.BranchName,
+			Receive:    u.Pb.Receive,
+			Code:       u.Pb.Code,
+			ReturnDate: u.Pb.ReturnDate,
+			Remark:     u.Pb.Remark,
+			Status:     u.Pb.Status,
+		}
+		err = receiveReturnDetailModel.Post(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		detail.Cost = receiveReturnDetailModel.Pb.GetCost()
 	}
 
 	return nil
 }
 
+// Cancel ReceiveReturn, the inventories of a posted receive return are reversed at the cancel time
+func (u *ReceiveReturn) Cancel(ctx context.Context, tx *sql.Tx) error {
+	now := time.Now().UTC()
+	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE receive_returns SET
+		status = $1,
+		updated_at = $2,
+		updated_by = $3
+		WHERE id = $4 AND company_id = $5 AND status = $6`,
+		DocumentCancelled, now, u.Pb.GetUpdatedBy(), u.Pb.GetId(), ctx.Value(app.Ctx("companyID")).(string), u.Pb.GetStatus(),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec cancel receive return: %v", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return status.Errorf(codes.Internal, "rows affected cancel receive return: %v", err)
+	}
+
+	if affected == 0 {
+		return status.Error(codes.FailedPrecondition, "receive return status has changed")
+	}
+
+	if u.Pb.GetStatus() == DocumentPosted {
+		err = reverseTransaction(ctx, tx, u.Pb.GetId(), now)
+		if err != nil {
+			return err
+		}
+	}
+
+	u.Pb.Status = DocumentCancelled
+	u.Pb.UpdatedAt = now.String()
+
+	return writeDocumentEvent(ctx, tx, "receive_return", EventCancelled, u.Pb, u.Pb.GetReturnDate())
+}
+
 // ListQuery builder
 func (u *ReceiveReturn) ListQuery(ctx context.Context, db *sql.DB, in *inventories.ListReceiveReturnRequest) (string, []interface{}, *inventories.ReceiveReturnPaginationResponse, error) {
 	var paginationResponse inventories.ReceiveReturnPaginationResponse
-	query := `SELECT id, company_id, branch_id, branch_name, receive_id, code, return_date, remark, created_at, created_by, updated_at, updated_by FROM receive_returns`
+	query := `SELECT id, company_id, branch_id, branch_name, receive_id, code, return_date, remark, status, created_at, created_by, updated_at, updated_by FROM receive_returns`
 
 	where := []string{"company_id = $1"}
 	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string)}
@@ -255,6 +410,11 @@ func (u *ReceiveReturn) ListQuery(ctx context.Context, db *sql.DB, in *inventori
 		where = append(where, fmt.Sprintf(`receive_id = $%d`, len(paramQueries)))
 	}
 
+	if len(in.GetStatus()) > 0 {
+		paramQueries = append(paramQueries, in.GetStatus())
+		where = append(where, fmt.Sprintf(`status = $%d`, len(paramQueries)))
+	}
+
 	if len(in.GetPagination().GetSearch()) > 0 {
 		paramQueries = append(paramQueries, in.GetPagination().GetSearch())
 		where = append(where, fmt.Sprintf(`(code ILIKE $%d OR remark ILIKE $%d)`, len(paramQueries), len(paramQueries)))
@@ -22,7 +22,7 @@ type ReceiveReturnDetail struct {
 func (u *ReceiveReturnDetail) Get(ctx context.Context, tx *sql.Tx) error {
 	query := `
 		SELECT receive_return_details.id, receive_returns.company_id, receive_return_details.receive_return_id, receive_return_details.product_id, 
-		receive_return_details.shelve_id 
+		receive_return_details.shelve_id, COALESCE(receive_return_details.barcode, ''), receive_return_details.qty, COALESCE(receive_return_details.lot_id, '') 
 		FROM receive_return_details 
 		JOIN receive_returns ON receive_return_details.receive_return_id = receive_returns.id
 		WHERE receive_return_details.id = $1 AND receive_return_details.receive_return_id = $2
@@ -36,9 +36,9 @@ func (u *ReceiveReturnDetail) Get(ctx context.Context, tx *sql.Tx) error {
 
 	var pbProduct inventories.Product
 	var pbShelve inventories.Shelve
-	var companyID string
+	var companyID, lotID string
 	err = stmt.QueryRowContext(ctx, u.Pb.GetId(), u.Pb.GetReceiveReturnId()).Scan(
-		&u.Pb.Id, &companyID, &u.Pb.ReceiveReturnId, &pbProduct.Id, &pbShelve.Id,
+		&u.Pb.Id, &companyID, &u.Pb.ReceiveReturnId, &pbProduct.Id, &pbShelve.Id, &u.Pb.Barcode, &u.Pb.Qty, &lotID,
 	)
 
 	if err == sql.ErrNoRows {
@@ -55,6 +55,9 @@ func (u *ReceiveReturnDetail) Get(ctx context.Context, tx *sql.Tx) error {
 
 	u.Pb.Product = &pbProduct
 	u.Pb.Shelve = &pbShelve
+	if len(lotID) > 0 {
+		u.Pb.Lot = &inventories.Lot{Id: lotID}
+	}
 
 	return nil
 }
@@ -62,9 +65,24 @@ func (u *ReceiveReturnDetail) Get(ctx context.Context, tx *sql.Tx) error {
 // Create ReceiveReturnDetail
 func (u *ReceiveReturnDetail) Create(ctx context.Context, tx *sql.Tx) error {
 	u.Pb.Id = uuid.New().String()
+	if len(u.Pb.GetBarcode()) > 0 {
+		unit := UnitStatus{Barcode: u.Pb.GetBarcode()}
+		err := u.checkUnit(ctx, tx, &unit)
+		if err != nil {
+			return err
+		}
+
+		if len(u.Pb.GetLot().GetId()) == 0 && len(unit.LotID) > 0 {
+			u.Pb.Lot = &inventories.Lot{Id: unit.LotID}
+		}
+	} else {
+		// quantity tracked products have no unit barcode, the line is its own barcode
+		u.Pb.Barcode = u.Pb.GetId()
+	}
+
 	query := `
-		INSERT INTO receive_return_details (id, receive_return_id, product_id, shelve_id) 
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO receive_return_details (id, receive_return_id, product_id, shelve_id, barcode, qty, lot_id) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 	`
 	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
@@ -77,33 +95,51 @@ func (u *ReceiveReturnDetail) Create(ctx context.Context, tx *sql.Tx) error {
 		u.Pb.GetReceiveReturnId(),
 		u.Pb.GetProduct().GetId(),
 		u.Pb.GetShelve().GetId(),
+		u.Pb.GetBarcode(),
+		u.Pb.GetQty(),
+		nullLot(u.Pb.GetLot().GetId()),
 	)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Exec insert receive return detail: %v", err)
 	}
 
+	return nil
+}
+
+// Post ReceiveReturnDetail, the unit is checked again as it may have moved since the draft was written
+func (u *ReceiveReturnDetail) Post(ctx context.Context, tx *sql.Tx) error {
+	if u.Pb.GetBarcode() != u.Pb.GetId() {
+		unit := UnitStatus{Barcode: u.Pb.GetBarcode()}
+		err := u.checkUnit(ctx, tx, &unit)
+		if err != nil {
+			return err
+		}
+	}
+
 	transactionDate, err := time.Parse("2006-01-02T15:04:05.000Z", u.PbReceiveReturn.GetReturnDate())
 	if err != nil {
 		return status.Errorf(codes.Internal, "convert transactiondate inventory: %v", err)
 	}
 	inventory := Inventory{
-		Barcode:         u.Pb.GetId(),
+		Barcode:         u.Pb.GetBarcode(),
 		BranchID:        u.PbReceiveReturn.GetBranchId(),
 		CompanyID:       ctx.Value(app.Ctx("companyID")).(string),
-		IsIn:            true,
+		IsIn:            false,
 		ProductID:       u.Pb.GetProduct().GetId(),
 		ShelveID:        u.Pb.GetShelve().GetId(),
 		TransactionDate: transactionDate,
 		TransactionCode: u.PbReceiveReturn.GetCode(),
 		TransactionID:   u.PbReceiveReturn.GetId(),
 		Type:            "RR",
+		Qty:             u.Pb.GetQty(),
+		LotID:           u.Pb.GetLot().GetId(),
 	}
 	err = inventory.Create(ctx, tx)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return u.updateCost(ctx, tx, inventory.Cost)
 }
 
 // Update ReceiveReturnDetail
@@ -111,8 +147,10 @@ func (u *ReceiveReturnDetail) Update(ctx context.Context, tx *sql.Tx) error {
 	query := `
 		UPDATE receive_return_details SET
 		product_id = $1, 
-		shelve_id = $2
-		WHERE id = $3
+		shelve_id = $2,
+		qty = $3,
+		lot_id = $4
+		WHERE id = $5
 	`
 	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
@@ -123,28 +161,14 @@ func (u *ReceiveReturnDetail) Update(ctx context.Context, tx *sql.Tx) error {
 	_, err = stmt.ExecContext(ctx,
 		u.Pb.GetProduct().GetId(),
 		u.Pb.GetShelve().GetId(),
+		u.Pb.GetQty(),
+		nullLot(u.Pb.GetLot().GetId()),
 		u.Pb.GetId(),
 	)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Exec update receive return detail: %v", err)
 	}
 
-	inventory := Inventory{
-		Barcode:       u.Pb.GetId(),
-		TransactionID: u.PbReceiveReturn.GetId(),
-	}
-	err = inventory.Get(ctx, tx)
-	if err != nil {
-		return err
-	}
-
-	inventory.ProductID = u.Pb.GetProduct().GetId()
-	inventory.ShelveID = u.Pb.GetShelve().GetId()
-	err = inventory.Update(ctx, tx)
-	if err != nil {
-		return err
-	}
-
 	return nil
 }
 
@@ -161,14 +185,30 @@ func (u *ReceiveReturnDetail) Delete(ctx context.Context, tx *sql.Tx) error {
 		return status.Errorf(codes.Internal, "Exec delete receive return detail: %v", err)
 	}
 
-	inventory := Inventory{
-		Barcode:       u.Pb.GetId(),
-		TransactionID: u.Pb.GetReceiveReturnId(),
+	return nil
+}
+
+// updateCost keep the cost of the movement on the receive return detail
+func (u *ReceiveReturnDetail) updateCost(ctx context.Context, tx *sql.Tx, cost float64) error {
+	_, err := tx.ExecContext(ctx, `UPDATE receive_return_details SET cost = $1 WHERE id = $2`, cost, u.Pb.GetId())
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec update receive return detail cost: %v", err)
 	}
-	err = inventory.Get(ctx, tx)
+
+	u.Pb.Cost = cost
+
+	return nil
+}
+
+// checkUnit the unit can go back to the supplier and the branch keeps the qty reserved for the sales orders,
+// the reservation lock of the product is taken before the unit is locked
+func (u *ReceiveReturnDetail) checkUnit(ctx context.Context, tx *sql.Tx, unit *UnitStatus) error {
+	reservationModel := Reservation{}
+	reservationModel.Pb = inventories.Reservation{BranchId: u.PbReceiveReturn.GetBranchId(), ProductId: u.Pb.GetProduct().GetId()}
+	err := reservationModel.CheckAvailable(ctx, tx, 1)
 	if err != nil {
 		return err
 	}
 
-	return inventory.Delete(ctx, tx)
+	return unit.CheckOut(ctx, tx, u.Pb.GetProduct().GetId(), u.PbReceiveReturn.GetBranchId(), u.Pb.GetShelve().GetId(), "", true)
 }
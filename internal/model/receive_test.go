@@ -0,0 +1,199 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// draftReceive a draft receive of one unit of the product
+func (u testProduct) draftReceive(t *testing.T, db *sql.DB) *Receive {
+	t.Helper()
+
+	receive := Receive{Pb: inventories.Receive{
+		Id:       uuid.New().String(),
+		BranchId: u.branchID,
+		Code:     "GR24000000002",
+		Details: []*inventories.ReceiveDetail{{
+			Id:       uuid.New().String(),
+			Product:  &inventories.Product{Id: u.productID},
+			Shelve:   &inventories.Shelve{Id: u.shelveID},
+			Qty:      1,
+			UnitCost: 1000,
+		}},
+	}}
+
+	_, err := db.Exec(`
+		INSERT INTO receives (id, company_id, branch_id, branch_name, purchase_id, code, receive_date, remark, created_by, updated_by, status)
+		VALUES ($1, $2, $3, 'Test', $4, $5, $6, '', $7, $7, $8)`,
+		receive.Pb.GetId(), u.companyID, u.branchID, uuid.New().String(), receive.Pb.GetCode(), time.Now().UTC(), u.userID, DocumentDraft,
+	)
+	if err != nil {
+		t.Fatalf("insert receive: %v", err)
+	}
+
+	return &receive
+}
+
+func (u testProduct) stock(t *testing.T, db *sql.DB) int32 {
+	t.Helper()
+
+	var qty int32
+	err := db.QueryRow(`SELECT COALESCE(SUM(qty), 0) FROM stock_balances WHERE company_id = $1 AND product_id = $2`,
+		u.companyID, u.productID).Scan(&qty)
+	if err != nil {
+		t.Fatalf("get stock: %v", err)
+	}
+
+	return qty
+}
+
+func TestReceiveCancelKeepsTheMovements(t *testing.T) {
+	db := openTestDB(t)
+	product := newTestProduct(t, db)
+	receive := product.draftReceive(t, db)
+
+	err := inTx(product.ctx, db, receive.Post)
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+
+	err = inTx(product.ctx, db, receive.Cancel)
+	if err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+
+	if stock := product.stock(t, db); stock != 0 {
+		t.Errorf("stock after cancel = %d, want 0", stock)
+	}
+
+	// the movement of the receive is offset by a reversal, nothing is deleted
+	var in, out int
+	err = db.QueryRow(`
+		SELECT COUNT(*) FILTER (WHERE in_out), COUNT(*) FILTER (WHERE NOT in_out) FROM inventories WHERE company_id = $1 AND transaction_id = $2`,
+		product.companyID, receive.Pb.GetId()).Scan(&in, &out)
+	if err != nil {
+		t.Fatalf("get movements: %v", err)
+	}
+
+	if in != 1 || out != 1 {
+		t.Errorf("movements = %d in, %d out, want 1 in and its reversal", in, out)
+	}
+
+	// a copy read before the cancel does not reverse the receive again
+	stale := Receive{Pb: inventories.Receive{Id: receive.Pb.GetId(), BranchId: product.branchID, Status: DocumentPosted}}
+	err = inTx(product.ctx, db, stale.Cancel)
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("cancel a stale copy = %v, want %v", err, codes.FailedPrecondition)
+	}
+}
+
+func TestReceiveCancelAfterTheUnitIsDelivered(t *testing.T) {
+	db := openTestDB(t)
+	product := newTestProduct(t, db)
+	receive := product.draftReceive(t, db)
+
+	err := inTx(product.ctx, db, receive.Post)
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+
+	err = inTx(product.ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		delivered := Inventory{
+			BranchID:        product.branchID,
+			ProductID:       product.productID,
+			Barcode:         receive.Pb.GetDetails()[0].GetId(),
+			TransactionID:   uuid.New().String(),
+			TransactionCode: "DO24000000001",
+			TransactionDate: time.Now().UTC(),
+			Type:            "DO",
+			ShelveID:        product.shelveID,
+			Qty:             1,
+		}
+		return delivered.Create(ctx, tx)
+	})
+	if err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+
+	err = inTx(product.ctx, db, receive.Cancel)
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("cancel = %v, want %v", err, codes.FailedPrecondition)
+	}
+
+	if stock := product.stock(t, db); stock != 0 {
+		t.Errorf("stock = %d, want 0", stock)
+	}
+}
+
+func TestPostReadsTheDraftAfterAnUpdate(t *testing.T) {
+	db := openTestDB(t)
+	product := newTestProduct(t, db)
+	receive := product.draftReceive(t, db)
+
+	_, err := db.Exec(`
+		INSERT INTO receive_details (id, receive_id, product_id, shelve_id, expired_date, qty, unit_cost)
+		VALUES ($1, $2, $3, $4, NOW(), 1, 1000)`,
+		uuid.New().String(), receive.Pb.GetId(), product.productID, product.shelveID,
+	)
+	if err != nil {
+		t.Fatalf("insert receive detail: %v", err)
+	}
+
+	update, err := db.BeginTx(product.ctx, nil)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	defer update.Rollback()
+
+	editing := Receive{Pb: inventories.Receive{Id: receive.Pb.GetId()}}
+	err = editing.GetForUpdate(product.ctx, update)
+	if err != nil {
+		t.Fatalf("get draft for update: %v", err)
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- inTx(product.ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+			posting := Receive{Pb: inventories.Receive{Id: receive.Pb.GetId()}}
+			err := posting.GetForUpdate(ctx, tx)
+			if err != nil {
+				return err
+			}
+
+			return posting.Post(ctx, tx)
+		})
+	}()
+
+	// the post waits for the update holding the draft
+	select {
+	case err = <-result:
+		t.Fatalf("post did not wait for the update: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	_, err = update.Exec(`UPDATE receive_details SET qty = 3 WHERE receive_id = $1`, receive.Pb.GetId())
+	if err != nil {
+		t.Fatalf("update receive detail: %v", err)
+	}
+
+	err = update.Commit()
+	if err != nil {
+		t.Fatalf("commit update: %v", err)
+	}
+
+	err = <-result
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+
+	if stock := product.stock(t, db); stock != 3 {
+		t.Errorf("stock after post = %d, want the 3 of the update", stock)
+	}
+}
@@ -0,0 +1,70 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Replenishment struct, Outstanding is the qty per product still to be received from the open purchases of the branch
+type Replenishment struct {
+	Outstanding map[string]int32
+	Pb          inventories.ReplenishmentPlan
+}
+
+// Plan the purchase suggestion of the branch. The suggested qty of a product is its minimum stock less the stock
+// on hand and less the qty outstanding on open purchases, only products with a positive qty are suggested.
+// The lines are grouped by brand.
+func (u *Replenishment) Plan(ctx context.Context, db *sql.DB) error {
+	query := `
+		SELECT brands.id, brands.code, brands.name, products.id, products.code, products.name, products.minimum_stock,
+			COALESCE(stock_branch($1, $2, products.id), 0)
+		FROM products
+		JOIN brands ON products.brand_id = brands.id AND products.company_id = brands.company_id
+		WHERE products.company_id = $1 AND products.minimum_stock > 0
+		ORDER BY brands.name, brands.id, products.code
+	`
+
+	rows, err := db.QueryContext(ctx, query, ctx.Value(app.Ctx("companyID")).(string), u.Pb.GetBranchId())
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw plan replenishment: %v", err)
+	}
+	defer rows.Close()
+
+	var pbBrandPlan *inventories.ReplenishmentBrand
+	for rows.Next() {
+		var pbBrand inventories.Brand
+		var pbProduct inventories.Product
+		var pbLine inventories.ReplenishmentLine
+		err = rows.Scan(&pbBrand.Id, &pbBrand.Code, &pbBrand.Name, &pbProduct.Id, &pbProduct.Code, &pbProduct.Name,
+			&pbLine.MinimumStock, &pbLine.OnHand)
+		if err != nil {
+			return status.Errorf(codes.Internal, "scan plan replenishment: %v", err)
+		}
+
+		pbLine.Outstanding = u.Outstanding[pbProduct.GetId()]
+		pbLine.Qty = pbLine.GetMinimumStock() - pbLine.GetOnHand() - pbLine.GetOutstanding()
+		if pbLine.GetQty() <= 0 {
+			continue
+		}
+
+		pbProduct.Brand = &pbBrand
+		pbLine.Product = &pbProduct
+
+		if pbBrandPlan == nil || pbBrandPlan.GetBrand().GetId() != pbBrand.GetId() {
+			pbBrandPlan = &inventories.ReplenishmentBrand{Brand: &pbBrand}
+			u.Pb.Brands = append(u.Pb.Brands, pbBrandPlan)
+		}
+		pbBrandPlan.Lines = append(pbBrandPlan.Lines, &pbLine)
+	}
+
+	if rows.Err() != nil {
+		return status.Errorf(codes.Internal, "rows plan replenishment: %v", rows.Err())
+	}
+
+	return nil
+}
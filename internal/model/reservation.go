@@ -0,0 +1,465 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// status of a reservation, only an active reservation that is not expired holds the stock
+const (
+	ReservationActive    string = "ACTIVE"
+	ReservationReleased  string = "RELEASED"
+	ReservationFulfilled string = "FULFILLED"
+	ReservationExpired   string = "EXPIRED"
+)
+
+// Reservation struct
+type Reservation struct {
+	Pb inventories.Reservation
+}
+
+// Get func
+func (u *Reservation) Get(ctx context.Context, db *sql.DB) error {
+	query := `
+		SELECT id, company_id, branch_id, sales_order_id, product_id, COALESCE(barcode, ''), qty, expired_at, status,
+			created_at, created_by, updated_at, updated_by, released_at, COALESCE(released_by, '')
+		FROM reservations WHERE id = $1
+	`
+
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare statement Get reservation: %v", err)
+	}
+	defer stmt.Close()
+
+	var companyID string
+	var expiredAt, createdAt, updatedAt time.Time
+	var releasedAt sql.NullTime
+	err = stmt.QueryRowContext(ctx, u.Pb.GetId()).Scan(
+		&u.Pb.Id, &companyID, &u.Pb.BranchId, &u.Pb.SalesOrderId, &u.Pb.ProductId, &u.Pb.Barcode, &u.Pb.Qty, &expiredAt, &u.Pb.Status,
+		&createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy, &releasedAt, &u.Pb.ReleasedBy,
+	)
+
+	if err == sql.ErrNoRows {
+		return status.Errorf(codes.NotFound, "Query Raw get reservation: %v", err)
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw get reservation: %v", err)
+	}
+
+	if companyID != ctx.Value(app.Ctx("companyID")).(string) {
+		return status.Error(codes.Unauthenticated, "its not your company data")
+	}
+
+	u.Pb.ExpiredAt = expiredAt.String()
+	u.Pb.CreatedAt = createdAt.String()
+	u.Pb.UpdatedAt = updatedAt.String()
+	if releasedAt.Valid {
+		u.Pb.ReleasedAt = releasedAt.Time.String()
+	}
+
+	return nil
+}
+
+// Create Reservation, the available stock of the branch is checked in the same transaction
+func (u *Reservation) Create(ctx context.Context, tx *sql.Tx) error {
+	expiredAt, err := time.Parse("2006-01-02T15:04:05.000Z", u.Pb.GetExpiredAt())
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "convert expired at: %v", err)
+	}
+
+	companyID := ctx.Value(app.Ctx("companyID")).(string)
+
+	err = lockReservation(ctx, tx, u.Pb.GetProductId())
+	if err != nil {
+		return err
+	}
+
+	err = u.expireDue(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	if len(u.Pb.GetBarcode()) > 0 {
+		unit := UnitStatus{Barcode: u.Pb.GetBarcode()}
+		err = unit.Get(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		if unit.ProductID != u.Pb.GetProductId() {
+			return status.Errorf(codes.InvalidArgument, "barcode %s is not of the product", u.Pb.GetBarcode())
+		}
+
+		if !unit.InStock || unit.BranchID != u.Pb.GetBranchId() {
+			return status.Errorf(codes.FailedPrecondition, "barcode %s is not in stock of the branch", u.Pb.GetBarcode())
+		}
+
+		var salesOrderID string
+		err = tx.QueryRowContext(ctx,
+			`SELECT sales_order_id FROM reservations WHERE company_id = $1 AND barcode = $2 AND status = $3`,
+			companyID, u.Pb.GetBarcode(), ReservationActive,
+		).Scan(&salesOrderID)
+		if err == nil {
+			return status.Errorf(codes.FailedPrecondition, "barcode already reserved for sales order %s", salesOrderID)
+		}
+
+		if err != sql.ErrNoRows {
+			return status.Errorf(codes.Internal, "Query Raw check reserved barcode: %v", err)
+		}
+	}
+
+	var available int32
+	err = tx.QueryRowContext(ctx, `SELECT COALESCE(stock_branch($1, $2, $3), 0) - stock_reserved($1, $2, $3)`,
+		companyID, u.Pb.GetBranchId(), u.Pb.GetProductId(),
+	).Scan(&available)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw available stock: %v", err)
+	}
+
+	if available < u.Pb.GetQty() {
+		return status.Errorf(codes.FailedPrecondition, "insufficient available stock, available %d", available)
+	}
+
+	u.Pb.Id = uuid.New().String()
+	u.Pb.Status = ReservationActive
+	now := time.Now().UTC()
+	u.Pb.CreatedBy = ctx.Value(app.Ctx("userID")).(string)
+	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+
+	query := `
+		INSERT INTO reservations (id, company_id, branch_id, sales_order_id, product_id, barcode, qty, expired_at, status, created_at, created_by, updated_at, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare insert reservation: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx,
+		u.Pb.GetId(),
+		companyID,
+		u.Pb.GetBranchId(),
+		u.Pb.GetSalesOrderId(),
+		u.Pb.GetProductId(),
+		sql.NullString{String: u.Pb.GetBarcode(), Valid: len(u.Pb.GetBarcode()) > 0},
+		u.Pb.GetQty(),
+		expiredAt,
+		u.Pb.GetStatus(),
+		now,
+		u.Pb.GetCreatedBy(),
+		now,
+		u.Pb.GetUpdatedBy(),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec insert reservation: %v", err)
+	}
+
+	u.Pb.CreatedAt = now.String()
+	u.Pb.UpdatedAt = u.Pb.CreatedAt
+
+	return nil
+}
+
+// Release an active reservation before its expiry
+func (u *Reservation) Release(ctx context.Context, tx *sql.Tx) error {
+	now := time.Now().UTC()
+	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+
+	err := tx.QueryRowContext(ctx, `
+		UPDATE reservations SET status = $1, released_at = $2, released_by = $3, updated_at = $2, updated_by = $3
+		WHERE id = $4 AND company_id = $5 AND status = $6
+		RETURNING status`,
+		ReservationReleased, now, u.Pb.GetUpdatedBy(), u.Pb.GetId(), ctx.Value(app.Ctx("companyID")).(string), ReservationActive,
+	).Scan(&u.Pb.Status)
+
+	if err == sql.ErrNoRows {
+		return status.Error(codes.FailedPrecondition, "reservation is not active")
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec release reservation: %v", err)
+	}
+
+	u.Pb.ReleasedAt = now.String()
+	u.Pb.ReleasedBy = u.Pb.GetUpdatedBy()
+	u.Pb.UpdatedAt = now.String()
+
+	return nil
+}
+
+// Fulfill the reservations of the sales order covering the delivered qty of the product, called when the delivery is
+// posted. A delivered unit fulfills its own reservation, otherwise the qty reservations are taken from the oldest,
+// the rest of the order keeps its hold.
+func (u *Reservation) Fulfill(ctx context.Context, tx *sql.Tx, qty int32) error {
+	err := lockReservation(ctx, tx, u.Pb.GetProductId())
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	userID := ctx.Value(app.Ctx("userID")).(string)
+	companyID := ctx.Value(app.Ctx("companyID")).(string)
+
+	if len(u.Pb.GetBarcode()) > 0 {
+		res, err := tx.ExecContext(ctx, `
+			UPDATE reservations SET status = $1, released_at = $2, released_by = $3, updated_at = $2, updated_by = $3
+			WHERE company_id = $4 AND sales_order_id = $5 AND barcode = $6 AND status = $7`,
+			ReservationFulfilled, now, userID, companyID, u.Pb.GetSalesOrderId(), u.Pb.GetBarcode(), ReservationActive,
+		)
+		if err != nil {
+			return status.Errorf(codes.Internal, "Exec fulfill reservation: %v", err)
+		}
+
+		fulfilled, err := res.RowsAffected()
+		if err != nil {
+			return status.Errorf(codes.Internal, "Exec fulfill reservation: %v", err)
+		}
+
+		if fulfilled > 0 {
+			return nil
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, qty FROM reservations
+		WHERE company_id = $1 AND branch_id = $2 AND sales_order_id = $3 AND product_id = $4 AND barcode IS NULL AND status = $5
+		ORDER BY created_at`,
+		companyID, u.Pb.GetBranchId(), u.Pb.GetSalesOrderId(), u.Pb.GetProductId(), ReservationActive,
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw list reservation to fulfill: %v", err)
+	}
+
+	var reservations []inventories.Reservation
+	for rows.Next() {
+		var reservation inventories.Reservation
+		err = rows.Scan(&reservation.Id, &reservation.Qty)
+		if err != nil {
+			rows.Close()
+			return status.Errorf(codes.Internal, "scan reservation to fulfill: %v", err)
+		}
+
+		reservations = append(reservations, reservation)
+	}
+	rows.Close()
+
+	if rows.Err() != nil {
+		return status.Errorf(codes.Internal, "rows reservation to fulfill: %v", rows.Err())
+	}
+
+	for _, reservation := range reservations {
+		if qty <= 0 {
+			break
+		}
+
+		if reservation.GetQty() > qty {
+			_, err = tx.ExecContext(ctx, `UPDATE reservations SET qty = qty - $1, updated_at = $2, updated_by = $3 WHERE id = $4`,
+				qty, now, userID, reservation.GetId(),
+			)
+			if err != nil {
+				return status.Errorf(codes.Internal, "Exec fulfill reservation: %v", err)
+			}
+
+			break
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE reservations SET status = $1, released_at = $2, released_by = $3, updated_at = $2, updated_by = $3
+			WHERE id = $4`,
+			ReservationFulfilled, now, userID, reservation.GetId(),
+		)
+		if err != nil {
+			return status.Errorf(codes.Internal, "Exec fulfill reservation: %v", err)
+		}
+
+		qty -= reservation.GetQty()
+	}
+
+	return nil
+}
+
+// IsReservedByOther check the barcode is not held by an active reservation of another sales order.
+// It holds the reservation lock of the product, a reservation of the barcode waits for the transaction.
+func (u *Reservation) IsReservedByOther(ctx context.Context, tx *sql.Tx) error {
+	err := lockReservation(ctx, tx, u.Pb.GetProductId())
+	if err != nil {
+		return err
+	}
+
+	var salesOrderID string
+	err = tx.QueryRowContext(ctx, `
+		SELECT sales_order_id FROM reservations
+		WHERE company_id = $1 AND barcode = $2 AND status = $3 AND expired_at > $4 AND sales_order_id <> $5`,
+		ctx.Value(app.Ctx("companyID")).(string), u.Pb.GetBarcode(), ReservationActive, time.Now().UTC(), u.Pb.GetSalesOrderId(),
+	).Scan(&salesOrderID)
+
+	if err == sql.ErrNoRows {
+		return nil
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw check reserved barcode: %v", err)
+	}
+
+	return status.Errorf(codes.FailedPrecondition, "barcode %s is reserved for sales order %s", u.Pb.GetBarcode(), salesOrderID)
+}
+
+// ReservedByOther qty of the product in the branch held by active reservations of the other sales orders
+func (u *Reservation) ReservedByOther(ctx context.Context, tx *sql.Tx) (int32, error) {
+	err := lockReservation(ctx, tx, u.Pb.GetProductId())
+	if err != nil {
+		return 0, err
+	}
+
+	return u.reservedByOther(ctx, tx)
+}
+
+// reservedByOther read without the reservation lock, for a suggestion that is checked again when the stock leaves
+func (u *Reservation) reservedByOther(ctx context.Context, db preparer) (int32, error) {
+	stmt, err := db.PrepareContext(ctx, `
+		SELECT COALESCE(SUM(qty), 0) FROM reservations
+		WHERE company_id = $1 AND branch_id = $2 AND product_id = $3 AND status = $4 AND expired_at > $5 AND sales_order_id <> $6`)
+	if err != nil {
+		return 0, status.Errorf(codes.Internal, "Prepare statement reserved by other: %v", err)
+	}
+	defer stmt.Close()
+
+	var reserved int32
+	err = stmt.QueryRowContext(ctx,
+		ctx.Value(app.Ctx("companyID")).(string), u.Pb.GetBranchId(), u.Pb.GetProductId(), ReservationActive, time.Now().UTC(),
+		u.Pb.GetSalesOrderId(),
+	).Scan(&reserved)
+	if err != nil {
+		return 0, status.Errorf(codes.Internal, "Query Raw reserved by other: %v", err)
+	}
+
+	return reserved, nil
+}
+
+// CheckAvailable the stock of the product in the branch must cover the qty leaving it and the qty reserved for the other
+// sales orders, the reservation lock of the product is held until the transaction ends
+func (u *Reservation) CheckAvailable(ctx context.Context, tx *sql.Tx, qty int32) error {
+	reserved, err := u.ReservedByOther(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	if reserved == 0 {
+		return nil
+	}
+
+	var branchStock int32
+	err = tx.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(qty), 0) FROM stock_balances WHERE company_id = $1 AND branch_id = $2 AND product_id = $3`,
+		ctx.Value(app.Ctx("companyID")).(string), u.Pb.GetBranchId(), u.Pb.GetProductId()).Scan(&branchStock)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw check branch qty: %v", err)
+	}
+
+	if branchStock-reserved < qty {
+		return status.Errorf(codes.FailedPrecondition, "insufficient available stock, %d reserved for other sales orders", reserved)
+	}
+
+	return nil
+}
+
+// lockReservation serialize the reservations and the outbounds of a product, two orders can not be promised the same stock
+func lockReservation(ctx context.Context, tx *sql.Tx, productID string) error {
+	_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, ctx.Value(app.Ctx("companyID")).(string)+productID)
+	if err != nil {
+		return status.Errorf(codes.Internal, "lock reservation: %v", err)
+	}
+
+	return nil
+}
+
+// expireDue mark the active reservations past their expiry, so the barcodes can be reserved again
+func (u *Reservation) expireDue(ctx context.Context, tx *sql.Tx) error {
+	now := time.Now().UTC()
+	_, err := tx.ExecContext(ctx, `
+		UPDATE reservations SET status = $1, updated_at = $2
+		WHERE company_id = $3 AND status = $4 AND expired_at <= $2`,
+		ReservationExpired, now, ctx.Value(app.Ctx("companyID")).(string), ReservationActive,
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec expire reservation: %v", err)
+	}
+
+	return nil
+}
+
+// ListQuery builder
+func (u *Reservation) ListQuery(ctx context.Context, db *sql.DB, in *inventories.ListReservationRequest) (string, []interface{}, *inventories.ReservationPaginationResponse, error) {
+	var paginationResponse inventories.ReservationPaginationResponse
+	query := `SELECT id, company_id, branch_id, sales_order_id, product_id, COALESCE(barcode, ''), qty, expired_at, status, created_at, created_by, updated_at, updated_by FROM reservations`
+
+	where := []string{"company_id = $1"}
+	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string)}
+
+	if len(in.GetBranchId()) > 0 {
+		paramQueries = append(paramQueries, in.GetBranchId())
+		where = append(where, fmt.Sprintf(`branch_id = $%d`, len(paramQueries)))
+	}
+
+	if len(in.GetSalesOrderId()) > 0 {
+		paramQueries = append(paramQueries, in.GetSalesOrderId())
+		where = append(where, fmt.Sprintf(`sales_order_id = $%d`, len(paramQueries)))
+	}
+
+	if len(in.GetProductId()) > 0 {
+		paramQueries = append(paramQueries, in.GetProductId())
+		where = append(where, fmt.Sprintf(`product_id = $%d`, len(paramQueries)))
+	}
+
+	if len(in.GetStatus()) > 0 {
+		paramQueries = append(paramQueries, in.GetStatus())
+		where = append(where, fmt.Sprintf(`status = $%d`, len(paramQueries)))
+	}
+
+	{
+		qCount := `SELECT COUNT(*) FROM reservations`
+		if len(where) > 0 {
+			qCount += " WHERE " + strings.Join(where, " AND ")
+		}
+		var count int
+		err := db.QueryRowContext(ctx, qCount, paramQueries...).Scan(&count)
+		if err != nil && err != sql.ErrNoRows {
+			return query, paramQueries, &paginationResponse, status.Error(codes.Internal, err.Error())
+		}
+
+		paginationResponse.Count = uint32(count)
+	}
+
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+
+	if len(in.GetPagination().GetOrderBy()) == 0 || !(in.GetPagination().GetOrderBy() == "expired_at") {
+		if in.GetPagination() == nil {
+			in.Pagination = &inventories.Pagination{OrderBy: "created_at"}
+		} else {
+			in.GetPagination().OrderBy = "created_at"
+		}
+	}
+
+	query += ` ORDER BY ` + in.GetPagination().GetOrderBy() + ` ` + in.GetPagination().GetSort().String()
+
+	if in.GetPagination().GetLimit() > 0 {
+		query += fmt.Sprintf(` LIMIT $%d OFFSET $%d`, (len(paramQueries) + 1), (len(paramQueries) + 2))
+		paramQueries = append(paramQueries, in.GetPagination().GetLimit(), in.GetPagination().GetOffset())
+	}
+
+	return query, paramQueries, &paginationResponse, nil
+}
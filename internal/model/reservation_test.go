@@ -0,0 +1,254 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (u testProduct) reserve(ctx context.Context, tx *sql.Tx, salesOrderID string, barcode string, qty int32) error {
+	reservation := Reservation{Pb: inventories.Reservation{
+		BranchId:     u.branchID,
+		SalesOrderId: salesOrderID,
+		ProductId:    u.productID,
+		Barcode:      barcode,
+		Qty:          qty,
+		ExpiredAt:    time.Now().UTC().Add(time.Hour).Format("2006-01-02T15:04:05.000Z"),
+	}}
+
+	return reservation.Create(ctx, tx)
+}
+
+func TestReservationContention(t *testing.T) {
+	db := openTestDB(t)
+	product := newTestProduct(t, db)
+	product.receive(t, db, 1)
+
+	first, err := db.BeginTx(product.ctx, nil)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	defer first.Rollback()
+
+	err = product.reserve(product.ctx, first, uuid.New().String(), "", 1)
+	if err != nil {
+		t.Fatalf("first reservation: %v", err)
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- inTx(product.ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+			return product.reserve(ctx, tx, uuid.New().String(), "", 1)
+		})
+	}()
+
+	// the second order waits for the first one, it can not read the stock before the first reservation is committed
+	select {
+	case err = <-result:
+		t.Fatalf("second reservation did not wait for the first one: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	err = first.Commit()
+	if err != nil {
+		t.Fatalf("commit first reservation: %v", err)
+	}
+
+	err = <-result
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("second reservation = %v, want %v", err, codes.FailedPrecondition)
+	}
+}
+
+func TestReservationOfReservedBarcode(t *testing.T) {
+	db := openTestDB(t)
+	product := newTestProduct(t, db)
+	barcodes := product.receive(t, db, 2)
+
+	reserve := func(salesOrderID string) error {
+		return inTx(product.ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+			return product.reserve(ctx, tx, salesOrderID, barcodes[0], 1)
+		})
+	}
+
+	err := reserve(uuid.New().String())
+	if err != nil {
+		t.Fatalf("reserve barcode: %v", err)
+	}
+
+	// the stock of the branch is still available, the unit itself is not
+	err = reserve(uuid.New().String())
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("reserve the barcode for another order = %v, want %v", err, codes.FailedPrecondition)
+	}
+}
+
+func TestCheckQtyKeepsReservedStock(t *testing.T) {
+	db := openTestDB(t)
+	product := newTestProduct(t, db)
+	product.receive(t, db, 1)
+
+	salesOrderID := uuid.New().String()
+	err := inTx(product.ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		return product.reserve(ctx, tx, salesOrderID, "", 1)
+	})
+	if err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		salesOrderID string
+		code         codes.Code
+	}{
+		{"the order holding the stock", salesOrderID, codes.OK},
+		{"another order", uuid.New().String(), codes.FailedPrecondition},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx, err := db.BeginTx(product.ctx, nil)
+			if err != nil {
+				t.Fatalf("begin: %v", err)
+			}
+			defer tx.Rollback()
+
+			outbound := Inventory{BranchID: product.branchID, ShelveID: product.shelveID, ProductID: product.productID, Qty: 1}
+			err = outbound.CheckQty(product.ctx, tx, tt.salesOrderID)
+			if status.Code(err) != tt.code {
+				t.Errorf("check qty = %v, want %v", err, tt.code)
+			}
+		})
+	}
+}
+
+func TestUnitOutboundKeepsReservedStock(t *testing.T) {
+	db := openTestDB(t)
+	product := newTestProduct(t, db)
+	barcodes := product.receive(t, db, 1)
+
+	// the order holds the qty of the branch, not a barcode
+	salesOrderID := uuid.New().String()
+	err := inTx(product.ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		return product.reserve(ctx, tx, salesOrderID, "", 1)
+	})
+	if err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+
+	delivery := func(salesOrderID string) func(ctx context.Context, tx *sql.Tx) error {
+		return func(ctx context.Context, tx *sql.Tx) error {
+			detail := DeliveryDetail{
+				Pb: inventories.DeliveryDetail{
+					Barcode: barcodes[0],
+					Product: &inventories.Product{Id: product.productID},
+					Shelve:  &inventories.Shelve{Id: product.shelveID},
+				},
+				PbDelivery: inventories.Delivery{BranchId: product.branchID, SalesOrderId: salesOrderID},
+			}
+			return detail.checkUnit(ctx, tx)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		check func(ctx context.Context, tx *sql.Tx) error
+		code  codes.Code
+	}{
+		{"delivery of the order holding the stock", delivery(salesOrderID), codes.OK},
+		{"delivery of another order", delivery(uuid.New().String()), codes.FailedPrecondition},
+		{"receive return", func(ctx context.Context, tx *sql.Tx) error {
+			detail := ReceiveReturnDetail{
+				Pb: inventories.ReceiveReturnDetail{
+					Barcode: barcodes[0],
+					Product: &inventories.Product{Id: product.productID},
+					Shelve:  &inventories.Shelve{Id: product.shelveID},
+				},
+				PbReceiveReturn: inventories.ReceiveReturn{BranchId: product.branchID},
+			}
+			return detail.checkUnit(ctx, tx, &UnitStatus{Barcode: barcodes[0]})
+		}, codes.FailedPrecondition},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx, err := db.BeginTx(product.ctx, nil)
+			if err != nil {
+				t.Fatalf("begin: %v", err)
+			}
+			defer tx.Rollback()
+
+			err = tt.check(product.ctx, tx)
+			if status.Code(err) != tt.code {
+				t.Errorf("check unit = %v, want %v", err, tt.code)
+			}
+		})
+	}
+}
+
+func TestFulfillKeepsTheRestOfTheOrder(t *testing.T) {
+	db := openTestDB(t)
+	product := newTestProduct(t, db)
+	barcodes := product.receive(t, db, 3)
+
+	salesOrderID := uuid.New().String()
+	err := inTx(product.ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		err := product.reserve(ctx, tx, salesOrderID, barcodes[0], 1)
+		if err != nil {
+			return err
+		}
+
+		return product.reserve(ctx, tx, salesOrderID, "", 2)
+	})
+	if err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+
+	fulfill := func(barcode string) {
+		t.Helper()
+		err := inTx(product.ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+			reservation := Reservation{Pb: inventories.Reservation{
+				BranchId:     product.branchID,
+				SalesOrderId: salesOrderID,
+				ProductId:    product.productID,
+				Barcode:      barcode,
+			}}
+			return reservation.Fulfill(ctx, tx, 1)
+		})
+		if err != nil {
+			t.Fatalf("fulfill %s: %v", barcode, err)
+		}
+	}
+
+	held := func() (units int32, qty int32) {
+		t.Helper()
+		err := db.QueryRow(`
+			SELECT COUNT(barcode), COALESCE(SUM(qty) FILTER (WHERE barcode IS NULL), 0) FROM reservations
+			WHERE company_id = $1 AND sales_order_id = $2 AND status = $3`,
+			product.companyID, salesOrderID, ReservationActive,
+		).Scan(&units, &qty)
+		if err != nil {
+			t.Fatalf("held reservations: %v", err)
+		}
+
+		return units, qty
+	}
+
+	// the reserved unit is delivered, the qty of the order is still held
+	fulfill(barcodes[0])
+	if units, qty := held(); units != 0 || qty != 2 {
+		t.Errorf("after the reserved unit held %d units and qty %d, want 0 and 2", units, qty)
+	}
+
+	// a unit without its own reservation takes one off the qty
+	fulfill(barcodes[1])
+	if units, qty := held(); units != 0 || qty != 1 {
+		t.Errorf("after another unit held %d units and qty %d, want 0 and 1", units, qty)
+	}
+}
@@ -0,0 +1,38 @@
+package model
+
+import (
+	"context"
+
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"github.com/jacky-htg/erp-proto/go/pb/sales"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SalesOrder struct
+type SalesOrder struct {
+	SalesOrderClient sales.SalesOrderServiceClient
+	Id               string
+}
+
+// Outstanding qty ordered per product on the sales order, an unknown sales order is returned as not found
+func (u *SalesOrder) Outstanding(ctx context.Context) (*inventories.OutstandingResponse, error) {
+	var output inventories.OutstandingResponse
+	out, err := u.SalesOrderClient.GetOutstandingSalesOrderDetails(ctx, &sales.OutstandingSalesOrderRequest{Id: u.Id})
+	if err != nil {
+		if s, ok := status.FromError(err); !ok || s.Code() == codes.Unknown {
+			err = status.Errorf(codes.Internal, "Error when calling sales.GetOutstandingSalesOrderDetails service: %s", err)
+		}
+
+		return &output, err
+	}
+
+	for _, v := range out.GetDetail() {
+		output.Detail = append(output.Detail, &inventories.OutstandingDetail{
+			ProductId: v.GetProductId(),
+			Quantity:  uint32(v.GetQuantity()),
+		})
+	}
+
+	return &output, nil
+}
@@ -96,7 +96,7 @@ func (u *Shelve) GetByCode(ctx context.Context, db *sql.DB) error {
 }
 
 // Create Shelve
-func (u *Shelve) Create(ctx context.Context, db *sql.DB) error {
+func (u *Shelve) Create(ctx context.Context, tx *sql.Tx) error {
 	u.Pb.Id = uuid.New().String()
 	now := time.Now().UTC()
 	u.Pb.CreatedBy = ctx.Value(app.Ctx("userID")).(string)
@@ -106,7 +106,7 @@ func (u *Shelve) Create(ctx context.Context, db *sql.DB) error {
 		INSERT INTO shelves (id, warehouse_id, code, capacity, created_at, created_by, updated_at, updated_by) 
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 	`
-	stmt, err := db.PrepareContext(ctx, query)
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare insert shelve: %v", err)
 	}
@@ -133,7 +133,7 @@ func (u *Shelve) Create(ctx context.Context, db *sql.DB) error {
 }
 
 // Update Shelve
-func (u *Shelve) Update(ctx context.Context, db *sql.DB) error {
+func (u *Shelve) Update(ctx context.Context, tx *sql.Tx) error {
 	now := time.Now().UTC()
 	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
 
@@ -144,7 +144,7 @@ func (u *Shelve) Update(ctx context.Context, db *sql.DB) error {
 		updated_by= $3
 		WHERE id = $4
 	`
-	stmt, err := db.PrepareContext(ctx, query)
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare update shelve: %v", err)
 	}
@@ -166,8 +166,8 @@ func (u *Shelve) Update(ctx context.Context, db *sql.DB) error {
 }
 
 // Delete Shelve
-func (u *Shelve) Delete(ctx context.Context, db *sql.DB) error {
-	stmt, err := db.PrepareContext(ctx, `DELETE FROM shelves WHERE id = $1`)
+func (u *Shelve) Delete(ctx context.Context, tx *sql.Tx) error {
+	stmt, err := tx.PrepareContext(ctx, `DELETE FROM shelves WHERE id = $1`)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare delete shelve: %v", err)
 	}
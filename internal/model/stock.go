@@ -3,6 +3,7 @@ package model
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"strings"
 	"time"
 
@@ -14,31 +15,65 @@ import (
 
 // Stock struct
 type Stock struct {
-	ListInput inventories.StockListInput
-	InfoInput inventories.StockInfoInput
-	StockInfo inventories.StockInfo
-	StockList inventories.StockList
+	ClosingInput inventories.ClosingStockRequest
+	InfoInput    inventories.StockInfoInput
+	StockInfo    inventories.StockInfo
 }
 
-// Closing Stock
+// Closing Stock of the requested period, the result is written as the saldo of the next month
 func (u *Stock) Closing(ctx context.Context, tx *sql.Tx) error {
-	stmt, err := tx.PrepareContext(ctx, `CALL closing_stocks($1, 0, 0)`)
+	closingPeriod := ClosingPeriod{Year: int(u.ClosingInput.GetYear()), Month: int(u.ClosingInput.GetMonth())}
+	err := closingPeriod.IsNext(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `CALL closing_stocks($1, $2, $3)`)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare closing stock: %v", err)
 	}
 	defer stmt.Close()
 
-	_, err = stmt.ExecContext(ctx, ctx.Value(app.Ctx("companyID")).(string))
+	_, err = stmt.ExecContext(ctx, ctx.Value(app.Ctx("companyID")).(string), closingPeriod.Year, closingPeriod.Month)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Exec closing stock: %v", err)
 	}
 
+	// transactions dated in the closed month are blocked from now on
+	return closingPeriod.Create(ctx, tx)
+}
+
+// Reopen Stock of the requested period, the saldo produced by closing the period and any later period is removed
+func (u *Stock) Reopen(ctx context.Context, tx *sql.Tx) error {
+	closingPeriod := ClosingPeriod{Year: int(u.ClosingInput.GetYear()), Month: int(u.ClosingInput.GetMonth())}
+	err := closingPeriod.Delete(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	// saldo of a month is the opening balance written when the previous month was closed
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM saldo_stock_details WHERE saldo_stock_id IN (
+			SELECT id FROM saldo_stocks WHERE company_id = $1 AND (year * 100 + month) > $2
+		)`,
+		ctx.Value(app.Ctx("companyID")).(string), closingPeriod.Year*100+closingPeriod.Month,
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec delete saldo stock details: %v", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM saldo_stocks WHERE company_id = $1 AND (year * 100 + month) > $2`,
+		ctx.Value(app.Ctx("companyID")).(string), closingPeriod.Year*100+closingPeriod.Month,
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec delete saldo stocks: %v", err)
+	}
+
 	return nil
 }
 
-// List Stock
-func (u *Stock) List(ctx context.Context, db *sql.DB) error {
-	const productSelect string = `
+// stockProductSelect the product columns of a stock row, followed by the stock and in transit columns
+const stockProductSelect string = `
 	products.id, products.company_id, 
 	brands.id, brands.code, brands.name,
 	product_categories.id, product_categories.name,
@@ -46,82 +81,116 @@ func (u *Stock) List(ctx context.Context, db *sql.DB) error {
 	products.created_at, products.created_by, products.updated_at, products.updated_by,
 	`
 
-	var stockQuery string = `stock (` + ctx.Value(app.Ctx("companyID")).(string) + `, products.id)`
-	if len(u.ListInput.GetBranchId()) > 0 {
-		stockQuery = `stock_branch (` + ctx.Value(app.Ctx("companyID")).(string) + `, ` + u.ListInput.GetBranchId() + `, products.id)`
-	}
-
-	query := `SELECT ` + productSelect + stockQuery + ` 
-		FROM products 
-		JOIN brands ON products.brand_id = brands.id AND products.company_id = brands.company_id
-		JOIN product_categories ON products.product_category_id = product_categories.id AND products.company_id = product_categories.company_id 
-	`
+// ListQuery Stock. With warehouse or shelve, the stock is the balance of the warehouse or shelve
+// and only products held there are listed.
+func (u *Stock) ListQuery(ctx context.Context, db *sql.DB, in *inventories.StockListInput) (string, []interface{}, *inventories.StockPaginationResponse, error) {
+	var paginationResponse inventories.StockPaginationResponse
 	where := []string{"products.company_id = $1"}
 	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string)}
 
-	if len(where) > 0 {
-		query += ` WHERE ` + strings.Join(where, " AND ")
-	}
-	rows, err := db.QueryContext(ctx, query, paramQueries...)
+	stockQuery, transitQuery, paramQueries, err := buildStockQuery(in.GetBranchId(), in.GetAsOfDate(), paramQueries)
 	if err != nil {
-		return status.Error(codes.Internal, err.Error())
+		return "", paramQueries, &paginationResponse, err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var pbStockInfo inventories.StockInfo
-		var pbProduct inventories.Product
-		var companyID string
-		var createdAt, updatedAt time.Time
-		var pbBrand inventories.Brand
-		var pbProductCategory inventories.ProductCategory
-		var stock int32
-		err = rows.Scan(
-			&pbProduct.Id, &companyID,
-			&pbBrand.Id, &pbBrand.Code, &pbBrand.Name,
-			&pbProductCategory.Id, &pbProductCategory.Name,
-			&pbProduct.Code, &pbProduct.Name, &pbProduct.MinimumStock,
-			&createdAt, &pbProduct.CreatedBy, &updatedAt, &pbProduct.UpdatedBy,
-			&stock,
-		)
+	if len(in.GetWarehouseId()) > 0 || len(in.GetShelveId()) > 0 {
+		if len(in.GetAsOfDate()) > 0 {
+			return "", paramQueries, &paginationResponse, status.Error(codes.InvalidArgument, "as of date can not be combined with warehouse or shelve")
+		}
 
-		if err != nil {
-			return status.Errorf(codes.Internal, "scan data: %v", err)
+		balanceWhere := []string{"stock_balances.company_id = $1", "stock_balances.product_id = products.id"}
+		if len(in.GetBranchId()) > 0 {
+			balanceWhere = append(balanceWhere, "stock_balances.branch_id = $2")
 		}
 
-		pbProduct.Brand = &pbBrand
-		pbProduct.ProductCategory = &pbProductCategory
+		if len(in.GetWarehouseId()) > 0 {
+			paramQueries = append(paramQueries, in.GetWarehouseId())
+			balanceWhere = append(balanceWhere, fmt.Sprintf(`stock_balances.warehouse_id = $%d`, len(paramQueries)))
+		}
 
-		pbProduct.CreatedAt = createdAt.String()
-		pbProduct.UpdatedAt = updatedAt.String()
-		pbStockInfo.Product = &pbProduct
-		pbStockInfo.Qty = stock
-		u.StockList.StockInfos = append(u.StockList.StockInfos, &pbStockInfo)
+		if len(in.GetShelveId()) > 0 {
+			paramQueries = append(paramQueries, in.GetShelveId())
+			balanceWhere = append(balanceWhere, fmt.Sprintf(`stock_balances.shelve_id = $%d`, len(paramQueries)))
+		}
+
+		stockQuery = `COALESCE((SELECT SUM(stock_balances.qty) FROM stock_balances WHERE ` + strings.Join(balanceWhere, " AND ") + `), 0)`
+		where = append(where, `EXISTS (SELECT 1 FROM stock_balances WHERE `+strings.Join(balanceWhere, " AND ")+` AND stock_balances.qty <> 0)`)
 	}
 
-	if rows.Err() != nil {
-		return status.Errorf(codes.Internal, "rows error: %v", err)
+	if len(in.GetBrandId()) > 0 {
+		paramQueries = append(paramQueries, in.GetBrandId())
+		where = append(where, fmt.Sprintf(`products.brand_id = $%d`, len(paramQueries)))
 	}
 
-	return nil
+	if len(in.GetProductCategoryId()) > 0 {
+		paramQueries = append(paramQueries, in.GetProductCategoryId())
+		where = append(where, fmt.Sprintf(`products.product_category_id = $%d`, len(paramQueries)))
+	}
+
+	if in.GetBelowMinimumStock() {
+		where = append(where, stockQuery+` < products.minimum_stock`)
+	}
+
+	if len(in.GetPagination().GetSearch()) > 0 {
+		paramQueries = append(paramQueries, "%"+in.GetPagination().GetSearch()+"%")
+		where = append(where, fmt.Sprintf(`(
+			products.name ILIKE $%d OR 
+			products.code ILIKE $%d OR 
+			brands.name ILIKE $%d OR 
+			brands.code ILIKE $%d OR 
+			product_categories.name ILIKE $%d)`,
+			len(paramQueries), len(paramQueries), len(paramQueries), len(paramQueries), len(paramQueries)))
+	}
+
+	query := `SELECT ` + stockProductSelect + stockQuery + `, ` + transitQuery + ` 
+		FROM products 
+		JOIN brands ON products.brand_id = brands.id AND products.company_id = brands.company_id
+		JOIN product_categories ON products.product_category_id = product_categories.id AND products.company_id = product_categories.company_id 
+		WHERE ` + strings.Join(where, " AND ")
+
+	{
+		// counted over the same select so every param of the stock columns is referenced
+		var count int
+		err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM (`+query+`) stocks`, paramQueries...).Scan(&count)
+		if err != nil && err != sql.ErrNoRows {
+			return query, paramQueries, &paginationResponse, status.Error(codes.Internal, err.Error())
+		}
+
+		paginationResponse.Count = uint32(count)
+	}
+
+	if len(in.GetPagination().GetOrderBy()) == 0 || !(in.GetPagination().GetOrderBy() == "products.name" || in.GetPagination().GetOrderBy() == "products.code") {
+		if in.GetPagination() == nil {
+			in.Pagination = &inventories.Pagination{OrderBy: "products.created_at"}
+		} else {
+			in.GetPagination().OrderBy = "products.created_at"
+		}
+	}
+
+	query += ` ORDER BY ` + in.GetPagination().GetOrderBy() + ` ` + in.GetPagination().GetSort().String()
+
+	if in.GetPagination().GetLimit() > 0 {
+		query += fmt.Sprintf(` LIMIT $%d OFFSET $%d`, (len(paramQueries) + 1), (len(paramQueries) + 2))
+		paramQueries = append(paramQueries, in.GetPagination().GetLimit(), in.GetPagination().GetOffset())
+	}
+
+	return query, paramQueries, &paginationResponse, nil
+}
+
+// Lots of the listed stock, grouped by product
+func (u *Stock) Lots(ctx context.Context, db *sql.DB, branchID string, asOfDate string) (map[string][]*inventories.LotStock, error) {
+	return stockLots(ctx, db, "", branchID, asOfDate)
 }
 
 // Info Stock
 func (u *Stock) Info(ctx context.Context, db *sql.DB) error {
-	const productSelect string = `
-	products.id, products.company_id, 
-	brands.id, brands.code, brands.name,
-	product_categories.id, product_categories.name,
-	products.code, products.name, products.minimum_stock, 
-	products.created_at, products.created_by, products.updated_at, products.updated_by,
-	`
-
-	var stockQuery string = `stock (` + ctx.Value(app.Ctx("companyID")).(string) + `, products.id)`
-	if len(u.ListInput.GetBranchId()) > 0 {
-		stockQuery = `stock_branch (` + ctx.Value(app.Ctx("companyID")).(string) + `, ` + u.ListInput.GetBranchId() + `, products.id)`
+	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string), u.InfoInput.GetProductId()}
+	stockQuery, transitQuery, paramQueries, err := buildStockQuery(u.InfoInput.GetBranchId(), u.InfoInput.GetAsOfDate(), paramQueries)
+	if err != nil {
+		return err
 	}
 
-	query := `SELECT ` + productSelect + stockQuery + ` 
+	query := `SELECT ` + stockProductSelect + stockQuery + `, ` + transitQuery + ` 
 		FROM products 
 		JOIN brands ON products.brand_id = brands.id AND products.company_id = brands.company_id
 		JOIN product_categories ON products.product_category_id = product_categories.id AND products.company_id = product_categories.company_id 
@@ -143,14 +212,14 @@ func (u *Stock) Info(ctx context.Context, db *sql.DB) error {
 	var createdAt, updatedAt time.Time
 	var pbBrand inventories.Brand
 	var pbProductCategory inventories.ProductCategory
-	var stock int32
-	err = stmt.QueryRowContext(ctx, ctx.Value(app.Ctx("companyID")).(string), u.InfoInput.ProductId).Scan(
+	var stock, inTransit int32
+	err = stmt.QueryRowContext(ctx, paramQueries...).Scan(
 		&pbProduct.Id, &companyID,
 		&pbBrand.Id, &pbBrand.Code, &pbBrand.Name,
 		&pbProductCategory.Id, &pbProductCategory.Name,
 		&pbProduct.Code, &pbProduct.Name, &pbProduct.MinimumStock,
 		&createdAt, &pbProduct.CreatedBy, &updatedAt, &pbProduct.UpdatedBy,
-		&stock,
+		&stock, &inTransit,
 	)
 
 	if err == sql.ErrNoRows {
@@ -171,10 +240,126 @@ func (u *Stock) Info(ctx context.Context, db *sql.DB) error {
 	pbProduct.CreatedAt = createdAt.String()
 	pbProduct.UpdatedAt = updatedAt.String()
 
+	lots, err := stockLots(ctx, db, pbProduct.GetId(), u.InfoInput.GetBranchId(), u.InfoInput.GetAsOfDate())
+	if err != nil {
+		return err
+	}
+
+	// reservations are held now, they are not part of a stock as of date
+	var branchID interface{}
+	if len(u.InfoInput.GetBranchId()) > 0 {
+		branchID = u.InfoInput.GetBranchId()
+	}
+	var reserved int32
+	err = db.QueryRowContext(ctx, `SELECT stock_reserved($1, $2, $3)`, companyID, branchID, pbProduct.GetId()).Scan(&reserved)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw get stock reserved: %v", err)
+	}
+
 	u.StockInfo = inventories.StockInfo{
-		Product: &pbProduct,
-		Qty:     stock,
+		Product:   &pbProduct,
+		Qty:       stock,
+		InTransit: inTransit,
+		Lots:      lots[pbProduct.GetId()],
+		OnHand:    stock,
+		Reserved:  reserved,
+		Available: stock - reserved,
 	}
 
 	return nil
 }
+
+// stockLots breakdown of the stock by lot, grouped by product. Saldo does not keep lots,
+// so the balance of a lot is the sum of all its movements.
+func stockLots(ctx context.Context, db *sql.DB, productID string, branchID string, asOfDate string) (map[string][]*inventories.LotStock, error) {
+	where := []string{"inventories.company_id = $1"}
+	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string)}
+
+	if len(productID) > 0 {
+		paramQueries = append(paramQueries, productID)
+		where = append(where, fmt.Sprintf(`inventories.product_id = $%d`, len(paramQueries)))
+	}
+
+	if len(branchID) > 0 {
+		paramQueries = append(paramQueries, branchID)
+		where = append(where, fmt.Sprintf(`inventories.branch_id = $%d`, len(paramQueries)))
+	}
+
+	if len(asOfDate) > 0 {
+		asOf, err := time.Parse("2006-01-02T15:04:05.000Z", asOfDate)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "Please supply valid as of date")
+		}
+
+		paramQueries = append(paramQueries, asOf)
+		where = append(where, fmt.Sprintf(`inventories.transaction_date <= $%d`, len(paramQueries)))
+	}
+
+	const signedQty string = `SUM(
+		case
+			when inventories.in_out then inventories.qty
+			else -inventories.qty
+		end
+	)`
+	query := `SELECT inventories.product_id, lots.id, lots.code, lots.expired_date, ` + signedQty + ` 
+		FROM inventories
+		JOIN lots ON inventories.lot_id = lots.id
+		WHERE ` + strings.Join(where, " AND ") + `
+		GROUP BY inventories.product_id, lots.id, lots.code, lots.expired_date
+		HAVING ` + signedQty + ` <> 0
+		ORDER BY lots.expired_date, lots.code`
+
+	rows, err := db.QueryContext(ctx, query, paramQueries...)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Query Raw stock lots: %v", err)
+	}
+	defer rows.Close()
+
+	output := make(map[string][]*inventories.LotStock)
+	for rows.Next() {
+		var pbLot inventories.Lot
+		var expiredDate sql.NullTime
+		var qty int32
+		err = rows.Scan(&pbLot.ProductId, &pbLot.Id, &pbLot.Code, &expiredDate, &qty)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "scan stock lots: %v", err)
+		}
+
+		if expiredDate.Valid {
+			pbLot.ExpiredDate = expiredDate.Time.String()
+		}
+
+		output[pbLot.GetProductId()] = append(output[pbLot.GetProductId()], &inventories.LotStock{Lot: &pbLot, Qty: qty})
+	}
+
+	if rows.Err() != nil {
+		return nil, status.Errorf(codes.Internal, "rows stock lots: %v", rows.Err())
+	}
+
+	return output, nil
+}
+
+// buildStockQuery build the stock and in transit columns, the branch and as of date are appended to paramQueries.
+// Without as of date the stock is the current stock, units shipped by other branches stay visible as in transit
+// until the destination confirms them.
+func buildStockQuery(branchID string, asOfDate string, paramQueries []interface{}) (string, string, []interface{}, error) {
+	branchParam := "NULL"
+	stock := `stock($1, products.id)`
+	if len(branchID) > 0 {
+		paramQueries = append(paramQueries, branchID)
+		branchParam = fmt.Sprintf("$%d", len(paramQueries))
+		stock = `stock_branch($1, ` + branchParam + `, products.id)`
+	}
+
+	if len(asOfDate) > 0 {
+		asOf, err := time.Parse("2006-01-02T15:04:05.000Z", asOfDate)
+		if err != nil {
+			return "", "", paramQueries, status.Error(codes.InvalidArgument, "Please supply valid as of date")
+		}
+
+		paramQueries = append(paramQueries, asOf)
+		stock = fmt.Sprintf(`stock_as_of($1, %s, products.id, $%d)`, branchParam, len(paramQueries))
+	}
+
+	return `COALESCE(` + stock + `, 0)`, `stock_in_transit($1, ` + branchParam + `, products.id)`, paramQueries, nil
+}
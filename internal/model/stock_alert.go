@@ -0,0 +1,292 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-pkg/util"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// status of a stock alert, an alert stays unresolved until the stock of the branch is back to the minimum
+const (
+	StockAlertOpen         string = "OPEN"
+	StockAlertAcknowledged string = "ACKNOWLEDGED"
+	StockAlertResolved     string = "RESOLVED"
+)
+
+// StockAlert struct
+type StockAlert struct {
+	Pb inventories.StockAlert
+}
+
+// stockAlertSelect the columns of a stock alert with its product
+const stockAlertSelect string = `
+	SELECT stock_alerts.id, stock_alerts.company_id, stock_alerts.branch_id, stock_alerts.product_id, products.code, products.name,
+		stock_alerts.qty, stock_alerts.minimum_stock, stock_alerts.status, stock_alerts.created_at, stock_alerts.updated_at,
+		stock_alerts.acknowledged_at, COALESCE(stock_alerts.acknowledged_by, ''), stock_alerts.resolved_at
+	FROM stock_alerts
+	JOIN products ON stock_alerts.product_id = products.id
+`
+
+// Get func
+func (u *StockAlert) Get(ctx context.Context, db *sql.DB) error {
+	stmt, err := db.PrepareContext(ctx, stockAlertSelect+` WHERE stock_alerts.id = $1`)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare statement Get stock alert: %v", err)
+	}
+	defer stmt.Close()
+
+	err = u.Scan(stmt.QueryRowContext(ctx, u.Pb.GetId()))
+
+	if err == sql.ErrNoRows {
+		return status.Errorf(codes.NotFound, "Query Raw get stock alert: %v", err)
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw get stock alert: %v", err)
+	}
+
+	if u.Pb.GetCompanyId() != ctx.Value(app.Ctx("companyID")).(string) {
+		return status.Error(codes.Unauthenticated, "its not your company data")
+	}
+
+	return nil
+}
+
+// Scan a row of stockAlertSelect
+func (u *StockAlert) Scan(row interface{ Scan(...interface{}) error }) error {
+	var createdAt, updatedAt time.Time
+	var acknowledgedAt, resolvedAt sql.NullTime
+	err := row.Scan(
+		&u.Pb.Id, &u.Pb.CompanyId, &u.Pb.BranchId, &u.Pb.ProductId, &u.Pb.ProductCode, &u.Pb.ProductName,
+		&u.Pb.Qty, &u.Pb.MinimumStock, &u.Pb.Status, &createdAt, &updatedAt,
+		&acknowledgedAt, &u.Pb.AcknowledgedBy, &resolvedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	u.Pb.CreatedAt = createdAt.String()
+	u.Pb.UpdatedAt = updatedAt.String()
+	if acknowledgedAt.Valid {
+		u.Pb.AcknowledgedAt = acknowledgedAt.Time.String()
+	}
+	if resolvedAt.Valid {
+		u.Pb.ResolvedAt = resolvedAt.Time.String()
+	}
+
+	return nil
+}
+
+// Acknowledge an open alert, the alert stays unresolved until the stock is back
+func (u *StockAlert) Acknowledge(ctx context.Context, tx *sql.Tx) error {
+	now := time.Now().UTC()
+	userID := ctx.Value(app.Ctx("userID")).(string)
+
+	err := tx.QueryRowContext(ctx, `
+		UPDATE stock_alerts SET status = $1, acknowledged_at = $2, acknowledged_by = $3, updated_at = $2
+		WHERE id = $4 AND company_id = $5 AND status = $6
+		RETURNING status`,
+		StockAlertAcknowledged, now, userID, u.Pb.GetId(), ctx.Value(app.Ctx("companyID")).(string), StockAlertOpen,
+	).Scan(&u.Pb.Status)
+
+	if err == sql.ErrNoRows {
+		return status.Error(codes.FailedPrecondition, "stock alert is not open")
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec acknowledge stock alert: %v", err)
+	}
+
+	u.Pb.AcknowledgedAt = now.String()
+	u.Pb.AcknowledgedBy = userID
+	u.Pb.UpdatedAt = now.String()
+
+	return nil
+}
+
+// Evaluate the stock of each product per branch against its minimum stock. A product below its minimum
+// raises an alert unless one is unresolved already, an unresolved alert of a product back to its minimum
+// is resolved. The branches are the branches having warehouses, an empty companyID or branchID evaluates all
+// of them. The new alerts are returned.
+func (u *StockAlert) Evaluate(ctx context.Context, db *sql.DB, companyID string, branchID string, productIDs []string) ([]*inventories.StockAlert, error) {
+	var raised []*inventories.StockAlert
+
+	where := []string{"(products.minimum_stock > 0 OR stock_alerts.id IS NOT NULL)"}
+	paramQueries := []interface{}{StockAlertResolved}
+
+	if len(companyID) > 0 {
+		paramQueries = append(paramQueries, companyID)
+		where = append(where, fmt.Sprintf(`products.company_id = $%d`, len(paramQueries)))
+	}
+
+	if len(branchID) > 0 {
+		paramQueries = append(paramQueries, branchID)
+		where = append(where, fmt.Sprintf(`branches.branch_id = $%d`, len(paramQueries)))
+	}
+
+	if len(productIDs) > 0 {
+		ids := make([]interface{}, len(productIDs))
+		for i, productID := range productIDs {
+			ids[i] = productID
+		}
+		var iCond string
+		paramQueries, iCond = util.ConvertWhereIn("products.id", paramQueries, ids)
+		where = append(where, iCond)
+	}
+
+	query := `
+		SELECT products.company_id, branches.branch_id, products.id, products.code, products.name, products.minimum_stock,
+			COALESCE((
+				SELECT SUM(stock_balances.qty) FROM stock_balances
+				WHERE stock_balances.company_id = products.company_id AND stock_balances.branch_id = branches.branch_id
+					AND stock_balances.product_id = products.id
+			), 0),
+			COALESCE(stock_alerts.id, '')
+		FROM products
+		JOIN (SELECT DISTINCT company_id, branch_id FROM warehouses) branches ON products.company_id = branches.company_id
+		LEFT JOIN stock_alerts ON stock_alerts.company_id = products.company_id AND stock_alerts.branch_id = branches.branch_id
+			AND stock_alerts.product_id = products.id AND stock_alerts.status <> $1
+		WHERE ` + strings.Join(where, " AND ")
+
+	rows, err := db.QueryContext(ctx, query, paramQueries...)
+	if err != nil {
+		return raised, status.Errorf(codes.Internal, "Query Raw evaluate stock alerts: %v", err)
+	}
+
+	var below, resolved []*inventories.StockAlert
+	for rows.Next() {
+		var pbStockAlert inventories.StockAlert
+		err = rows.Scan(&pbStockAlert.CompanyId, &pbStockAlert.BranchId, &pbStockAlert.ProductId, &pbStockAlert.ProductCode,
+			&pbStockAlert.ProductName, &pbStockAlert.MinimumStock, &pbStockAlert.Qty, &pbStockAlert.Id)
+		if err != nil {
+			rows.Close()
+			return raised, status.Errorf(codes.Internal, "scan evaluate stock alerts: %v", err)
+		}
+
+		if pbStockAlert.GetQty() < pbStockAlert.GetMinimumStock() {
+			if len(pbStockAlert.GetId()) == 0 {
+				below = append(below, &pbStockAlert)
+			}
+		} else if len(pbStockAlert.GetId()) > 0 {
+			resolved = append(resolved, &pbStockAlert)
+		}
+	}
+
+	if rows.Err() != nil {
+		rows.Close()
+		return raised, status.Errorf(codes.Internal, "rows evaluate stock alerts: %v", rows.Err())
+	}
+	rows.Close()
+
+	now := time.Now().UTC()
+	for _, pbStockAlert := range resolved {
+		_, err = db.ExecContext(ctx, `UPDATE stock_alerts SET status = $1, qty = $2, resolved_at = $3, updated_at = $3 WHERE id = $4`,
+			StockAlertResolved, pbStockAlert.GetQty(), now, pbStockAlert.GetId())
+		if err != nil {
+			return raised, status.Errorf(codes.Internal, "Exec resolve stock alert: %v", err)
+		}
+	}
+
+	for _, pbStockAlert := range below {
+		pbStockAlert.Id = uuid.New().String()
+		pbStockAlert.Status = StockAlertOpen
+
+		// an evaluation running concurrently may have raised the alert already
+		res, err := db.ExecContext(ctx, `
+			INSERT INTO stock_alerts (id, company_id, branch_id, product_id, qty, minimum_stock, status, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8)
+			ON CONFLICT (company_id, branch_id, product_id) WHERE status <> 'RESOLVED' DO NOTHING`,
+			pbStockAlert.GetId(), pbStockAlert.GetCompanyId(), pbStockAlert.GetBranchId(), pbStockAlert.GetProductId(),
+			pbStockAlert.GetQty(), pbStockAlert.GetMinimumStock(), pbStockAlert.GetStatus(), now,
+		)
+		if err != nil {
+			return raised, status.Errorf(codes.Internal, "Exec insert stock alert: %v", err)
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return raised, status.Errorf(codes.Internal, "rows affected insert stock alert: %v", err)
+		}
+
+		if affected > 0 {
+			pbStockAlert.CreatedAt = now.String()
+			pbStockAlert.UpdatedAt = pbStockAlert.CreatedAt
+			raised = append(raised, pbStockAlert)
+		}
+	}
+
+	return raised, nil
+}
+
+// ListQuery builder
+func (u *StockAlert) ListQuery(ctx context.Context, db *sql.DB, in *inventories.ListStockAlertRequest) (string, []interface{}, *inventories.StockAlertPaginationResponse, error) {
+	var paginationResponse inventories.StockAlertPaginationResponse
+	query := stockAlertSelect
+
+	where := []string{"stock_alerts.company_id = $1"}
+	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string)}
+
+	if len(in.GetBranchId()) > 0 {
+		paramQueries = append(paramQueries, in.GetBranchId())
+		where = append(where, fmt.Sprintf(`stock_alerts.branch_id = $%d`, len(paramQueries)))
+	}
+
+	if len(in.GetProductId()) > 0 {
+		paramQueries = append(paramQueries, in.GetProductId())
+		where = append(where, fmt.Sprintf(`stock_alerts.product_id = $%d`, len(paramQueries)))
+	}
+
+	if len(in.GetStatus()) > 0 {
+		paramQueries = append(paramQueries, in.GetStatus())
+		where = append(where, fmt.Sprintf(`stock_alerts.status = $%d`, len(paramQueries)))
+	}
+
+	if len(in.GetPagination().GetSearch()) > 0 {
+		paramQueries = append(paramQueries, "%"+in.GetPagination().GetSearch()+"%")
+		where = append(where, fmt.Sprintf(`(products.name ILIKE $%d OR products.code ILIKE $%d)`, len(paramQueries), len(paramQueries)))
+	}
+
+	{
+		qCount := `SELECT COUNT(*) FROM stock_alerts JOIN products ON stock_alerts.product_id = products.id`
+		if len(where) > 0 {
+			qCount += " WHERE " + strings.Join(where, " AND ")
+		}
+		var count int
+		err := db.QueryRowContext(ctx, qCount, paramQueries...).Scan(&count)
+		if err != nil && err != sql.ErrNoRows {
+			return query, paramQueries, &paginationResponse, status.Error(codes.Internal, err.Error())
+		}
+
+		paginationResponse.Count = uint32(count)
+	}
+
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+
+	if len(in.GetPagination().GetOrderBy()) == 0 || !(in.GetPagination().GetOrderBy() == "stock_alerts.updated_at") {
+		if in.GetPagination() == nil {
+			in.Pagination = &inventories.Pagination{OrderBy: "stock_alerts.created_at"}
+		} else {
+			in.GetPagination().OrderBy = "stock_alerts.created_at"
+		}
+	}
+
+	query += ` ORDER BY ` + in.GetPagination().GetOrderBy() + ` ` + in.GetPagination().GetSort().String()
+
+	if in.GetPagination().GetLimit() > 0 {
+		query += fmt.Sprintf(` LIMIT $%d OFFSET $%d`, (len(paramQueries) + 1), (len(paramQueries) + 2))
+		paramQueries = append(paramQueries, in.GetPagination().GetLimit(), in.GetPagination().GetOffset())
+	}
+
+	return query, paramQueries, &paginationResponse, nil
+}
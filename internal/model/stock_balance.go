@@ -0,0 +1,123 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StockBalance struct, the current qty of a product on a shelve
+type StockBalance struct {
+	CompanyID   string
+	BranchID    string
+	WarehouseID string
+	ShelveID    string
+	ProductID   string
+	Qty         int32
+}
+
+// StockBalanceDrift a balance that differs from the sum of its inventories
+type StockBalanceDrift struct {
+	StockBalance
+	Expected int32
+}
+
+// stockBalanceQuery the balances as the sum of the inventories
+const stockBalanceQuery string = `
+	SELECT inventories.company_id, inventories.branch_id, shelves.warehouse_id, inventories.shelve_id, inventories.product_id,
+		SUM(
+			case
+				when inventories.in_out then inventories.qty
+				else -inventories.qty
+			end
+		) qty
+	FROM inventories
+	JOIN shelves ON inventories.shelve_id = shelves.id
+	GROUP BY inventories.company_id, inventories.branch_id, shelves.warehouse_id, inventories.shelve_id, inventories.product_id
+`
+
+// applyStockBalance add the signed qty of an inventory movement to its balance, a negative sign reverts the movement
+func applyStockBalance(ctx context.Context, tx *sql.Tx, inventory *Inventory, sign int32) error {
+	qty := inventory.Qty * sign
+	if !inventory.IsIn {
+		qty = -qty
+	}
+
+	query := `
+		INSERT INTO stock_balances (company_id, branch_id, warehouse_id, shelve_id, product_id, qty, updated_at)
+		SELECT $1, $2, shelves.warehouse_id, shelves.id, $4, $5, $6 FROM shelves WHERE shelves.id = $3
+		ON CONFLICT (company_id, branch_id, warehouse_id, shelve_id, product_id)
+		DO UPDATE SET qty = stock_balances.qty + EXCLUDED.qty, updated_at = EXCLUDED.updated_at
+	`
+	_, err := tx.ExecContext(ctx, query,
+		inventory.CompanyID,
+		inventory.BranchID,
+		inventory.ShelveID,
+		inventory.ProductID,
+		qty,
+		time.Now().UTC(),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec apply stock balance: %v", err)
+	}
+
+	return nil
+}
+
+// Rebuild all stock balances from the inventories, the balances that drifted are returned
+func (u *StockBalance) Rebuild(ctx context.Context, tx *sql.Tx) ([]StockBalanceDrift, error) {
+	var drifts []StockBalanceDrift
+
+	_, err := tx.ExecContext(ctx, `LOCK TABLE stock_balances IN EXCLUSIVE MODE`)
+	if err != nil {
+		return drifts, status.Errorf(codes.Internal, "lock stock balances: %v", err)
+	}
+
+	query := `
+		WITH expected AS (` + stockBalanceQuery + `)
+		SELECT COALESCE(expected.company_id, stock_balances.company_id), COALESCE(expected.branch_id, stock_balances.branch_id),
+			COALESCE(expected.warehouse_id, stock_balances.warehouse_id), COALESCE(expected.shelve_id, stock_balances.shelve_id),
+			COALESCE(expected.product_id, stock_balances.product_id), COALESCE(stock_balances.qty, 0), COALESCE(expected.qty, 0)
+		FROM expected
+		FULL OUTER JOIN stock_balances ON expected.company_id = stock_balances.company_id AND expected.branch_id = stock_balances.branch_id
+			AND expected.warehouse_id = stock_balances.warehouse_id AND expected.shelve_id = stock_balances.shelve_id
+			AND expected.product_id = stock_balances.product_id
+		WHERE COALESCE(stock_balances.qty, 0) <> COALESCE(expected.qty, 0)
+	`
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return drifts, status.Errorf(codes.Internal, "Query Raw stock balance drift: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var drift StockBalanceDrift
+		err = rows.Scan(&drift.CompanyID, &drift.BranchID, &drift.WarehouseID, &drift.ShelveID, &drift.ProductID, &drift.Qty, &drift.Expected)
+		if err != nil {
+			return drifts, status.Errorf(codes.Internal, "scan stock balance drift: %v", err)
+		}
+
+		drifts = append(drifts, drift)
+	}
+
+	if rows.Err() != nil {
+		return drifts, status.Errorf(codes.Internal, "rows stock balance drift: %v", rows.Err())
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM stock_balances`)
+	if err != nil {
+		return drifts, status.Errorf(codes.Internal, "Exec delete stock balances: %v", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO stock_balances (company_id, branch_id, warehouse_id, shelve_id, product_id, qty)
+		SELECT company_id, branch_id, warehouse_id, shelve_id, product_id, qty FROM (`+stockBalanceQuery+`) expected`)
+	if err != nil {
+		return drifts, status.Errorf(codes.Internal, "Exec insert stock balances: %v", err)
+	}
+
+	return drifts, nil
+}
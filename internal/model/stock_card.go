@@ -0,0 +1,90 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StockCard struct
+type StockCard struct {
+	Opening   int32
+	Closing   int32
+	StartDate time.Time
+	EndDate   time.Time
+}
+
+// Balance get the opening balance of the day before start date and the closing balance of end date
+func (u *StockCard) Balance(ctx context.Context, db *sql.DB, in *inventories.StockCardRequest) error {
+	var branchID interface{}
+	if len(in.GetBranchId()) > 0 {
+		branchID = in.GetBranchId()
+	}
+
+	stmt, err := db.PrepareContext(ctx, `SELECT COALESCE(stock_as_of($1, $2, $3, $4), 0), COALESCE(stock_as_of($1, $2, $3, $5), 0)`)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare statement stock card balance: %v", err)
+	}
+	defer stmt.Close()
+
+	err = stmt.QueryRowContext(ctx,
+		ctx.Value(app.Ctx("companyID")).(string),
+		branchID,
+		in.GetProductId(),
+		u.StartDate.AddDate(0, 0, -1),
+		u.EndDate,
+	).Scan(&u.Opening, &u.Closing)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw stock card balance: %v", err)
+	}
+
+	return nil
+}
+
+// ListQuery builder of the movements with running balance, the balance is computed before paging
+func (u *StockCard) ListQuery(ctx context.Context, db *sql.DB, in *inventories.StockCardRequest) (string, []interface{}, *inventories.StockCardPaginationResponse, error) {
+	var paginationResponse inventories.StockCardPaginationResponse
+
+	where := []string{"inventories.company_id = $1", "inventories.product_id = $2", "inventories.transaction_date BETWEEN $3 AND $4"}
+	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string), in.GetProductId(), u.StartDate, u.EndDate}
+
+	if len(in.GetBranchId()) > 0 {
+		paramQueries = append(paramQueries, in.GetBranchId())
+		where = append(where, fmt.Sprintf(`inventories.branch_id = $%d`, len(paramQueries)))
+	}
+
+	{
+		qCount := `SELECT COUNT(*) FROM inventories WHERE ` + strings.Join(where, " AND ")
+		var count int
+		err := db.QueryRowContext(ctx, qCount, paramQueries...).Scan(&count)
+		if err != nil && err != sql.ErrNoRows {
+			return "", paramQueries, &paginationResponse, status.Error(codes.Internal, err.Error())
+		}
+
+		paginationResponse.Count = uint32(count)
+	}
+
+	const order string = `inventories.transaction_date, inventories.created_at, inventories.id`
+	paramQueries = append(paramQueries, u.Opening)
+	query := `SELECT ` + transactionSelect + fmt.Sprintf(`, $%d + SUM(
+			case
+				when inventories.in_out then inventories.qty
+				else -inventories.qty
+			end
+		) OVER (ORDER BY `+order+`)`, len(paramQueries)) +
+		transactionJoin + ` WHERE ` + strings.Join(where, " AND ") + ` ORDER BY ` + order
+
+	if in.GetPagination().GetLimit() > 0 {
+		query += fmt.Sprintf(` LIMIT $%d OFFSET $%d`, (len(paramQueries) + 1), (len(paramQueries) + 2))
+		paramQueries = append(paramQueries, in.GetPagination().GetLimit(), in.GetPagination().GetOffset())
+	}
+
+	return query, paramQueries, &paginationResponse, nil
+}
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StockChannel the postgres channel notified on every change of the inventories
+const StockChannel string = "stock_changes"
+
+// StockChange struct, the payload of a stock change notification
+type StockChange struct {
+	CompanyID   string `json:"company_id"`
+	BranchID    string `json:"branch_id"`
+	WarehouseID string `json:"warehouse_id"`
+	ProductID   string `json:"product_id"`
+	Operation   string `json:"operation"`
+}
+
+// Balance of the product after the change, in the warehouse when it is given, otherwise in the branch
+func (u *StockChange) Balance(ctx context.Context, db *sql.DB, warehouseID string) (int32, error) {
+	var qty int32
+	err := db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(qty), 0) FROM stock_balances
+		WHERE company_id = $1 AND branch_id = $2 AND product_id = $3 AND ($4 = '' OR warehouse_id = $4)`,
+		u.CompanyID, u.BranchID, u.ProductID, warehouseID,
+	).Scan(&qty)
+	if err != nil {
+		return qty, status.Errorf(codes.Internal, "Query Raw stock change balance: %v", err)
+	}
+
+	return qty, nil
+}
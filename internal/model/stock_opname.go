@@ -0,0 +1,460 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-pkg/util"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Stock opname status
+const (
+	StockOpnameOpen     = "OPEN"
+	StockOpnameApproved = "APPROVED"
+)
+
+// StockOpname struct
+type StockOpname struct {
+	Pb         inventories.StockOpname
+	PbVariance inventories.StockOpnameVariance
+	// elsewhere unexpected barcodes that inventories has in stock on a shelve not counted by the session
+	elsewhere map[string]unitLocation
+	// movedAfter barcodes of the variance with a movement dated after the opname date, they can not be adjusted
+	movedAfter []string
+}
+
+// unitLocation the branch and shelve a unit is in stock on
+type unitLocation struct {
+	branchID string
+	shelveID string
+}
+
+// Get func
+func (u *StockOpname) Get(ctx context.Context, db *sql.DB) error {
+	query := `
+		SELECT stock_opnames.id, stock_opnames.company_id, stock_opnames.branch_id, stock_opnames.branch_name,
+		stock_opnames.warehouse_id, warehouses.code, warehouses.name, stock_opnames.code, stock_opnames.opname_date,
+		stock_opnames.status, stock_opnames.remark, stock_opnames.created_at, stock_opnames.created_by,
+		stock_opnames.updated_at, stock_opnames.updated_by, COALESCE(stock_opnames.approved_by, ''),
+		json_agg(DISTINCT jsonb_build_object(
+			'id', shelves.id,
+			'code', shelves.code
+		)) as shelves
+		FROM stock_opnames
+		JOIN warehouses ON stock_opnames.warehouse_id = warehouses.id
+		JOIN stock_opname_shelves ON stock_opnames.id = stock_opname_shelves.stock_opname_id
+		JOIN shelves ON stock_opname_shelves.shelve_id = shelves.id
+		WHERE stock_opnames.id = $1
+		GROUP BY stock_opnames.id, warehouses.id
+	`
+
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare statement Get stock opname: %v", err)
+	}
+	defer stmt.Close()
+
+	var dateOpname, createdAt, updatedAt time.Time
+	var companyID, shelves string
+	var pbWarehouse inventories.Warehouse
+	err = stmt.QueryRowContext(ctx, u.Pb.GetId()).Scan(
+		&u.Pb.Id, &companyID, &u.Pb.BranchId, &u.Pb.BranchName,
+		&pbWarehouse.Id, &pbWarehouse.Code, &pbWarehouse.Name, &u.Pb.Code, &dateOpname,
+		&u.Pb.Status, &u.Pb.Remark, &createdAt, &u.Pb.CreatedBy,
+		&updatedAt, &u.Pb.UpdatedBy, &u.Pb.ApprovedBy, &shelves,
+	)
+
+	if err == sql.ErrNoRows {
+		return status.Errorf(codes.NotFound, "Query Raw get stock opname: %v", err)
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw get stock opname: %v", err)
+	}
+
+	if companyID != ctx.Value(app.Ctx("companyID")).(string) {
+		return status.Error(codes.Unauthenticated, "its not your company")
+	}
+
+	u.Pb.Warehouse = &pbWarehouse
+	u.Pb.OpnameDate = dateOpname.String()
+	u.Pb.CreatedAt = createdAt.String()
+	u.Pb.UpdatedAt = updatedAt.String()
+
+	opnameShelves := []struct {
+		ID   string
+		Code string
+	}{}
+	err = json.Unmarshal([]byte(shelves), &opnameShelves)
+	if err != nil {
+		return status.Errorf(codes.Internal, "unmarshal opnameShelves: %v", err)
+	}
+
+	for _, shelve := range opnameShelves {
+		u.Pb.Shelves = append(u.Pb.Shelves, &inventories.Shelve{
+			Id:   shelve.ID,
+			Code: shelve.Code,
+		})
+	}
+
+	return nil
+}
+
+// Create StockOpname, opening a count session for a warehouse or some of its shelves
+func (u *StockOpname) Create(ctx context.Context, tx *sql.Tx) error {
+	u.Pb.Id = uuid.New().String()
+	now := time.Now().UTC()
+	u.Pb.CreatedBy = ctx.Value(app.Ctx("userID")).(string)
+	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+	u.Pb.Status = StockOpnameOpen
+	dateOpname, err := time.Parse("2006-01-02T15:04:05.000Z", u.Pb.GetOpnameDate())
+	if err != nil {
+		return status.Errorf(codes.Internal, "convert Date: %v", err)
+	}
+
+	u.Pb.Code, err = util.GetCode(ctx, tx, "stock_opnames", "OP")
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO stock_opnames (id, company_id, branch_id, branch_name, warehouse_id, code, opname_date, status, remark, created_at, created_by, updated_at, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare insert stock opname: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx,
+		u.Pb.GetId(),
+		ctx.Value(app.Ctx("companyID")).(string),
+		u.Pb.GetBranchId(),
+		u.Pb.GetBranchName(),
+		u.Pb.GetWarehouse().GetId(),
+		u.Pb.GetCode(),
+		dateOpname,
+		u.Pb.GetStatus(),
+		u.Pb.GetRemark(),
+		now,
+		u.Pb.GetCreatedBy(),
+		now,
+		u.Pb.GetUpdatedBy(),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec insert stock opname: %v", err)
+	}
+
+	u.Pb.CreatedAt = now.String()
+	u.Pb.UpdatedAt = u.Pb.CreatedAt
+
+	err = writeDocumentEvent(ctx, tx, "stock_opname", EventCreated, u.Pb, u.Pb.GetOpnameDate())
+	if err != nil {
+		return err
+	}
+
+	// without explicit shelves, the session counts every shelve of the warehouse
+	if len(u.Pb.GetShelves()) == 0 {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO stock_opname_shelves (stock_opname_id, shelve_id)
+			SELECT $1, id FROM shelves WHERE warehouse_id = $2`,
+			u.Pb.GetId(), u.Pb.GetWarehouse().GetId())
+		if err != nil {
+			return status.Errorf(codes.Internal, "Exec insert stock opname shelves: %v", err)
+		}
+
+		return nil
+	}
+
+	stmtShelve, err := tx.PrepareContext(ctx, `INSERT INTO stock_opname_shelves (stock_opname_id, shelve_id) VALUES ($1, $2)`)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare insert stock opname shelve: %v", err)
+	}
+	defer stmtShelve.Close()
+
+	for _, shelve := range u.Pb.GetShelves() {
+		_, err = stmtShelve.ExecContext(ctx, u.Pb.GetId(), shelve.GetId())
+		if err != nil {
+			return status.Errorf(codes.Internal, "Exec insert stock opname shelve: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// HasShelve check if the shelve is counted by the session
+func (u *StockOpname) HasShelve(shelveID string) bool {
+	for _, shelve := range u.Pb.GetShelves() {
+		if shelve.GetId() == shelveID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Variance compare the scanned barcodes with the barcodes that inventories says should be on the counted shelves
+// by the end of the opname date. A product tracked by quantity has no unit barcodes, it is left out of the comparison.
+func (u *StockOpname) Variance(ctx context.Context, tx *sql.Tx) error {
+	query := `
+	WITH opname AS (
+		SELECT opname_date + 1 AS until FROM stock_opnames WHERE id = $2
+	), current_inventories AS (
+		SELECT DISTINCT ON (inventories.barcode) inventories.barcode, inventories.product_id, inventories.branch_id,
+			inventories.shelve_id, inventories.in_out
+		FROM inventories
+		JOIN products ON inventories.product_id = products.id
+		WHERE inventories.company_id = $1 AND products.tracking_mode <> 'QUANTITY'
+			AND inventories.transaction_date < (SELECT until FROM opname)
+		ORDER BY inventories.barcode, inventories.transaction_date DESC, inventories.created_at DESC
+	), counted AS (
+		SELECT shelve_id FROM stock_opname_shelves WHERE stock_opname_id = $2
+	), expected AS (
+		SELECT current_inventories.barcode, current_inventories.product_id, current_inventories.shelve_id
+		FROM current_inventories
+		JOIN counted ON current_inventories.shelve_id = counted.shelve_id
+		WHERE current_inventories.in_out
+	), scanned AS (
+		SELECT stock_opname_scans.barcode, stock_opname_scans.product_id, stock_opname_scans.shelve_id
+		FROM stock_opname_scans
+		JOIN products ON stock_opname_scans.product_id = products.id
+		WHERE stock_opname_scans.stock_opname_id = $2 AND products.tracking_mode <> 'QUANTITY'
+	)
+	(SELECT FALSE, expected.barcode, products.id, products.code, products.name, shelves.id, shelves.code, '', '',
+		EXISTS (SELECT 1 FROM inventories WHERE company_id = $1 AND barcode = expected.barcode
+			AND transaction_date >= (SELECT until FROM opname))
+	FROM expected
+	LEFT JOIN scanned ON expected.barcode = scanned.barcode AND expected.shelve_id = scanned.shelve_id
+	JOIN products ON expected.product_id = products.id
+	JOIN shelves ON expected.shelve_id = shelves.id
+	WHERE scanned.barcode IS NULL)
+	UNION ALL
+	(SELECT TRUE, scanned.barcode, products.id, products.code, products.name, shelves.id, shelves.code,
+		COALESCE(elsewhere.branch_id, ''), COALESCE(elsewhere.shelve_id, ''),
+		EXISTS (SELECT 1 FROM inventories WHERE company_id = $1 AND barcode = scanned.barcode
+			AND transaction_date >= (SELECT until FROM opname))
+	FROM scanned
+	LEFT JOIN expected ON scanned.barcode = expected.barcode AND scanned.shelve_id = expected.shelve_id
+	LEFT JOIN current_inventories elsewhere ON scanned.barcode = elsewhere.barcode AND elsewhere.in_out
+		AND elsewhere.shelve_id NOT IN (SELECT shelve_id FROM counted)
+	JOIN products ON scanned.product_id = products.id
+	JOIN shelves ON scanned.shelve_id = shelves.id
+	WHERE expected.barcode IS NULL)
+	`
+
+	rows, err := tx.QueryContext(ctx, query, ctx.Value(app.Ctx("companyID")).(string), u.Pb.GetId())
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query stock opname variance: %v", err)
+	}
+	defer rows.Close()
+
+	u.PbVariance = inventories.StockOpnameVariance{StockOpnameId: u.Pb.GetId()}
+	u.elsewhere = make(map[string]unitLocation)
+	u.movedAfter = nil
+	for rows.Next() {
+		var isUnexpected, isMovedAfter bool
+		var pbItem inventories.StockOpnameItem
+		var pbProduct inventories.Product
+		var pbShelve inventories.Shelve
+		var location unitLocation
+		err = rows.Scan(&isUnexpected, &pbItem.Barcode, &pbProduct.Id, &pbProduct.Code, &pbProduct.Name, &pbShelve.Id, &pbShelve.Code,
+			&location.branchID, &location.shelveID, &isMovedAfter)
+		if err != nil {
+			return status.Errorf(codes.Internal, "scan stock opname variance: %v", err)
+		}
+
+		pbItem.Product = &pbProduct
+		pbItem.Shelve = &pbShelve
+		if isMovedAfter {
+			u.movedAfter = append(u.movedAfter, pbItem.GetBarcode())
+		}
+
+		if isUnexpected {
+			u.PbVariance.Unexpected = append(u.PbVariance.Unexpected, &pbItem)
+			if len(location.shelveID) > 0 {
+				u.elsewhere[pbItem.GetBarcode()] = location
+			}
+		} else {
+			u.PbVariance.Missing = append(u.PbVariance.Missing, &pbItem)
+		}
+	}
+
+	if rows.Err() != nil {
+		return status.Errorf(codes.Internal, "rows stock opname variance: %v", rows.Err())
+	}
+
+	return nil
+}
+
+// Approve StockOpname, posting the variance as adjustment
+func (u *StockOpname) Approve(ctx context.Context, tx *sql.Tx) error {
+	now := time.Now().UTC()
+	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+	u.Pb.ApprovedBy = u.Pb.UpdatedBy
+
+	var dateOpname time.Time
+	err := tx.QueryRowContext(ctx, `
+		UPDATE stock_opnames SET
+		status = $1,
+		approved_at = $2,
+		approved_by = $3,
+		updated_at = $2,
+		updated_by = $3
+		WHERE id = $4 AND company_id = $5 AND status = $6
+		RETURNING opname_date`,
+		StockOpnameApproved, now, u.Pb.GetApprovedBy(), u.Pb.GetId(), ctx.Value(app.Ctx("companyID")).(string), StockOpnameOpen,
+	).Scan(&dateOpname)
+
+	if err == sql.ErrNoRows {
+		return status.Error(codes.FailedPrecondition, "stock opname already approved")
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec approve stock opname: %v", err)
+	}
+
+	u.Pb.Status = StockOpnameApproved
+	u.Pb.UpdatedAt = now.String()
+
+	err = writeDocumentEvent(ctx, tx, "stock_opname", EventApproved, u.Pb, u.Pb.GetOpnameDate())
+	if err != nil {
+		return err
+	}
+
+	err = u.Variance(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	// an adjustment dated at the opname can not go before a later movement of the unit, the shelve is counted again
+	if len(u.movedAfter) > 0 {
+		return status.Errorf(codes.FailedPrecondition, "barcode %s has moved after the opname date, count it again", u.movedAfter[0])
+	}
+
+	// the adjustments are dated at the end of the opname date, after every movement the session is compared with
+	adjustedAt := dateOpname.AddDate(0, 0, 1).Add(-time.Microsecond)
+
+	// missing barcodes go out, unexpected barcodes go in
+	for _, items := range []struct {
+		isIn  bool
+		items []*inventories.StockOpnameItem
+	}{
+		{false, u.PbVariance.GetMissing()},
+		{true, u.PbVariance.GetUnexpected()},
+	} {
+		for _, item := range items.items {
+			// a unit still in stock on another shelve leaves it first, otherwise it is counted twice
+			if location, ok := u.elsewhere[item.GetBarcode()]; ok && items.isIn {
+				moved := Inventory{
+					Barcode:         item.GetBarcode(),
+					BranchID:        location.branchID,
+					CompanyID:       ctx.Value(app.Ctx("companyID")).(string),
+					IsIn:            false,
+					ProductID:       item.GetProduct().GetId(),
+					ShelveID:        location.shelveID,
+					TransactionDate: adjustedAt,
+					TransactionCode: u.Pb.GetCode(),
+					TransactionID:   u.Pb.GetId(),
+					Type:            "OP",
+				}
+				err = moved.Create(ctx, tx)
+				if err != nil {
+					return err
+				}
+			}
+
+			inventory := Inventory{
+				Barcode:         item.GetBarcode(),
+				BranchID:        u.Pb.GetBranchId(),
+				CompanyID:       ctx.Value(app.Ctx("companyID")).(string),
+				IsIn:            items.isIn,
+				ProductID:       item.GetProduct().GetId(),
+				ShelveID:        item.GetShelve().GetId(),
+				TransactionDate: adjustedAt,
+				TransactionCode: u.Pb.GetCode(),
+				TransactionID:   u.Pb.GetId(),
+				Type:            "OP",
+			}
+			err = inventory.Create(ctx, tx)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ListQuery builder
+func (u *StockOpname) ListQuery(ctx context.Context, db *sql.DB, in *inventories.ListStockOpnameRequest) (string, []interface{}, *inventories.StockOpnamePaginationResponse, error) {
+	var paginationResponse inventories.StockOpnamePaginationResponse
+	query := `SELECT id, company_id, branch_id, branch_name, warehouse_id, code, opname_date, status, remark, created_at, created_by, updated_at, updated_by FROM stock_opnames`
+
+	where := []string{"company_id = $1"}
+	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string)}
+
+	if len(in.GetBranchId()) > 0 {
+		paramQueries = append(paramQueries, in.GetBranchId())
+		where = append(where, fmt.Sprintf(`branch_id = $%d`, len(paramQueries)))
+	}
+
+	if len(in.GetWarehouseId()) > 0 {
+		paramQueries = append(paramQueries, in.GetWarehouseId())
+		where = append(where, fmt.Sprintf(`warehouse_id = $%d`, len(paramQueries)))
+	}
+
+	if len(in.GetStatus()) > 0 {
+		paramQueries = append(paramQueries, in.GetStatus())
+		where = append(where, fmt.Sprintf(`status = $%d`, len(paramQueries)))
+	}
+
+	if len(in.GetPagination().GetSearch()) > 0 {
+		paramQueries = append(paramQueries, "%"+in.GetPagination().GetSearch()+"%")
+		where = append(where, fmt.Sprintf(`(code ILIKE $%d OR remark ILIKE $%d)`, len(paramQueries), len(paramQueries)))
+	}
+
+	{
+		qCount := `SELECT COUNT(*) FROM stock_opnames`
+		if len(where) > 0 {
+			qCount += " WHERE " + strings.Join(where, " AND ")
+		}
+		var count int
+		err := db.QueryRowContext(ctx, qCount, paramQueries...).Scan(&count)
+		if err != nil && err != sql.ErrNoRows {
+			return query, paramQueries, &paginationResponse, status.Error(codes.Internal, err.Error())
+		}
+
+		paginationResponse.Count = uint32(count)
+	}
+
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+
+	if len(in.GetPagination().GetOrderBy()) == 0 || !(in.GetPagination().GetOrderBy() == "code") {
+		if in.GetPagination() == nil {
+			in.Pagination = &inventories.Pagination{OrderBy: "created_at"}
+		} else {
+			in.GetPagination().OrderBy = "created_at"
+		}
+	}
+
+	query += ` ORDER BY ` + in.GetPagination().GetOrderBy() + ` ` + in.GetPagination().GetSort().String()
+
+	if in.GetPagination().GetLimit() > 0 {
+		query += fmt.Sprintf(` LIMIT $%d OFFSET $%d`, (len(paramQueries) + 1), (len(paramQueries) + 2))
+		paramQueries = append(paramQueries, in.GetPagination().GetLimit(), in.GetPagination().GetOffset())
+	}
+
+	return query, paramQueries, &paginationResponse, nil
+}
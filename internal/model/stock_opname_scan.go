@@ -0,0 +1,80 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StockOpnameScan struct
+type StockOpnameScan struct {
+	Pb inventories.StockOpnameScan
+}
+
+// GetProduct find the product of a scanned barcode from its inventory history
+func (u *StockOpnameScan) GetProduct(ctx context.Context, db *sql.DB) error {
+	var productID string
+	err := db.QueryRowContext(ctx, `
+		SELECT product_id FROM inventories
+		WHERE company_id = $1 AND barcode = $2
+		ORDER BY transaction_date DESC, created_at DESC LIMIT 1`,
+		ctx.Value(app.Ctx("companyID")).(string), u.Pb.GetBarcode(),
+	).Scan(&productID)
+
+	if err == sql.ErrNoRows {
+		return status.Error(codes.InvalidArgument, "unknown barcode, please supply valid product")
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw get product of barcode: %v", err)
+	}
+
+	u.Pb.Product = &inventories.Product{Id: productID}
+
+	return nil
+}
+
+// Create StockOpnameScan, scanning the same barcode twice keeps the last shelve
+func (u *StockOpnameScan) Create(ctx context.Context, db *sql.DB) error {
+	u.Pb.Id = uuid.New().String()
+	now := time.Now().UTC()
+	u.Pb.ScannedBy = ctx.Value(app.Ctx("userID")).(string)
+
+	query := `
+		INSERT INTO stock_opname_scans (id, stock_opname_id, product_id, barcode, shelve_id, scanned_at, scanned_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (stock_opname_id, barcode) DO UPDATE SET
+		product_id = EXCLUDED.product_id,
+		shelve_id = EXCLUDED.shelve_id,
+		scanned_at = EXCLUDED.scanned_at,
+		scanned_by = EXCLUDED.scanned_by
+	`
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare insert stock opname scan: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx,
+		u.Pb.GetId(),
+		u.Pb.GetStockOpnameId(),
+		u.Pb.GetProduct().GetId(),
+		u.Pb.GetBarcode(),
+		u.Pb.GetShelve().GetId(),
+		now,
+		u.Pb.GetScannedBy(),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec insert stock opname scan: %v", err)
+	}
+
+	u.Pb.ScannedAt = now.String()
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// move a unit of the product in or out of the shelve at the date
+func (u testProduct) move(t *testing.T, db *sql.DB, barcode string, isIn bool, date time.Time) {
+	t.Helper()
+
+	transactionType := "DO"
+	if isIn {
+		transactionType = "GR"
+	}
+
+	err := inTx(u.ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		inventory := Inventory{
+			BranchID:        u.branchID,
+			ProductID:       u.productID,
+			Barcode:         barcode,
+			TransactionID:   uuid.New().String(),
+			TransactionCode: transactionType + "24000000001",
+			TransactionDate: date,
+			Type:            transactionType,
+			IsIn:            isIn,
+			ShelveID:        u.shelveID,
+			Qty:             1,
+		}
+		return inventory.Create(ctx, tx)
+	})
+	if err != nil {
+		t.Fatalf("move %s: %v", barcode, err)
+	}
+}
+
+// openOpname an open stock opname of the shelve at the date with the scanned barcodes
+func (u testProduct) openOpname(t *testing.T, db *sql.DB, date time.Time, scanned ...string) *StockOpname {
+	t.Helper()
+
+	opname := StockOpname{Pb: inventories.StockOpname{Id: uuid.New().String(), BranchId: u.branchID, Code: "SO24000000001"}}
+	err := inTx(u.ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			INSERT INTO stock_opnames (id, company_id, branch_id, branch_name, warehouse_id, code, opname_date, status, remark, created_by, updated_by)
+			SELECT $1, $2, $3, 'Test', warehouse_id, $4, $5, $6, '', $7, $7 FROM shelves WHERE id = $8`,
+			opname.Pb.GetId(), u.companyID, u.branchID, opname.Pb.GetCode(), date, StockOpnameOpen, u.userID, u.shelveID,
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`INSERT INTO stock_opname_shelves (stock_opname_id, shelve_id) VALUES ($1, $2)`, opname.Pb.GetId(), u.shelveID)
+		if err != nil {
+			return err
+		}
+
+		for _, barcode := range scanned {
+			_, err = tx.Exec(`
+				INSERT INTO stock_opname_scans (id, stock_opname_id, product_id, barcode, shelve_id, scanned_by)
+				VALUES ($1, $2, $3, $4, $5, $6)`,
+				uuid.New().String(), opname.Pb.GetId(), u.productID, barcode, u.shelveID, u.userID,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("open stock opname: %v", err)
+	}
+
+	return &opname
+}
+
+func TestApproveComparesTheStockAtTheOpnameDate(t *testing.T) {
+	db := openTestDB(t)
+	product := newTestProduct(t, db)
+
+	opnameDate := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -3)
+	before, after := opnameDate.Add(-time.Hour), opnameDate.AddDate(0, 0, 1).Add(time.Hour)
+
+	// counted on the shelve and delivered after the count
+	counted := uuid.New().String()
+	product.move(t, db, counted, true, before)
+	product.move(t, db, counted, false, after)
+
+	// received after the count
+	product.move(t, db, uuid.New().String(), true, after)
+
+	opname := product.openOpname(t, db, opnameDate, counted)
+	err := inTx(product.ctx, db, opname.Approve)
+	if err != nil {
+		t.Fatalf("approve: %v", err)
+	}
+
+	if len(opname.PbVariance.GetMissing()) > 0 || len(opname.PbVariance.GetUnexpected()) > 0 {
+		t.Errorf("variance = %d missing and %d unexpected, want none", len(opname.PbVariance.GetMissing()),
+			len(opname.PbVariance.GetUnexpected()))
+	}
+
+	if stock := product.stock(t, db); stock != 1 {
+		t.Errorf("stock after approve = %d, want 1", stock)
+	}
+}
+
+func TestApproveRejectsUnitMovedAfterTheOpnameDate(t *testing.T) {
+	db := openTestDB(t)
+	product := newTestProduct(t, db)
+
+	opnameDate := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -3)
+
+	// missing on the count, delivered afterward
+	missing := uuid.New().String()
+	product.move(t, db, missing, true, opnameDate.Add(-time.Hour))
+	product.move(t, db, missing, false, opnameDate.AddDate(0, 0, 1).Add(time.Hour))
+
+	opname := product.openOpname(t, db, opnameDate)
+	err := inTx(product.ctx, db, opname.Approve)
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("approve = %v, want %v", err, codes.FailedPrecondition)
+	}
+}
@@ -0,0 +1,373 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-pkg/util"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Transfer status
+const (
+	TransferInTransit = "IN_TRANSIT"
+	TransferReceived  = "RECEIVED"
+)
+
+// Transfer struct
+type Transfer struct {
+	Pb inventories.Transfer
+}
+
+// Get func
+func (u *Transfer) Get(ctx context.Context, db *sql.DB) error {
+	query := `
+		SELECT transfers.id, transfers.company_id, transfers.branch_id, transfers.branch_name,
+		transfers.to_branch_id, transfers.to_branch_name, transfers.code, transfers.transfer_date,
+		COALESCE(to_char(transfers.receive_date, 'YYYY-MM-DD'), ''), transfers.status, transfers.remark,
+		transfers.created_at, transfers.created_by, transfers.updated_at, transfers.updated_by, COALESCE(transfers.received_by, ''),
+		json_agg(DISTINCT jsonb_build_object(
+			'id', transfer_details.id,
+			'transfer_id', transfer_details.transfer_id,
+			'product_id', transfer_details.product_id,
+			'product_name', products.name,
+			'product_code', products.code,
+			'barcode', transfer_details.barcode,
+			'from_shelve_id', transfer_details.from_shelve_id,
+			'from_shelve_code', from_shelves.code,
+			'to_shelve_id', COALESCE(transfer_details.to_shelve_id, ''),
+			'to_shelve_code', COALESCE(to_shelves.code, '')
+		)) as details
+		FROM transfers
+		JOIN transfer_details ON transfers.id = transfer_details.transfer_id
+		JOIN products ON transfer_details.product_id = products.id
+		JOIN shelves from_shelves ON transfer_details.from_shelve_id = from_shelves.id
+		LEFT JOIN shelves to_shelves ON transfer_details.to_shelve_id = to_shelves.id
+		WHERE transfers.id = $1
+		GROUP BY transfers.id
+	`
+
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare statement Get transfer: %v", err)
+	}
+	defer stmt.Close()
+
+	var dateTransfer, createdAt, updatedAt time.Time
+	var companyID, details string
+	err = stmt.QueryRowContext(ctx, u.Pb.GetId()).Scan(
+		&u.Pb.Id, &companyID, &u.Pb.BranchId, &u.Pb.BranchName, &u.Pb.ToBranchId, &u.Pb.ToBranchName,
+		&u.Pb.Code, &dateTransfer, &u.Pb.ReceiveDate, &u.Pb.Status, &u.Pb.Remark,
+		&createdAt, &u.Pb.CreatedBy, &updatedAt, &u.Pb.UpdatedBy, &u.Pb.ReceivedBy, &details,
+	)
+
+	if err == sql.ErrNoRows {
+		return status.Errorf(codes.NotFound, "Query Raw get transfer: %v", err)
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw get transfer: %v", err)
+	}
+
+	if companyID != ctx.Value(app.Ctx("companyID")).(string) {
+		return status.Error(codes.Unauthenticated, "its not your company")
+	}
+
+	u.Pb.TransferDate = dateTransfer.String()
+	u.Pb.CreatedAt = createdAt.String()
+	u.Pb.UpdatedAt = updatedAt.String()
+
+	detailTransfers := []struct {
+		ID             string
+		TransferID     string `json:"transfer_id"`
+		ProductID      string `json:"product_id"`
+		ProductName    string `json:"product_name"`
+		ProductCode    string `json:"product_code"`
+		Barcode        string
+		FromShelveID   string `json:"from_shelve_id"`
+		FromShelveCode string `json:"from_shelve_code"`
+		ToShelveID     string `json:"to_shelve_id"`
+		ToShelveCode   string `json:"to_shelve_code"`
+	}{}
+	err = json.Unmarshal([]byte(details), &detailTransfers)
+	if err != nil {
+		return status.Errorf(codes.Internal, "unmarshal detailTransfers: %v", err)
+	}
+
+	for _, detail := range detailTransfers {
+		u.Pb.Details = append(u.Pb.Details, &inventories.TransferDetail{
+			Id:         detail.ID,
+			TransferId: detail.TransferID,
+			Barcode:    detail.Barcode,
+			Product: &inventories.Product{
+				Id:   detail.ProductID,
+				Code: detail.ProductCode,
+				Name: detail.ProductName,
+			},
+			FromShelve: &inventories.Shelve{
+				Id:   detail.FromShelveID,
+				Code: detail.FromShelveCode,
+			},
+			ToShelve: &inventories.Shelve{
+				Id:   detail.ToShelveID,
+				Code: detail.ToShelveCode,
+			},
+		})
+	}
+
+	return nil
+}
+
+// Create Transfer, shipping the goods from the origin branch
+func (u *Transfer) Create(ctx context.Context, tx *sql.Tx) error {
+	u.Pb.Id = uuid.New().String()
+	now := time.Now().UTC()
+	u.Pb.CreatedBy = ctx.Value(app.Ctx("userID")).(string)
+	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+	u.Pb.Status = TransferInTransit
+	dateTransfer, err := time.Parse("2006-01-02T15:04:05.000Z", u.Pb.GetTransferDate())
+	if err != nil {
+		return status.Errorf(codes.Internal, "convert Date: %v", err)
+	}
+
+	u.Pb.Code, err = util.GetCode(ctx, tx, "transfers", "TR")
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO transfers (id, company_id, branch_id, branch_name, to_branch_id, to_branch_name, code, transfer_date, status, remark, created_at, created_by, updated_at, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+	`
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare insert transfer: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx,
+		u.Pb.GetId(),
+		ctx.Value(app.Ctx("companyID")).(string),
+		u.Pb.GetBranchId(),
+		u.Pb.GetBranchName(),
+		u.Pb.GetToBranchId(),
+		u.Pb.GetToBranchName(),
+		u.Pb.GetCode(),
+		dateTransfer,
+		u.Pb.GetStatus(),
+		u.Pb.GetRemark(),
+		now,
+		u.Pb.GetCreatedBy(),
+		now,
+		u.Pb.GetUpdatedBy(),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec insert transfer: %v", err)
+	}
+
+	u.Pb.CreatedAt = now.String()
+	u.Pb.UpdatedAt = u.Pb.CreatedAt
+
+	err = writeDocumentEvent(ctx, tx, "transfer", EventCreated, u.Pb, u.Pb.GetTransferDate())
+	if err != nil {
+		return err
+	}
+
+	for _, detail := range u.Pb.GetDetails() {
+		transferDetailModel := TransferDetail{}
+		transferDetailModel.Pb = inventories.TransferDetail{
+			TransferId: u.Pb.GetId(),
+			Barcode:    detail.GetBarcode(),
+			Product:    detail.GetProduct(),
+			FromShelve: detail.GetFromShelve(),
+		}
+		transferDetailModel.PbTransfer = inventories.Transfer{
+			Id:           u.Pb.Id,
+			BranchId:     u.Pb.BranchId,
+			BranchName:   u.Pb.BranchName,
+			ToBranchId:   u.Pb.ToBranchId,
+			ToBranchName: u.Pb.ToBranchName,
+			Code:         u.Pb.Code,
+			TransferDate: u.Pb.TransferDate,
+			Status:       u.Pb.Status,
+			Remark:       u.Pb.Remark,
+		}
+		err = transferDetailModel.Create(ctx, tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Receive Transfer, confirming the goods on the destination branch
+func (u *Transfer) Receive(ctx context.Context, tx *sql.Tx) error {
+	now := time.Now().UTC()
+	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
+	u.Pb.ReceivedBy = u.Pb.UpdatedBy
+	u.Pb.Status = TransferReceived
+	dateReceive, err := time.Parse("2006-01-02T15:04:05.000Z", u.Pb.GetReceiveDate())
+	if err != nil {
+		return status.Errorf(codes.Internal, "convert receive date: %v", err)
+	}
+
+	// the units arrive after they left, a receive dated earlier would keep them out of stock on both branches
+	var dateTransfer time.Time
+	err = tx.QueryRowContext(ctx, `SELECT transfer_date FROM transfers WHERE id = $1 FOR UPDATE`, u.Pb.GetId()).Scan(&dateTransfer)
+	if err == sql.ErrNoRows {
+		return status.Errorf(codes.NotFound, "Query Raw get transfer date: %v", err)
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw get transfer date: %v", err)
+	}
+
+	if dateReceive.Before(dateTransfer) {
+		return status.Error(codes.InvalidArgument, "receive date can not be before the transfer date")
+	}
+
+	query := `
+		UPDATE transfers SET
+		receive_date = $1,
+		status = $2,
+		received_by = $3,
+		updated_at = $4,
+		updated_by= $5
+		WHERE id = $6 AND status = $7
+	`
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare receive transfer: %v", err)
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(ctx,
+		dateReceive,
+		u.Pb.GetStatus(),
+		u.Pb.GetReceivedBy(),
+		now,
+		u.Pb.GetUpdatedBy(),
+		u.Pb.GetId(),
+		TransferInTransit,
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec receive transfer: %v", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return status.Errorf(codes.Internal, "rows affected receive transfer: %v", err)
+	}
+
+	if affected == 0 {
+		return status.Error(codes.FailedPrecondition, "transfer already received")
+	}
+
+	u.Pb.UpdatedAt = now.String()
+
+	err = writeDocumentEvent(ctx, tx, "transfer", EventReceived, u.Pb, u.Pb.GetReceiveDate())
+	if err != nil {
+		return err
+	}
+
+	for _, detail := range u.Pb.GetDetails() {
+		transferDetailModel := TransferDetail{}
+		transferDetailModel.Pb = inventories.TransferDetail{
+			Id:         detail.GetId(),
+			TransferId: u.Pb.GetId(),
+			Barcode:    detail.GetBarcode(),
+			Product:    detail.GetProduct(),
+			FromShelve: detail.GetFromShelve(),
+			ToShelve:   detail.GetToShelve(),
+		}
+		transferDetailModel.PbTransfer = inventories.Transfer{
+			Id:           u.Pb.Id,
+			BranchId:     u.Pb.BranchId,
+			ToBranchId:   u.Pb.ToBranchId,
+			Code:         u.Pb.Code,
+			ReceiveDate:  u.Pb.ReceiveDate,
+			TransferDate: u.Pb.TransferDate,
+			Status:       u.Pb.Status,
+		}
+		err = transferDetailModel.Receive(ctx, tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ListQuery builder
+func (u *Transfer) ListQuery(ctx context.Context, db *sql.DB, in *inventories.ListTransferRequest) (string, []interface{}, *inventories.TransferPaginationResponse, error) {
+	var paginationResponse inventories.TransferPaginationResponse
+	query := `SELECT id, company_id, branch_id, branch_name, to_branch_id, to_branch_name, code, transfer_date,
+		COALESCE(to_char(receive_date, 'YYYY-MM-DD'), ''), status, remark, created_at, created_by, updated_at, updated_by FROM transfers`
+
+	where := []string{"company_id = $1"}
+	paramQueries := []interface{}{ctx.Value(app.Ctx("companyID")).(string)}
+
+	if len(in.GetBranchId()) > 0 {
+		paramQueries = append(paramQueries, in.GetBranchId())
+		where = append(where, fmt.Sprintf(`branch_id = $%d`, len(paramQueries)))
+	}
+
+	if len(in.GetToBranchId()) > 0 {
+		paramQueries = append(paramQueries, in.GetToBranchId())
+		where = append(where, fmt.Sprintf(`to_branch_id = $%d`, len(paramQueries)))
+	}
+
+	if len(in.GetStatus()) > 0 {
+		paramQueries = append(paramQueries, in.GetStatus())
+		where = append(where, fmt.Sprintf(`status = $%d`, len(paramQueries)))
+	}
+
+	if len(in.GetPagination().GetSearch()) > 0 {
+		paramQueries = append(paramQueries, "%"+in.GetPagination().GetSearch()+"%")
+		where = append(where, fmt.Sprintf(`(code ILIKE $%d OR remark ILIKE $%d)`, len(paramQueries), len(paramQueries)))
+	}
+
+	{
+		qCount := `SELECT COUNT(*) FROM transfers`
+		if len(where) > 0 {
+			qCount += " WHERE " + strings.Join(where, " AND ")
+		}
+		var count int
+		err := db.QueryRowContext(ctx, qCount, paramQueries...).Scan(&count)
+		if err != nil && err != sql.ErrNoRows {
+			return query, paramQueries, &paginationResponse, status.Error(codes.Internal, err.Error())
+		}
+
+		paginationResponse.Count = uint32(count)
+	}
+
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+
+	if len(in.GetPagination().GetOrderBy()) == 0 || !(in.GetPagination().GetOrderBy() == "code") {
+		if in.GetPagination() == nil {
+			in.Pagination = &inventories.Pagination{OrderBy: "created_at"}
+		} else {
+			in.GetPagination().OrderBy = "created_at"
+		}
+	}
+
+	query += ` ORDER BY ` + in.GetPagination().GetOrderBy() + ` ` + in.GetPagination().GetSort().String()
+
+	if in.GetPagination().GetLimit() > 0 {
+		query += fmt.Sprintf(` LIMIT $%d OFFSET $%d`, (len(paramQueries) + 1), (len(paramQueries) + 2))
+		paramQueries = append(paramQueries, in.GetPagination().GetLimit(), in.GetPagination().GetOffset())
+	}
+
+	return query, paramQueries, &paginationResponse, nil
+}
@@ -0,0 +1,126 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TransferDetail struct
+type TransferDetail struct {
+	Pb         inventories.TransferDetail
+	PbTransfer inventories.Transfer
+}
+
+// Create TransferDetail, the barcode leaves the origin branch. The branch keeps the qty reserved for the sales orders,
+// the reservation lock of the product is taken before the unit is locked
+func (u *TransferDetail) Create(ctx context.Context, tx *sql.Tx) error {
+	u.Pb.Id = uuid.New().String()
+	reservationModel := Reservation{}
+	reservationModel.Pb = inventories.Reservation{BranchId: u.PbTransfer.GetBranchId(), ProductId: u.Pb.GetProduct().GetId()}
+	err := reservationModel.CheckAvailable(ctx, tx, 1)
+	if err != nil {
+		return err
+	}
+
+	unit := UnitStatus{Barcode: u.Pb.GetBarcode()}
+	err = unit.CheckOut(ctx, tx, u.Pb.GetProduct().GetId(), u.PbTransfer.GetBranchId(), u.Pb.GetFromShelve().GetId(), "", true)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO transfer_details (id, transfer_id, product_id, barcode, from_shelve_id)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare insert transfer detail: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx,
+		u.Pb.GetId(),
+		u.Pb.GetTransferId(),
+		u.Pb.GetProduct().GetId(),
+		u.Pb.GetBarcode(),
+		u.Pb.GetFromShelve().GetId(),
+	)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec insert transfer detail: %v", err)
+	}
+
+	transactionDate, err := time.Parse("2006-01-02T15:04:05.000Z", u.PbTransfer.GetTransferDate())
+	if err != nil {
+		return status.Errorf(codes.Internal, "convert transactiondate inventory: %v", err)
+	}
+	inventory := Inventory{
+		Barcode:         u.Pb.GetBarcode(),
+		BranchID:        u.PbTransfer.GetBranchId(),
+		CompanyID:       ctx.Value(app.Ctx("companyID")).(string),
+		IsIn:            false,
+		ProductID:       u.Pb.GetProduct().GetId(),
+		ShelveID:        u.Pb.GetFromShelve().GetId(),
+		TransactionDate: transactionDate,
+		TransactionCode: u.PbTransfer.GetCode(),
+		TransactionID:   u.PbTransfer.GetId(),
+		Type:            "TO",
+		LotID:           unit.LotID,
+	}
+	return inventory.Create(ctx, tx)
+}
+
+// Receive TransferDetail, the barcode enters the destination branch
+func (u *TransferDetail) Receive(ctx context.Context, tx *sql.Tx) error {
+	stmt, err := tx.PrepareContext(ctx, `UPDATE transfer_details SET to_shelve_id = $1 WHERE id = $2 AND transfer_id = $3`)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Prepare receive transfer detail: %v", err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, u.Pb.GetToShelve().GetId(), u.Pb.GetId(), u.Pb.GetTransferId())
+	if err != nil {
+		return status.Errorf(codes.Internal, "Exec receive transfer detail: %v", err)
+	}
+
+	transactionDate, err := time.Parse("2006-01-02T15:04:05.000Z", u.PbTransfer.GetReceiveDate())
+	if err != nil {
+		return status.Errorf(codes.Internal, "convert transactiondate inventory: %v", err)
+	}
+
+	// the unit arrives with the lot it was shipped
+	unit := UnitStatus{Barcode: u.Pb.GetBarcode()}
+	err = unit.Get(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	// the unit arrives at the cost it left the origin branch
+	shipped := Inventory{Barcode: u.Pb.GetBarcode(), TransactionID: u.PbTransfer.GetId(), IsIn: false}
+	err = shipped.GetByInOut(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	inventory := Inventory{
+		Barcode:         u.Pb.GetBarcode(),
+		BranchID:        u.PbTransfer.GetToBranchId(),
+		CompanyID:       ctx.Value(app.Ctx("companyID")).(string),
+		IsIn:            true,
+		ProductID:       u.Pb.GetProduct().GetId(),
+		ShelveID:        u.Pb.GetToShelve().GetId(),
+		TransactionDate: transactionDate,
+		TransactionCode: u.PbTransfer.GetCode(),
+		TransactionID:   u.PbTransfer.GetId(),
+		Type:            "TI",
+		UnitCost:        shipped.Cost / float64(shipped.Qty),
+		LotID:           unit.LotID,
+	}
+	return inventory.Create(ctx, tx)
+}
@@ -0,0 +1,109 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UnitStatus current state of a serialized unit, derived from its latest inventory movement
+type UnitStatus struct {
+	Barcode              string
+	ProductID            string
+	BranchID             string
+	ShelveID             string
+	LotID                string
+	InStock              bool
+	Type                 string
+	TransactionID        string
+	ReservedSalesOrderID string
+}
+
+// Get func, the barcode is locked until the end of the transaction so concurrent documents can not move the same unit
+func (u *UnitStatus) Get(ctx context.Context, tx *sql.Tx) error {
+	companyID := ctx.Value(app.Ctx("companyID")).(string)
+	_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, companyID+u.Barcode)
+	if err != nil {
+		return status.Errorf(codes.Internal, "lock unit status: %v", err)
+	}
+
+	query := `
+		SELECT barcode, product_id, branch_id, shelve_id, COALESCE(lot_id, ''), in_stock, type, transaction_id, 
+			COALESCE(reserved_sales_order_id, '')
+		FROM unit_statuses WHERE company_id = $1 AND barcode = $2
+	`
+	err = tx.QueryRowContext(ctx, query, companyID, u.Barcode).Scan(
+		&u.Barcode, &u.ProductID, &u.BranchID, &u.ShelveID, &u.LotID, &u.InStock, &u.Type, &u.TransactionID, &u.ReservedSalesOrderID,
+	)
+
+	if err == sql.ErrNoRows {
+		return status.Errorf(codes.NotFound, "barcode %s not found", u.Barcode)
+	}
+
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw get unit status: %v", err)
+	}
+
+	return nil
+}
+
+// CheckOut validate the unit of the product can leave the shelve of the branch. With checkReservation,
+// a unit reserved for a sales order can only leave for that sales order.
+func (u *UnitStatus) CheckOut(ctx context.Context, tx *sql.Tx, productID string, branchID string, shelveID string, salesOrderID string, checkReservation bool) error {
+	err := u.Get(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	if u.ProductID != productID {
+		return status.Errorf(codes.InvalidArgument, "barcode %s is not of the product", u.Barcode)
+	}
+
+	if !u.InStock {
+		return status.Errorf(codes.FailedPrecondition, "barcode %s is not in stock", u.Barcode)
+	}
+
+	if u.BranchID != branchID {
+		return status.Error(codes.Unauthenticated, "barcode not your own")
+	}
+
+	if len(shelveID) > 0 && u.ShelveID != shelveID {
+		return status.Error(codes.InvalidArgument, "barcode not in the shelve")
+	}
+
+	if checkReservation && len(u.ReservedSalesOrderID) > 0 && u.ReservedSalesOrderID != salesOrderID {
+		return status.Errorf(codes.FailedPrecondition, "barcode %s is reserved for sales order %s", u.Barcode, u.ReservedSalesOrderID)
+	}
+
+	return nil
+}
+
+// CheckReturn validate the unit of the product left the branch by the delivery it is returned from,
+// a unit can only come back once
+func (u *UnitStatus) CheckReturn(ctx context.Context, tx *sql.Tx, productID string, branchID string, deliveryID string) error {
+	err := u.Get(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	if u.ProductID != productID {
+		return status.Errorf(codes.InvalidArgument, "barcode %s is not of the product", u.Barcode)
+	}
+
+	if u.InStock {
+		return status.Errorf(codes.FailedPrecondition, "barcode %s is still in stock", u.Barcode)
+	}
+
+	if u.Type != "DO" || u.TransactionID != deliveryID {
+		return status.Errorf(codes.FailedPrecondition, "barcode %s is not delivered by the delivery", u.Barcode)
+	}
+
+	if u.BranchID != branchID {
+		return status.Error(codes.Unauthenticated, "barcode not your own")
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Valuation struct, the period is a month
+type Valuation struct {
+	BranchID  string
+	StartDate time.Time
+	EndDate   time.Time
+	Total     inventories.ValuationLine
+}
+
+// IsOpeningClosed check the opening of the period is known. The opening is the saldo written when the previous month
+// was closed, without saldo the period must be before any transaction.
+func (u *Valuation) IsOpeningClosed(ctx context.Context, db *sql.DB) error {
+	var hasSaldo, hasPrevious bool
+	err := db.QueryRowContext(ctx, `
+		SELECT
+			EXISTS(SELECT 1 FROM saldo_stocks WHERE company_id = $1 AND year = $2 AND month = $3),
+			EXISTS(SELECT 1 FROM inventories WHERE company_id = $1 AND transaction_date < $4)`,
+		ctx.Value(app.Ctx("companyID")).(string), u.StartDate.Year(), int(u.StartDate.Month()), u.StartDate,
+	).Scan(&hasSaldo, &hasPrevious)
+	if err != nil {
+		return status.Errorf(codes.Internal, "Query Raw valuation opening: %v", err)
+	}
+
+	if !hasSaldo && hasPrevious {
+		return status.Error(codes.FailedPrecondition, "previous period is not closed, the opening value is unknown")
+	}
+
+	return nil
+}
+
+// ListQuery builder of the valuation per product of the branch: opening from the saldo of the period, in and out
+// from the movements of the period and the closing as their sum. A mutation moves the stock inside the branch and
+// is left out.
+func (u *Valuation) ListQuery(ctx context.Context) (string, []interface{}) {
+	query := `
+		WITH opening AS (
+			SELECT saldo_stocks.product_id, SUM(saldo_stock_details.qty) qty, SUM(saldo_stock_details.value) value
+			FROM saldo_stocks
+			JOIN saldo_stock_details ON saldo_stocks.id = saldo_stock_details.saldo_stock_id
+			WHERE saldo_stocks.company_id = $1 AND saldo_stocks.year = $2 AND saldo_stocks.month = $3 AND saldo_stock_details.branch_id = $4
+			GROUP BY saldo_stocks.product_id
+		), movements AS (
+			SELECT product_id,
+				SUM(case when in_out then qty else 0 end) in_qty,
+				SUM(case when in_out then cost else 0 end) in_value,
+				SUM(case when in_out then 0 else qty end) out_qty,
+				SUM(case when in_out then 0 else cost end) out_value
+			FROM inventories
+			WHERE company_id = $1 AND branch_id = $4 AND transaction_date >= $5 AND transaction_date < $6 AND type <> 'MU'
+			GROUP BY product_id
+		)
+		SELECT products.id, products.code, products.name,
+			COALESCE(opening.qty, 0), COALESCE(opening.value, 0),
+			COALESCE(movements.in_qty, 0), COALESCE(movements.in_value, 0),
+			COALESCE(movements.out_qty, 0), COALESCE(movements.out_value, 0)
+		FROM products
+		LEFT JOIN opening ON products.id = opening.product_id
+		LEFT JOIN movements ON products.id = movements.product_id
+		WHERE products.company_id = $1 AND (opening.product_id IS NOT NULL OR movements.product_id IS NOT NULL)
+		ORDER BY products.code
+	`
+
+	paramQueries := []interface{}{
+		ctx.Value(app.Ctx("companyID")).(string),
+		u.StartDate.Year(),
+		int(u.StartDate.Month()),
+		u.BranchID,
+		u.StartDate,
+		u.EndDate,
+	}
+
+	return query, paramQueries
+}
+
+// Scan a valuation line of the product, the closing is computed and added to the total
+func (u *Valuation) Scan(rows *sql.Rows) (*inventories.ValuationLine, error) {
+	var pbLine inventories.ValuationLine
+	var pbProduct inventories.Product
+	err := rows.Scan(&pbProduct.Id, &pbProduct.Code, &pbProduct.Name,
+		&pbLine.OpeningQty, &pbLine.OpeningValue, &pbLine.InQty, &pbLine.InValue, &pbLine.OutQty, &pbLine.OutValue)
+	if err != nil {
+		return &pbLine, status.Errorf(codes.Internal, "scan valuation: %v", err)
+	}
+
+	pbLine.Product = &pbProduct
+	pbLine.ClosingQty = pbLine.GetOpeningQty() + pbLine.GetInQty() - pbLine.GetOutQty()
+	pbLine.ClosingValue = pbLine.GetOpeningValue() + pbLine.GetInValue() - pbLine.GetOutValue()
+
+	u.Total.OpeningQty += pbLine.GetOpeningQty()
+	u.Total.OpeningValue += pbLine.GetOpeningValue()
+	u.Total.InQty += pbLine.GetInQty()
+	u.Total.InValue += pbLine.GetInValue()
+	u.Total.OutQty += pbLine.GetOutQty()
+	u.Total.OutValue += pbLine.GetOutValue()
+	u.Total.ClosingQty += pbLine.GetClosingQty()
+	u.Total.ClosingValue += pbLine.GetClosingValue()
+
+	return &pbLine, nil
+}
@@ -94,7 +94,7 @@ func (u *Warehouse) GetByCode(ctx context.Context, db *sql.DB) error {
 }
 
 // Create Warehouse
-func (u *Warehouse) Create(ctx context.Context, db *sql.DB) error {
+func (u *Warehouse) Create(ctx context.Context, tx *sql.Tx) error {
 	u.Pb.Id = uuid.New().String()
 	now := time.Now().UTC()
 	u.Pb.CreatedBy = ctx.Value(app.Ctx("userID")).(string)
@@ -104,7 +104,7 @@ func (u *Warehouse) Create(ctx context.Context, db *sql.DB) error {
 		INSERT INTO warehouses (id, company_id, branch_id, branch_name, code, name, pic_name, pic_phone, created_at, created_by, updated_at, updated_by) 
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 	`
-	stmt, err := db.PrepareContext(ctx, query)
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare insert warehouse: %v", err)
 	}
@@ -135,7 +135,7 @@ func (u *Warehouse) Create(ctx context.Context, db *sql.DB) error {
 }
 
 // Update Warehouse
-func (u *Warehouse) Update(ctx context.Context, db *sql.DB) error {
+func (u *Warehouse) Update(ctx context.Context, tx *sql.Tx) error {
 	now := time.Now().UTC()
 	u.Pb.UpdatedBy = ctx.Value(app.Ctx("userID")).(string)
 
@@ -148,7 +148,7 @@ func (u *Warehouse) Update(ctx context.Context, db *sql.DB) error {
 		updated_by= $5
 		WHERE id = $6
 	`
-	stmt, err := db.PrepareContext(ctx, query)
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare update warehouse: %v", err)
 	}
@@ -172,8 +172,8 @@ func (u *Warehouse) Update(ctx context.Context, db *sql.DB) error {
 }
 
 // Delete Warehouse
-func (u *Warehouse) Delete(ctx context.Context, db *sql.DB) error {
-	stmt, err := db.PrepareContext(ctx, `DELETE FROM warehouses WHERE company_id = $1 AND id = $2`)
+func (u *Warehouse) Delete(ctx context.Context, tx *sql.Tx) error {
+	stmt, err := tx.PrepareContext(ctx, `DELETE FROM warehouses WHERE company_id = $1 AND id = $2`)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Prepare delete warehouse: %v", err)
 	}
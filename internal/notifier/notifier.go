@@ -0,0 +1,86 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"github.com/jacky-htg/inventory-service/internal/linefile"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Notifier push a raised stock alert outside of the service
+type Notifier interface {
+	Notify(ctx context.Context, alert *inventories.StockAlert) error
+}
+
+// New notifier of the kind, the target is the url of a webhook or the path of a file.
+// An empty kind has no notifier.
+func New(kind string, target string) (Notifier, error) {
+	switch kind {
+	case "":
+		return nil, nil
+	case "webhook":
+		if len(target) == 0 {
+			return nil, fmt.Errorf("webhook notifier needs an url")
+		}
+		return &Webhook{URL: target, Client: &http.Client{Timeout: 10 * time.Second}}, nil
+	case "file":
+		if len(target) == 0 {
+			return nil, fmt.Errorf("file notifier needs a path")
+		}
+		return &File{File: linefile.File{Path: target}}, nil
+	}
+
+	return nil, fmt.Errorf("unknown notifier %s", kind)
+}
+
+// Webhook post the alert as json to the url
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+// Notify func
+func (u *Webhook) Notify(ctx context.Context, alert *inventories.StockAlert) error {
+	body, err := protojson.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("marshal stock alert: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create webhook request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := u.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post webhook: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("post webhook: status %s", resp.Status)
+	}
+
+	return nil
+}
+
+// File append the alert as a json line to the file
+type File struct {
+	linefile.File
+}
+
+// Notify func
+func (u *File) Notify(ctx context.Context, alert *inventories.StockAlert) error {
+	line, err := protojson.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("marshal stock alert: %v", err)
+	}
+
+	return u.Append(line)
+}
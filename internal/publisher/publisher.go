@@ -0,0 +1,83 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jacky-htg/inventory-service/internal/linefile"
+)
+
+// Event a domain event of the outbox
+type Event struct {
+	ID          string          `json:"id"`
+	CompanyID   string          `json:"company_id"`
+	Topic       string          `json:"topic"`
+	AggregateID string          `json:"aggregate_id"`
+	Payload     json.RawMessage `json:"payload"`
+	OccurredAt  time.Time       `json:"occurred_at"`
+}
+
+// Publisher deliver the events of the outbox outside of the service
+type Publisher interface {
+	Publish(ctx context.Context, event *Event) error
+}
+
+// New publisher of the kind, the target is the path of a file. An empty kind has no publisher.
+func New(kind string, target string) (Publisher, error) {
+	switch kind {
+	case "":
+		return nil, nil
+	case "file":
+		if len(target) == 0 {
+			return nil, fmt.Errorf("file publisher needs a path")
+		}
+		return &File{File: linefile.File{Path: target}}, nil
+	}
+
+	return nil, fmt.Errorf("unknown publisher %s", kind)
+}
+
+// Memory keep the published events, for tests
+type Memory struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// Publish func
+func (u *Memory) Publish(ctx context.Context, event *Event) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.events = append(u.events, *event)
+
+	return nil
+}
+
+// Events published so far, the oldest first
+func (u *Memory) Events() []Event {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	events := make([]Event, len(u.events))
+	copy(events, u.events)
+
+	return events
+}
+
+// File append the event as a json line to the file
+type File struct {
+	linefile.File
+}
+
+// Publish func
+func (u *File) Publish(ctx context.Context, event *Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal event: %v", err)
+	}
+
+	return u.Append(line)
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/jacky-htg/erp-proto/go/pb/inventories"
 	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"github.com/jacky-htg/erp-proto/go/pb/sales"
 	"github.com/jacky-htg/erp-proto/go/pb/users"
 	"github.com/jacky-htg/inventory-service/internal/service"
 	"google.golang.org/grpc"
@@ -13,7 +14,7 @@ import (
 
 // GrpcRoute func
 func GrpcRoute(grpcServer *grpc.Server, db *sql.DB, log map[string]*log.Logger,
-	userConn, purchaseConn *grpc.ClientConn) {
+	userConn, purchaseConn, salesConn *grpc.ClientConn, alertEngine *service.StockAlertEngine, stockWatcher *service.StockWatcher) {
 	categoryServer := service.Category{Db: db, Log: log}
 	inventories.RegisterCategoryServiceServer(grpcServer, &categoryServer)
 
@@ -29,6 +30,43 @@ func GrpcRoute(grpcServer *grpc.Server, db *sql.DB, log map[string]*log.Logger,
 	shelveServer := service.Shelve{Db: db, Log: log}
 	inventories.RegisterShelveServiceServer(grpcServer, &shelveServer)
 
+	companySettingServer := service.CompanySetting{
+		Db:         db,
+		UserClient: users.NewUserServiceClient(userConn),
+		Log:        log,
+	}
+	inventories.RegisterCompanySettingServiceServer(grpcServer, &companySettingServer)
+
+	accountMappingServer := service.AccountMapping{
+		Db:         db,
+		UserClient: users.NewUserServiceClient(userConn),
+		Log:        log,
+	}
+	inventories.RegisterAccountMappingServiceServer(grpcServer, &accountMappingServer)
+
+	approvalRuleServer := service.ApprovalRule{
+		Db:         db,
+		UserClient: users.NewUserServiceClient(userConn),
+		Log:        log,
+	}
+	inventories.RegisterApprovalRuleServiceServer(grpcServer, &approvalRuleServer)
+
+	approvalServer := service.Approval{
+		Db:           db,
+		UserClient:   users.NewUserServiceClient(userConn),
+		RegionClient: users.NewRegionServiceClient(userConn),
+		BranchClient: users.NewBranchServiceClient(userConn),
+		Log:          log,
+	}
+	inventories.RegisterApprovalServiceServer(grpcServer, &approvalServer)
+
+	auditServer := service.Audit{
+		Db:         db,
+		UserClient: users.NewUserServiceClient(userConn),
+		Log:        log,
+	}
+	inventories.RegisterAuditServiceServer(grpcServer, &auditServer)
+
 	warehouseServer := service.Warehouse{
 		Db:           db,
 		UserClient:   users.NewUserServiceClient(userConn),
@@ -49,11 +87,13 @@ func GrpcRoute(grpcServer *grpc.Server, db *sql.DB, log map[string]*log.Logger,
 	inventories.RegisterReceiveServiceServer(grpcServer, &receiveServer)
 
 	deliveryServer := service.Delivery{
-		Db:           db,
-		UserClient:   users.NewUserServiceClient((userConn)),
-		RegionClient: users.NewRegionServiceClient(userConn),
-		BranchClient: users.NewBranchServiceClient(userConn),
-		Log:          log,
+		Db:               db,
+		UserClient:       users.NewUserServiceClient((userConn)),
+		RegionClient:     users.NewRegionServiceClient(userConn),
+		BranchClient:     users.NewBranchServiceClient(userConn),
+		SalesOrderClient: sales.NewSalesOrderServiceClient(salesConn),
+		AlertEngine:      alertEngine,
+		Log:              log,
 	}
 	inventories.RegisterDeliveryServiceServer(grpcServer, &deliveryServer)
 
@@ -62,6 +102,7 @@ func GrpcRoute(grpcServer *grpc.Server, db *sql.DB, log map[string]*log.Logger,
 		UserClient:   users.NewUserServiceClient((userConn)),
 		RegionClient: users.NewRegionServiceClient(userConn),
 		BranchClient: users.NewBranchServiceClient(userConn),
+		AlertEngine:  alertEngine,
 		Log:          log,
 	}
 	inventories.RegisterReceiveReturnServiceServer(grpcServer, &receiveReturnServer)
@@ -75,11 +116,68 @@ func GrpcRoute(grpcServer *grpc.Server, db *sql.DB, log map[string]*log.Logger,
 	}
 	inventories.RegisterDeliveryReturnServiceServer(grpcServer, &deliveryReturnServer)
 
+	mutationServer := service.Mutation{
+		Db:           db,
+		UserClient:   users.NewUserServiceClient(userConn),
+		RegionClient: users.NewRegionServiceClient(userConn),
+		BranchClient: users.NewBranchServiceClient(userConn),
+		Log:          log,
+	}
+	inventories.RegisterMutationServiceServer(grpcServer, &mutationServer)
+
+	transferServer := service.Transfer{
+		Db:           db,
+		UserClient:   users.NewUserServiceClient(userConn),
+		RegionClient: users.NewRegionServiceClient(userConn),
+		BranchClient: users.NewBranchServiceClient(userConn),
+		AlertEngine:  alertEngine,
+		Log:          log,
+	}
+	inventories.RegisterTransferServiceServer(grpcServer, &transferServer)
+
+	stockOpnameServer := service.StockOpname{
+		Db:           db,
+		UserClient:   users.NewUserServiceClient(userConn),
+		RegionClient: users.NewRegionServiceClient(userConn),
+		BranchClient: users.NewBranchServiceClient(userConn),
+		Log:          log,
+	}
+	inventories.RegisterStockOpnameServiceServer(grpcServer, &stockOpnameServer)
+
+	reservationServer := service.Reservation{
+		Db:           db,
+		UserClient:   users.NewUserServiceClient(userConn),
+		RegionClient: users.NewRegionServiceClient(userConn),
+		BranchClient: users.NewBranchServiceClient(userConn),
+		Log:          log,
+	}
+	inventories.RegisterReservationServiceServer(grpcServer, &reservationServer)
+
+	replenishmentServer := service.Replenishment{
+		Db:             db,
+		UserClient:     users.NewUserServiceClient(userConn),
+		RegionClient:   users.NewRegionServiceClient(userConn),
+		BranchClient:   users.NewBranchServiceClient(userConn),
+		PurchaseClient: purchases.NewPurchaseServiceClient(purchaseConn),
+		Log:            log,
+	}
+	inventories.RegisterReplenishmentServiceServer(grpcServer, &replenishmentServer)
+
+	stockAlertServer := service.StockAlert{
+		Db:           db,
+		UserClient:   users.NewUserServiceClient(userConn),
+		RegionClient: users.NewRegionServiceClient(userConn),
+		BranchClient: users.NewBranchServiceClient(userConn),
+		Log:          log,
+	}
+	inventories.RegisterStockAlertServiceServer(grpcServer, &stockAlertServer)
+
 	stockServer := service.Stock{
 		Db:           db,
 		UserClient:   users.NewUserServiceClient((userConn)),
 		RegionClient: users.NewRegionServiceClient(userConn),
 		BranchClient: users.NewBranchServiceClient(userConn),
+		Watcher:      stockWatcher,
 		Log:          log,
 	}
 	inventories.RegisterStockServiceServer(grpcServer, &stockServer)
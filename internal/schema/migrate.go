@@ -579,6 +579,1147 @@ var migrations = []darwin.Migration{
 			CONSTRAINT fk_shelve_mutation__details_to_destination_shelves FOREIGN KEY (to_shelve_id) REFERENCES shelves(id)
 		);`,
 	},
+	{
+		Version:     24,
+		Description: "Shelve Mutations By Branch",
+		Script: `
+		ALTER TABLE shelve_mutations ADD COLUMN branch_id char(36), ADD COLUMN branch_name varchar(100);
+		UPDATE shelve_mutations SET branch_id = warehouses.branch_id, branch_name = warehouses.branch_name
+			FROM warehouses WHERE warehouses.id = shelve_mutations.warehouse_id;
+		ALTER TABLE shelve_mutations ALTER COLUMN branch_id SET NOT NULL, ALTER COLUMN branch_name SET NOT NULL;`,
+	},
+	{
+		Version:     25,
+		Description: "Shelve Mutations Across Warehouses",
+		Script: `
+		ALTER TABLE shelve_mutations ALTER COLUMN warehouse_id DROP NOT NULL;`,
+	},
+	{
+		Version:     26,
+		Description: "Add Transfers",
+		Script: `
+		CREATE TABLE transfers (
+			id char(36) NOT NULL PRIMARY KEY,
+			company_id	char(36) NOT NULL,
+			branch_id char(36) NOT NULL,
+			branch_name varchar(100) NOT NULL,
+			to_branch_id char(36) NOT NULL,
+			to_branch_name varchar(100) NOT NULL,
+			code	CHAR(13) NOT NULL,
+			transfer_date	DATE NOT NULL,
+			receive_date	DATE NULL,
+			status VARCHAR(20) NOT NULL,
+			remark VARCHAR(255) NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			created_by char(36) NOT NULL,
+			updated_by char(36) NOT NULL,
+			received_by char(36) NULL,
+			UNIQUE(company_id, code)
+		);`,
+	},
+	{
+		Version:     27,
+		Description: "Add Transfer Details",
+		Script: `
+		CREATE TABLE transfer_details (
+			id char(36) NOT NULL PRIMARY KEY,
+			transfer_id	char(36) NOT NULL,
+			product_id char(36) NOT NULL,
+			barcode char(36) NOT NULL,
+			from_shelve_id char(36) NOT NULL,
+			to_shelve_id char(36) NULL,
+			UNIQUE(transfer_id, barcode),
+			CONSTRAINT fk_transfer_details_to_transfers FOREIGN KEY (transfer_id) REFERENCES transfers(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			CONSTRAINT fk_transfer_details_to_products FOREIGN KEY (product_id) REFERENCES products(id),
+			CONSTRAINT fk_transfer_details_to_origin_shelves FOREIGN KEY (from_shelve_id) REFERENCES shelves(id),
+			CONSTRAINT fk_transfer_details_to_destination_shelves FOREIGN KEY (to_shelve_id) REFERENCES shelves(id)
+		);`,
+	},
+	{
+		Version:     28,
+		Description: "Add Stock In Transit Func",
+		Script: `
+		CREATE or replace FUNCTION stock_in_transit (companyID character, branchID character, productID character) RETURNS int
+		as $$
+		declare 
+			stock int;
+		begin
+			
+			select count(transfer_details.barcode) into stock
+			from transfers
+			join transfer_details ON transfers.id = transfer_details.transfer_id
+			where transfers.company_id = companyID 
+				and transfers.status = 'IN_TRANSIT'
+				and transfer_details.product_id = productID
+				and (branchID IS NULL OR transfers.to_branch_id = branchID);
+			
+			RETURN stock;
+
+		END;
+		$$ language plpgsql
+		`,
+	},
+	{
+		Version:     29,
+		Description: "Add Stock Opnames",
+		Script: `
+		CREATE TABLE stock_opnames (
+			id char(36) NOT NULL PRIMARY KEY,
+			company_id	char(36) NOT NULL,
+			branch_id char(36) NOT NULL,
+			branch_name varchar(100) NOT NULL,
+			warehouse_id char(36) NOT NULL,
+			code	CHAR(13) NOT NULL,
+			opname_date	DATE NOT NULL,
+			status VARCHAR(20) NOT NULL,
+			remark VARCHAR(255) NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			created_by char(36) NOT NULL,
+			updated_by char(36) NOT NULL,
+			approved_at TIMESTAMP NULL,
+			approved_by char(36) NULL,
+			UNIQUE(company_id, code),
+			CONSTRAINT fk_stock_opnames_to_warehouses FOREIGN KEY (warehouse_id) REFERENCES warehouses(id)
+		);`,
+	},
+	{
+		Version:     30,
+		Description: "Add Stock Opname Shelves",
+		Script: `
+		CREATE TABLE stock_opname_shelves (
+			stock_opname_id char(36) NOT NULL,
+			shelve_id char(36) NOT NULL,
+			PRIMARY KEY (stock_opname_id, shelve_id),
+			CONSTRAINT fk_stock_opname_shelves_to_stock_opnames FOREIGN KEY (stock_opname_id) REFERENCES stock_opnames(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			CONSTRAINT fk_stock_opname_shelves_to_shelves FOREIGN KEY (shelve_id) REFERENCES shelves(id)
+		);`,
+	},
+	{
+		Version:     31,
+		Description: "Add Stock Opname Scans",
+		Script: `
+		CREATE TABLE stock_opname_scans (
+			id char(36) NOT NULL PRIMARY KEY,
+			stock_opname_id char(36) NOT NULL,
+			product_id char(36) NOT NULL,
+			barcode char(36) NOT NULL,
+			shelve_id char(36) NOT NULL,
+			scanned_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			scanned_by char(36) NOT NULL,
+			UNIQUE(stock_opname_id, barcode),
+			CONSTRAINT fk_stock_opname_scans_to_stock_opnames FOREIGN KEY (stock_opname_id) REFERENCES stock_opnames(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			CONSTRAINT fk_stock_opname_scans_to_products FOREIGN KEY (product_id) REFERENCES products(id),
+			CONSTRAINT fk_stock_opname_scans_to_shelves FOREIGN KEY (shelve_id) REFERENCES shelves(id)
+		);`,
+	},
+	{
+		Version:     32,
+		Description: "Add Closing Periods",
+		Script: `
+		CREATE TABLE closing_periods (
+			company_id char(36) NOT NULL,
+			year INT NOT NULL,
+			month INT NOT NULL,
+			closed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			closed_by char(36) NOT NULL,
+			PRIMARY KEY (company_id, year, month)
+		);`,
+	},
+	{
+		Version:     33,
+		Description: "Closing Stock Into Next Month Saldo",
+		Script: `
+		create or replace procedure closing_stocks(
+			companyID char, 
+			curYear int, 
+			curMonth int
+		) 
+		as $$
+		declare 
+				nextYear int;
+				nextMonth int;
+		begin	
+	
+			IF curYear = 0 THEN
+				select date_part('year', CURRENT_DATE) into curYear;
+			END IF;
+		
+			IF curMonth = 0 THEN 
+				select date_part('month', CURRENT_DATE) into curMonth;
+			END IF;
+			
+			select curYear into nextYear;
+			select curMonth + 1 into nextMonth;
+			
+			IF curMonth = 12 THEN 
+				select curYear+1 into nextYear;
+				select 1 into nextMonth;
+			END IF;
+	
+			INSERT INTO saldo_stocks (company_id, product_id, qty, year, month)
+			SELECT companyID, saldo.id AS product_id, 
+				case 
+					when transaction.qty IS null then saldo.qty
+					else saldo.qty+transaction.qty
+				end 
+				AS qty, nextYear AS year, nextMonth AS month 
+			FROM (
+				SELECT products.id, 
+					case 
+						when saldo_stocks.qty IS null then 0
+						else saldo_stocks.qty
+					end 
+					AS qty
+				FROM products
+				LEFT JOIN saldo_stocks ON products.id = saldo_stocks.product_id AND products.company_id=saldo_stocks.company_id AND saldo_stocks.year=curYear AND saldo_stocks.month=curMonth
+				WHERE products.company_id=companyID
+			) AS saldo
+			LEFT JOIN (
+				SELECT tr.product_id, SUM(tr.qty) AS qty
+				FROM (
+					select inventories.product_id, 
+						case 
+							when inventories.in_out then 1
+							else -1
+						end 
+						as qty   
+					from inventories
+					WHERE date_part('month', inventories.transaction_date)=curMonth AND date_part('year', inventories.transaction_date)=curYear AND inventories.company_id=companyID
+				) as tr
+				GROUP BY tr.product_id
+			) as transaction ON saldo.id=transaction.product_id;
+
+			call closing_stock_details(companyID, curYear, curMonth);
+			
+		end;
+		$$ language plpgsql `,
+	},
+	{
+		Version:     34,
+		Description: "Add Stock As Of Func",
+		Script: `
+		CREATE or replace FUNCTION stock_as_of (companyID character, branchID character, productID character, asOf date) RETURNS int
+		as $$
+		declare 
+			stock int;
+			saldoID bigint;
+			saldoQty int;
+			saldoDate date;
+		begin
+			
+			-- saldo of a month is the opening balance of its first day
+			SELECT saldo_stocks.id, saldo_stocks.qty, make_date(saldo_stocks.year, saldo_stocks.month, 1)
+			INTO saldoID, saldoQty, saldoDate
+			FROM saldo_stocks
+			WHERE saldo_stocks.company_id = companyID AND saldo_stocks.product_id = productID
+				AND make_date(saldo_stocks.year, saldo_stocks.month, 1) <= asOf
+			ORDER BY saldo_stocks.year DESC, saldo_stocks.month DESC
+			LIMIT 1;
+
+			IF saldoID IS NULL THEN
+				saldoQty := 0;
+			ELSIF branchID IS NOT NULL THEN
+				SELECT COUNT(saldo_stock_details.id) INTO saldoQty
+				FROM saldo_stock_details
+				WHERE saldo_stock_details.saldo_stock_id = saldoID AND saldo_stock_details.branch_id = branchID;
+			END IF;
+
+			SELECT COALESCE(SUM(
+				case 
+					when inventories.in_out then 1
+					else -1
+				end
+			), 0) INTO stock
+			FROM inventories
+			WHERE inventories.company_id = companyID AND inventories.product_id = productID
+				AND (branchID IS NULL OR inventories.branch_id = branchID)
+				AND (saldoDate IS NULL OR inventories.transaction_date >= saldoDate)
+				AND inventories.transaction_date <= asOf;
+			
+			RETURN saldoQty + stock;
+
+		END;
+		$$ language plpgsql
+		`,
+	},
+	{
+		Version:     35,
+		Description: "Add Quantity Tracking",
+		Script: `
+		ALTER TABLE products ADD COLUMN tracking_mode VARCHAR(10) NOT NULL DEFAULT 'SERIAL';
+		ALTER TABLE inventories ADD COLUMN qty INTEGER NOT NULL DEFAULT 1;
+		ALTER TABLE receive_details ADD COLUMN qty INTEGER NOT NULL DEFAULT 1;
+		ALTER TABLE delivery_details ADD COLUMN IF NOT EXISTS barcode char(36) NULL;
+		ALTER TABLE delivery_details ADD COLUMN qty INTEGER NOT NULL DEFAULT 1;
+		ALTER TABLE receive_return_details ADD COLUMN qty INTEGER NOT NULL DEFAULT 1;
+		ALTER TABLE delivery_return_details ADD COLUMN qty INTEGER NOT NULL DEFAULT 1;
+		ALTER TABLE saldo_stock_details ADD COLUMN qty INTEGER NOT NULL DEFAULT 1;
+		ALTER TABLE saldo_stock_details DROP CONSTRAINT IF EXISTS saldo_stock_details_code_saldo_stock_id_key;
+		ALTER TABLE saldo_stock_details ADD CONSTRAINT saldo_stock_details_saldo_stock_id_branch_id_code_key UNIQUE(saldo_stock_id, branch_id, code);`,
+	},
+	{
+		Version:     36,
+		Description: "Closing Stock Details By Quantity",
+		Script: `
+		create or replace procedure closing_stock_details(
+			companyID char, 
+			curYear int, 
+			curMonth int
+		) 
+		as $$
+		declare 
+				nextYear int;
+				nextMonth int;
+		begin	
+			
+			IF curYear = 0 THEN
+				select date_part('year', CURRENT_DATE) into curYear;
+			END IF;
+		
+			IF curMonth = 0 THEN 
+				select date_part('month', CURRENT_DATE) into curMonth;
+			END IF;
+			
+			select curYear into nextYear;
+			select curMonth + 1 into nextMonth;
+			
+			IF curMonth = 12 THEN 
+				select curYear+1 into nextYear;
+				select 1 into nextMonth;
+			END IF;
+		
+			-- serialized units are kept per barcode, quantity tracked products are pooled per branch under the product id
+			INSERT INTO saldo_stock_details (saldo_stock_id, branch_id, code, qty)
+			SELECT 
+				saldo_stocks.id saldo_stock_id,
+				group_inventories.branch_id,
+				group_inventories.code,
+				group_inventories.qty
+			FROM (
+				SELECT 
+					union_inventories.product_id, 
+					union_inventories.branch_id, 
+					union_inventories.code, 
+					SUM(union_inventories.qty) qty
+				FROM (
+					(SELECT 
+						saldo_stocks.product_id, 
+						saldo_stock_details.branch_id,
+						saldo_stock_details.code,
+						saldo_stock_details.qty  
+					FROM saldo_stocks
+					JOIN saldo_stock_details ON saldo_stocks.id = saldo_stock_details.saldo_stock_id
+					WHERE saldo_stocks.year = curYear AND saldo_stocks.month = curMonth and saldo_stocks.company_id = companyID)
+					union all
+					(SELECT 
+						inventories.product_id,
+						inventories.branch_id,
+						case 
+							when products.tracking_mode = 'QUANTITY' then products.id
+							else inventories.barcode
+						end
+						as code,
+						case 
+							when inventories.in_out then inventories.qty
+							else -inventories.qty
+						end 
+						as qty
+					FROM inventories
+					JOIN products ON inventories.product_id = products.id
+					where date_part('month', inventories.transaction_date)=curMonth and date_part('year', inventories.transaction_date)=curYear and inventories.company_id = companyID)
+				) union_inventories
+				GROUP BY union_inventories.product_id, union_inventories.branch_id, union_inventories.code
+			) group_inventories
+			join saldo_stocks ON group_inventories.product_id=saldo_stocks.product_id and saldo_stocks.year = nextYear and saldo_stocks.month = nextMonth and saldo_stocks.company_id = companyID
+			WHERE group_inventories.qty > 0;
+			
+		end;
+		$$ language plpgsql `,
+	},
+	{
+		Version:     37,
+		Description: "Closing Stock By Quantity",
+		Script: `
+		create or replace procedure closing_stocks(
+			companyID char, 
+			curYear int, 
+			curMonth int
+		) 
+		as $$
+		declare 
+				nextYear int;
+				nextMonth int;
+		begin	
+	
+			IF curYear = 0 THEN
+				select date_part('year', CURRENT_DATE) into curYear;
+			END IF;
+		
+			IF curMonth = 0 THEN 
+				select date_part('month', CURRENT_DATE) into curMonth;
+			END IF;
+			
+			select curYear into nextYear;
+			select curMonth + 1 into nextMonth;
+			
+			IF curMonth = 12 THEN 
+				select curYear+1 into nextYear;
+				select 1 into nextMonth;
+			END IF;
+	
+			INSERT INTO saldo_stocks (company_id, product_id, qty, year, month)
+			SELECT companyID, saldo.id AS product_id, 
+				case 
+					when transaction.qty IS null then saldo.qty
+					else saldo.qty+transaction.qty
+				end 
+				AS qty, nextYear AS year, nextMonth AS month 
+			FROM (
+				SELECT products.id, 
+					case 
+						when saldo_stocks.qty IS null then 0
+						else saldo_stocks.qty
+					end 
+					AS qty
+				FROM products
+				LEFT JOIN saldo_stocks ON products.id = saldo_stocks.product_id AND products.company_id=saldo_stocks.company_id AND saldo_stocks.year=curYear AND saldo_stocks.month=curMonth
+				WHERE products.company_id=companyID
+			) AS saldo
+			LEFT JOIN (
+				SELECT tr.product_id, SUM(tr.qty) AS qty
+				FROM (
+					select inventories.product_id, 
+						case 
+							when inventories.in_out then inventories.qty
+							else -inventories.qty
+						end 
+						as qty   
+					from inventories
+					WHERE date_part('month', inventories.transaction_date)=curMonth AND date_part('year', inventories.transaction_date)=curYear AND inventories.company_id=companyID
+				) as tr
+				GROUP BY tr.product_id
+			) as transaction ON saldo.id=transaction.product_id;
+
+			call closing_stock_details(companyID, curYear, curMonth);
+			
+		end;
+		$$ language plpgsql `,
+	},
+	{
+		Version:     38,
+		Description: "Stock Func By Quantity",
+		Script: `
+		CREATE or replace FUNCTION stock (companyID character , productID character) RETURNS int
+		as $$
+		declare 
+			stock int;
+		begin
+			
+			select SUM(union_stocks.qty) into stock
+			from (
+				(select saldo_stocks.qty
+				FROM saldo_stocks
+				WHERE saldo_stocks.year=date_part('year', CURRENT_DATE) and saldo_stocks.month=date_part('month', CURRENT_DATE) and saldo_stocks.company_id = companyID and saldo_stocks.product_id = productID)
+				union all
+				(select  
+					case 
+						when inventories.in_out then inventories.qty
+						else -inventories.qty
+					end
+					as qty 
+				from inventories
+				where date_part('month', inventories.transaction_date)=date_part('month', CURRENT_DATE) and date_part('year', inventories.transaction_date)=date_part('year', CURRENT_DATE) and inventories.company_id = companyID and inventories.product_id = productID)
+			) union_stocks;
+			
+			RETURN COALESCE(stock, 0);
+
+		END;
+		$$ language plpgsql
+		`,
+	},
+	{
+		Version:     39,
+		Description: "Stock Branch Func By Quantity",
+		Script: `
+		CREATE or replace FUNCTION stock_branch (companyID character, branchID character, productID character) RETURNS int
+		as $$
+		declare 
+			stock int;
+		begin
+			
+			select SUM(union_stocks.qty) into stock
+			from (
+				(select saldo_stock_details.qty
+				FROM saldo_stocks
+				JOIN saldo_stock_details ON saldo_stocks.id = saldo_stock_details.saldo_stock_id
+				WHERE saldo_stocks.year=date_part('year', CURRENT_DATE) and saldo_stocks.month=date_part('month', CURRENT_DATE) and saldo_stocks.company_id = companyID and saldo_stocks.product_id = productID and saldo_stock_details.branch_id = branchID)
+				union all
+				(select  
+					case 
+						when inventories.in_out then inventories.qty
+						else -inventories.qty
+					end
+					as qty 
+				from inventories
+				where date_part('month', inventories.transaction_date)=date_part('month', CURRENT_DATE) and date_part('year', inventories.transaction_date)=date_part('year', CURRENT_DATE) and inventories.company_id = companyID and inventories.product_id = productID and inventories.branch_id = branchID)
+			) union_stocks;
+			
+			RETURN COALESCE(stock, 0);
+
+		END;
+		$$ language plpgsql
+		`,
+	},
+	{
+		Version:     40,
+		Description: "Stock As Of Func By Quantity",
+		Script: `
+		CREATE or replace FUNCTION stock_as_of (companyID character, branchID character, productID character, asOf date) RETURNS int
+		as $$
+		declare 
+			stock int;
+			saldoID bigint;
+			saldoQty int;
+			saldoDate date;
+		begin
+			
+			-- saldo of a month is the opening balance of its first day
+			SELECT saldo_stocks.id, saldo_stocks.qty, make_date(saldo_stocks.year, saldo_stocks.month, 1)
+			INTO saldoID, saldoQty, saldoDate
+			FROM saldo_stocks
+			WHERE saldo_stocks.company_id = companyID AND saldo_stocks.product_id = productID
+				AND make_date(saldo_stocks.year, saldo_stocks.month, 1) <= asOf
+			ORDER BY saldo_stocks.year DESC, saldo_stocks.month DESC
+			LIMIT 1;
+
+			IF saldoID IS NULL THEN
+				saldoQty := 0;
+			ELSIF branchID IS NOT NULL THEN
+				SELECT COALESCE(SUM(saldo_stock_details.qty), 0) INTO saldoQty
+				FROM saldo_stock_details
+				WHERE saldo_stock_details.saldo_stock_id = saldoID AND saldo_stock_details.branch_id = branchID;
+			END IF;
+
+			SELECT COALESCE(SUM(
+				case 
+					when inventories.in_out then inventories.qty
+					else -inventories.qty
+				end
+			), 0) INTO stock
+			FROM inventories
+			WHERE inventories.company_id = companyID AND inventories.product_id = productID
+				AND (branchID IS NULL OR inventories.branch_id = branchID)
+				AND (saldoDate IS NULL OR inventories.transaction_date >= saldoDate)
+				AND inventories.transaction_date <= asOf;
+			
+			RETURN saldoQty + stock;
+
+		END;
+		$$ language plpgsql
+		`,
+	},
+	{
+		Version:     41,
+		Description: "Add Lots",
+		Script: `
+		CREATE TABLE lots (
+			id char(36) NOT NULL PRIMARY KEY,
+			company_id	char(36) NOT NULL,
+			product_id char(36) NOT NULL,
+			code	VARCHAR(50) NOT NULL,
+			expired_date	DATE NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			created_by char(36) NOT NULL,
+			updated_by char(36) NOT NULL,
+			UNIQUE(company_id, product_id, code),
+			CONSTRAINT fk_lots_to_products FOREIGN KEY (product_id) REFERENCES products(id)
+		);`,
+	},
+	{
+		Version:     42,
+		Description: "Add Lot Reference",
+		Script: `
+		ALTER TABLE inventories ADD COLUMN lot_id char(36) NULL REFERENCES lots(id);
+		ALTER TABLE receive_details ADD COLUMN lot_id char(36) NULL REFERENCES lots(id);
+		ALTER TABLE delivery_details ADD COLUMN lot_id char(36) NULL REFERENCES lots(id);
+		ALTER TABLE receive_return_details ADD COLUMN lot_id char(36) NULL REFERENCES lots(id);
+		ALTER TABLE delivery_return_details ADD COLUMN lot_id char(36) NULL REFERENCES lots(id);
+		CREATE INDEX inventories_lot_id_idx ON inventories (lot_id);`,
+	},
+	{
+		Version:     43,
+		Description: "Stock Lot Func",
+		Script: `
+		CREATE or replace FUNCTION stock_lot (companyID character, branchID character, lotID character, asOf date) RETURNS int
+		as $$
+		declare 
+			stock int;
+		begin
+			
+			-- saldo does not keep lots, the lot balance is the sum of all its movements
+			SELECT COALESCE(SUM(
+				case 
+					when inventories.in_out then inventories.qty
+					else -inventories.qty
+				end
+			), 0) INTO stock
+			FROM inventories
+			WHERE inventories.company_id = companyID AND inventories.lot_id = lotID
+				AND (branchID IS NULL OR inventories.branch_id = branchID)
+				AND (asOf IS NULL OR inventories.transaction_date <= asOf);
+			
+			RETURN stock;
+
+		END;
+		$$ language plpgsql
+		`,
+	},
+	{
+		Version:     44,
+		Description: "Add Pick Method To Product Categories",
+		Script:      `ALTER TABLE product_categories ADD COLUMN pick_method VARCHAR(4) NOT NULL DEFAULT 'FIFO';`,
+	},
+	{
+		Version:     45,
+		Description: "Add Reservations",
+		Script: `
+		CREATE TABLE reservations (
+			id char(36) NOT NULL PRIMARY KEY,
+			company_id	char(36) NOT NULL,
+			branch_id char(36) NOT NULL,
+			sales_order_id char(36) NOT NULL,
+			product_id char(36) NOT NULL,
+			barcode char(36) NULL,
+			qty INTEGER NOT NULL DEFAULT 1,
+			expired_at TIMESTAMP NOT NULL,
+			status VARCHAR(20) NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			created_by char(36) NOT NULL,
+			updated_by char(36) NOT NULL,
+			released_at TIMESTAMP NULL,
+			released_by char(36) NULL,
+			CONSTRAINT fk_reservations_to_products FOREIGN KEY (product_id) REFERENCES products(id)
+		);
+		CREATE INDEX reservations_company_id_product_id_status_idx ON reservations (company_id, product_id, status);
+		CREATE INDEX reservations_company_id_sales_order_id_idx ON reservations (company_id, sales_order_id);
+		CREATE UNIQUE INDEX reservations_active_barcode_key ON reservations (company_id, barcode) WHERE status = 'ACTIVE' AND barcode IS NOT NULL;`,
+	},
+	{
+		Version:     46,
+		Description: "Stock Reserved Func",
+		Script: `
+		CREATE or replace FUNCTION stock_reserved (companyID character, branchID character, productID character) RETURNS int
+		as $$
+		declare 
+			stock int;
+		begin
+			
+			SELECT COALESCE(SUM(reservations.qty), 0) INTO stock
+			FROM reservations
+			WHERE reservations.company_id = companyID AND reservations.product_id = productID
+				AND (branchID IS NULL OR reservations.branch_id = branchID)
+				AND reservations.status = 'ACTIVE' AND reservations.expired_at > (NOW() AT TIME ZONE 'UTC');
+			
+			RETURN stock;
+
+		END;
+		$$ language plpgsql
+		`,
+	},
+	{
+		Version:     47,
+		Description: "Add Barcode To Return Details",
+		Script: `
+		ALTER TABLE receive_return_details ADD COLUMN barcode char(36) NULL;
+		ALTER TABLE delivery_return_details ADD COLUMN barcode char(36) NULL;
+		UPDATE receive_return_details SET barcode = units.barcode
+		FROM (
+			SELECT transaction_id, product_id, shelve_id, MIN(barcode) barcode FROM inventories
+			WHERE type = 'RR'
+			GROUP BY transaction_id, product_id, shelve_id
+			HAVING COUNT(*) = 1
+		) units
+		WHERE receive_return_details.receive_return_id = units.transaction_id AND receive_return_details.product_id = units.product_id 
+			AND receive_return_details.shelve_id = units.shelve_id;
+		UPDATE delivery_return_details SET barcode = units.barcode
+		FROM (
+			SELECT transaction_id, product_id, shelve_id, MIN(barcode) barcode FROM inventories
+			WHERE type = 'DR'
+			GROUP BY transaction_id, product_id, shelve_id
+			HAVING COUNT(*) = 1
+		) units
+		WHERE delivery_return_details.delivery_return_id = units.transaction_id AND delivery_return_details.product_id = units.product_id 
+			AND delivery_return_details.shelve_id = units.shelve_id;`,
+	},
+	{
+		Version:     48,
+		Description: "Add Unit Statuses View",
+		Script: `
+		CREATE OR REPLACE VIEW unit_statuses AS
+		SELECT latest.company_id, latest.barcode, latest.product_id, latest.branch_id, latest.shelve_id, latest.lot_id,
+			latest.in_out AS in_stock, latest.type, latest.transaction_id, latest.transaction_date,
+			reservations.sales_order_id AS reserved_sales_order_id
+		FROM (
+			SELECT DISTINCT ON (inventories.company_id, inventories.barcode) inventories.company_id, inventories.barcode,
+				inventories.product_id, inventories.branch_id, inventories.shelve_id, inventories.lot_id, inventories.in_out,
+				inventories.type, inventories.transaction_id, inventories.transaction_date
+			FROM inventories
+			ORDER BY inventories.company_id, inventories.barcode, inventories.transaction_date DESC, inventories.created_at DESC
+		) AS latest
+		LEFT JOIN reservations ON latest.company_id = reservations.company_id AND latest.barcode = reservations.barcode 
+			AND reservations.status = 'ACTIVE' AND reservations.expired_at > (NOW() AT TIME ZONE 'UTC');
+		CREATE INDEX inventories_company_id_barcode_idx ON inventories (company_id, barcode, transaction_date DESC, created_at DESC);`,
+	},
+	{
+		Version:     49,
+		Description: "Add Stock Balances",
+		Script: `
+		CREATE TABLE stock_balances (
+			company_id	char(36) NOT NULL,
+			branch_id char(36) NOT NULL,
+			warehouse_id char(36) NOT NULL,
+			shelve_id char(36) NOT NULL,
+			product_id char(36) NOT NULL,
+			qty INTEGER NOT NULL DEFAULT 0,
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (company_id, branch_id, warehouse_id, shelve_id, product_id)
+		);
+		CREATE INDEX stock_balances_company_id_product_id_idx ON stock_balances (company_id, product_id);
+		INSERT INTO stock_balances (company_id, branch_id, warehouse_id, shelve_id, product_id, qty)
+		SELECT inventories.company_id, inventories.branch_id, shelves.warehouse_id, inventories.shelve_id, inventories.product_id,
+			SUM(
+				case 
+					when inventories.in_out then inventories.qty
+					else -inventories.qty
+				end
+			)
+		FROM inventories
+		JOIN shelves ON inventories.shelve_id = shelves.id
+		GROUP BY inventories.company_id, inventories.branch_id, shelves.warehouse_id, inventories.shelve_id, inventories.product_id;`,
+	},
+	{
+		Version:     50,
+		Description: "Stock Func By Stock Balances",
+		Script: `
+		CREATE or replace FUNCTION stock (companyID character , productID character) RETURNS int
+		as $$
+		declare 
+			stock int;
+		begin
+			
+			SELECT SUM(stock_balances.qty) INTO stock
+			FROM stock_balances
+			WHERE stock_balances.company_id = companyID AND stock_balances.product_id = productID;
+			
+			RETURN COALESCE(stock, 0);
+
+		END;
+		$$ language plpgsql;
+
+		CREATE or replace FUNCTION stock_branch (companyID character, branchID character, productID character) RETURNS int
+		as $$
+		declare 
+			stock int;
+		begin
+			
+			SELECT SUM(stock_balances.qty) INTO stock
+			FROM stock_balances
+			WHERE stock_balances.company_id = companyID AND stock_balances.product_id = productID AND stock_balances.branch_id = branchID;
+			
+			RETURN COALESCE(stock, 0);
+
+		END;
+		$$ language plpgsql
+		`,
+	},
+	{
+		Version:     51,
+		Description: "Add Stock Alerts",
+		Script: `
+		CREATE TABLE stock_alerts (
+			id char(36) NOT NULL PRIMARY KEY,
+			company_id	char(36) NOT NULL,
+			branch_id char(36) NOT NULL,
+			product_id char(36) NOT NULL,
+			qty INTEGER NOT NULL,
+			minimum_stock INTEGER NOT NULL,
+			status VARCHAR(20) NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			acknowledged_at TIMESTAMP NULL,
+			acknowledged_by char(36) NULL,
+			resolved_at TIMESTAMP NULL,
+			CONSTRAINT fk_stock_alerts_to_products FOREIGN KEY (product_id) REFERENCES products(id)
+		);
+		CREATE INDEX stock_alerts_company_id_status_idx ON stock_alerts (company_id, status);
+		CREATE UNIQUE INDEX stock_alerts_unresolved_key ON stock_alerts (company_id, branch_id, product_id) WHERE status <> 'RESOLVED';`,
+	},
+	{
+		Version:     52,
+		Description: "Add Company Settings",
+		Script: `
+		CREATE TABLE company_settings (
+			company_id	char(36) NOT NULL PRIMARY KEY,
+			receive_tolerance_percent NUMERIC(5,2) NOT NULL DEFAULT 0,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			created_by char(36) NOT NULL,
+			updated_by char(36) NOT NULL
+		);`,
+	},
+	{
+		Version:     53,
+		Description: "Add Costing",
+		Script: `
+		ALTER TABLE company_settings ADD COLUMN costing_method VARCHAR(4) NOT NULL DEFAULT 'FIFO';
+		ALTER TABLE receive_details ADD COLUMN unit_cost NUMERIC(18,4) NOT NULL DEFAULT 0;
+		ALTER TABLE inventories ADD COLUMN cost NUMERIC(18,4) NOT NULL DEFAULT 0;
+		ALTER TABLE delivery_details ADD COLUMN cost NUMERIC(18,4) NOT NULL DEFAULT 0;
+		ALTER TABLE receive_return_details ADD COLUMN cost NUMERIC(18,4) NOT NULL DEFAULT 0;
+		ALTER TABLE delivery_return_details ADD COLUMN cost NUMERIC(18,4) NOT NULL DEFAULT 0;
+		ALTER TABLE saldo_stock_details ADD COLUMN value NUMERIC(18,4) NOT NULL DEFAULT 0;
+		CREATE TABLE cost_layers (
+			id char(36) NOT NULL PRIMARY KEY,
+			company_id	char(36) NOT NULL,
+			branch_id char(36) NOT NULL,
+			product_id char(36) NOT NULL,
+			inventory_id char(36) NULL,
+			layer_date TIMESTAMP NOT NULL,
+			qty INTEGER NOT NULL,
+			unit_cost NUMERIC(18,4) NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			CONSTRAINT fk_cost_layers_to_products FOREIGN KEY (product_id) REFERENCES products(id)
+		);
+		CREATE INDEX cost_layers_company_id_branch_id_product_id_idx ON cost_layers (company_id, branch_id, product_id, layer_date);
+		CREATE INDEX cost_layers_inventory_id_idx ON cost_layers (inventory_id);`,
+	},
+	{
+		Version:     54,
+		Description: "Closing Stock Details With Value",
+		Script: `
+		create or replace procedure closing_stock_details(
+			companyID char, 
+			curYear int, 
+			curMonth int
+		) 
+		as $$
+		declare 
+				nextYear int;
+				nextMonth int;
+		begin	
+			
+			IF curYear = 0 THEN
+				select date_part('year', CURRENT_DATE) into curYear;
+			END IF;
+		
+			IF curMonth = 0 THEN 
+				select date_part('month', CURRENT_DATE) into curMonth;
+			END IF;
+			
+			select curYear into nextYear;
+			select curMonth + 1 into nextMonth;
+			
+			IF curMonth = 12 THEN 
+				select curYear+1 into nextYear;
+				select 1 into nextMonth;
+			END IF;
+		
+			-- the value is the cost of the stock. A code is kept while it is in stock, the value left on a code out of stock
+			-- is carried on the product in the branch, the code of the product.
+			INSERT INTO saldo_stock_details (saldo_stock_id, branch_id, code, qty, value)
+			SELECT 
+				saldo_stocks.id saldo_stock_id,
+				carried.branch_id,
+				carried.code,
+				SUM(carried.qty),
+				SUM(carried.value)
+			FROM (
+				SELECT 
+					group_inventories.product_id,
+					group_inventories.branch_id,
+					case 
+						when group_inventories.qty > 0 then group_inventories.code
+						else group_inventories.product_id
+					end
+					as code,
+					GREATEST(group_inventories.qty, 0) qty,
+					group_inventories.value
+				FROM (
+					SELECT 
+						union_inventories.product_id, 
+						union_inventories.branch_id, 
+						union_inventories.code, 
+						SUM(union_inventories.qty) qty,
+						SUM(union_inventories.value) value
+					FROM (
+						(SELECT 
+							saldo_stocks.product_id, 
+							saldo_stock_details.branch_id,
+							saldo_stock_details.code,
+							saldo_stock_details.qty,
+							saldo_stock_details.value
+						FROM saldo_stocks
+						JOIN saldo_stock_details ON saldo_stocks.id = saldo_stock_details.saldo_stock_id
+						WHERE saldo_stocks.year = curYear AND saldo_stocks.month = curMonth and saldo_stocks.company_id = companyID)
+						union all
+						(SELECT 
+							inventories.product_id,
+							inventories.branch_id,
+							case 
+								when products.tracking_mode = 'QUANTITY' then products.id
+								else inventories.barcode
+							end
+							as code,
+							case 
+								when inventories.in_out then inventories.qty
+								else -inventories.qty
+							end 
+							as qty,
+							case 
+								when inventories.in_out then inventories.cost
+								else -inventories.cost
+							end 
+							as value
+						FROM inventories
+						JOIN products ON inventories.product_id = products.id
+						where date_part('month', inventories.transaction_date)=curMonth and date_part('year', inventories.transaction_date)=curYear and inventories.company_id = companyID)
+					) union_inventories
+					GROUP BY union_inventories.product_id, union_inventories.branch_id, union_inventories.code
+				) group_inventories
+			) carried
+			join saldo_stocks ON carried.product_id=saldo_stocks.product_id and saldo_stocks.year = nextYear and saldo_stocks.month = nextMonth and saldo_stocks.company_id = companyID
+			GROUP BY saldo_stocks.id, carried.branch_id, carried.code
+			HAVING SUM(carried.qty) > 0 OR SUM(carried.value) <> 0;
+			
+		end;
+		$$ language plpgsql `,
+	},
+	{
+		Version:     55,
+		Description: "Add Journals",
+		Script: `
+		CREATE TABLE account_mappings (
+			id char(36) NOT NULL PRIMARY KEY,
+			company_id	char(36) NOT NULL,
+			type	char(2) NOT NULL,
+			debit_account_id	char(36) NOT NULL,
+			credit_account_id	char(36) NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			created_by char(36) NOT NULL,
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_by char(36) NOT NULL,
+			UNIQUE(company_id, type)
+		);
+		CREATE TABLE journal_outbox (
+			id char(36) NOT NULL PRIMARY KEY,
+			company_id	char(36) NOT NULL,
+			branch_id char(36) NOT NULL,
+			transaction_id char(36) NOT NULL,
+			transaction_code	CHAR(13) NOT NULL,
+			transaction_type	char(2) NOT NULL,
+			transaction_date	DATE NOT NULL,
+			debit_account_id	char(36) NULL,
+			credit_account_id	char(36) NULL,
+			amount NUMERIC(18,4) NOT NULL,
+			status VARCHAR(8) NOT NULL DEFAULT 'PENDING',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			sent_at TIMESTAMP NULL
+		);
+		CREATE INDEX journal_outbox_transaction_id_idx ON journal_outbox (transaction_id);
+		CREATE INDEX journal_outbox_status_created_at_idx ON journal_outbox (status, created_at);`,
+	},
+	{
+		Version:     56,
+		Description: "Add Event Outbox",
+		Script: `
+		CREATE TABLE event_outbox (
+			id char(36) NOT NULL PRIMARY KEY,
+			company_id	char(36) NOT NULL,
+			topic VARCHAR(50) NOT NULL,
+			aggregate_id char(36) NOT NULL,
+			payload JSONB NOT NULL,
+			status VARCHAR(9) NOT NULL DEFAULT 'PENDING',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			published_at TIMESTAMP NULL
+		);
+		CREATE INDEX event_outbox_status_created_at_idx ON event_outbox (status, created_at);`,
+	},
+	{
+		Version:     57,
+		Description: "Notify Stock Changes",
+		Script: `
+		CREATE or replace FUNCTION notify_stock_change() RETURNS trigger
+		as $$
+		declare 
+			rec record;
+		begin
+			-- an update moving the stock notifies the place it left and the place it entered
+			IF TG_OP = 'DELETE' OR TG_OP = 'UPDATE' THEN
+				FOR rec IN SELECT OLD.company_id, OLD.branch_id, shelves.warehouse_id, OLD.product_id FROM shelves WHERE shelves.id = OLD.shelve_id LOOP
+					PERFORM pg_notify('stock_changes', json_build_object(
+						'company_id', rec.company_id, 'branch_id', rec.branch_id, 'warehouse_id', rec.warehouse_id,
+						'product_id', rec.product_id, 'operation', TG_OP)::text);
+				END LOOP;
+			END IF;
+
+			IF TG_OP = 'INSERT' OR TG_OP = 'UPDATE' THEN
+				FOR rec IN SELECT NEW.company_id, NEW.branch_id, shelves.warehouse_id, NEW.product_id FROM shelves WHERE shelves.id = NEW.shelve_id LOOP
+					PERFORM pg_notify('stock_changes', json_build_object(
+						'company_id', rec.company_id, 'branch_id', rec.branch_id, 'warehouse_id', rec.warehouse_id,
+						'product_id', rec.product_id, 'operation', TG_OP)::text);
+				END LOOP;
+			END IF;
+
+			RETURN NULL;
+		END;
+		$$ language plpgsql;
+
+		CREATE TRIGGER inventories_notify_stock_change
+		AFTER INSERT OR UPDATE OR DELETE ON inventories
+		FOR EACH ROW EXECUTE PROCEDURE notify_stock_change();`,
+	},
+	{
+		Version:     58,
+		Description: "Add Document Status",
+		Script: `
+		ALTER TABLE receives ADD COLUMN status VARCHAR(9) NOT NULL DEFAULT 'POSTED';
+		ALTER TABLE receives ALTER COLUMN status SET DEFAULT 'DRAFT';
+		ALTER TABLE deliveries ADD COLUMN status VARCHAR(9) NOT NULL DEFAULT 'POSTED';
+		ALTER TABLE deliveries ALTER COLUMN status SET DEFAULT 'DRAFT';
+		ALTER TABLE receive_returns ADD COLUMN status VARCHAR(9) NOT NULL DEFAULT 'POSTED';
+		ALTER TABLE receive_returns ALTER COLUMN status SET DEFAULT 'DRAFT';
+		ALTER TABLE delivery_returns ADD COLUMN status VARCHAR(9) NOT NULL DEFAULT 'POSTED';
+		ALTER TABLE delivery_returns ALTER COLUMN status SET DEFAULT 'DRAFT';
+		CREATE INDEX inventories_company_id_transaction_id_idx ON inventories (company_id, transaction_id);`,
+	},
+	{
+		Version:     59,
+		Description: "Add Approvals",
+		Script: `
+		CREATE TABLE approval_rules (
+			id char(36) NOT NULL PRIMARY KEY,
+			company_id	char(36) NOT NULL,
+			document_type	char(2) NOT NULL,
+			min_qty	INT NOT NULL DEFAULT 0,
+			approver_scope	VARCHAR(7) NOT NULL DEFAULT 'BRANCH',
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			created_by char(36) NOT NULL,
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_by char(36) NOT NULL,
+			UNIQUE(company_id, document_type)
+		);
+		CREATE TABLE approvals (
+			id char(36) NOT NULL PRIMARY KEY,
+			company_id	char(36) NOT NULL,
+			document_type	char(2) NOT NULL,
+			document_id	char(36) NOT NULL,
+			document_updated_at TIMESTAMP NOT NULL,
+			decision	VARCHAR(8) NOT NULL,
+			remark	VARCHAR(255) NOT NULL DEFAULT '',
+			decided_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			decided_by char(36) NOT NULL
+		);
+		CREATE INDEX approvals_company_id_document_id_idx ON approvals (company_id, document_id, decided_at);`,
+	},
+	{
+		Version:     60,
+		Description: "Add Audits",
+		Script: `
+		CREATE TABLE audits (
+			id char(36) NOT NULL PRIMARY KEY,
+			company_id	char(36) NOT NULL,
+			entity	VARCHAR(20) NOT NULL,
+			entity_id	char(36) NOT NULL,
+			method	VARCHAR(255) NOT NULL,
+			before_image	JSONB,
+			after_image	JSONB,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			created_by char(36) NOT NULL
+		);
+		CREATE INDEX audits_company_id_entity_id_idx ON audits (company_id, entity_id, created_at);
+		CREATE INDEX audits_company_id_created_at_idx ON audits (company_id, created_at);`,
+	},
+	{
+		Version:     61,
+		Description: "Receive Returns Leave The Stock",
+		Script: `
+		-- receive returns were recorded as incoming movements, a return to the supplier takes the stock out. 
+		-- Every stock figure built from those movements counted the returned qty twice in the wrong direction: 
+		-- the balance of the shelve and the saldo of every month closed after the return.
+		CREATE TEMPORARY TABLE wrong_receive_returns AS
+		SELECT inventories.id, inventories.company_id, inventories.branch_id, inventories.shelve_id, inventories.product_id,
+			case 
+				when products.tracking_mode = 'QUANTITY' then products.id
+				else inventories.barcode
+			end
+			as code,
+			inventories.qty, COALESCE(inventories.cost, 0) cost,
+			date_part('year', inventories.transaction_date) * 100 + date_part('month', inventories.transaction_date) AS period
+		FROM inventories
+		JOIN products ON inventories.product_id = products.id
+		WHERE inventories.type = 'RR' AND inventories.in_out;
+
+		UPDATE stock_balances SET qty = stock_balances.qty - wrong.qty, updated_at = NOW()
+		FROM (
+			SELECT company_id, branch_id, shelve_id, product_id, SUM(2 * qty) qty FROM wrong_receive_returns
+			GROUP BY company_id, branch_id, shelve_id, product_id
+		) wrong
+		WHERE stock_balances.company_id = wrong.company_id AND stock_balances.branch_id = wrong.branch_id 
+			AND stock_balances.shelve_id = wrong.shelve_id AND stock_balances.product_id = wrong.product_id;
+
+		-- the saldo of a month is the stock at its start, it holds the returns of every month before it
+		UPDATE saldo_stocks SET qty = saldo_stocks.qty - wrong.qty
+		FROM (
+			SELECT saldo_stocks.id, SUM(2 * wrong_receive_returns.qty) qty FROM saldo_stocks
+			JOIN wrong_receive_returns ON saldo_stocks.company_id = wrong_receive_returns.company_id 
+				AND saldo_stocks.product_id = wrong_receive_returns.product_id
+				AND saldo_stocks.year * 100 + saldo_stocks.month > wrong_receive_returns.period
+			GROUP BY saldo_stocks.id
+		) wrong
+		WHERE saldo_stocks.id = wrong.id;
+
+		UPDATE saldo_stock_details SET qty = saldo_stock_details.qty - wrong.qty, value = saldo_stock_details.value - wrong.value
+		FROM (
+			SELECT saldo_stock_details.id, SUM(2 * wrong_receive_returns.qty) qty, SUM(2 * wrong_receive_returns.cost) value 
+			FROM saldo_stocks
+			JOIN saldo_stock_details ON saldo_stocks.id = saldo_stock_details.saldo_stock_id
+			JOIN wrong_receive_returns ON saldo_stocks.company_id = wrong_receive_returns.company_id 
+				AND saldo_stocks.product_id = wrong_receive_returns.product_id
+				AND saldo_stock_details.branch_id = wrong_receive_returns.branch_id
+				AND saldo_stock_details.code = wrong_receive_returns.code
+				AND saldo_stocks.year * 100 + saldo_stocks.month > wrong_receive_returns.period
+			GROUP BY saldo_stock_details.id
+		) wrong
+		WHERE saldo_stock_details.id = wrong.id;
+
+		-- a code out of stock carries its value on the product in the branch, as the closing does
+		INSERT INTO saldo_stock_details (saldo_stock_id, branch_id, code, qty, value)
+		SELECT saldo_stock_details.saldo_stock_id, saldo_stock_details.branch_id, saldo_stocks.product_id, 0, SUM(saldo_stock_details.value)
+		FROM saldo_stock_details
+		JOIN saldo_stocks ON saldo_stock_details.saldo_stock_id = saldo_stocks.id
+		WHERE saldo_stock_details.qty <= 0 AND saldo_stock_details.code <> saldo_stocks.product_id
+		GROUP BY saldo_stock_details.saldo_stock_id, saldo_stock_details.branch_id, saldo_stocks.product_id
+		ON CONFLICT (saldo_stock_id, branch_id, code) DO UPDATE SET value = saldo_stock_details.value + EXCLUDED.value;
+
+		DELETE FROM saldo_stock_details USING saldo_stocks 
+		WHERE saldo_stock_details.saldo_stock_id = saldo_stocks.id AND saldo_stock_details.qty <= 0 
+			AND saldo_stock_details.code <> saldo_stocks.product_id;
+
+		DELETE FROM saldo_stock_details WHERE qty <= 0 AND value = 0;
+
+		UPDATE inventories SET in_out = false WHERE id IN (SELECT id FROM wrong_receive_returns);
+
+		DROP TABLE wrong_receive_returns;`,
+	},
 }
 
 // Migrate attempts to bring the schema for db up to date with the migrations
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/inventory-service/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// AccountMapping struct
+type AccountMapping struct {
+	Db         *sql.DB
+	Log        map[string]*log.Logger
+	UserClient users.UserServiceClient
+	inventories.UnimplementedAccountMappingServiceServer
+}
+
+// Upsert AccountMapping of a transaction type, only a user of the whole company can change it
+func (u *AccountMapping) Upsert(ctx context.Context, in *inventories.AccountMapping) (*inventories.AccountMapping, error) {
+	var accountMappingModel model.AccountMapping
+	var err error
+
+	// basic validation
+	{
+		if _, ok := model.JournalTypes[in.GetType()]; !ok {
+			return &accountMappingModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid type: GR, DO, RR, DR or OP")
+		}
+
+		if len(in.GetDebitAccountId()) == 0 {
+			return &accountMappingModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid debit account")
+		}
+
+		if len(in.GetCreditAccountId()) == 0 {
+			return &accountMappingModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid credit account")
+		}
+
+		if in.GetDebitAccountId() == in.GetCreditAccountId() {
+			return &accountMappingModel.Pb, status.Error(codes.InvalidArgument, "debit and credit account must be different")
+		}
+	}
+
+	userLogin, err := getUserLogin(ctx, u.UserClient)
+	if err != nil {
+		return &accountMappingModel.Pb, err
+	}
+
+	if len(userLogin.GetBranchId()) > 0 || len(userLogin.GetRegionId()) > 0 {
+		return &accountMappingModel.Pb, status.Error(codes.PermissionDenied, "only company user can change account mapping")
+	}
+
+	accountMappingModel.Pb = inventories.AccountMapping{
+		Type:            in.GetType(),
+		DebitAccountId:  in.GetDebitAccountId(),
+		CreditAccountId: in.GetCreditAccountId(),
+	}
+
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &accountMappingModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	err = accountMappingModel.Upsert(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &accountMappingModel.Pb, err
+	}
+
+	tx.Commit()
+
+	return &accountMappingModel.Pb, nil
+}
+
+// Delete AccountMapping, the transaction type is no longer journalized
+func (u *AccountMapping) Delete(ctx context.Context, in *inventories.Id) (*inventories.MyBoolean, error) {
+	var output inventories.MyBoolean
+	output.Boolean = false
+
+	var accountMappingModel model.AccountMapping
+	var err error
+
+	// basic validation
+	{
+		if len(in.GetId()) == 0 {
+			return &output, status.Error(codes.InvalidArgument, "Please supply valid id")
+		}
+		accountMappingModel.Pb.Id = in.GetId()
+	}
+
+	userLogin, err := getUserLogin(ctx, u.UserClient)
+	if err != nil {
+		return &output, err
+	}
+
+	if len(userLogin.GetBranchId()) > 0 || len(userLogin.GetRegionId()) > 0 {
+		return &output, status.Error(codes.PermissionDenied, "only company user can change account mapping")
+	}
+
+	err = accountMappingModel.Get(ctx, u.Db)
+	if err != nil {
+		return &output, err
+	}
+
+	err = accountMappingModel.Delete(ctx, u.Db)
+	if err != nil {
+		return &output, err
+	}
+
+	output.Boolean = true
+	return &output, nil
+}
+
+// List AccountMapping
+func (u *AccountMapping) List(in *inventories.MyEmpty, stream inventories.AccountMappingService_ListServer) error {
+	ctx := stream.Context()
+	var accountMappingModel model.AccountMapping
+	query, paramQueries := accountMappingModel.ListQuery(ctx)
+
+	rows, err := u.Db.QueryContext(ctx, query, paramQueries...)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return err
+		}
+
+		var pbAccountMapping inventories.AccountMapping
+		var companyID string
+		var createdAt, updatedAt time.Time
+		err = rows.Scan(&pbAccountMapping.Id, &companyID, &pbAccountMapping.Type, &pbAccountMapping.DebitAccountId,
+			&pbAccountMapping.CreditAccountId, &createdAt, &pbAccountMapping.CreatedBy, &updatedAt, &pbAccountMapping.UpdatedBy)
+		if err != nil {
+			return status.Errorf(codes.Internal, "scan data: %v", err)
+		}
+
+		pbAccountMapping.CreatedAt = createdAt.String()
+		pbAccountMapping.UpdatedAt = updatedAt.String()
+
+		err = stream.Send(&inventories.ListAccountMappingResponse{AccountMapping: &pbAccountMapping})
+		if err != nil {
+			return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+		}
+	}
+
+	if rows.Err() != nil {
+		return status.Errorf(codes.Internal, "rows error: %v", rows.Err())
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/inventory-service/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Approval struct
+type Approval struct {
+	Db           *sql.DB
+	Log          map[string]*log.Logger
+	UserClient   users.UserServiceClient
+	RegionClient users.RegionServiceClient
+	BranchClient users.BranchServiceClient
+	inventories.UnimplementedApprovalServiceServer
+}
+
+// Approve a draft document, the approved version can be posted
+func (u *Approval) Approve(ctx context.Context, in *inventories.ApprovalRequest) (*inventories.Approval, error) {
+	return u.decide(ctx, in, model.ApprovalApproved)
+}
+
+// Reject a draft document, it can not be posted until it is changed and approved
+func (u *Approval) Reject(ctx context.Context, in *inventories.ApprovalRequest) (*inventories.Approval, error) {
+	return u.decide(ctx, in, model.ApprovalRejected)
+}
+
+func (u *Approval) decide(ctx context.Context, in *inventories.ApprovalRequest, decision string) (*inventories.Approval, error) {
+	var approvalModel model.Approval
+	var err error
+
+	// basic validation
+	{
+		if _, ok := model.ApprovalDocuments[in.GetDocumentType()]; !ok {
+			return &approvalModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid document type: GR, DO, RR or DR")
+		}
+
+		if len(in.GetDocumentId()) == 0 {
+			return &approvalModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid document")
+		}
+
+		if decision == model.ApprovalRejected && len(in.GetRemark()) == 0 {
+			return &approvalModel.Pb, status.Error(codes.InvalidArgument, "Please supply the reason of the rejection")
+		}
+	}
+
+	approvalModel.Pb = inventories.Approval{
+		DocumentType: in.GetDocumentType(),
+		DocumentId:   in.GetDocumentId(),
+		Decision:     decision,
+		Remark:       in.GetRemark(),
+	}
+
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &approvalModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	err = approvalModel.GetDocument(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &approvalModel.Pb, err
+	}
+
+	if approvalModel.DocumentStatus != model.DocumentDraft {
+		tx.Rollback()
+		return &approvalModel.Pb, status.Error(codes.FailedPrecondition, "only a draft document can be decided")
+	}
+
+	rule, err := approvalModel.Rule(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &approvalModel.Pb, err
+	}
+
+	if rule == nil {
+		tx.Rollback()
+		return &approvalModel.Pb, status.Error(codes.FailedPrecondition, "the document does not need approval")
+	}
+
+	err = isApprover(ctx, u.UserClient, u.RegionClient, u.BranchClient, approvalModel.BranchID, rule.Pb.GetApproverScope(), approvalModel.DocumentUpdatedBy)
+	if err != nil {
+		tx.Rollback()
+		return &approvalModel.Pb, err
+	}
+
+	err = approvalModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &approvalModel.Pb, err
+	}
+
+	tx.Commit()
+
+	return &approvalModel.Pb, nil
+}
+
+// List Approval, the decisions made on a document
+func (u *Approval) List(in *inventories.ListApprovalRequest, stream inventories.ApprovalService_ListServer) error {
+	ctx := stream.Context()
+
+	if len(in.GetDocumentId()) == 0 {
+		return status.Error(codes.InvalidArgument, "Please supply valid document")
+	}
+
+	var approvalModel model.Approval
+	approvalModel.Pb.DocumentId = in.GetDocumentId()
+	query, paramQueries := approvalModel.ListQuery(ctx)
+
+	rows, err := u.Db.QueryContext(ctx, query, paramQueries...)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return err
+		}
+
+		var pbApproval inventories.Approval
+		var decidedAt time.Time
+		err = rows.Scan(&pbApproval.Id, &pbApproval.DocumentType, &pbApproval.DocumentId, &pbApproval.Decision,
+			&pbApproval.Remark, &decidedAt, &pbApproval.DecidedBy)
+		if err != nil {
+			return status.Errorf(codes.Internal, "scan data: %v", err)
+		}
+
+		pbApproval.DecidedAt = decidedAt.String()
+
+		err = stream.Send(&inventories.ListApprovalResponse{Approval: &pbApproval})
+		if err != nil {
+			return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+		}
+	}
+
+	if rows.Err() != nil {
+		return status.Errorf(codes.Internal, "rows error: %v", rows.Err())
+	}
+
+	return nil
+}
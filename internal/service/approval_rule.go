@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/inventory-service/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ApprovalRule struct
+type ApprovalRule struct {
+	Db         *sql.DB
+	Log        map[string]*log.Logger
+	UserClient users.UserServiceClient
+	inventories.UnimplementedApprovalRuleServiceServer
+}
+
+// Upsert ApprovalRule of a document type, only a user of the whole company can change it
+func (u *ApprovalRule) Upsert(ctx context.Context, in *inventories.ApprovalRule) (*inventories.ApprovalRule, error) {
+	var approvalRuleModel model.ApprovalRule
+	var err error
+
+	// basic validation
+	{
+		if _, ok := model.ApprovalDocuments[in.GetDocumentType()]; !ok {
+			return &approvalRuleModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid document type: GR, DO, RR or DR")
+		}
+
+		if in.GetMinQty() < 0 {
+			return &approvalRuleModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid min qty")
+		}
+
+		if len(in.GetApproverScope()) == 0 {
+			in.ApproverScope = model.ApproverBranch
+		}
+
+		if !(in.GetApproverScope() == model.ApproverBranch || in.GetApproverScope() == model.ApproverRegion || in.GetApproverScope() == model.ApproverCompany) {
+			return &approvalRuleModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid approver scope: BRANCH, REGION or COMPANY")
+		}
+	}
+
+	userLogin, err := getUserLogin(ctx, u.UserClient)
+	if err != nil {
+		return &approvalRuleModel.Pb, err
+	}
+
+	if len(userLogin.GetBranchId()) > 0 || len(userLogin.GetRegionId()) > 0 {
+		return &approvalRuleModel.Pb, status.Error(codes.PermissionDenied, "only company user can change approval rule")
+	}
+
+	approvalRuleModel.Pb = inventories.ApprovalRule{
+		DocumentType:  in.GetDocumentType(),
+		MinQty:        in.GetMinQty(),
+		ApproverScope: in.GetApproverScope(),
+	}
+
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &approvalRuleModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	err = approvalRuleModel.Upsert(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &approvalRuleModel.Pb, err
+	}
+
+	tx.Commit()
+
+	return &approvalRuleModel.Pb, nil
+}
+
+// Delete ApprovalRule, the documents of the type are posted without approval
+func (u *ApprovalRule) Delete(ctx context.Context, in *inventories.Id) (*inventories.MyBoolean, error) {
+	var output inventories.MyBoolean
+	output.Boolean = false
+
+	var approvalRuleModel model.ApprovalRule
+	var err error
+
+	// basic validation
+	{
+		if len(in.GetId()) == 0 {
+			return &output, status.Error(codes.InvalidArgument, "Please supply valid id")
+		}
+		approvalRuleModel.Pb.Id = in.GetId()
+	}
+
+	userLogin, err := getUserLogin(ctx, u.UserClient)
+	if err != nil {
+		return &output, err
+	}
+
+	if len(userLogin.GetBranchId()) > 0 || len(userLogin.GetRegionId()) > 0 {
+		return &output, status.Error(codes.PermissionDenied, "only company user can change approval rule")
+	}
+
+	err = approvalRuleModel.Get(ctx, u.Db)
+	if err != nil {
+		return &output, err
+	}
+
+	err = approvalRuleModel.Delete(ctx, u.Db)
+	if err != nil {
+		return &output, err
+	}
+
+	output.Boolean = true
+	return &output, nil
+}
+
+// List ApprovalRule
+func (u *ApprovalRule) List(in *inventories.MyEmpty, stream inventories.ApprovalRuleService_ListServer) error {
+	ctx := stream.Context()
+	var approvalRuleModel model.ApprovalRule
+	query, paramQueries := approvalRuleModel.ListQuery(ctx)
+
+	rows, err := u.Db.QueryContext(ctx, query, paramQueries...)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return err
+		}
+
+		var pbApprovalRule inventories.ApprovalRule
+		var companyID string
+		var createdAt, updatedAt time.Time
+		err = rows.Scan(&pbApprovalRule.Id, &companyID, &pbApprovalRule.DocumentType, &pbApprovalRule.MinQty,
+			&pbApprovalRule.ApproverScope, &createdAt, &pbApprovalRule.CreatedBy, &updatedAt, &pbApprovalRule.UpdatedBy)
+		if err != nil {
+			return status.Errorf(codes.Internal, "scan data: %v", err)
+		}
+
+		pbApprovalRule.CreatedAt = createdAt.String()
+		pbApprovalRule.UpdatedAt = updatedAt.String()
+
+		err = stream.Send(&inventories.ListApprovalRuleResponse{ApprovalRule: &pbApprovalRule})
+		if err != nil {
+			return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+		}
+	}
+
+	if rows.Err() != nil {
+		return status.Errorf(codes.Internal, "rows error: %v", rows.Err())
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/inventory-service/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Audit struct
+type Audit struct {
+	Db         *sql.DB
+	Log        map[string]*log.Logger
+	UserClient users.UserServiceClient
+	inventories.UnimplementedAuditServiceServer
+}
+
+// List Audit of a period, filtered by entity and user. The trail spans all branches, only a user of the whole
+// company can read it.
+func (u *Audit) List(in *inventories.ListAuditRequest, stream inventories.AuditService_ListServer) error {
+	ctx := stream.Context()
+	var startDate, endDate time.Time
+	var err error
+
+	// basic validation
+	{
+		if len(in.GetEntity()) > 0 {
+			if _, ok := model.AuditEntities[in.GetEntity()]; !ok {
+				return status.Error(codes.InvalidArgument, "Please supply valid entity")
+			}
+		}
+
+		startDate, err = time.Parse("2006-01-02T15:04:05.000Z", in.GetStartDate())
+		if err != nil {
+			return status.Error(codes.InvalidArgument, "Please supply valid start date")
+		}
+
+		endDate, err = time.Parse("2006-01-02T15:04:05.000Z", in.GetEndDate())
+		if err != nil || endDate.Before(startDate) {
+			return status.Error(codes.InvalidArgument, "Please supply valid end date")
+		}
+	}
+
+	userLogin, err := getUserLogin(ctx, u.UserClient)
+	if err != nil {
+		return err
+	}
+
+	if len(userLogin.GetBranchId()) > 0 || len(userLogin.GetRegionId()) > 0 {
+		return status.Error(codes.PermissionDenied, "only company user can read the audit trail")
+	}
+
+	var auditModel model.Audit
+	query, paramQueries, paginationResponse, err := auditModel.ListQuery(ctx, u.Db, in, startDate, endDate)
+	if err != nil {
+		return err
+	}
+
+	rows, err := u.Db.QueryContext(ctx, query, paramQueries...)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer rows.Close()
+	paginationResponse.Pagination = in.GetPagination()
+
+	for rows.Next() {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return err
+		}
+
+		var pbAudit inventories.Audit
+		var createdAt time.Time
+		err = rows.Scan(&pbAudit.Id, &pbAudit.CompanyId, &pbAudit.Entity, &pbAudit.EntityId, &pbAudit.Method,
+			&pbAudit.Before, &pbAudit.After, &createdAt, &pbAudit.CreatedBy)
+		if err != nil {
+			return status.Errorf(codes.Internal, "scan data: %v", err)
+		}
+
+		pbAudit.CreatedAt = createdAt.String()
+
+		res := &inventories.ListAuditResponse{
+			Pagination: paginationResponse,
+			Audit:      &pbAudit,
+		}
+
+		err = stream.Send(res)
+		if err != nil {
+			return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+		}
+	}
+
+	if rows.Err() != nil {
+		return status.Errorf(codes.Internal, "rows error: %v", rows.Err())
+	}
+
+	return nil
+}
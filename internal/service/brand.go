@@ -62,11 +62,28 @@ func (u *Brand) Create(ctx context.Context, in *inventories.Brand) (*inventories
 		Code: in.GetCode(),
 		Name: in.GetName(),
 	}
-	err = brandModel.Create(ctx, u.Db)
+
+	tx, err := u.Db.BeginTx(ctx, nil)
 	if err != nil {
+		return &brandModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	err = brandModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
 		return &brandModel.Pb, err
 	}
 
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "brand", EntityId: brandModel.Pb.GetId()}
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &brandModel.Pb, err
+	}
+
+	tx.Commit()
+
 	return &brandModel.Pb, nil
 }
 
@@ -94,11 +111,33 @@ func (u *Brand) Update(ctx context.Context, in *inventories.Brand) (*inventories
 		brandModel.Pb.Name = in.GetName()
 	}
 
-	err = brandModel.Update(ctx, u.Db)
+	tx, err := u.Db.BeginTx(ctx, nil)
 	if err != nil {
+		return &brandModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "brand", EntityId: brandModel.Pb.GetId()}
+	err = auditModel.Begin(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &brandModel.Pb, err
+	}
+
+	err = brandModel.Update(ctx, tx)
+	if err != nil {
+		tx.Rollback()
 		return &brandModel.Pb, err
 	}
 
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &brandModel.Pb, err
+	}
+
+	tx.Commit()
+
 	return &brandModel.Pb, nil
 }
 
@@ -148,11 +187,33 @@ func (u *Brand) Delete(ctx context.Context, in *inventories.Id) (*inventories.My
 		return &output, err
 	}
 
-	err = brandModel.Delete(ctx, u.Db)
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &output, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "brand", EntityId: brandModel.Pb.GetId()}
+	err = auditModel.Begin(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &output, err
+	}
+
+	err = brandModel.Delete(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &output, err
+	}
+
+	err = auditModel.Create(ctx, tx)
 	if err != nil {
+		tx.Rollback()
 		return &output, err
 	}
 
+	tx.Commit()
+
 	output.Boolean = true
 	return &output, nil
 }
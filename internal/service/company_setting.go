@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"log"
+
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/inventory-service/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CompanySetting struct
+type CompanySetting struct {
+	Db         *sql.DB
+	Log        map[string]*log.Logger
+	UserClient users.UserServiceClient
+	inventories.UnimplementedCompanySettingServiceServer
+}
+
+// View CompanySetting
+func (u *CompanySetting) View(ctx context.Context, in *inventories.MyEmpty) (*inventories.CompanySetting, error) {
+	var companySettingModel model.CompanySetting
+	err := companySettingModel.Get(ctx, u.Db)
+	if err != nil {
+		return &companySettingModel.Pb, err
+	}
+
+	return &companySettingModel.Pb, nil
+}
+
+// Update CompanySetting, only a user of the whole company can change it
+func (u *CompanySetting) Update(ctx context.Context, in *inventories.CompanySetting) (*inventories.CompanySetting, error) {
+	var companySettingModel model.CompanySetting
+	var err error
+
+	// basic validation
+	{
+		if in.GetReceiveTolerancePercent() < 0 || in.GetReceiveTolerancePercent() > 100 {
+			return &companySettingModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid receive tolerance percent")
+		}
+
+		if len(in.GetCostingMethod()) == 0 {
+			in.CostingMethod = model.CostingFIFO
+		}
+
+		if in.GetCostingMethod() != model.CostingFIFO && in.GetCostingMethod() != model.CostingAverage {
+			return &companySettingModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid costing method: FIFO or AVG")
+		}
+	}
+
+	userLogin, err := getUserLogin(ctx, u.UserClient)
+	if err != nil {
+		return &companySettingModel.Pb, err
+	}
+
+	if len(userLogin.GetBranchId()) > 0 || len(userLogin.GetRegionId()) > 0 {
+		return &companySettingModel.Pb, status.Error(codes.PermissionDenied, "only company user can change company setting")
+	}
+
+	err = companySettingModel.Get(ctx, u.Db)
+	if err != nil {
+		return &companySettingModel.Pb, err
+	}
+
+	companySettingModel.Pb.ReceiveTolerancePercent = in.GetReceiveTolerancePercent()
+	companySettingModel.Pb.CostingMethod = in.GetCostingMethod()
+
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &companySettingModel.Pb, err
+	}
+
+	err = companySettingModel.Upsert(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &companySettingModel.Pb, err
+	}
+
+	tx.Commit()
+
+	return &companySettingModel.Pb, nil
+}
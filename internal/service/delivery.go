@@ -8,6 +8,7 @@ import (
 
 	"github.com/jacky-htg/erp-pkg/app"
 	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"github.com/jacky-htg/erp-proto/go/pb/sales"
 	"github.com/jacky-htg/erp-proto/go/pb/users"
 	"github.com/jacky-htg/inventory-service/internal/model"
 	"google.golang.org/grpc/codes"
@@ -16,21 +17,22 @@ import (
 
 // Delivery struct
 type Delivery struct {
-	Db           *sql.DB
-	Log          map[string]*log.Logger
-	UserClient   users.UserServiceClient
-	RegionClient users.RegionServiceClient
-	BranchClient users.BranchServiceClient
+	Db               *sql.DB
+	Log              map[string]*log.Logger
+	UserClient       users.UserServiceClient
+	RegionClient     users.RegionServiceClient
+	BranchClient     users.BranchServiceClient
+	SalesOrderClient sales.SalesOrderServiceClient
+	AlertEngine      *StockAlertEngine
 	inventories.UnimplementedDeliveryServiceServer
 }
 
-// Create Delivery
+// Create Delivery, the delivery is a draft until it is posted
 func (u *Delivery) Create(ctx context.Context, in *inventories.Delivery) (*inventories.Delivery, error) {
 	var deliveryModel model.Delivery
+	var outbounds []model.Inventory
 	var err error
 
-	// TODO : if this month any closing stock, create transaction for thus month will be blocked
-
 	// basic validation
 	{
 		if len(in.GetBranchId()) == 0 {
@@ -59,6 +61,11 @@ func (u *Delivery) Create(ctx context.Context, in *inventories.Delivery) (*inven
 			return &deliveryModel.Pb, err
 		}
 
+		detail.Qty, err = detailQty(&productModel.Pb, detail.GetQty())
+		if err != nil {
+			return &deliveryModel.Pb, err
+		}
+
 		// shelve validation
 		if len(detail.GetShelve().GetId()) == 0 {
 			return &deliveryModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid shelve")
@@ -71,6 +78,29 @@ func (u *Delivery) Create(ctx context.Context, in *inventories.Delivery) (*inven
 			return &deliveryModel.Pb, err
 		}
 
+		if productModel.Pb.GetTrackingMode() == model.TrackingQuantity {
+			// a quantity line is checked by its qty, a barcode would pass it as a unit
+			if len(detail.GetBarcode()) > 0 {
+				return &deliveryModel.Pb, status.Error(codes.InvalidArgument, "product tracked by quantity has no barcode")
+			}
+
+			if len(detail.GetLot().GetId()) > 0 {
+				err = isLotOfProduct(ctx, u.Db, detail.GetLot().GetId(), productModel.Pb.GetId())
+				if err != nil {
+					return &deliveryModel.Pb, err
+				}
+			}
+
+			outbounds = append(outbounds, model.Inventory{
+				BranchID:  in.GetBranchId(),
+				ShelveID:  detail.GetShelve().GetId(),
+				ProductID: productModel.Pb.GetId(),
+				Qty:       detail.GetQty(),
+				LotID:     detail.GetLot().GetId(),
+			})
+			continue
+		}
+
 		if len(detail.GetBarcode()) == 0 {
 			return &deliveryModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid barcode")
 		}
@@ -84,6 +114,11 @@ func (u *Delivery) Create(ctx context.Context, in *inventories.Delivery) (*inven
 			return &deliveryModel.Pb, err
 		}
 
+		// a serialized unit leaves with the lot it was received
+		detail.Lot = nil
+		if len(inventory.LotID) > 0 {
+			detail.Lot = &inventories.Lot{Id: inventory.LotID}
+		}
 	}
 
 	err = isYourBranch(ctx, u.UserClient, u.RegionClient, u.BranchClient, in.GetBranchId())
@@ -96,6 +131,11 @@ func (u *Delivery) Create(ctx context.Context, in *inventories.Delivery) (*inven
 		return &deliveryModel.Pb, err
 	}
 
+	ordered, err := u.salesOrdered(ctx, in.GetSalesOrderId())
+	if err != nil {
+		return &deliveryModel.Pb, err
+	}
+
 	deliveryModel.Pb = inventories.Delivery{
 		BranchId:     in.GetBranchId(),
 		BranchName:   branch.GetName(),
@@ -111,12 +151,39 @@ func (u *Delivery) Create(ctx context.Context, in *inventories.Delivery) (*inven
 		return &deliveryModel.Pb, err
 	}
 
+	// transaction in a closed period is blocked
+	err = isPeriodOpen(ctx, tx, in.GetDeliveryDate())
+	if err != nil {
+		tx.Rollback()
+		return &deliveryModel.Pb, err
+	}
+
+	err = checkOutbound(ctx, tx, in.GetSalesOrderId(), outbounds)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryModel.Pb, err
+	}
+
 	err = deliveryModel.Create(ctx, tx)
 	if err != nil {
 		tx.Rollback()
 		return &deliveryModel.Pb, err
 	}
 
+	err = deliveryModel.CheckOutstanding(ctx, tx, ordered)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryModel.Pb, err
+	}
+
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "delivery", EntityId: deliveryModel.Pb.GetId()}
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryModel.Pb, err
+	}
+
 	tx.Commit()
 
 	return &deliveryModel.Pb, nil
@@ -127,8 +194,6 @@ func (u *Delivery) Update(ctx context.Context, in *inventories.Delivery) (*inven
 	var deliveryModel model.Delivery
 	var err error
 
-	// TODO : if this month any closing stock, create transaction for thus month will be blocked
-
 	// basic validation
 	{
 		if len(in.GetId()) == 0 {
@@ -144,17 +209,65 @@ func (u *Delivery) Update(ctx context.Context, in *inventories.Delivery) (*inven
 		return &deliveryModel.Pb, err
 	}
 
+	if deliveryModel.Pb.GetStatus() != model.DocumentDraft {
+		return &deliveryModel.Pb, status.Error(codes.FailedPrecondition, "only a draft delivery can be updated")
+	}
+
+	salesOrderID := deliveryModel.Pb.GetSalesOrderId()
+	if len(in.GetSalesOrderId()) > 0 {
+		salesOrderID = in.GetSalesOrderId()
+	}
+
+	ordered, err := u.salesOrdered(ctx, salesOrderID)
+	if err != nil {
+		return &deliveryModel.Pb, err
+	}
+
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &deliveryModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	// the draft is locked and read again, the update is made on the document as it is now
+	err = deliveryModel.GetForUpdate(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryModel.Pb, err
+	}
+
+	if deliveryModel.Pb.GetStatus() != model.DocumentDraft {
+		tx.Rollback()
+		return &deliveryModel.Pb, status.Error(codes.FailedPrecondition, "only a draft delivery can be updated")
+	}
+
+	currentDate := deliveryModel.Pb.GetDeliveryDate()
+
 	if len(in.GetSalesOrderId()) > 0 {
 		deliveryModel.Pb.SalesOrderId = in.GetSalesOrderId()
 	}
 
+	if deliveryModel.Pb.GetSalesOrderId() != salesOrderID {
+		tx.Rollback()
+		return &deliveryModel.Pb, status.Error(codes.FailedPrecondition, "delivery has changed, update it again")
+	}
+
 	if _, err := time.Parse("2006-01-02T15:04:05.000Z", in.GetDeliveryDate()); err == nil {
 		deliveryModel.Pb.DeliveryDate = in.GetDeliveryDate()
 	}
 
-	tx, err := u.Db.BeginTx(ctx, nil)
+	// both the current and the new document date must be in an open period
+	err = isPeriodOpen(ctx, tx, currentDate, in.GetDeliveryDate())
 	if err != nil {
-		return &deliveryModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+		tx.Rollback()
+		return &deliveryModel.Pb, err
+	}
+
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "delivery", EntityId: deliveryModel.Pb.GetId()}
+	err = auditModel.Begin(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryModel.Pb, err
 	}
 
 	err = deliveryModel.Update(ctx, tx)
@@ -179,6 +292,12 @@ func (u *Delivery) Update(ctx context.Context, in *inventories.Delivery) (*inven
 			return &deliveryModel.Pb, err
 		}
 
+		detail.Qty, err = detailQty(&productModel.Pb, detail.GetQty())
+		if err != nil {
+			tx.Rollback()
+			return &deliveryModel.Pb, err
+		}
+
 		// shelve validation
 		if len(detail.GetShelve().GetId()) == 0 {
 			tx.Rollback()
@@ -201,17 +320,52 @@ func (u *Delivery) Update(ctx context.Context, in *inventories.Delivery) (*inven
 				}
 			}
 		} else {
-			if len(detail.GetBarcode()) == 0 {
-				return &deliveryModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid barcode")
-			}
+			if productModel.Pb.GetTrackingMode() == model.TrackingQuantity {
+				// a quantity line is checked by its qty, a barcode would pass it as a unit
+				if len(detail.GetBarcode()) > 0 {
+					tx.Rollback()
+					return &deliveryModel.Pb, status.Error(codes.InvalidArgument, "product tracked by quantity has no barcode")
+				}
 
-			inventory := model.Inventory{
-				BranchID: in.GetBranchId(),
-				Barcode:  detail.GetBarcode(),
-			}
-			err = inventory.CheckBarcode(ctx, u.Db)
-			if err != nil {
-				return &deliveryModel.Pb, err
+				if len(detail.GetLot().GetId()) > 0 {
+					err = isLotOfProduct(ctx, u.Db, detail.GetLot().GetId(), productModel.Pb.GetId())
+					if err != nil {
+						tx.Rollback()
+						return &deliveryModel.Pb, err
+					}
+				}
+
+				err = checkOutbound(ctx, tx, deliveryModel.Pb.GetSalesOrderId(), []model.Inventory{{
+					BranchID:  deliveryModel.Pb.GetBranchId(),
+					ShelveID:  detail.GetShelve().GetId(),
+					ProductID: productModel.Pb.GetId(),
+					Qty:       detail.GetQty(),
+					LotID:     detail.GetLot().GetId(),
+				}})
+				if err != nil {
+					tx.Rollback()
+					return &deliveryModel.Pb, err
+				}
+			} else {
+				if len(detail.GetBarcode()) == 0 {
+					tx.Rollback()
+					return &deliveryModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid barcode")
+				}
+
+				inventory := model.Inventory{
+					BranchID: in.GetBranchId(),
+					Barcode:  detail.GetBarcode(),
+				}
+				err = inventory.CheckBarcode(ctx, u.Db)
+				if err != nil {
+					tx.Rollback()
+					return &deliveryModel.Pb, err
+				}
+
+				detail.Lot = nil
+				if len(inventory.LotID) > 0 {
+					detail.Lot = &inventories.Lot{Id: inventory.LotID}
+				}
 			}
 
 			// operasi insert
@@ -220,6 +374,8 @@ func (u *Delivery) Update(ctx context.Context, in *inventories.Delivery) (*inven
 				Barcode:    detail.GetBarcode(),
 				Product:    detail.GetProduct(),
 				Shelve:     detail.GetShelve(),
+				Qty:        detail.GetQty(),
+				Lot:        detail.GetLot(),
 			}}
 			deliveryDetailModel.PbDelivery = inventories.Delivery{
 				Id:           deliveryModel.Pb.Id,
@@ -258,11 +414,272 @@ func (u *Delivery) Update(ctx context.Context, in *inventories.Delivery) (*inven
 		}
 	}
 
+	err = deliveryModel.CheckOutstanding(ctx, tx, ordered)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryModel.Pb, err
+	}
+
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryModel.Pb, err
+	}
+
 	tx.Commit()
 
 	return &deliveryModel.Pb, nil
 }
 
+// Post Delivery, the delivered goods leave the stock
+func (u *Delivery) Post(ctx context.Context, in *inventories.Id) (*inventories.Delivery, error) {
+	var deliveryModel model.Delivery
+	var err error
+
+	// basic validation
+	{
+		if len(in.GetId()) == 0 {
+			return &deliveryModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid id")
+		}
+		deliveryModel.Pb.Id = in.GetId()
+	}
+
+	err = deliveryModel.Get(ctx, u.Db)
+	if err != nil {
+		return &deliveryModel.Pb, err
+	}
+
+	if deliveryModel.Pb.GetStatus() != model.DocumentDraft {
+		return &deliveryModel.Pb, status.Error(codes.FailedPrecondition, "only a draft delivery can be posted")
+	}
+
+	err = isYourBranch(ctx, u.UserClient, u.RegionClient, u.BranchClient, deliveryModel.Pb.GetBranchId())
+	if err != nil {
+		return &deliveryModel.Pb, err
+	}
+
+	ordered, err := u.salesOrdered(ctx, deliveryModel.Pb.GetSalesOrderId())
+	if err != nil {
+		return &deliveryModel.Pb, err
+	}
+
+	salesOrderID := deliveryModel.Pb.GetSalesOrderId()
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &deliveryModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	// the draft is locked and read again, an update committed since it was read is posted as it is now
+	err = deliveryModel.GetForUpdate(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryModel.Pb, err
+	}
+
+	if deliveryModel.Pb.GetStatus() != model.DocumentDraft {
+		tx.Rollback()
+		return &deliveryModel.Pb, status.Error(codes.FailedPrecondition, "only a draft delivery can be posted")
+	}
+
+	if deliveryModel.Pb.GetSalesOrderId() != salesOrderID {
+		tx.Rollback()
+		return &deliveryModel.Pb, status.Error(codes.FailedPrecondition, "delivery has changed, post it again")
+	}
+
+	err = isPeriodOpen(ctx, tx, deliveryModel.Pb.GetDeliveryDate())
+	if err != nil {
+		tx.Rollback()
+		return &deliveryModel.Pb, err
+	}
+
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "delivery", EntityId: deliveryModel.Pb.GetId()}
+	err = auditModel.Begin(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryModel.Pb, err
+	}
+
+	approvalModel := model.Approval{}
+	approvalModel.Pb = inventories.Approval{DocumentType: "DO", DocumentId: deliveryModel.Pb.GetId()}
+	err = approvalModel.CheckApproved(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryModel.Pb, err
+	}
+
+	// a quantity line is its own barcode, its stock is checked here while a unit is checked when it is posted
+	var outbounds []model.Inventory
+	for _, detail := range deliveryModel.Pb.GetDetails() {
+		if detail.GetBarcode() != detail.GetId() {
+			continue
+		}
+
+		outbounds = append(outbounds, model.Inventory{
+			BranchID:  deliveryModel.Pb.GetBranchId(),
+			ShelveID:  detail.GetShelve().GetId(),
+			ProductID: detail.GetProduct().GetId(),
+			Qty:       detail.GetQty(),
+			LotID:     detail.GetLot().GetId(),
+		})
+	}
+
+	err = checkOutbound(ctx, tx, deliveryModel.Pb.GetSalesOrderId(), outbounds)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryModel.Pb, err
+	}
+
+	err = deliveryModel.Post(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryModel.Pb, err
+	}
+
+	err = deliveryModel.CheckOutstanding(ctx, tx, ordered)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryModel.Pb, err
+	}
+
+	// the reservations of the sales order are done for the delivered goods only
+	if len(deliveryModel.Pb.GetSalesOrderId()) > 0 {
+		for _, detail := range deliveryModel.Pb.GetDetails() {
+			reservationModel := model.Reservation{}
+			reservationModel.Pb = inventories.Reservation{
+				BranchId:     deliveryModel.Pb.GetBranchId(),
+				SalesOrderId: deliveryModel.Pb.GetSalesOrderId(),
+				ProductId:    detail.GetProduct().GetId(),
+			}
+			if detail.GetBarcode() != detail.GetId() {
+				reservationModel.Pb.Barcode = detail.GetBarcode()
+			}
+
+			err = reservationModel.Fulfill(ctx, tx, detail.GetQty())
+			if err != nil {
+				tx.Rollback()
+				return &deliveryModel.Pb, err
+			}
+		}
+	}
+
+	journalModel := model.Journal{TransactionID: deliveryModel.Pb.GetId()}
+	err = journalModel.Post(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryModel.Pb, err
+	}
+
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryModel.Pb, err
+	}
+
+	tx.Commit()
+
+	productIDs := make([]string, len(deliveryModel.Pb.GetDetails()))
+	for i, detail := range deliveryModel.Pb.GetDetails() {
+		productIDs[i] = detail.GetProduct().GetId()
+	}
+	u.AlertEngine.AfterOutbound(ctx, deliveryModel.Pb.GetBranchId(), productIDs)
+
+	return &deliveryModel.Pb, nil
+}
+
+// Cancel Delivery, a draft is only marked cancelled while a posted delivery is reversed back into the stock
+func (u *Delivery) Cancel(ctx context.Context, in *inventories.Id) (*inventories.Delivery, error) {
+	var deliveryModel model.Delivery
+	var err error
+
+	// basic validation
+	{
+		if len(in.GetId()) == 0 {
+			return &deliveryModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid id")
+		}
+		deliveryModel.Pb.Id = in.GetId()
+	}
+
+	err = deliveryModel.Get(ctx, u.Db)
+	if err != nil {
+		return &deliveryModel.Pb, err
+	}
+
+	if deliveryModel.Pb.GetStatus() == model.DocumentCancelled {
+		return &deliveryModel.Pb, status.Error(codes.FailedPrecondition, "delivery already cancelled")
+	}
+
+	err = isYourBranch(ctx, u.UserClient, u.RegionClient, u.BranchClient, deliveryModel.Pb.GetBranchId())
+	if err != nil {
+		return &deliveryModel.Pb, err
+	}
+
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &deliveryModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	if deliveryModel.Pb.GetStatus() == model.DocumentPosted {
+		err = isPeriodOpen(ctx, tx, time.Now().UTC().Format("2006-01-02T15:04:05.000Z"))
+		if err != nil {
+			tx.Rollback()
+			return &deliveryModel.Pb, err
+		}
+	}
+
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "delivery", EntityId: deliveryModel.Pb.GetId()}
+	err = auditModel.Begin(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryModel.Pb, err
+	}
+
+	err = deliveryModel.Cancel(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryModel.Pb, err
+	}
+
+	journalModel := model.Journal{TransactionID: deliveryModel.Pb.GetId()}
+	err = journalModel.Post(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryModel.Pb, err
+	}
+
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryModel.Pb, err
+	}
+
+	tx.Commit()
+
+	return &deliveryModel.Pb, nil
+}
+
+// salesOrdered qty ordered per product on the sales order
+func (u *Delivery) salesOrdered(ctx context.Context, salesOrderID string) (map[string]int32, error) {
+	mSalesOrder := model.SalesOrder{Id: salesOrderID, SalesOrderClient: u.SalesOrderClient}
+	outstanding, err := mSalesOrder.Outstanding(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ordered := make(map[string]int32)
+	for _, detail := range outstanding.GetDetail() {
+		ordered[detail.GetProductId()] += int32(detail.GetQuantity())
+	}
+
+	return ordered, nil
+}
+
+// OutstandingBySalesOrder qty of the sales order not delivered yet, per product
+func (u *Delivery) OutstandingBySalesOrder(ctx context.Context, in *inventories.Id) (*inventories.OutstandingResponse, error) {
+	return outstandingBySalesOrder(ctx, u.Db, u.SalesOrderClient, in.GetId())
+}
+
 // View Delivery
 func (u *Delivery) View(ctx context.Context, in *inventories.Id) (*inventories.Delivery, error) {
 	var deliveryModel model.Delivery
@@ -309,8 +726,8 @@ func (u *Delivery) List(in *inventories.ListDeliveryRequest, stream inventories.
 		var pbDelivery inventories.Delivery
 		var companyID string
 		var createdAt, updatedAt time.Time
-		err = rows.Scan(&pbDelivery.Id, &companyID, &pbDelivery.BranchId, &pbDelivery.BranchName,
-			&pbDelivery.Code, &pbDelivery.DeliveryDate, &pbDelivery.Remark,
+		err = rows.Scan(&pbDelivery.Id, &companyID, &pbDelivery.BranchId, &pbDelivery.BranchName, &pbDelivery.SalesOrderId,
+			&pbDelivery.Code, &pbDelivery.DeliveryDate, &pbDelivery.Remark, &pbDelivery.Status,
 			&createdAt, &pbDelivery.CreatedBy, &updatedAt, &pbDelivery.UpdatedBy)
 		if err != nil {
 			return status.Errorf(codes.Internal, "scan data: %v", err)
@@ -331,3 +748,51 @@ func (u *Delivery) List(in *inventories.ListDeliveryRequest, stream inventories.
 	}
 	return nil
 }
+
+// SuggestPicks propose the barcodes and shelves to ship, ordered by the pick method of the product category
+func (u *Delivery) SuggestPicks(ctx context.Context, in *inventories.SuggestPicksRequest) (*inventories.SuggestPicksResponse, error) {
+	var pickModel model.Pick
+	var err error
+
+	// basic validation
+	{
+		if len(in.GetBranchId()) == 0 {
+			return &pickModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid branch")
+		}
+
+		if len(in.GetProductId()) == 0 {
+			return &pickModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid product")
+		}
+
+		if in.GetQty() <= 0 {
+			return &pickModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid qty")
+		}
+	}
+
+	err = isYourBranch(ctx, u.UserClient, u.RegionClient, u.BranchClient, in.GetBranchId())
+	if err != nil {
+		return &pickModel.Pb, err
+	}
+
+	productModel := model.Product{}
+	productModel.Pb = inventories.Product{Id: in.GetProductId()}
+	err = productModel.Get(ctx, u.Db)
+	if err != nil {
+		return &pickModel.Pb, err
+	}
+
+	productCategoryModel := model.ProductCategory{}
+	productCategoryModel.Pb = inventories.ProductCategory{Id: productModel.Pb.GetProductCategory().GetId()}
+	err = productCategoryModel.Get(ctx, u.Db)
+	if err != nil {
+		return &pickModel.Pb, err
+	}
+
+	pickModel.Method = productCategoryModel.Pb.GetPickMethod()
+	err = pickModel.Suggest(ctx, u.Db, in, productModel.Pb.GetTrackingMode())
+	if err != nil {
+		return &pickModel.Pb, err
+	}
+
+	return &pickModel.Pb, nil
+}
@@ -24,13 +24,11 @@ type DeliveryReturn struct {
 	inventories.UnimplementedDeliveryReturnServiceServer
 }
 
-// Create DeliveryReturn
+// Create DeliveryReturn, the delivery return is a draft until it is posted
 func (u *DeliveryReturn) Create(ctx context.Context, in *inventories.DeliveryReturn) (*inventories.DeliveryReturn, error) {
 	var deliveryReturnModel model.DeliveryReturn
 	var err error
 
-	// TODO : if this month any closing stock, create transaction for thus month will be blocked
-
 	// basic validation
 	{
 		if len(in.GetBranchId()) == 0 {
@@ -59,6 +57,22 @@ func (u *DeliveryReturn) Create(ctx context.Context, in *inventories.DeliveryRet
 			return &deliveryReturnModel.Pb, err
 		}
 
+		detail.Qty, err = detailQty(&productModel.Pb, detail.GetQty())
+		if err != nil {
+			return &deliveryReturnModel.Pb, err
+		}
+
+		if productModel.Pb.GetTrackingMode() != model.TrackingQuantity && len(detail.GetBarcode()) == 0 {
+			return &deliveryReturnModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid barcode")
+		}
+
+		if len(detail.GetLot().GetId()) > 0 {
+			err = isLotOfProduct(ctx, u.Db, detail.GetLot().GetId(), productModel.Pb.GetId())
+			if err != nil {
+				return &deliveryReturnModel.Pb, err
+			}
+		}
+
 		// shelve validation
 		if len(detail.GetShelve().GetId()) == 0 {
 			return &deliveryReturnModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid shelve")
@@ -97,12 +111,27 @@ func (u *DeliveryReturn) Create(ctx context.Context, in *inventories.DeliveryRet
 		return &deliveryReturnModel.Pb, err
 	}
 
+	// transaction in a closed period is blocked
+	err = isPeriodOpen(ctx, tx, in.GetReturnDate())
+	if err != nil {
+		tx.Rollback()
+		return &deliveryReturnModel.Pb, err
+	}
+
 	err = deliveryReturnModel.Create(ctx, tx)
 	if err != nil {
 		tx.Rollback()
 		return &deliveryReturnModel.Pb, err
 	}
 
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "delivery_return", EntityId: deliveryReturnModel.Pb.GetId()}
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryReturnModel.Pb, err
+	}
+
 	tx.Commit()
 
 	return &deliveryReturnModel.Pb, nil
@@ -134,8 +163,6 @@ func (u *DeliveryReturn) Update(ctx context.Context, in *inventories.DeliveryRet
 	var deliveryReturnModel model.DeliveryReturn
 	var err error
 
-	// TODO : if this month any closing stock, create transaction for thus month will be blocked
-
 	// basic validation
 	{
 		if len(in.GetId()) == 0 {
@@ -146,11 +173,25 @@ func (u *DeliveryReturn) Update(ctx context.Context, in *inventories.DeliveryRet
 
 	// TODO : if any mutation_unit update will be blocked
 
-	err = deliveryReturnModel.Get(ctx, u.Db)
+	tx, err := u.Db.BeginTx(ctx, nil)
 	if err != nil {
+		return &deliveryReturnModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	// the draft is locked and read in the transaction, the update is made on the document as it is now
+	err = deliveryReturnModel.GetForUpdate(ctx, tx)
+	if err != nil {
+		tx.Rollback()
 		return &deliveryReturnModel.Pb, err
 	}
 
+	if deliveryReturnModel.Pb.GetStatus() != model.DocumentDraft {
+		tx.Rollback()
+		return &deliveryReturnModel.Pb, status.Error(codes.FailedPrecondition, "only a draft delivery return can be updated")
+	}
+
+	currentDate := deliveryReturnModel.Pb.GetReturnDate()
+
 	if len(in.GetDelivery().GetId()) > 0 {
 		deliveryReturnModel.Pb.Delivery = in.GetDelivery()
 	}
@@ -159,9 +200,19 @@ func (u *DeliveryReturn) Update(ctx context.Context, in *inventories.DeliveryRet
 		deliveryReturnModel.Pb.ReturnDate = in.GetReturnDate()
 	}
 
-	tx, err := u.Db.BeginTx(ctx, nil)
+	// both the current and the new document date must be in an open period
+	err = isPeriodOpen(ctx, tx, currentDate, in.GetReturnDate())
 	if err != nil {
-		return &deliveryReturnModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+		tx.Rollback()
+		return &deliveryReturnModel.Pb, err
+	}
+
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "delivery_return", EntityId: deliveryReturnModel.Pb.GetId()}
+	err = auditModel.Begin(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryReturnModel.Pb, err
 	}
 
 	err = deliveryReturnModel.Update(ctx, tx)
@@ -186,6 +237,25 @@ func (u *DeliveryReturn) Update(ctx context.Context, in *inventories.DeliveryRet
 			return &deliveryReturnModel.Pb, err
 		}
 
+		detail.Qty, err = detailQty(&productModel.Pb, detail.GetQty())
+		if err != nil {
+			tx.Rollback()
+			return &deliveryReturnModel.Pb, err
+		}
+
+		if productModel.Pb.GetTrackingMode() != model.TrackingQuantity && len(detail.GetBarcode()) == 0 {
+			tx.Rollback()
+			return &deliveryReturnModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid barcode")
+		}
+
+		if len(detail.GetLot().GetId()) > 0 {
+			err = isLotOfProduct(ctx, u.Db, detail.GetLot().GetId(), productModel.Pb.GetId())
+			if err != nil {
+				tx.Rollback()
+				return &deliveryReturnModel.Pb, err
+			}
+		}
+
 		// shelve validation
 		if len(detail.GetShelve().GetId()) == 0 {
 			tx.Rollback()
@@ -213,6 +283,8 @@ func (u *DeliveryReturn) Update(ctx context.Context, in *inventories.DeliveryRet
 
 			deliveryReturnDetailModel.Pb.Product = detail.GetProduct()
 			deliveryReturnDetailModel.Pb.Shelve = detail.GetShelve()
+			deliveryReturnDetailModel.Pb.Qty = detail.GetQty()
+			deliveryReturnDetailModel.Pb.Lot = detail.GetLot()
 			deliveryReturnDetailModel.PbDeliveryReturn = inventories.DeliveryReturn{
 				Id:         deliveryReturnModel.Pb.Id,
 				BranchId:   deliveryReturnModel.Pb.BranchId,
@@ -247,6 +319,9 @@ func (u *DeliveryReturn) Update(ctx context.Context, in *inventories.DeliveryRet
 				DeliveryReturnId: deliveryReturnModel.Pb.GetId(),
 				Product:          detail.GetProduct(),
 				Shelve:           detail.GetShelve(),
+				Barcode:          detail.GetBarcode(),
+				Qty:              detail.GetQty(),
+				Lot:              detail.GetLot(),
 			}}
 			deliveryReturnDetailModel.PbDeliveryReturn = inventories.DeliveryReturn{
 				Id:         deliveryReturnModel.Pb.Id,
@@ -285,6 +360,192 @@ func (u *DeliveryReturn) Update(ctx context.Context, in *inventories.DeliveryRet
 		}
 	}
 
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryReturnModel.Pb, err
+	}
+
+	tx.Commit()
+
+	return &deliveryReturnModel.Pb, nil
+}
+
+// Post DeliveryReturn, the returned goods come back into the stock
+func (u *DeliveryReturn) Post(ctx context.Context, in *inventories.Id) (*inventories.DeliveryReturn, error) {
+	var deliveryReturnModel model.DeliveryReturn
+	var err error
+
+	// basic validation
+	{
+		if len(in.GetId()) == 0 {
+			return &deliveryReturnModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid id")
+		}
+		deliveryReturnModel.Pb.Id = in.GetId()
+	}
+
+	err = deliveryReturnModel.Get(ctx, u.Db)
+	if err != nil {
+		return &deliveryReturnModel.Pb, err
+	}
+
+	if deliveryReturnModel.Pb.GetStatus() != model.DocumentDraft {
+		return &deliveryReturnModel.Pb, status.Error(codes.FailedPrecondition, "only a draft delivery return can be posted")
+	}
+
+	err = isYourBranch(ctx, u.UserClient, u.RegionClient, u.BranchClient, deliveryReturnModel.Pb.GetBranchId())
+	if err != nil {
+		return &deliveryReturnModel.Pb, err
+	}
+
+	// goods can only come back from a delivery that has left the stock
+	var deliveryModel model.Delivery
+	deliveryModel.Pb.Id = deliveryReturnModel.Pb.GetDelivery().GetId()
+	err = deliveryModel.Get(ctx, u.Db)
+	if err != nil {
+		return &deliveryReturnModel.Pb, err
+	}
+
+	if deliveryModel.Pb.GetStatus() != model.DocumentPosted {
+		return &deliveryReturnModel.Pb, status.Errorf(codes.FailedPrecondition, "delivery %s is not posted", deliveryModel.Pb.GetCode())
+	}
+
+	deliveryID := deliveryReturnModel.Pb.GetDelivery().GetId()
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &deliveryReturnModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	// the draft is locked and read again, an update committed since it was read is posted as it is now
+	err = deliveryReturnModel.GetForUpdate(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryReturnModel.Pb, err
+	}
+
+	if deliveryReturnModel.Pb.GetStatus() != model.DocumentDraft {
+		tx.Rollback()
+		return &deliveryReturnModel.Pb, status.Error(codes.FailedPrecondition, "only a draft delivery return can be posted")
+	}
+
+	if deliveryReturnModel.Pb.GetDelivery().GetId() != deliveryID {
+		tx.Rollback()
+		return &deliveryReturnModel.Pb, status.Error(codes.FailedPrecondition, "delivery return has changed, post it again")
+	}
+
+	err = isPeriodOpen(ctx, tx, deliveryReturnModel.Pb.GetReturnDate())
+	if err != nil {
+		tx.Rollback()
+		return &deliveryReturnModel.Pb, err
+	}
+
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "delivery_return", EntityId: deliveryReturnModel.Pb.GetId()}
+	err = auditModel.Begin(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryReturnModel.Pb, err
+	}
+
+	approvalModel := model.Approval{}
+	approvalModel.Pb = inventories.Approval{DocumentType: "DR", DocumentId: deliveryReturnModel.Pb.GetId()}
+	err = approvalModel.CheckApproved(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryReturnModel.Pb, err
+	}
+
+	err = deliveryReturnModel.Post(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryReturnModel.Pb, err
+	}
+
+	journalModel := model.Journal{TransactionID: deliveryReturnModel.Pb.GetId()}
+	err = journalModel.Post(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryReturnModel.Pb, err
+	}
+
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryReturnModel.Pb, err
+	}
+
+	tx.Commit()
+
+	return &deliveryReturnModel.Pb, nil
+}
+
+// Cancel DeliveryReturn, a draft is only marked cancelled while a posted delivery return is reversed out of the stock
+func (u *DeliveryReturn) Cancel(ctx context.Context, in *inventories.Id) (*inventories.DeliveryReturn, error) {
+	var deliveryReturnModel model.DeliveryReturn
+	var err error
+
+	// basic validation
+	{
+		if len(in.GetId()) == 0 {
+			return &deliveryReturnModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid id")
+		}
+		deliveryReturnModel.Pb.Id = in.GetId()
+	}
+
+	err = deliveryReturnModel.Get(ctx, u.Db)
+	if err != nil {
+		return &deliveryReturnModel.Pb, err
+	}
+
+	if deliveryReturnModel.Pb.GetStatus() == model.DocumentCancelled {
+		return &deliveryReturnModel.Pb, status.Error(codes.FailedPrecondition, "delivery return already cancelled")
+	}
+
+	err = isYourBranch(ctx, u.UserClient, u.RegionClient, u.BranchClient, deliveryReturnModel.Pb.GetBranchId())
+	if err != nil {
+		return &deliveryReturnModel.Pb, err
+	}
+
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &deliveryReturnModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	if deliveryReturnModel.Pb.GetStatus() == model.DocumentPosted {
+		err = isPeriodOpen(ctx, tx, time.Now().UTC().Format("2006-01-02T15:04:05.000Z"))
+		if err != nil {
+			tx.Rollback()
+			return &deliveryReturnModel.Pb, err
+		}
+	}
+
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "delivery_return", EntityId: deliveryReturnModel.Pb.GetId()}
+	err = auditModel.Begin(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryReturnModel.Pb, err
+	}
+
+	err = deliveryReturnModel.Cancel(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryReturnModel.Pb, err
+	}
+
+	journalModel := model.Journal{TransactionID: deliveryReturnModel.Pb.GetId()}
+	err = journalModel.Post(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryReturnModel.Pb, err
+	}
+
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &deliveryReturnModel.Pb, err
+	}
+
 	tx.Commit()
 
 	return &deliveryReturnModel.Pb, nil
@@ -313,15 +574,16 @@ func (u *DeliveryReturn) List(in *inventories.ListDeliveryReturnRequest, stream
 		}
 
 		var pbDeliveryReturn inventories.DeliveryReturn
-		var companyID string
+		var companyID, deliveryID string
 		var createdAt, updatedAt time.Time
-		err = rows.Scan(&pbDeliveryReturn.Id, &companyID, &pbDeliveryReturn.BranchId, &pbDeliveryReturn.BranchName,
-			&pbDeliveryReturn.Code, &pbDeliveryReturn.ReturnDate, &pbDeliveryReturn.Remark,
+		err = rows.Scan(&pbDeliveryReturn.Id, &companyID, &pbDeliveryReturn.BranchId, &pbDeliveryReturn.BranchName, &deliveryID,
+			&pbDeliveryReturn.Code, &pbDeliveryReturn.ReturnDate, &pbDeliveryReturn.Remark, &pbDeliveryReturn.Status,
 			&createdAt, &pbDeliveryReturn.CreatedBy, &updatedAt, &pbDeliveryReturn.UpdatedBy)
 		if err != nil {
 			return status.Errorf(codes.Internal, "scan data: %v", err)
 		}
 
+		pbDeliveryReturn.Delivery = &inventories.Delivery{Id: deliveryID}
 		pbDeliveryReturn.CreatedAt = createdAt.String()
 		pbDeliveryReturn.UpdatedAt = updatedAt.String()
 
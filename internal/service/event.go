@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/jacky-htg/inventory-service/internal/model"
+	"github.com/jacky-htg/inventory-service/internal/publisher"
+)
+
+// eventBatch events published on each run
+const eventBatch int = 500
+
+// EventRelay publish the events of the outbox in the order they were written. A publisher failure holds the later
+// events of the same aggregate until the next run, the events of the other aggregates are still published.
+type EventRelay struct {
+	Db        *sql.DB
+	Log       map[string]*log.Logger
+	Publisher publisher.Publisher
+}
+
+// Run relay the pending events on each interval until the context is done
+func (u *EventRelay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			u.relay(ctx)
+		}
+	}
+}
+
+// relay the pending events one by one. No lock is held while the publisher is called, an aggregate with a failed
+// event is skipped for the rest of the run so its events are never published out of order.
+func (u *EventRelay) relay(ctx context.Context) {
+	var eventModel model.Event
+	events, err := eventModel.Pending(ctx, u.Db, eventBatch)
+	if err != nil {
+		u.Log["error"].Printf("pending events: %v", err)
+		return
+	}
+
+	held := make(map[string]bool)
+	for _, event := range events {
+		if held[event.AggregateID] {
+			continue
+		}
+
+		err = u.Publisher.Publish(ctx, &publisher.Event{
+			ID:          event.ID,
+			CompanyID:   event.CompanyID,
+			Topic:       event.Topic,
+			AggregateID: event.AggregateID,
+			Payload:     json.RawMessage(event.Payload),
+			OccurredAt:  event.CreatedAt,
+		})
+		if err != nil {
+			u.Log["warning"].Printf("publish event %s %s, attempt %d: %v", event.ID, event.Topic, event.Attempts+1, err)
+			held[event.AggregateID] = true
+			err = event.MarkFailed(ctx, u.Db, err)
+		} else {
+			err = event.MarkPublished(ctx, u.Db)
+		}
+
+		if err != nil {
+			u.Log["error"].Printf("mark event %s: %v", event.ID, err)
+			return
+		}
+	}
+}
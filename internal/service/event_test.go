@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/inventory-service/internal/model"
+	"github.com/jacky-htg/inventory-service/internal/publisher"
+)
+
+// failingPublisher fail the failing events, the other events are kept by the memory publisher
+type failingPublisher struct {
+	publisher.Memory
+	failing map[string]bool
+}
+
+func (u *failingPublisher) Publish(ctx context.Context, event *publisher.Event) error {
+	if u.failing[event.ID] {
+		return errors.New("broker is down")
+	}
+
+	return u.Memory.Publish(ctx, event)
+}
+
+// insertEvent into the outbox, dated in the past so the relay reads it before the events of the other tests
+func insertEvent(t *testing.T, db *sql.DB, companyID string, aggregateID string, sequence int) string {
+	t.Helper()
+
+	id := uuid.New().String()
+	_, err := db.Exec(`
+		INSERT INTO event_outbox (id, company_id, topic, aggregate_id, payload, status, created_at)
+		VALUES ($1, $2, 'receive.updated', $3, '{}', $4, $5)`,
+		id, companyID, aggregateID, model.EventPending, time.Date(2000, 1, 1, 0, 0, sequence, 0, time.UTC),
+	)
+	if err != nil {
+		t.Fatalf("insert event: %v", err)
+	}
+
+	return id
+}
+
+// publishedOf the ids of the published events of the company, in the order they were published
+func publishedOf(sink *failingPublisher, companyID string) []string {
+	var ids []string
+	for _, event := range sink.Events() {
+		if event.CompanyID == companyID {
+			ids = append(ids, event.ID)
+		}
+	}
+
+	return ids
+}
+
+func sameOrder(got []string, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestEventRelayHoldsFailedAggregate(t *testing.T) {
+	db := openTestDB(t)
+
+	companyID, failing, other := uuid.New().String(), uuid.New().String(), uuid.New().String()
+	failingCreated := insertEvent(t, db, companyID, failing, 1)
+	otherCreated := insertEvent(t, db, companyID, other, 2)
+	failingUpdated := insertEvent(t, db, companyID, failing, 3)
+
+	sink := &failingPublisher{failing: map[string]bool{failingCreated: true}}
+	relay := EventRelay{Db: db, Log: testLog(), Publisher: sink}
+	relay.relay(context.Background())
+
+	// the later event of the failed aggregate waits, the other aggregate is published
+	if published := publishedOf(sink, companyID); !sameOrder(published, []string{otherCreated}) {
+		t.Fatalf("published = %v, want only %s", published, otherCreated)
+	}
+
+	var attempts int32
+	err := db.QueryRow(`SELECT attempts FROM event_outbox WHERE id = $1 AND status = $2`, failingUpdated, model.EventPending).Scan(&attempts)
+	if err != nil || attempts != 0 {
+		t.Fatalf("held event = %v, %d attempts, want pending without attempt", err, attempts)
+	}
+
+	sink.failing = nil
+	relay.relay(context.Background())
+
+	want := []string{otherCreated, failingCreated, failingUpdated}
+	if published := publishedOf(sink, companyID); !sameOrder(published, want) {
+		t.Errorf("published = %v, want %v", published, want)
+	}
+}
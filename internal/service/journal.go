@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/jacky-htg/inventory-service/internal/model"
+)
+
+// journalBatch journals sent to the ledger on each run
+const journalBatch int = 100
+
+// ledgerTimeout bound of a single call to the ledger, a slow ledger fails the journal instead of holding the relay
+const ledgerTimeout = 10 * time.Second
+
+// JournalRelay send the journals of the outbox to the general ledger service. A ledger outage leaves the journals
+// pending, the warehouse transactions are never blocked by the ledger.
+type JournalRelay struct {
+	Db     *sql.DB
+	Log    map[string]*log.Logger
+	Ledger *model.Ledger
+}
+
+// Run relay the pending journals on each interval until the context is done
+func (u *JournalRelay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			u.relay(ctx)
+		}
+	}
+}
+
+// relay the pending journals one by one. No lock is held while the ledger is called, each call is bounded by its own
+// timeout and each journal is marked in its own statement.
+func (u *JournalRelay) relay(ctx context.Context) {
+	var journalModel model.Journal
+	journals, err := journalModel.Pending(ctx, u.Db, journalBatch)
+	if err != nil {
+		u.Log["error"].Printf("pending journals: %v", err)
+		return
+	}
+
+	for _, journal := range journals {
+		err = u.post(ctx, &journal)
+		if err != nil {
+			u.Log["warning"].Printf("post journal %s of %s, attempt %d: %v", journal.ID, journal.TransactionCode, journal.Attempts+1, err)
+			err = journal.MarkFailed(ctx, u.Db, err)
+		} else {
+			err = journal.MarkSent(ctx, u.Db)
+		}
+
+		if err != nil {
+			u.Log["error"].Printf("mark journal %s: %v", journal.ID, err)
+			return
+		}
+	}
+}
+
+func (u *JournalRelay) post(ctx context.Context, journal *model.Journal) error {
+	ctx, cancel := context.WithTimeout(ctx, ledgerTimeout)
+	defer cancel()
+
+	return u.Ledger.Post(ctx, journal)
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jacky-htg/erp-proto/go/pb/ledgers"
+	"github.com/jacky-htg/inventory-service/internal/model"
+	"google.golang.org/grpc"
+)
+
+// fakeJournalClient fail the journals of the failing references, the other journals are booked
+type fakeJournalClient struct {
+	ledgers.JournalServiceClient
+	failing map[string]bool
+	booked  []string
+}
+
+func (u *fakeJournalClient) Create(ctx context.Context, in *ledgers.Journal, opts ...grpc.CallOption) (*ledgers.Journal, error) {
+	if u.failing[in.GetReferenceId()] {
+		return nil, errors.New("ledger is down")
+	}
+
+	u.booked = append(u.booked, in.GetReferenceId())
+	return in, nil
+}
+
+// insertJournal into the outbox, dated in the past so the relay reads it before the journals of the other tests
+func insertJournal(t *testing.T, db *sql.DB, journalStatus string) string {
+	t.Helper()
+
+	id := uuid.New().String()
+	mapped := journalStatus != model.JournalUnmapped
+	_, err := db.Exec(`
+		INSERT INTO journal_outbox (id, company_id, branch_id, transaction_id, transaction_code, transaction_type,
+			transaction_date, debit_account_id, credit_account_id, amount, status, created_at)
+		VALUES ($1, $2, $3, $4, 'GR24000000001', 'GR', $5, $6, $7, 100, $8, $5)`,
+		id, uuid.New().String(), uuid.New().String(), uuid.New().String(), time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		sql.NullString{String: "inventory", Valid: mapped}, sql.NullString{String: "payable", Valid: mapped}, journalStatus,
+	)
+	if err != nil {
+		t.Fatalf("insert journal: %v", err)
+	}
+
+	return id
+}
+
+func TestJournalRelayRetriesFailedJournal(t *testing.T) {
+	db := openTestDB(t)
+
+	sent := insertJournal(t, db, model.JournalPending)
+	failed := insertJournal(t, db, model.JournalPending)
+	unmapped := insertJournal(t, db, model.JournalUnmapped)
+
+	client := &fakeJournalClient{failing: map[string]bool{failed: true}}
+	relay := JournalRelay{Db: db, Log: testLog(), Ledger: &model.Ledger{JournalClient: client}}
+	relay.relay(context.Background())
+
+	tests := []struct {
+		id       string
+		status   string
+		attempts int32
+		hasError bool
+	}{
+		{sent, model.JournalSent, 1, false},
+		{failed, model.JournalPending, 1, true},
+		{unmapped, model.JournalUnmapped, 0, false},
+	}
+
+	for _, tt := range tests {
+		var journalStatus string
+		var attempts int32
+		var lastError sql.NullString
+		err := db.QueryRow(`SELECT status, attempts, last_error FROM journal_outbox WHERE id = $1`, tt.id).
+			Scan(&journalStatus, &attempts, &lastError)
+		if err != nil {
+			t.Fatalf("get journal: %v", err)
+		}
+
+		if journalStatus != tt.status || attempts != tt.attempts || lastError.Valid != tt.hasError {
+			t.Errorf("journal %s = %s, %d attempts, error %v, want %s, %d attempts, error %v",
+				tt.id, journalStatus, attempts, lastError.Valid, tt.status, tt.attempts, tt.hasError)
+		}
+	}
+
+	// the next run only retries the failed journal, a journal is booked once
+	client.failing = nil
+	relay.relay(context.Background())
+
+	booked := make(map[string]int)
+	for _, id := range client.booked {
+		booked[id]++
+	}
+
+	if booked[sent] != 1 || booked[failed] != 1 || booked[unmapped] != 0 {
+		t.Errorf("booked = %v, want the sent and the failed journal once", booked)
+	}
+}
@@ -0,0 +1,342 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/inventory-service/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Mutation struct
+type Mutation struct {
+	Db           *sql.DB
+	Log          map[string]*log.Logger
+	UserClient   users.UserServiceClient
+	RegionClient users.RegionServiceClient
+	BranchClient users.BranchServiceClient
+	inventories.UnimplementedMutationServiceServer
+}
+
+// Create Mutation
+func (u *Mutation) Create(ctx context.Context, in *inventories.Mutation) (*inventories.Mutation, error) {
+	var mutationModel model.Mutation
+	var err error
+
+	// basic validation
+	{
+		if len(in.GetBranchId()) == 0 {
+			return &mutationModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid branch")
+		}
+
+		if _, err := time.Parse("2006-01-02T15:04:05.000Z", in.GetMutationDate()); err != nil {
+			return &mutationModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid date")
+		}
+
+		if len(in.GetDetails()) == 0 {
+			return &mutationModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid details")
+		}
+	}
+
+	for _, detail := range in.GetDetails() {
+		err = u.validateDetail(ctx, in.GetBranchId(), detail)
+		if err != nil {
+			return &mutationModel.Pb, err
+		}
+	}
+
+	err = isYourBranch(ctx, u.UserClient, u.RegionClient, u.BranchClient, in.GetBranchId())
+	if err != nil {
+		return &mutationModel.Pb, err
+	}
+
+	branch, err := getBranch(ctx, u.BranchClient, in.GetBranchId())
+	if err != nil {
+		return &mutationModel.Pb, err
+	}
+
+	mutationModel.Pb = inventories.Mutation{
+		BranchId:     in.GetBranchId(),
+		BranchName:   branch.GetName(),
+		MutationDate: in.GetMutationDate(),
+		Remark:       in.GetRemark(),
+		Details:      in.GetDetails(),
+	}
+
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &mutationModel.Pb, err
+	}
+
+	// transaction in a closed period is blocked
+	err = isPeriodOpen(ctx, tx, in.GetMutationDate())
+	if err != nil {
+		tx.Rollback()
+		return &mutationModel.Pb, err
+	}
+
+	err = mutationModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &mutationModel.Pb, err
+	}
+
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "mutation", EntityId: mutationModel.Pb.GetId()}
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &mutationModel.Pb, err
+	}
+
+	tx.Commit()
+
+	return &mutationModel.Pb, nil
+}
+
+// Update Mutation
+func (u *Mutation) Update(ctx context.Context, in *inventories.Mutation) (*inventories.Mutation, error) {
+	var mutationModel model.Mutation
+	var err error
+
+	// basic validation
+	{
+		if len(in.GetId()) == 0 {
+			return &mutationModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid id")
+		}
+		mutationModel.Pb.Id = in.GetId()
+	}
+
+	err = mutationModel.Get(ctx, u.Db)
+	if err != nil {
+		return &mutationModel.Pb, err
+	}
+
+	currentDate := mutationModel.Pb.GetMutationDate()
+
+	err = isYourBranch(ctx, u.UserClient, u.RegionClient, u.BranchClient, mutationModel.Pb.GetBranchId())
+	if err != nil {
+		return &mutationModel.Pb, err
+	}
+
+	if _, err := time.Parse("2006-01-02T15:04:05.000Z", in.GetMutationDate()); err == nil {
+		mutationModel.Pb.MutationDate = in.GetMutationDate()
+	}
+
+	if len(in.GetRemark()) > 0 {
+		mutationModel.Pb.Remark = in.GetRemark()
+	}
+
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &mutationModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	// both the current and the new document date must be in an open period
+	err = isPeriodOpen(ctx, tx, currentDate, in.GetMutationDate())
+	if err != nil {
+		tx.Rollback()
+		return &mutationModel.Pb, err
+	}
+
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "mutation", EntityId: mutationModel.Pb.GetId()}
+	err = auditModel.Begin(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &mutationModel.Pb, err
+	}
+
+	err = mutationModel.Update(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &mutationModel.Pb, err
+	}
+
+	for _, detail := range in.GetDetails() {
+		if len(detail.GetId()) > 0 {
+			for index, data := range mutationModel.Pb.GetDetails() {
+				if data.GetId() == detail.GetId() {
+					mutationModel.Pb.Details = append(mutationModel.Pb.Details[:index], mutationModel.Pb.Details[index+1:]...)
+					break
+				}
+			}
+		} else {
+			err = u.validateDetail(ctx, mutationModel.Pb.GetBranchId(), detail)
+			if err != nil {
+				tx.Rollback()
+				return &mutationModel.Pb, err
+			}
+
+			// operasi insert
+			mutationDetailModel := model.MutationDetail{Pb: inventories.MutationDetail{
+				MutationId: mutationModel.Pb.GetId(),
+				Barcode:    detail.GetBarcode(),
+				Product:    detail.GetProduct(),
+				FromShelve: detail.GetFromShelve(),
+				ToShelve:   detail.GetToShelve(),
+			}}
+			mutationDetailModel.PbMutation = inventories.Mutation{
+				Id:           mutationModel.Pb.Id,
+				BranchId:     mutationModel.Pb.BranchId,
+				BranchName:   mutationModel.Pb.BranchName,
+				Code:         mutationModel.Pb.Code,
+				MutationDate: mutationModel.Pb.MutationDate,
+				Remark:       mutationModel.Pb.Remark,
+				CreatedAt:    mutationModel.Pb.CreatedAt,
+				CreatedBy:    mutationModel.Pb.CreatedBy,
+				UpdatedAt:    mutationModel.Pb.UpdatedAt,
+				UpdatedBy:    mutationModel.Pb.UpdatedBy,
+			}
+			err = mutationDetailModel.Create(ctx, tx)
+			if err != nil {
+				tx.Rollback()
+				return &mutationModel.Pb, err
+			}
+		}
+	}
+
+	// delete existing detail
+	for _, data := range mutationModel.Pb.GetDetails() {
+		mutationDetailModel := model.MutationDetail{Pb: inventories.MutationDetail{
+			MutationId: mutationModel.Pb.GetId(),
+			Id:         data.GetId(),
+			Barcode:    data.GetBarcode(),
+		}}
+		err = mutationDetailModel.Delete(ctx, tx)
+		if err != nil {
+			tx.Rollback()
+			return &mutationModel.Pb, err
+		}
+	}
+
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &mutationModel.Pb, err
+	}
+
+	tx.Commit()
+
+	return &mutationModel.Pb, nil
+}
+
+// View Mutation
+func (u *Mutation) View(ctx context.Context, in *inventories.Id) (*inventories.Mutation, error) {
+	var mutationModel model.Mutation
+	var err error
+
+	// basic validation
+	{
+		if len(in.GetId()) == 0 {
+			return &mutationModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid id")
+		}
+		mutationModel.Pb.Id = in.GetId()
+	}
+
+	err = mutationModel.Get(ctx, u.Db)
+	if err != nil {
+		return &mutationModel.Pb, err
+	}
+
+	return &mutationModel.Pb, nil
+}
+
+// List Mutation
+func (u *Mutation) List(in *inventories.ListMutationRequest, stream inventories.MutationService_ListServer) error {
+	ctx := stream.Context()
+	var mutationModel model.Mutation
+	query, paramQueries, paginationResponse, err := mutationModel.ListQuery(ctx, u.Db, in)
+	if err != nil {
+		return err
+	}
+
+	rows, err := u.Db.QueryContext(ctx, query, paramQueries...)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer rows.Close()
+	paginationResponse.Pagination = in.GetPagination()
+
+	for rows.Next() {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return err
+		}
+
+		var pbMutation inventories.Mutation
+		var companyID string
+		var mutationDate, createdAt, updatedAt time.Time
+		err = rows.Scan(&pbMutation.Id, &companyID, &pbMutation.BranchId, &pbMutation.BranchName,
+			&pbMutation.Code, &mutationDate, &pbMutation.Remark,
+			&createdAt, &pbMutation.CreatedBy, &updatedAt, &pbMutation.UpdatedBy)
+		if err != nil {
+			return status.Errorf(codes.Internal, "scan data: %v", err)
+		}
+
+		pbMutation.MutationDate = mutationDate.String()
+		pbMutation.CreatedAt = createdAt.String()
+		pbMutation.UpdatedAt = updatedAt.String()
+
+		res := &inventories.ListMutationResponse{
+			Pagination: paginationResponse,
+			Mutation:   &pbMutation,
+		}
+
+		err = stream.Send(res)
+		if err != nil {
+			return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+		}
+	}
+	return nil
+}
+
+func (u *Mutation) validateDetail(ctx context.Context, branchID string, detail *inventories.MutationDetail) error {
+	// product validation
+	if len(detail.GetProduct().GetId()) == 0 {
+		return status.Error(codes.InvalidArgument, "Please supply valid product")
+	}
+
+	productModel := model.Product{}
+	productModel.Pb = inventories.Product{Id: detail.GetProduct().GetId()}
+	err := productModel.Get(ctx, u.Db)
+	if err != nil {
+		return err
+	}
+
+	if productModel.Pb.GetTrackingMode() == model.TrackingQuantity {
+		return status.Error(codes.InvalidArgument, "mutation only support serialized product")
+	}
+
+	// shelve validation, both shelves must belong to the mutation branch
+	err = isShelveInBranch(ctx, u.Db, detail.GetFromShelve().GetId(), branchID)
+	if err != nil {
+		return err
+	}
+
+	err = isShelveInBranch(ctx, u.Db, detail.GetToShelve().GetId(), branchID)
+	if err != nil {
+		return err
+	}
+
+	if detail.GetFromShelve().GetId() == detail.GetToShelve().GetId() {
+		return status.Error(codes.InvalidArgument, "origin and destination shelve must be different")
+	}
+
+	if len(detail.GetBarcode()) == 0 {
+		return status.Error(codes.InvalidArgument, "Please supply valid barcode")
+	}
+
+	inventory := model.Inventory{
+		BranchID: branchID,
+		Barcode:  detail.GetBarcode(),
+		ShelveID: detail.GetFromShelve().GetId(),
+	}
+	return inventory.CheckBarcode(ctx, u.Db)
+}
@@ -38,6 +38,14 @@ func (u *Product) Create(ctx context.Context, in *inventories.Product) (*invento
 		if len(in.GetProductCategory().GetId()) == 0 {
 			return &productModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid product category")
 		}
+
+		if len(in.GetTrackingMode()) == 0 {
+			in.TrackingMode = model.TrackingSerial
+		}
+
+		if in.GetTrackingMode() != model.TrackingSerial && in.GetTrackingMode() != model.TrackingQuantity {
+			return &productModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid tracking mode")
+		}
 	}
 
 	// brand validation
@@ -82,12 +90,30 @@ func (u *Product) Create(ctx context.Context, in *inventories.Product) (*invento
 		Name:            in.GetName(),
 		Code:            in.GetCode(),
 		MinimumStock:    in.GetMinimumStock(),
+		TrackingMode:    in.GetTrackingMode(),
+	}
+
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &productModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
 	}
-	err = productModel.Create(ctx, u.Db)
+
+	err = productModel.Create(ctx, tx)
 	if err != nil {
+		tx.Rollback()
 		return &productModel.Pb, err
 	}
 
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "product", EntityId: productModel.Pb.GetId()}
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &productModel.Pb, err
+	}
+
+	tx.Commit()
+
 	return &productModel.Pb, nil
 }
 
@@ -137,11 +163,33 @@ func (u *Product) Update(ctx context.Context, in *inventories.Product) (*invento
 		productModel.Pb.ProductCategory = in.GetProductCategory()
 	}
 
-	err = productModel.Update(ctx, u.Db)
+	tx, err := u.Db.BeginTx(ctx, nil)
 	if err != nil {
+		return &productModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "product", EntityId: productModel.Pb.GetId()}
+	err = auditModel.Begin(ctx, tx)
+	if err != nil {
+		tx.Rollback()
 		return &productModel.Pb, err
 	}
 
+	err = productModel.Update(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &productModel.Pb, err
+	}
+
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &productModel.Pb, err
+	}
+
+	tx.Commit()
+
 	return &productModel.Pb, nil
 }
 
@@ -187,11 +235,33 @@ func (u *Product) Delete(ctx context.Context, in *inventories.Id) (*inventories.
 		return &output, err
 	}
 
-	err = productModel.Delete(ctx, u.Db)
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &output, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "product", EntityId: productModel.Pb.GetId()}
+	err = auditModel.Begin(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &output, err
+	}
+
+	err = productModel.Delete(ctx, tx)
 	if err != nil {
+		tx.Rollback()
 		return &output, err
 	}
 
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &output, err
+	}
+
+	tx.Commit()
+
 	output.Boolean = true
 	return &output, nil
 }
@@ -227,7 +297,7 @@ func (u *Product) List(in *inventories.ListProductRequest, stream inventories.Pr
 			&pbProduct.Id, &companyID,
 			&pbBrand.Id, &pbBrand.Code, &pbBrand.Name,
 			&pbProductCategory.Id, &pbProductCategory.Name,
-			&pbProduct.Code, &pbProduct.Name, &pbProduct.MinimumStock,
+			&pbProduct.Code, &pbProduct.Name, &pbProduct.MinimumStock, &pbProduct.TrackingMode,
 			&createdAt, &pbProduct.CreatedBy, &updatedAt, &pbProduct.UpdatedBy,
 		)
 
@@ -34,6 +34,14 @@ func (u *ProductCategory) Create(ctx context.Context, in *inventories.ProductCat
 		if len(in.GetCategory().GetId()) == 0 {
 			return &productCategoryModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid category")
 		}
+
+		if len(in.GetPickMethod()) == 0 {
+			in.PickMethod = model.PickFIFO
+		}
+
+		if !(in.GetPickMethod() == model.PickFIFO || in.GetPickMethod() == model.PickFEFO) {
+			return &productCategoryModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid pick method")
+		}
 	}
 
 	// category validation
@@ -47,8 +55,9 @@ func (u *ProductCategory) Create(ctx context.Context, in *inventories.ProductCat
 	}
 
 	productCategoryModel.Pb = inventories.ProductCategory{
-		Category: in.GetCategory(),
-		Name:     in.GetName(),
+		Category:   in.GetCategory(),
+		Name:       in.GetName(),
+		PickMethod: in.GetPickMethod(),
 	}
 	err = productCategoryModel.Create(ctx, u.Db)
 	if err != nil {
@@ -80,6 +89,13 @@ func (u *ProductCategory) Update(ctx context.Context, in *inventories.ProductCat
 		productCategoryModel.Pb.Name = in.GetName()
 	}
 
+	if len(in.GetPickMethod()) > 0 {
+		if !(in.GetPickMethod() == model.PickFIFO || in.GetPickMethod() == model.PickFEFO) {
+			return &productCategoryModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid pick method")
+		}
+		productCategoryModel.Pb.PickMethod = in.GetPickMethod()
+	}
+
 	if len(in.GetCategory().GetId()) > 0 && in.GetCategory().GetId() != productCategoryModel.Pb.GetCategory().GetId() {
 		categoryModel := model.Category{}
 		categoryModel.Pb.Id = in.GetCategory().GetId()
@@ -176,7 +192,7 @@ func (u *ProductCategory) List(in *inventories.ListProductCategoryRequest, strea
 		var companyID string
 		var pbCategory inventories.Category
 		var createdAt, updatedAt time.Time
-		err = rows.Scan(&pbProductCategory.Id, &companyID, &pbCategory.Id, &pbCategory.Name, &pbProductCategory.Name, &createdAt, &pbProductCategory.CreatedBy, &updatedAt, &pbProductCategory.UpdatedBy)
+		err = rows.Scan(&pbProductCategory.Id, &companyID, &pbCategory.Id, &pbCategory.Name, &pbProductCategory.Name, &pbProductCategory.PickMethod, &createdAt, &pbProductCategory.CreatedBy, &updatedAt, &pbProductCategory.UpdatedBy)
 		if err != nil {
 			return status.Errorf(codes.Internal, "scan data: %v", err)
 		}
@@ -26,13 +26,11 @@ type Receive struct {
 	inventories.UnimplementedReceiveServiceServer
 }
 
-// Create Receive
+// Create Receive, the receive is a draft until it is posted
 func (u *Receive) Create(ctx context.Context, in *inventories.Receive) (*inventories.Receive, error) {
 	var receiveModel model.Receive
 	var err error
 
-	// TODO : if this month any closing stock, create transaction for thus month will be blocked
-
 	// basic validation
 	{
 		if len(in.GetBranchId()) == 0 {
@@ -61,6 +59,18 @@ func (u *Receive) Create(ctx context.Context, in *inventories.Receive) (*invento
 			return &receiveModel.Pb, err
 		}
 
+		detail.Qty, err = detailQty(&productModel.Pb, detail.GetQty())
+		if err != nil {
+			return &receiveModel.Pb, err
+		}
+
+		if len(detail.GetLot().GetCode()) == 0 && len(detail.GetLot().GetId()) > 0 {
+			err = isLotOfProduct(ctx, u.Db, detail.GetLot().GetId(), productModel.Pb.GetId())
+			if err != nil {
+				return &receiveModel.Pb, err
+			}
+		}
+
 		// shelve validation
 		if len(detail.GetShelve().GetId()) == 0 {
 			return &receiveModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid shelve")
@@ -76,6 +86,10 @@ func (u *Receive) Create(ctx context.Context, in *inventories.Receive) (*invento
 		if _, err := time.Parse("2006-01-02T15:04:05.000Z", detail.GetExpiredDate()); err != nil {
 			return &receiveModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid expired date")
 		}
+
+		if detail.GetUnitCost() < 0 {
+			return &receiveModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid unit cost")
+		}
 	}
 
 	err = isYourBranch(ctx, u.UserClient, u.RegionClient, u.BranchClient, in.GetBranchId())
@@ -88,6 +102,24 @@ func (u *Receive) Create(ctx context.Context, in *inventories.Receive) (*invento
 		return &receiveModel.Pb, err
 	}
 
+	ordered, prices, err := u.purchaseOrdered(ctx, in.GetPurchaseId())
+	if err != nil {
+		return &receiveModel.Pb, err
+	}
+
+	// a detail without unit cost is costed at the purchase price
+	for _, detail := range in.GetDetails() {
+		if detail.GetUnitCost() == 0 {
+			detail.UnitCost = prices[detail.GetProduct().GetId()]
+		}
+	}
+
+	var companySettingModel model.CompanySetting
+	err = companySettingModel.Get(ctx, u.Db)
+	if err != nil {
+		return &receiveModel.Pb, err
+	}
+
 	receiveModel.Pb = inventories.Receive{
 		BranchId:    in.GetBranchId(),
 		BranchName:  branch.GetName(),
@@ -103,12 +135,33 @@ func (u *Receive) Create(ctx context.Context, in *inventories.Receive) (*invento
 		return &receiveModel.Pb, err
 	}
 
+	// transaction in a closed period is blocked
+	err = isPeriodOpen(ctx, tx, in.GetReceiveDate())
+	if err != nil {
+		tx.Rollback()
+		return &receiveModel.Pb, err
+	}
+
 	err = receiveModel.Create(ctx, tx)
 	if err != nil {
 		tx.Rollback()
 		return &receiveModel.Pb, err
 	}
 
+	err = receiveModel.CheckOutstanding(ctx, tx, ordered, companySettingModel.Pb.GetReceiveTolerancePercent())
+	if err != nil {
+		tx.Rollback()
+		return &receiveModel.Pb, err
+	}
+
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "receive", EntityId: receiveModel.Pb.GetId()}
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &receiveModel.Pb, err
+	}
+
 	tx.Commit()
 
 	return &receiveModel.Pb, nil
@@ -119,8 +172,6 @@ func (u *Receive) Update(ctx context.Context, in *inventories.Receive) (*invento
 	var receiveModel model.Receive
 	var err error
 
-	// TODO : if this month any closing stock, create transaction for thus month will be blocked
-
 	// basic validation
 	{
 		if len(in.GetId()) == 0 {
@@ -136,17 +187,71 @@ func (u *Receive) Update(ctx context.Context, in *inventories.Receive) (*invento
 		return &receiveModel.Pb, err
 	}
 
+	if receiveModel.Pb.GetStatus() != model.DocumentDraft {
+		return &receiveModel.Pb, status.Error(codes.FailedPrecondition, "only a draft receive can be updated")
+	}
+
+	purchaseID := receiveModel.Pb.GetPurchaseId()
+	if len(in.GetPurchaseId()) > 0 {
+		purchaseID = in.GetPurchaseId()
+	}
+
+	ordered, prices, err := u.purchaseOrdered(ctx, purchaseID)
+	if err != nil {
+		return &receiveModel.Pb, err
+	}
+
+	var companySettingModel model.CompanySetting
+	err = companySettingModel.Get(ctx, u.Db)
+	if err != nil {
+		return &receiveModel.Pb, err
+	}
+
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &receiveModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	// the draft is locked and read again, the update is made on the document as it is now
+	err = receiveModel.GetForUpdate(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &receiveModel.Pb, err
+	}
+
+	if receiveModel.Pb.GetStatus() != model.DocumentDraft {
+		tx.Rollback()
+		return &receiveModel.Pb, status.Error(codes.FailedPrecondition, "only a draft receive can be updated")
+	}
+
+	currentDate := receiveModel.Pb.GetReceiveDate()
+
 	if len(in.GetPurchaseId()) > 0 {
 		receiveModel.Pb.PurchaseId = in.GetPurchaseId()
 	}
 
+	if receiveModel.Pb.GetPurchaseId() != purchaseID {
+		tx.Rollback()
+		return &receiveModel.Pb, status.Error(codes.FailedPrecondition, "receive has changed, update it again")
+	}
+
 	if _, err := time.Parse("2006-01-02T15:04:05.000Z", in.GetReceiveDate()); err == nil {
 		receiveModel.Pb.ReceiveDate = in.GetReceiveDate()
 	}
 
-	tx, err := u.Db.BeginTx(ctx, nil)
+	// both the current and the new document date must be in an open period
+	err = isPeriodOpen(ctx, tx, currentDate, in.GetReceiveDate())
 	if err != nil {
-		return &receiveModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+		tx.Rollback()
+		return &receiveModel.Pb, err
+	}
+
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "receive", EntityId: receiveModel.Pb.GetId()}
+	err = auditModel.Begin(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &receiveModel.Pb, err
 	}
 
 	err = receiveModel.Update(ctx, tx)
@@ -171,6 +276,20 @@ func (u *Receive) Update(ctx context.Context, in *inventories.Receive) (*invento
 			return &receiveModel.Pb, err
 		}
 
+		detail.Qty, err = detailQty(&productModel.Pb, detail.GetQty())
+		if err != nil {
+			tx.Rollback()
+			return &receiveModel.Pb, err
+		}
+
+		if len(detail.GetLot().GetCode()) == 0 && len(detail.GetLot().GetId()) > 0 {
+			err = isLotOfProduct(ctx, u.Db, detail.GetLot().GetId(), productModel.Pb.GetId())
+			if err != nil {
+				tx.Rollback()
+				return &receiveModel.Pb, err
+			}
+		}
+
 		// shelve validation
 		if len(detail.GetShelve().GetId()) == 0 {
 			tx.Rollback()
@@ -190,6 +309,15 @@ func (u *Receive) Update(ctx context.Context, in *inventories.Receive) (*invento
 			return &receiveModel.Pb, status.Error(codes.InvalidArgument, "please supllay valid expired date")
 		}
 
+		if detail.GetUnitCost() < 0 {
+			tx.Rollback()
+			return &receiveModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid unit cost")
+		}
+
+		if detail.GetUnitCost() == 0 {
+			detail.UnitCost = prices[detail.GetProduct().GetId()]
+		}
+
 		if len(detail.GetId()) > 0 {
 			// operasi update
 			receiveDetailModel := model.ReceiveDetail{}
@@ -204,6 +332,9 @@ func (u *Receive) Update(ctx context.Context, in *inventories.Receive) (*invento
 			receiveDetailModel.Pb.ExpiredDate = detail.GetExpiredDate()
 			receiveDetailModel.Pb.Product = detail.GetProduct()
 			receiveDetailModel.Pb.Shelve = detail.GetShelve()
+			receiveDetailModel.Pb.Qty = detail.GetQty()
+			receiveDetailModel.Pb.UnitCost = detail.GetUnitCost()
+			receiveDetailModel.Pb.Lot = detail.GetLot()
 			receiveDetailModel.PbReceive = inventories.Receive{
 				Id:          receiveModel.Pb.Id,
 				BranchId:    receiveModel.Pb.BranchId,
@@ -239,6 +370,9 @@ func (u *Receive) Update(ctx context.Context, in *inventories.Receive) (*invento
 				ExpiredDate: detail.GetExpiredDate(),
 				Product:     detail.GetProduct(),
 				Shelve:      detail.GetShelve(),
+				Qty:         detail.GetQty(),
+				UnitCost:    detail.GetUnitCost(),
+				Lot:         detail.GetLot(),
 			}}
 			receiveDetailModel.PbReceive = inventories.Receive{
 				Id:          receiveModel.Pb.Id,
@@ -277,13 +411,25 @@ func (u *Receive) Update(ctx context.Context, in *inventories.Receive) (*invento
 		}
 	}
 
+	err = receiveModel.CheckOutstanding(ctx, tx, ordered, companySettingModel.Pb.GetReceiveTolerancePercent())
+	if err != nil {
+		tx.Rollback()
+		return &receiveModel.Pb, err
+	}
+
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &receiveModel.Pb, err
+	}
+
 	tx.Commit()
 
 	return &receiveModel.Pb, nil
 }
 
-// View Receive
-func (u *Receive) View(ctx context.Context, in *inventories.Id) (*inventories.Receive, error) {
+// Post Receive, the received goods go into the stock
+func (u *Receive) Post(ctx context.Context, in *inventories.Id) (*inventories.Receive, error) {
 	var receiveModel model.Receive
 	var err error
 
@@ -300,47 +446,216 @@ func (u *Receive) View(ctx context.Context, in *inventories.Id) (*inventories.Re
 		return &receiveModel.Pb, err
 	}
 
+	if receiveModel.Pb.GetStatus() != model.DocumentDraft {
+		return &receiveModel.Pb, status.Error(codes.FailedPrecondition, "only a draft receive can be posted")
+	}
+
+	err = isYourBranch(ctx, u.UserClient, u.RegionClient, u.BranchClient, receiveModel.Pb.GetBranchId())
+	if err != nil {
+		return &receiveModel.Pb, err
+	}
+
+	// the purchase may have changed since the draft was written
+	ordered, _, err := u.purchaseOrdered(ctx, receiveModel.Pb.GetPurchaseId())
+	if err != nil {
+		return &receiveModel.Pb, err
+	}
+
+	var companySettingModel model.CompanySetting
+	err = companySettingModel.Get(ctx, u.Db)
+	if err != nil {
+		return &receiveModel.Pb, err
+	}
+
+	purchaseID := receiveModel.Pb.GetPurchaseId()
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &receiveModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	// the draft is locked and read again, an update committed since it was read is posted as it is now
+	err = receiveModel.GetForUpdate(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &receiveModel.Pb, err
+	}
+
+	if receiveModel.Pb.GetStatus() != model.DocumentDraft {
+		tx.Rollback()
+		return &receiveModel.Pb, status.Error(codes.FailedPrecondition, "only a draft receive can be posted")
+	}
+
+	if receiveModel.Pb.GetPurchaseId() != purchaseID {
+		tx.Rollback()
+		return &receiveModel.Pb, status.Error(codes.FailedPrecondition, "receive has changed, post it again")
+	}
+
+	err = isPeriodOpen(ctx, tx, receiveModel.Pb.GetReceiveDate())
+	if err != nil {
+		tx.Rollback()
+		return &receiveModel.Pb, err
+	}
+
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "receive", EntityId: receiveModel.Pb.GetId()}
+	err = auditModel.Begin(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &receiveModel.Pb, err
+	}
+
+	approvalModel := model.Approval{}
+	approvalModel.Pb = inventories.Approval{DocumentType: "GR", DocumentId: receiveModel.Pb.GetId()}
+	err = approvalModel.CheckApproved(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &receiveModel.Pb, err
+	}
+
+	err = receiveModel.Post(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &receiveModel.Pb, err
+	}
+
+	err = receiveModel.CheckOutstanding(ctx, tx, ordered, companySettingModel.Pb.GetReceiveTolerancePercent())
+	if err != nil {
+		tx.Rollback()
+		return &receiveModel.Pb, err
+	}
+
+	journalModel := model.Journal{TransactionID: receiveModel.Pb.GetId()}
+	err = journalModel.Post(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &receiveModel.Pb, err
+	}
+
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &receiveModel.Pb, err
+	}
+
+	tx.Commit()
+
 	return &receiveModel.Pb, nil
 }
 
-func (u *Receive) OutstandingByPurchase(ctx context.Context, in *inventories.Id) (*inventories.OutstandingResponse, error) {
-	var mPurchase model.Purchase = model.Purchase{Id: in.Id, PurchaseClient: u.PurchaseClient}
-	output, err := mPurchase.Outstanding(ctx)
+// Cancel Receive, a draft is only marked cancelled while a posted receive is reversed out of the stock
+func (u *Receive) Cancel(ctx context.Context, in *inventories.Id) (*inventories.Receive, error) {
+	var receiveModel model.Receive
+	var err error
+
+	// basic validation
+	{
+		if len(in.GetId()) == 0 {
+			return &receiveModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid id")
+		}
+		receiveModel.Pb.Id = in.GetId()
+	}
+
+	err = receiveModel.Get(ctx, u.Db)
 	if err != nil {
-		return nil, err
+		return &receiveModel.Pb, err
 	}
 
-	var ids []string
-	for _, v := range output.Detail {
-		ids = append(ids, v.ProductId)
+	if receiveModel.Pb.GetStatus() == model.DocumentCancelled {
+		return &receiveModel.Pb, status.Error(codes.FailedPrecondition, "receive already cancelled")
+	}
+
+	err = isYourBranch(ctx, u.UserClient, u.RegionClient, u.BranchClient, receiveModel.Pb.GetBranchId())
+	if err != nil {
+		return &receiveModel.Pb, err
 	}
 
 	tx, err := u.Db.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "begin transaction: %v", err)
+		return &receiveModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	// the reversal is written at the cancel time
+	if receiveModel.Pb.GetStatus() == model.DocumentPosted {
+		err = isPeriodOpen(ctx, tx, time.Now().UTC().Format("2006-01-02T15:04:05.000Z"))
+		if err != nil {
+			tx.Rollback()
+			return &receiveModel.Pb, err
+		}
 	}
 
-	var mReceiveDetail model.ReceiveDetail
-	out, err := mReceiveDetail.ListByPurchaseId(ctx, tx, in.Id, ids)
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "receive", EntityId: receiveModel.Pb.GetId()}
+	err = auditModel.Begin(ctx, tx)
 	if err != nil {
 		tx.Rollback()
-		return nil, err
+		return &receiveModel.Pb, err
+	}
+
+	err = receiveModel.Cancel(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &receiveModel.Pb, err
+	}
+
+	journalModel := model.Journal{TransactionID: receiveModel.Pb.GetId()}
+	err = journalModel.Post(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &receiveModel.Pb, err
+	}
+
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &receiveModel.Pb, err
 	}
 
 	tx.Commit()
 
-	for i, v := range output.Detail {
-		for _, val := range out {
-			if val.ProductId == v.ProductId {
-				output.Detail[i].Quantity -= val.Quantity
-				output.Detail[i].ProductName = val.ProductName
-				output.Detail[i].ProductCode = val.ProductCode
-				break
-			}
+	return &receiveModel.Pb, nil
+}
+
+// View Receive
+func (u *Receive) View(ctx context.Context, in *inventories.Id) (*inventories.Receive, error) {
+	var receiveModel model.Receive
+	var err error
+
+	// basic validation
+	{
+		if len(in.GetId()) == 0 {
+			return &receiveModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid id")
 		}
+		receiveModel.Pb.Id = in.GetId()
+	}
+
+	err = receiveModel.Get(ctx, u.Db)
+	if err != nil {
+		return &receiveModel.Pb, err
 	}
 
-	return output, nil
+	return &receiveModel.Pb, nil
+}
+
+// purchaseOrdered qty ordered and unit price per product on the purchase
+func (u *Receive) purchaseOrdered(ctx context.Context, purchaseID string) (map[string]int32, map[string]float64, error) {
+	mPurchase := model.Purchase{Id: purchaseID, PurchaseClient: u.PurchaseClient}
+	outstanding, err := mPurchase.Outstanding(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ordered := make(map[string]int32)
+	prices := make(map[string]float64)
+	for _, detail := range outstanding.GetDetail() {
+		ordered[detail.GetProductId()] += int32(detail.GetQuantity())
+		prices[detail.GetProductId()] = detail.GetUnitCost()
+	}
+
+	return ordered, prices, nil
+}
+
+func (u *Receive) OutstandingByPurchase(ctx context.Context, in *inventories.Id) (*inventories.OutstandingResponse, error) {
+	return outstandingByPurchase(ctx, u.Db, u.PurchaseClient, in.GetId())
 }
 
 // List Receive
@@ -369,7 +684,7 @@ func (u *Receive) List(in *inventories.ListReceiveRequest, stream inventories.Re
 		var companyID string
 		var createdAt, updatedAt time.Time
 		err = rows.Scan(&pbReceive.Id, &companyID, &pbReceive.BranchId, &pbReceive.BranchName,
-			&pbReceive.PurchaseId, &pbReceive.Code, &pbReceive.ReceiveDate, &pbReceive.Remark,
+			&pbReceive.PurchaseId, &pbReceive.Code, &pbReceive.ReceiveDate, &pbReceive.Remark, &pbReceive.Status,
 			&createdAt, &pbReceive.CreatedBy, &updatedAt, &pbReceive.UpdatedBy)
 		if err != nil {
 			return status.Errorf(codes.Internal, "scan data: %v", err)
@@ -21,16 +21,15 @@ type ReceiveReturn struct {
 	UserClient   users.UserServiceClient
 	RegionClient users.RegionServiceClient
 	BranchClient users.BranchServiceClient
+	AlertEngine  *StockAlertEngine
 	inventories.UnimplementedReceiveReturnServiceServer
 }
 
-// Create ReceiveReturn
+// Create ReceiveReturn, the receive return is a draft until it is posted
 func (u *ReceiveReturn) Create(ctx context.Context, in *inventories.ReceiveReturn) (*inventories.ReceiveReturn, error) {
 	var receiveReturnModel model.ReceiveReturn
 	var err error
 
-	// TODO : if this month any closing stock, create transaction for thus month will be blocked
-
 	// basic validation
 	{
 		if len(in.GetBranchId()) == 0 {
@@ -59,6 +58,22 @@ func (u *ReceiveReturn) Create(ctx context.Context, in *inventories.ReceiveRetur
 			return &receiveReturnModel.Pb, err
 		}
 
+		detail.Qty, err = detailQty(&productModel.Pb, detail.GetQty())
+		if err != nil {
+			return &receiveReturnModel.Pb, err
+		}
+
+		if productModel.Pb.GetTrackingMode() != model.TrackingQuantity && len(detail.GetBarcode()) == 0 {
+			return &receiveReturnModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid barcode")
+		}
+
+		if len(detail.GetLot().GetId()) > 0 {
+			err = isLotOfProduct(ctx, u.Db, detail.GetLot().GetId(), productModel.Pb.GetId())
+			if err != nil {
+				return &receiveReturnModel.Pb, err
+			}
+		}
+
 		// shelve validation
 		if len(detail.GetShelve().GetId()) == 0 {
 			return &receiveReturnModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid shelve")
@@ -97,12 +112,27 @@ func (u *ReceiveReturn) Create(ctx context.Context, in *inventories.ReceiveRetur
 		return &receiveReturnModel.Pb, err
 	}
 
+	// transaction in a closed period is blocked
+	err = isPeriodOpen(ctx, tx, in.GetReturnDate())
+	if err != nil {
+		tx.Rollback()
+		return &receiveReturnModel.Pb, err
+	}
+
 	err = receiveReturnModel.Create(ctx, tx)
 	if err != nil {
 		tx.Rollback()
 		return &receiveReturnModel.Pb, err
 	}
 
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "receive_return", EntityId: receiveReturnModel.Pb.GetId()}
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &receiveReturnModel.Pb, err
+	}
+
 	tx.Commit()
 
 	return &receiveReturnModel.Pb, nil
@@ -134,8 +164,6 @@ func (u *ReceiveReturn) Update(ctx context.Context, in *inventories.ReceiveRetur
 	var receiveReturnModel model.ReceiveReturn
 	var err error
 
-	// TODO : if this month any closing stock, create transaction for thus month will be blocked
-
 	// basic validation
 	{
 		if len(in.GetId()) == 0 {
@@ -146,11 +174,25 @@ func (u *ReceiveReturn) Update(ctx context.Context, in *inventories.ReceiveRetur
 
 	// TODO : if any mutation_unit update will be blocked
 
-	err = receiveReturnModel.Get(ctx, u.Db)
+	tx, err := u.Db.BeginTx(ctx, nil)
 	if err != nil {
+		return &receiveReturnModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	// the draft is locked and read in the transaction, the update is made on the document as it is now
+	err = receiveReturnModel.GetForUpdate(ctx, tx)
+	if err != nil {
+		tx.Rollback()
 		return &receiveReturnModel.Pb, err
 	}
 
+	if receiveReturnModel.Pb.GetStatus() != model.DocumentDraft {
+		tx.Rollback()
+		return &receiveReturnModel.Pb, status.Error(codes.FailedPrecondition, "only a draft receive return can be updated")
+	}
+
+	currentDate := receiveReturnModel.Pb.GetReturnDate()
+
 	if len(in.GetReceive().GetId()) > 0 {
 		receiveReturnModel.Pb.Receive = in.GetReceive()
 	}
@@ -159,9 +201,19 @@ func (u *ReceiveReturn) Update(ctx context.Context, in *inventories.ReceiveRetur
 		receiveReturnModel.Pb.ReturnDate = in.GetReturnDate()
 	}
 
-	tx, err := u.Db.BeginTx(ctx, nil)
+	// both the current and the new document date must be in an open period
+	err = isPeriodOpen(ctx, tx, currentDate, in.GetReturnDate())
 	if err != nil {
-		return &receiveReturnModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+		tx.Rollback()
+		return &receiveReturnModel.Pb, err
+	}
+
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "receive_return", EntityId: receiveReturnModel.Pb.GetId()}
+	err = auditModel.Begin(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &receiveReturnModel.Pb, err
 	}
 
 	err = receiveReturnModel.Update(ctx, tx)
@@ -186,6 +238,25 @@ func (u *ReceiveReturn) Update(ctx context.Context, in *inventories.ReceiveRetur
 			return &receiveReturnModel.Pb, err
 		}
 
+		detail.Qty, err = detailQty(&productModel.Pb, detail.GetQty())
+		if err != nil {
+			tx.Rollback()
+			return &receiveReturnModel.Pb, err
+		}
+
+		if productModel.Pb.GetTrackingMode() != model.TrackingQuantity && len(detail.GetBarcode()) == 0 {
+			tx.Rollback()
+			return &receiveReturnModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid barcode")
+		}
+
+		if len(detail.GetLot().GetId()) > 0 {
+			err = isLotOfProduct(ctx, u.Db, detail.GetLot().GetId(), productModel.Pb.GetId())
+			if err != nil {
+				tx.Rollback()
+				return &receiveReturnModel.Pb, err
+			}
+		}
+
 		// shelve validation
 		if len(detail.GetShelve().GetId()) == 0 {
 			tx.Rollback()
@@ -213,6 +284,8 @@ func (u *ReceiveReturn) Update(ctx context.Context, in *inventories.ReceiveRetur
 
 			receiveReturnDetailModel.Pb.Product = detail.GetProduct()
 			receiveReturnDetailModel.Pb.Shelve = detail.GetShelve()
+			receiveReturnDetailModel.Pb.Qty = detail.GetQty()
+			receiveReturnDetailModel.Pb.Lot = detail.GetLot()
 			receiveReturnDetailModel.PbReceiveReturn = inventories.ReceiveReturn{
 				Id:         receiveReturnModel.Pb.Id,
 				BranchId:   receiveReturnModel.Pb.BranchId,
@@ -247,6 +320,9 @@ func (u *ReceiveReturn) Update(ctx context.Context, in *inventories.ReceiveRetur
 				ReceiveReturnId: receiveReturnModel.Pb.GetId(),
 				Product:         detail.GetProduct(),
 				Shelve:          detail.GetShelve(),
+				Barcode:         detail.GetBarcode(),
+				Qty:             detail.GetQty(),
+				Lot:             detail.GetLot(),
 			}}
 			receiveReturnDetailModel.PbReceiveReturn = inventories.ReceiveReturn{
 				Id:         receiveReturnModel.Pb.Id,
@@ -285,6 +361,198 @@ func (u *ReceiveReturn) Update(ctx context.Context, in *inventories.ReceiveRetur
 		}
 	}
 
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &receiveReturnModel.Pb, err
+	}
+
+	tx.Commit()
+
+	return &receiveReturnModel.Pb, nil
+}
+
+// Post ReceiveReturn, the returned goods leave the stock
+func (u *ReceiveReturn) Post(ctx context.Context, in *inventories.Id) (*inventories.ReceiveReturn, error) {
+	var receiveReturnModel model.ReceiveReturn
+	var err error
+
+	// basic validation
+	{
+		if len(in.GetId()) == 0 {
+			return &receiveReturnModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid id")
+		}
+		receiveReturnModel.Pb.Id = in.GetId()
+	}
+
+	err = receiveReturnModel.Get(ctx, u.Db)
+	if err != nil {
+		return &receiveReturnModel.Pb, err
+	}
+
+	if receiveReturnModel.Pb.GetStatus() != model.DocumentDraft {
+		return &receiveReturnModel.Pb, status.Error(codes.FailedPrecondition, "only a draft receive return can be posted")
+	}
+
+	err = isYourBranch(ctx, u.UserClient, u.RegionClient, u.BranchClient, receiveReturnModel.Pb.GetBranchId())
+	if err != nil {
+		return &receiveReturnModel.Pb, err
+	}
+
+	// goods can only go back from a receive that is in the stock
+	var receiveModel model.Receive
+	receiveModel.Pb.Id = receiveReturnModel.Pb.GetReceive().GetId()
+	err = receiveModel.Get(ctx, u.Db)
+	if err != nil {
+		return &receiveReturnModel.Pb, err
+	}
+
+	if receiveModel.Pb.GetStatus() != model.DocumentPosted {
+		return &receiveReturnModel.Pb, status.Errorf(codes.FailedPrecondition, "receive %s is not posted", receiveModel.Pb.GetCode())
+	}
+
+	receiveID := receiveReturnModel.Pb.GetReceive().GetId()
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &receiveReturnModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	// the draft is locked and read again, an update committed since it was read is posted as it is now
+	err = receiveReturnModel.GetForUpdate(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &receiveReturnModel.Pb, err
+	}
+
+	if receiveReturnModel.Pb.GetStatus() != model.DocumentDraft {
+		tx.Rollback()
+		return &receiveReturnModel.Pb, status.Error(codes.FailedPrecondition, "only a draft receive return can be posted")
+	}
+
+	if receiveReturnModel.Pb.GetReceive().GetId() != receiveID {
+		tx.Rollback()
+		return &receiveReturnModel.Pb, status.Error(codes.FailedPrecondition, "receive return has changed, post it again")
+	}
+
+	err = isPeriodOpen(ctx, tx, receiveReturnModel.Pb.GetReturnDate())
+	if err != nil {
+		tx.Rollback()
+		return &receiveReturnModel.Pb, err
+	}
+
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "receive_return", EntityId: receiveReturnModel.Pb.GetId()}
+	err = auditModel.Begin(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &receiveReturnModel.Pb, err
+	}
+
+	approvalModel := model.Approval{}
+	approvalModel.Pb = inventories.Approval{DocumentType: "RR", DocumentId: receiveReturnModel.Pb.GetId()}
+	err = approvalModel.CheckApproved(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &receiveReturnModel.Pb, err
+	}
+
+	err = receiveReturnModel.Post(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &receiveReturnModel.Pb, err
+	}
+
+	journalModel := model.Journal{TransactionID: receiveReturnModel.Pb.GetId()}
+	err = journalModel.Post(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &receiveReturnModel.Pb, err
+	}
+
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &receiveReturnModel.Pb, err
+	}
+
+	tx.Commit()
+
+	productIDs := make([]string, len(receiveReturnModel.Pb.GetDetails()))
+	for i, detail := range receiveReturnModel.Pb.GetDetails() {
+		productIDs[i] = detail.GetProduct().GetId()
+	}
+	u.AlertEngine.AfterOutbound(ctx, receiveReturnModel.Pb.GetBranchId(), productIDs)
+
+	return &receiveReturnModel.Pb, nil
+}
+
+// Cancel ReceiveReturn, a draft is only marked cancelled while a posted receive return is reversed back into the stock
+func (u *ReceiveReturn) Cancel(ctx context.Context, in *inventories.Id) (*inventories.ReceiveReturn, error) {
+	var receiveReturnModel model.ReceiveReturn
+	var err error
+
+	// basic validation
+	{
+		if len(in.GetId()) == 0 {
+			return &receiveReturnModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid id")
+		}
+		receiveReturnModel.Pb.Id = in.GetId()
+	}
+
+	err = receiveReturnModel.Get(ctx, u.Db)
+	if err != nil {
+		return &receiveReturnModel.Pb, err
+	}
+
+	if receiveReturnModel.Pb.GetStatus() == model.DocumentCancelled {
+		return &receiveReturnModel.Pb, status.Error(codes.FailedPrecondition, "receive return already cancelled")
+	}
+
+	err = isYourBranch(ctx, u.UserClient, u.RegionClient, u.BranchClient, receiveReturnModel.Pb.GetBranchId())
+	if err != nil {
+		return &receiveReturnModel.Pb, err
+	}
+
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &receiveReturnModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	if receiveReturnModel.Pb.GetStatus() == model.DocumentPosted {
+		err = isPeriodOpen(ctx, tx, time.Now().UTC().Format("2006-01-02T15:04:05.000Z"))
+		if err != nil {
+			tx.Rollback()
+			return &receiveReturnModel.Pb, err
+		}
+	}
+
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "receive_return", EntityId: receiveReturnModel.Pb.GetId()}
+	err = auditModel.Begin(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &receiveReturnModel.Pb, err
+	}
+
+	err = receiveReturnModel.Cancel(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &receiveReturnModel.Pb, err
+	}
+
+	journalModel := model.Journal{TransactionID: receiveReturnModel.Pb.GetId()}
+	err = journalModel.Post(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &receiveReturnModel.Pb, err
+	}
+
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &receiveReturnModel.Pb, err
+	}
+
 	tx.Commit()
 
 	return &receiveReturnModel.Pb, nil
@@ -313,15 +581,16 @@ func (u *ReceiveReturn) List(in *inventories.ListReceiveReturnRequest, stream in
 		}
 
 		var pbReceiveReturn inventories.ReceiveReturn
-		var companyID string
+		var companyID, receiveID string
 		var createdAt, updatedAt time.Time
-		err = rows.Scan(&pbReceiveReturn.Id, &companyID, &pbReceiveReturn.BranchId, &pbReceiveReturn.BranchName,
-			&pbReceiveReturn.Code, &pbReceiveReturn.ReturnDate, &pbReceiveReturn.Remark,
+		err = rows.Scan(&pbReceiveReturn.Id, &companyID, &pbReceiveReturn.BranchId, &pbReceiveReturn.BranchName, &receiveID,
+			&pbReceiveReturn.Code, &pbReceiveReturn.ReturnDate, &pbReceiveReturn.Remark, &pbReceiveReturn.Status,
 			&createdAt, &pbReceiveReturn.CreatedBy, &updatedAt, &pbReceiveReturn.UpdatedBy)
 		if err != nil {
 			return status.Errorf(codes.Internal, "scan data: %v", err)
 		}
 
+		pbReceiveReturn.Receive = &inventories.Receive{Id: receiveID}
 		pbReceiveReturn.CreatedAt = createdAt.String()
 		pbReceiveReturn.UpdatedAt = updatedAt.String()
 
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"log"
+
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/inventory-service/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Replenishment struct
+type Replenishment struct {
+	Db             *sql.DB
+	Log            map[string]*log.Logger
+	UserClient     users.UserServiceClient
+	RegionClient   users.RegionServiceClient
+	BranchClient   users.BranchServiceClient
+	PurchaseClient purchases.PurchaseServiceClient
+	inventories.UnimplementedReplenishmentServiceServer
+}
+
+// Plan Replenishment of the branch, with create draft every brand of the plan becomes a draft purchase. A draft is
+// created once per branch, day and lines, a plan that failed on a brand can be sent again.
+func (u *Replenishment) Plan(ctx context.Context, in *inventories.ReplenishmentRequest) (*inventories.ReplenishmentPlan, error) {
+	var replenishmentModel model.Replenishment
+	var err error
+
+	// basic validation
+	{
+		if len(in.GetBranchId()) == 0 {
+			return &replenishmentModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid branch")
+		}
+		replenishmentModel.Pb.BranchId = in.GetBranchId()
+	}
+
+	err = isYourBranch(ctx, u.UserClient, u.RegionClient, u.BranchClient, in.GetBranchId())
+	if err != nil {
+		return &replenishmentModel.Pb, err
+	}
+
+	purchaseModel := model.Purchase{PurchaseClient: u.PurchaseClient}
+	purchaseIDs, err := purchaseModel.OpenByBranch(ctx, in.GetBranchId())
+	if err != nil {
+		return &replenishmentModel.Pb, err
+	}
+
+	replenishmentModel.Outstanding = make(map[string]int32)
+	for _, purchaseID := range purchaseIDs {
+		outstanding, err := outstandingByPurchase(ctx, u.Db, u.PurchaseClient, purchaseID)
+		if err != nil {
+			return &replenishmentModel.Pb, err
+		}
+
+		for _, detail := range outstanding.GetDetail() {
+			replenishmentModel.Outstanding[detail.GetProductId()] += int32(detail.GetQuantity())
+		}
+	}
+
+	err = replenishmentModel.Plan(ctx, u.Db)
+	if err != nil {
+		return &replenishmentModel.Pb, err
+	}
+
+	if in.GetCreateDraft() {
+		for _, brandPlan := range replenishmentModel.Pb.GetBrands() {
+			purchaseModel := model.Purchase{PurchaseClient: u.PurchaseClient}
+			err = purchaseModel.CreateDraft(ctx, in.GetBranchId(), "Replenishment of "+brandPlan.GetBrand().GetName(), brandPlan.GetLines())
+			if err != nil {
+				return &replenishmentModel.Pb, err
+			}
+
+			brandPlan.PurchaseId = purchaseModel.Id
+		}
+	}
+
+	return &replenishmentModel.Pb, nil
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/inventory-service/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Reservation struct
+type Reservation struct {
+	Db           *sql.DB
+	Log          map[string]*log.Logger
+	UserClient   users.UserServiceClient
+	RegionClient users.RegionServiceClient
+	BranchClient users.BranchServiceClient
+	inventories.UnimplementedReservationServiceServer
+}
+
+// Create Reservation of stock or of a barcode for a sales order
+func (u *Reservation) Create(ctx context.Context, in *inventories.Reservation) (*inventories.Reservation, error) {
+	var reservationModel model.Reservation
+	var err error
+
+	// basic validation
+	{
+		if len(in.GetBranchId()) == 0 {
+			return &reservationModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid branch")
+		}
+
+		if len(in.GetSalesOrderId()) == 0 {
+			return &reservationModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid sales order")
+		}
+
+		if len(in.GetProductId()) == 0 {
+			return &reservationModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid product")
+		}
+
+		expiredAt, err := time.Parse("2006-01-02T15:04:05.000Z", in.GetExpiredAt())
+		if err != nil || !expiredAt.After(time.Now().UTC()) {
+			return &reservationModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid expired at")
+		}
+
+		if len(in.GetBarcode()) > 0 {
+			in.Qty = 1
+		}
+
+		if in.GetQty() <= 0 {
+			return &reservationModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid qty")
+		}
+	}
+
+	productModel := model.Product{}
+	productModel.Pb = inventories.Product{Id: in.GetProductId()}
+	err = productModel.Get(ctx, u.Db)
+	if err != nil {
+		return &reservationModel.Pb, err
+	}
+
+	if len(in.GetBarcode()) > 0 {
+		if productModel.Pb.GetTrackingMode() == model.TrackingQuantity {
+			return &reservationModel.Pb, status.Error(codes.InvalidArgument, "quantity tracked product can not be reserved by barcode")
+		}
+
+		inventory := model.Inventory{
+			BranchID: in.GetBranchId(),
+			Barcode:  in.GetBarcode(),
+		}
+		err = inventory.CheckBarcode(ctx, u.Db)
+		if err != nil {
+			return &reservationModel.Pb, err
+		}
+	}
+
+	err = isYourBranch(ctx, u.UserClient, u.RegionClient, u.BranchClient, in.GetBranchId())
+	if err != nil {
+		return &reservationModel.Pb, err
+	}
+
+	reservationModel.Pb = inventories.Reservation{
+		BranchId:     in.GetBranchId(),
+		SalesOrderId: in.GetSalesOrderId(),
+		ProductId:    in.GetProductId(),
+		Barcode:      in.GetBarcode(),
+		Qty:          in.GetQty(),
+		ExpiredAt:    in.GetExpiredAt(),
+	}
+
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &reservationModel.Pb, err
+	}
+
+	err = reservationModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &reservationModel.Pb, err
+	}
+
+	tx.Commit()
+
+	return &reservationModel.Pb, nil
+}
+
+// Release Reservation
+func (u *Reservation) Release(ctx context.Context, in *inventories.Id) (*inventories.Reservation, error) {
+	var reservationModel model.Reservation
+	var err error
+
+	// basic validation
+	{
+		if len(in.GetId()) == 0 {
+			return &reservationModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid id")
+		}
+		reservationModel.Pb.Id = in.GetId()
+	}
+
+	err = reservationModel.Get(ctx, u.Db)
+	if err != nil {
+		return &reservationModel.Pb, err
+	}
+
+	err = isYourBranch(ctx, u.UserClient, u.RegionClient, u.BranchClient, reservationModel.Pb.GetBranchId())
+	if err != nil {
+		return &reservationModel.Pb, err
+	}
+
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &reservationModel.Pb, err
+	}
+
+	err = reservationModel.Release(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &reservationModel.Pb, err
+	}
+
+	tx.Commit()
+
+	return &reservationModel.Pb, nil
+}
+
+// View Reservation
+func (u *Reservation) View(ctx context.Context, in *inventories.Id) (*inventories.Reservation, error) {
+	var reservationModel model.Reservation
+	var err error
+
+	// basic validation
+	{
+		if len(in.GetId()) == 0 {
+			return &reservationModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid id")
+		}
+		reservationModel.Pb.Id = in.GetId()
+	}
+
+	err = reservationModel.Get(ctx, u.Db)
+	if err != nil {
+		return &reservationModel.Pb, err
+	}
+
+	return &reservationModel.Pb, nil
+}
+
+// List Reservation
+func (u *Reservation) List(in *inventories.ListReservationRequest, stream inventories.ReservationService_ListServer) error {
+	ctx := stream.Context()
+	var reservationModel model.Reservation
+	query, paramQueries, paginationResponse, err := reservationModel.ListQuery(ctx, u.Db, in)
+	if err != nil {
+		return err
+	}
+
+	rows, err := u.Db.QueryContext(ctx, query, paramQueries...)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer rows.Close()
+	paginationResponse.Pagination = in.GetPagination()
+
+	for rows.Next() {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return err
+		}
+
+		var pbReservation inventories.Reservation
+		var companyID string
+		var expiredAt, createdAt, updatedAt time.Time
+		err = rows.Scan(&pbReservation.Id, &companyID, &pbReservation.BranchId, &pbReservation.SalesOrderId, &pbReservation.ProductId,
+			&pbReservation.Barcode, &pbReservation.Qty, &expiredAt, &pbReservation.Status,
+			&createdAt, &pbReservation.CreatedBy, &updatedAt, &pbReservation.UpdatedBy)
+		if err != nil {
+			return status.Errorf(codes.Internal, "scan data: %v", err)
+		}
+
+		pbReservation.ExpiredAt = expiredAt.String()
+		pbReservation.CreatedAt = createdAt.String()
+		pbReservation.UpdatedAt = updatedAt.String()
+
+		res := &inventories.ListReservationResponse{
+			Pagination:  paginationResponse,
+			Reservation: &pbReservation,
+		}
+
+		err = stream.Send(res)
+		if err != nil {
+			return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+		}
+	}
+	return nil
+}
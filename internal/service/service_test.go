@@ -0,0 +1,45 @@
+package service
+
+import (
+	"database/sql"
+	"io"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/jacky-htg/inventory-service/internal/schema"
+
+	// postgres driver
+	_ "github.com/lib/pq"
+)
+
+// openTestDB the migrated test database, the tests on the database are skipped when POSTGRES_TEST_DSN is not set
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if len(dsn) == 0 {
+		t.Skip("POSTGRES_TEST_DSN is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	err = schema.Migrate(db)
+	if err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+
+	return db
+}
+
+func testLog() map[string]*log.Logger {
+	return map[string]*log.Logger{
+		"error":   log.New(io.Discard, "", 0),
+		"info":    log.New(io.Discard, "", 0),
+		"warning": log.New(io.Discard, "", 0),
+	}
+}
@@ -63,11 +63,28 @@ func (u *Shelve) Create(ctx context.Context, in *inventories.Shelve) (*inventori
 		Code:      in.GetCode(),
 		Warehouse: in.GetWarehouse(),
 	}
-	err = shelveModel.Create(ctx, u.Db)
+
+	tx, err := u.Db.BeginTx(ctx, nil)
 	if err != nil {
+		return &shelveModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	err = shelveModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
 		return &shelveModel.Pb, err
 	}
 
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "shelve", EntityId: shelveModel.Pb.GetId()}
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &shelveModel.Pb, err
+	}
+
+	tx.Commit()
+
 	return &shelveModel.Pb, nil
 }
 
@@ -93,11 +110,33 @@ func (u *Shelve) Update(ctx context.Context, in *inventories.Shelve) (*inventori
 		shelveModel.Pb.Capacity = in.GetCapacity()
 	}
 
-	err = shelveModel.Update(ctx, u.Db)
+	tx, err := u.Db.BeginTx(ctx, nil)
 	if err != nil {
+		return &shelveModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "shelve", EntityId: shelveModel.Pb.GetId()}
+	err = auditModel.Begin(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &shelveModel.Pb, err
+	}
+
+	err = shelveModel.Update(ctx, tx)
+	if err != nil {
+		tx.Rollback()
 		return &shelveModel.Pb, err
 	}
 
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &shelveModel.Pb, err
+	}
+
+	tx.Commit()
+
 	return &shelveModel.Pb, nil
 }
 
@@ -143,11 +182,33 @@ func (u *Shelve) Delete(ctx context.Context, in *inventories.Id) (*inventories.M
 		return &output, err
 	}
 
-	err = shelveModel.Delete(ctx, u.Db)
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &output, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "shelve", EntityId: shelveModel.Pb.GetId()}
+	err = auditModel.Begin(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &output, err
+	}
+
+	err = shelveModel.Delete(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &output, err
+	}
+
+	err = auditModel.Create(ctx, tx)
 	if err != nil {
+		tx.Rollback()
 		return &output, err
 	}
 
+	tx.Commit()
+
 	output.Boolean = true
 	return &output, nil
 }
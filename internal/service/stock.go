@@ -4,10 +4,14 @@ import (
 	"context"
 	"database/sql"
 	"log"
+	"time"
 
+	"github.com/jacky-htg/erp-pkg/app"
 	"github.com/jacky-htg/erp-proto/go/pb/inventories"
 	"github.com/jacky-htg/erp-proto/go/pb/users"
 	"github.com/jacky-htg/inventory-service/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // Stock struct
@@ -17,6 +21,7 @@ type Stock struct {
 	UserClient   users.UserServiceClient
 	RegionClient users.RegionServiceClient
 	BranchClient users.BranchServiceClient
+	Watcher      *StockWatcher
 	inventories.UnimplementedStockServiceServer
 }
 
@@ -25,6 +30,25 @@ func (u *Stock) Closing(ctx context.Context, in *inventories.ClosingStockRequest
 	var stockModel model.Stock
 	var err error
 
+	// basic validation
+	{
+		// without explicit period, the current month is closed
+		if in.GetYear() == 0 && in.GetMonth() == 0 {
+			now := time.Now().UTC()
+			in.Year = uint32(now.Year())
+			in.Month = uint32(now.Month())
+		}
+
+		if in.GetYear() == 0 || in.GetMonth() < 1 || in.GetMonth() > 12 {
+			return &inventories.MyBoolean{}, status.Error(codes.InvalidArgument, "Please supply valid period")
+		}
+	}
+
+	stockModel.ClosingInput = inventories.ClosingStockRequest{
+		Year:  in.GetYear(),
+		Month: in.GetMonth(),
+	}
+
 	tx, err := u.Db.BeginTx(ctx, nil)
 	if err != nil {
 		return &inventories.MyBoolean{}, err
@@ -41,28 +65,153 @@ func (u *Stock) Closing(ctx context.Context, in *inventories.ClosingStockRequest
 	return &inventories.MyBoolean{Boolean: true}, err
 }
 
+// Reopen Stock of a closed period, every later period is reopened too
+func (u *Stock) Reopen(ctx context.Context, in *inventories.ClosingStockRequest) (*inventories.MyBoolean, error) {
+	var stockModel model.Stock
+	var err error
+
+	// basic validation
+	{
+		if in.GetYear() == 0 || in.GetMonth() < 1 || in.GetMonth() > 12 {
+			return &inventories.MyBoolean{}, status.Error(codes.InvalidArgument, "Please supply valid period")
+		}
+	}
+
+	stockModel.ClosingInput = inventories.ClosingStockRequest{
+		Year:  in.GetYear(),
+		Month: in.GetMonth(),
+	}
+
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &inventories.MyBoolean{}, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	err = stockModel.Reopen(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &inventories.MyBoolean{}, err
+	}
+
+	tx.Commit()
+
+	return &inventories.MyBoolean{Boolean: true}, nil
+}
+
 // List Stock
-func (u *Stock) List(ctx context.Context, in *inventories.StockListInput) (*inventories.StockList, error) {
+func (u *Stock) List(in *inventories.StockListInput, stream inventories.StockService_ListServer) error {
+	ctx := stream.Context()
 	var stockModel model.Stock
 	var err error
 
+	// basic validation
+	{
+		if len(in.GetShelveId()) > 0 {
+			shelveModel := model.Shelve{}
+			shelveModel.Pb = inventories.Shelve{Id: in.GetShelveId()}
+			err = shelveModel.Get(ctx, u.Db)
+			if err != nil {
+				return err
+			}
+
+			if len(in.GetWarehouseId()) > 0 && in.GetWarehouseId() != shelveModel.Pb.GetWarehouse().GetId() {
+				return status.Error(codes.InvalidArgument, "shelve is not in the warehouse")
+			}
+			in.WarehouseId = shelveModel.Pb.GetWarehouse().GetId()
+		}
+
+		// stock of a warehouse is scoped to the branch of the warehouse
+		if len(in.GetWarehouseId()) > 0 {
+			warehouseModel := model.Warehouse{}
+			warehouseModel.Pb = inventories.Warehouse{Id: in.GetWarehouseId()}
+			err = warehouseModel.Get(ctx, u.Db)
+			if err != nil {
+				return err
+			}
+
+			if len(in.GetBranchId()) > 0 && in.GetBranchId() != warehouseModel.Pb.GetBranchId() {
+				return status.Error(codes.InvalidArgument, "warehouse is not in the branch")
+			}
+			in.BranchId = warehouseModel.Pb.GetBranchId()
+		}
+	}
+
 	if len(in.GetBranchId()) > 0 {
 		err = isYourBranch(ctx, u.UserClient, u.RegionClient, u.BranchClient, in.GetBranchId())
 		if err != nil {
-			return &inventories.StockList{}, err
+			return err
 		}
 	}
 
-	stockModel.ListInput = inventories.StockListInput{
-		BranchId: in.BranchId,
+	query, paramQueries, paginationResponse, err := stockModel.ListQuery(ctx, u.Db, in)
+	if err != nil {
+		return err
+	}
+
+	lots, err := stockModel.Lots(ctx, u.Db, in.GetBranchId(), in.GetAsOfDate())
+	if err != nil {
+		return err
 	}
 
-	err = stockModel.List(ctx, u.Db)
+	rows, err := u.Db.QueryContext(ctx, query, paramQueries...)
 	if err != nil {
-		return &inventories.StockList{}, err
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer rows.Close()
+	paginationResponse.Pagination = in.GetPagination()
+
+	for rows.Next() {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return err
+		}
+
+		var pbProduct inventories.Product
+		var companyID string
+		var createdAt, updatedAt time.Time
+		var pbBrand inventories.Brand
+		var pbProductCategory inventories.ProductCategory
+		var stock, inTransit int32
+		err = rows.Scan(
+			&pbProduct.Id, &companyID,
+			&pbBrand.Id, &pbBrand.Code, &pbBrand.Name,
+			&pbProductCategory.Id, &pbProductCategory.Name,
+			&pbProduct.Code, &pbProduct.Name, &pbProduct.MinimumStock,
+			&createdAt, &pbProduct.CreatedBy, &updatedAt, &pbProduct.UpdatedBy,
+			&stock, &inTransit,
+		)
+
+		if err != nil {
+			return status.Errorf(codes.Internal, "scan data: %v", err)
+		}
+
+		pbProduct.Brand = &pbBrand
+		pbProduct.ProductCategory = &pbProductCategory
+
+		pbProduct.CreatedAt = createdAt.String()
+		pbProduct.UpdatedAt = updatedAt.String()
+
+		res := &inventories.ListStockResponse{
+			Pagination: paginationResponse,
+			StockInfo: &inventories.StockInfo{
+				Product:   &pbProduct,
+				Qty:       stock,
+				InTransit: inTransit,
+				Lots:      lots[pbProduct.GetId()],
+			},
+		}
+
+		err = stream.Send(res)
+		if err != nil {
+			return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+		}
 	}
 
-	return &stockModel.StockList, nil
+	if rows.Err() != nil {
+		return status.Errorf(codes.Internal, "rows error: %v", rows.Err())
+	}
+
+	return nil
 }
 
 // Info Stock
@@ -80,6 +229,7 @@ func (u *Stock) Info(ctx context.Context, in *inventories.StockInfoInput) (*inve
 	stockModel.InfoInput = inventories.StockInfoInput{
 		BranchId:  in.BranchId,
 		ProductId: in.ProductId,
+		AsOfDate:  in.AsOfDate,
 	}
 
 	err = stockModel.Info(ctx, u.Db)
@@ -89,3 +239,261 @@ func (u *Stock) Info(ctx context.Context, in *inventories.StockInfoInput) (*inve
 
 	return &stockModel.StockInfo, nil
 }
+
+// StockCard of a product in a period, streamed as opening balance, movements with running balance and closing balance
+func (u *Stock) StockCard(in *inventories.StockCardRequest, stream inventories.StockService_StockCardServer) error {
+	ctx := stream.Context()
+	var stockCardModel model.StockCard
+	var err error
+
+	// basic validation
+	{
+		if len(in.GetProductId()) == 0 {
+			return status.Error(codes.InvalidArgument, "Please supply valid product")
+		}
+
+		stockCardModel.StartDate, err = time.Parse("2006-01-02T15:04:05.000Z", in.GetStartDate())
+		if err != nil {
+			return status.Error(codes.InvalidArgument, "Please supply valid start date")
+		}
+
+		stockCardModel.EndDate, err = time.Parse("2006-01-02T15:04:05.000Z", in.GetEndDate())
+		if err != nil || stockCardModel.EndDate.Before(stockCardModel.StartDate) {
+			return status.Error(codes.InvalidArgument, "Please supply valid end date")
+		}
+	}
+
+	productModel := model.Product{}
+	productModel.Pb = inventories.Product{Id: in.GetProductId()}
+	err = productModel.Get(ctx, u.Db)
+	if err != nil {
+		return err
+	}
+
+	if len(in.GetBranchId()) > 0 {
+		err = isYourBranch(ctx, u.UserClient, u.RegionClient, u.BranchClient, in.GetBranchId())
+		if err != nil {
+			return err
+		}
+	}
+
+	err = stockCardModel.Balance(ctx, u.Db, in)
+	if err != nil {
+		return err
+	}
+
+	query, paramQueries, paginationResponse, err := stockCardModel.ListQuery(ctx, u.Db, in)
+	if err != nil {
+		return err
+	}
+	paginationResponse.Pagination = in.GetPagination()
+
+	err = stream.Send(&inventories.StockCardResponse{
+		Pagination: paginationResponse,
+		Opening:    stockCardModel.Opening,
+		Balance:    stockCardModel.Opening,
+	})
+	if err != nil {
+		return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+	}
+
+	rows, err := u.Db.QueryContext(ctx, query, paramQueries...)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return err
+		}
+
+		var pbTransaction inventories.Transaction
+		var balance int32
+		err = rows.Scan(
+			&pbTransaction.BranchId, &pbTransaction.BranchName, &pbTransaction.WarehouseId, &pbTransaction.WarehouseName, &pbTransaction.ShelveId,
+			&pbTransaction.ShelveCode, &pbTransaction.ProductId, &pbTransaction.Barcode, &pbTransaction.TransactionCode,
+			&pbTransaction.TransactionType, &pbTransaction.TransactionDate, &pbTransaction.IsIn, &pbTransaction.Qty,
+			&pbTransaction.LotId, &pbTransaction.LotCode, &balance,
+		)
+		if err != nil {
+			return status.Errorf(codes.Internal, "scan data: %v", err)
+		}
+
+		err = stream.Send(&inventories.StockCardResponse{
+			Pagination:  paginationResponse,
+			Transaction: &pbTransaction,
+			Balance:     balance,
+		})
+		if err != nil {
+			return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+		}
+	}
+
+	if rows.Err() != nil {
+		return status.Errorf(codes.Internal, "rows error: %v", rows.Err())
+	}
+
+	return stream.Send(&inventories.StockCardResponse{
+		Pagination: paginationResponse,
+		Closing:    stockCardModel.Closing,
+		Balance:    stockCardModel.Closing,
+	})
+}
+
+// Valuation of the stock of a branch in a month, streamed per product with the total as the last response
+func (u *Stock) Valuation(in *inventories.ValuationRequest, stream inventories.StockService_ValuationServer) error {
+	ctx := stream.Context()
+	var valuationModel model.Valuation
+	var err error
+
+	// basic validation
+	{
+		if len(in.GetBranchId()) == 0 {
+			return status.Error(codes.InvalidArgument, "Please supply valid branch")
+		}
+		valuationModel.BranchID = in.GetBranchId()
+
+		if in.GetYear() <= 0 {
+			return status.Error(codes.InvalidArgument, "Please supply valid year")
+		}
+
+		if in.GetMonth() < 1 || in.GetMonth() > 12 {
+			return status.Error(codes.InvalidArgument, "Please supply valid month")
+		}
+
+		valuationModel.StartDate = time.Date(int(in.GetYear()), time.Month(in.GetMonth()), 1, 0, 0, 0, 0, time.UTC)
+		valuationModel.EndDate = valuationModel.StartDate.AddDate(0, 1, 0)
+	}
+
+	err = isYourBranch(ctx, u.UserClient, u.RegionClient, u.BranchClient, in.GetBranchId())
+	if err != nil {
+		return err
+	}
+
+	err = valuationModel.IsOpeningClosed(ctx, u.Db)
+	if err != nil {
+		return err
+	}
+
+	query, paramQueries := valuationModel.ListQuery(ctx)
+
+	rows, err := u.Db.QueryContext(ctx, query, paramQueries...)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return err
+		}
+
+		pbLine, err := valuationModel.Scan(rows)
+		if err != nil {
+			return err
+		}
+
+		err = stream.Send(&inventories.ValuationResponse{Line: pbLine})
+		if err != nil {
+			return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+		}
+	}
+
+	if rows.Err() != nil {
+		return status.Errorf(codes.Internal, "rows error: %v", rows.Err())
+	}
+
+	return stream.Send(&inventories.ValuationResponse{Total: &valuationModel.Total})
+}
+
+// Watch the stock changes of a branch, a warehouse or products. Every change of a matching inventory is pushed with
+// the new balance of the product in the branch, or in the warehouse when the watch is on a warehouse.
+func (u *Stock) Watch(in *inventories.WatchStockRequest, stream inventories.StockService_WatchServer) error {
+	ctx := stream.Context()
+	var err error
+
+	if u.Watcher == nil {
+		return status.Error(codes.Unavailable, "stock watch is not enabled")
+	}
+
+	// basic validation
+	{
+		if len(in.GetWarehouseId()) > 0 {
+			warehouseModel := model.Warehouse{}
+			warehouseModel.Pb = inventories.Warehouse{Id: in.GetWarehouseId()}
+			err = warehouseModel.Get(ctx, u.Db)
+			if err != nil {
+				return err
+			}
+
+			if len(in.GetBranchId()) > 0 && in.GetBranchId() != warehouseModel.Pb.GetBranchId() {
+				return status.Error(codes.InvalidArgument, "warehouse is not in the branch")
+			}
+			in.BranchId = warehouseModel.Pb.GetBranchId()
+		}
+	}
+
+	// without branch the whole company is watched, only a user of the whole company can do it
+	if len(in.GetBranchId()) > 0 {
+		err = isYourBranch(ctx, u.UserClient, u.RegionClient, u.BranchClient, in.GetBranchId())
+		if err != nil {
+			return err
+		}
+	} else {
+		userLogin, err := getUserLogin(ctx, u.UserClient)
+		if err != nil {
+			return err
+		}
+
+		if len(userLogin.GetBranchId()) > 0 || len(userLogin.GetRegionId()) > 0 {
+			return status.Error(codes.PermissionDenied, "Please supply valid branch")
+		}
+	}
+
+	products := make(map[string]bool)
+	for _, productID := range in.GetProductIds() {
+		products[productID] = true
+	}
+
+	companyID := ctx.Value(app.Ctx("companyID")).(string)
+	changes, unsubscribe := u.Watcher.Subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return app.ContextError(ctx)
+
+		case change, ok := <-changes:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "stock watch falls behind the changes, please watch again")
+			}
+
+			if change.CompanyID != companyID ||
+				(len(in.GetBranchId()) > 0 && change.BranchID != in.GetBranchId()) ||
+				(len(in.GetWarehouseId()) > 0 && change.WarehouseID != in.GetWarehouseId()) ||
+				(len(products) > 0 && !products[change.ProductID]) {
+				continue
+			}
+
+			qty, err := change.Balance(ctx, u.Db, in.GetWarehouseId())
+			if err != nil {
+				return err
+			}
+
+			err = stream.Send(&inventories.StockChange{
+				BranchId:    change.BranchID,
+				WarehouseId: change.WarehouseID,
+				ProductId:   change.ProductID,
+				Operation:   change.Operation,
+				Qty:         qty,
+			})
+			if err != nil {
+				return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/inventory-service/internal/model"
+	"github.com/jacky-htg/inventory-service/internal/notifier"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StockAlert struct
+type StockAlert struct {
+	Db           *sql.DB
+	Log          map[string]*log.Logger
+	UserClient   users.UserServiceClient
+	RegionClient users.RegionServiceClient
+	BranchClient users.BranchServiceClient
+	inventories.UnimplementedStockAlertServiceServer
+}
+
+// Acknowledge StockAlert
+func (u *StockAlert) Acknowledge(ctx context.Context, in *inventories.Id) (*inventories.StockAlert, error) {
+	var stockAlertModel model.StockAlert
+	var err error
+
+	// basic validation
+	{
+		if len(in.GetId()) == 0 {
+			return &stockAlertModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid id")
+		}
+		stockAlertModel.Pb.Id = in.GetId()
+	}
+
+	err = stockAlertModel.Get(ctx, u.Db)
+	if err != nil {
+		return &stockAlertModel.Pb, err
+	}
+
+	err = isYourBranch(ctx, u.UserClient, u.RegionClient, u.BranchClient, stockAlertModel.Pb.GetBranchId())
+	if err != nil {
+		return &stockAlertModel.Pb, err
+	}
+
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &stockAlertModel.Pb, err
+	}
+
+	err = stockAlertModel.Acknowledge(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &stockAlertModel.Pb, err
+	}
+
+	tx.Commit()
+
+	return &stockAlertModel.Pb, nil
+}
+
+// List StockAlert
+func (u *StockAlert) List(in *inventories.ListStockAlertRequest, stream inventories.StockAlertService_ListServer) error {
+	ctx := stream.Context()
+	var stockAlertModel model.StockAlert
+
+	if len(in.GetBranchId()) > 0 {
+		err := isYourBranch(ctx, u.UserClient, u.RegionClient, u.BranchClient, in.GetBranchId())
+		if err != nil {
+			return err
+		}
+	}
+
+	query, paramQueries, paginationResponse, err := stockAlertModel.ListQuery(ctx, u.Db, in)
+	if err != nil {
+		return err
+	}
+
+	rows, err := u.Db.QueryContext(ctx, query, paramQueries...)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer rows.Close()
+	paginationResponse.Pagination = in.GetPagination()
+
+	for rows.Next() {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return err
+		}
+
+		var stockAlert model.StockAlert
+		err = stockAlert.Scan(rows)
+		if err != nil {
+			return status.Errorf(codes.Internal, "scan data: %v", err)
+		}
+
+		res := &inventories.ListStockAlertResponse{
+			Pagination: paginationResponse,
+			StockAlert: &stockAlert.Pb,
+		}
+
+		err = stream.Send(res)
+		if err != nil {
+			return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+		}
+	}
+	return nil
+}
+
+// afterOutboundTimeout bound of the evaluation and the notifications following an outbound transaction
+const afterOutboundTimeout = 30 * time.Second
+
+// StockAlertEngine evaluate the stock against the minimum stock and notify the raised alerts
+type StockAlertEngine struct {
+	Db       *sql.DB
+	Log      map[string]*log.Logger
+	Notifier notifier.Notifier
+}
+
+// AfterOutbound evaluate the products of an outbound transaction of the branch. It is called after the
+// transaction is committed and runs in the background, so the response of the transaction does not wait for it.
+// The evaluation outlives the request but is bounded by its own timeout, a failure is logged.
+func (u *StockAlertEngine) AfterOutbound(ctx context.Context, branchID string, productIDs []string) {
+	if u == nil || len(productIDs) == 0 {
+		return
+	}
+
+	companyID := ctx.Value(app.Ctx("companyID")).(string)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), afterOutboundTimeout)
+		defer cancel()
+
+		u.evaluate(ctx, companyID, branchID, productIDs)
+	}()
+}
+
+// Run evaluate every product of every branch on each interval until the context is done
+func (u *StockAlertEngine) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			u.evaluate(ctx, "", "", nil)
+		}
+	}
+}
+
+func (u *StockAlertEngine) evaluate(ctx context.Context, companyID string, branchID string, productIDs []string) {
+	var stockAlertModel model.StockAlert
+	alerts, err := stockAlertModel.Evaluate(ctx, u.Db, companyID, branchID, productIDs)
+	if err != nil {
+		u.Log["error"].Printf("evaluate stock alerts: %v", err)
+		return
+	}
+
+	for _, alert := range alerts {
+		u.Log["warning"].Printf("stock alert: company %s branch %s product %s below minimum stock, %d of %d",
+			alert.GetCompanyId(), alert.GetBranchId(), alert.GetProductCode(), alert.GetQty(), alert.GetMinimumStock())
+
+		if u.Notifier == nil {
+			continue
+		}
+
+		err = u.Notifier.Notify(ctx, alert)
+		if err != nil {
+			u.Log["error"].Printf("notify stock alert %s: %v", alert.GetId(), err)
+		}
+	}
+}
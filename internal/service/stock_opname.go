@@ -0,0 +1,383 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/inventory-service/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StockOpname struct
+type StockOpname struct {
+	Db           *sql.DB
+	Log          map[string]*log.Logger
+	UserClient   users.UserServiceClient
+	RegionClient users.RegionServiceClient
+	BranchClient users.BranchServiceClient
+	inventories.UnimplementedStockOpnameServiceServer
+}
+
+// Open StockOpname session for a warehouse
+func (u *StockOpname) Open(ctx context.Context, in *inventories.StockOpname) (*inventories.StockOpname, error) {
+	var stockOpnameModel model.StockOpname
+	var err error
+
+	// basic validation
+	{
+		if len(in.GetWarehouse().GetId()) == 0 {
+			return &stockOpnameModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid warehouse")
+		}
+
+		if _, err := time.Parse("2006-01-02T15:04:05.000Z", in.GetOpnameDate()); err != nil {
+			return &stockOpnameModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid date")
+		}
+	}
+
+	warehouseModel := model.Warehouse{}
+	warehouseModel.Pb = inventories.Warehouse{Id: in.GetWarehouse().GetId()}
+	err = warehouseModel.Get(ctx, u.Db)
+	if err != nil {
+		return &stockOpnameModel.Pb, err
+	}
+
+	for _, shelve := range in.GetShelves() {
+		shelveModel := model.Shelve{}
+		shelveModel.Pb = inventories.Shelve{Id: shelve.GetId()}
+		err = shelveModel.Get(ctx, u.Db)
+		if err != nil {
+			return &stockOpnameModel.Pb, err
+		}
+
+		if shelveModel.Pb.GetWarehouse().GetId() != warehouseModel.Pb.GetId() {
+			return &stockOpnameModel.Pb, status.Error(codes.InvalidArgument, "shelve is not in the warehouse")
+		}
+	}
+
+	err = isYourBranch(ctx, u.UserClient, u.RegionClient, u.BranchClient, warehouseModel.Pb.GetBranchId())
+	if err != nil {
+		return &stockOpnameModel.Pb, err
+	}
+
+	stockOpnameModel.Pb = inventories.StockOpname{
+		BranchId:   warehouseModel.Pb.GetBranchId(),
+		BranchName: warehouseModel.Pb.GetBranchName(),
+		Warehouse:  &warehouseModel.Pb,
+		OpnameDate: in.GetOpnameDate(),
+		Remark:     in.GetRemark(),
+		Shelves:    in.GetShelves(),
+	}
+
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &stockOpnameModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	// transaction in a closed period is blocked
+	err = isPeriodOpen(ctx, tx, in.GetOpnameDate())
+	if err != nil {
+		tx.Rollback()
+		return &stockOpnameModel.Pb, err
+	}
+
+	err = stockOpnameModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &stockOpnameModel.Pb, err
+	}
+
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "stock_opname", EntityId: stockOpnameModel.Pb.GetId()}
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &stockOpnameModel.Pb, err
+	}
+
+	tx.Commit()
+
+	return &stockOpnameModel.Pb, nil
+}
+
+// Scan barcodes found on the shelves of an open StockOpname session
+func (u *StockOpname) Scan(stream inventories.StockOpnameService_ScanServer) error {
+	ctx := stream.Context()
+	var scanned uint32
+	sessions := make(map[string]*model.StockOpname)
+
+	for {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return err
+		}
+
+		in, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return status.Errorf(codes.Unknown, "cannot receive stream request: %v", err)
+		}
+
+		// basic validation
+		{
+			if len(in.GetStockOpnameId()) == 0 {
+				return status.Error(codes.InvalidArgument, "Please supply valid stock opname")
+			}
+
+			if len(in.GetBarcode()) == 0 {
+				return status.Error(codes.InvalidArgument, "Please supply valid barcode")
+			}
+		}
+
+		stockOpnameModel, ok := sessions[in.GetStockOpnameId()]
+		if !ok {
+			stockOpnameModel = &model.StockOpname{}
+			stockOpnameModel.Pb.Id = in.GetStockOpnameId()
+			err = stockOpnameModel.Get(ctx, u.Db)
+			if err != nil {
+				return err
+			}
+
+			if stockOpnameModel.Pb.GetStatus() != model.StockOpnameOpen {
+				return status.Error(codes.FailedPrecondition, "stock opname already approved")
+			}
+
+			err = isYourBranch(ctx, u.UserClient, u.RegionClient, u.BranchClient, stockOpnameModel.Pb.GetBranchId())
+			if err != nil {
+				return err
+			}
+
+			sessions[in.GetStockOpnameId()] = stockOpnameModel
+		}
+
+		if !stockOpnameModel.HasShelve(in.GetShelve().GetId()) {
+			return status.Error(codes.InvalidArgument, "shelve is not counted by the stock opname")
+		}
+
+		var scanModel model.StockOpnameScan
+		scanModel.Pb = inventories.StockOpnameScan{
+			StockOpnameId: in.GetStockOpnameId(),
+			Barcode:       in.GetBarcode(),
+			Product:       in.GetProduct(),
+			Shelve:        in.GetShelve(),
+		}
+
+		if len(in.GetProduct().GetId()) == 0 {
+			err = scanModel.GetProduct(ctx, u.Db)
+			if err != nil {
+				return err
+			}
+		}
+
+		productModel := model.Product{}
+		productModel.Pb = inventories.Product{Id: scanModel.Pb.GetProduct().GetId()}
+		err = productModel.Get(ctx, u.Db)
+		if err != nil {
+			return err
+		}
+
+		// the session counts units, a product tracked by quantity has no barcode of its own to scan
+		if productModel.Pb.GetTrackingMode() == model.TrackingQuantity {
+			return status.Error(codes.InvalidArgument, "product tracked by quantity can not be scanned")
+		}
+
+		err = scanModel.Create(ctx, u.Db)
+		if err != nil {
+			return err
+		}
+
+		scanned++
+	}
+
+	return stream.SendAndClose(&inventories.StockOpnameScanResponse{Scanned: scanned})
+}
+
+// Variance of StockOpname, barcodes missing from and unexpected on the counted shelves
+func (u *StockOpname) Variance(ctx context.Context, in *inventories.Id) (*inventories.StockOpnameVariance, error) {
+	var stockOpnameModel model.StockOpname
+	var err error
+
+	// basic validation
+	{
+		if len(in.GetId()) == 0 {
+			return &stockOpnameModel.PbVariance, status.Error(codes.InvalidArgument, "Please supply valid id")
+		}
+		stockOpnameModel.Pb.Id = in.GetId()
+	}
+
+	err = stockOpnameModel.Get(ctx, u.Db)
+	if err != nil {
+		return &stockOpnameModel.PbVariance, err
+	}
+
+	err = isYourBranch(ctx, u.UserClient, u.RegionClient, u.BranchClient, stockOpnameModel.Pb.GetBranchId())
+	if err != nil {
+		return &stockOpnameModel.PbVariance, err
+	}
+
+	tx, err := u.Db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return &stockOpnameModel.PbVariance, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	err = stockOpnameModel.Variance(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &stockOpnameModel.PbVariance, err
+	}
+
+	tx.Commit()
+
+	return &stockOpnameModel.PbVariance, nil
+}
+
+// Approve StockOpname, the variance is posted to inventories as adjustment
+func (u *StockOpname) Approve(ctx context.Context, in *inventories.Id) (*inventories.StockOpnameVariance, error) {
+	var stockOpnameModel model.StockOpname
+	var err error
+
+	// basic validation
+	{
+		if len(in.GetId()) == 0 {
+			return &stockOpnameModel.PbVariance, status.Error(codes.InvalidArgument, "Please supply valid id")
+		}
+		stockOpnameModel.Pb.Id = in.GetId()
+	}
+
+	err = stockOpnameModel.Get(ctx, u.Db)
+	if err != nil {
+		return &stockOpnameModel.PbVariance, err
+	}
+
+	if stockOpnameModel.Pb.GetStatus() != model.StockOpnameOpen {
+		return &stockOpnameModel.PbVariance, status.Error(codes.FailedPrecondition, "stock opname already approved")
+	}
+
+	err = isYourBranch(ctx, u.UserClient, u.RegionClient, u.BranchClient, stockOpnameModel.Pb.GetBranchId())
+	if err != nil {
+		return &stockOpnameModel.PbVariance, err
+	}
+
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &stockOpnameModel.PbVariance, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	// the adjustment is posted at the opname date
+	err = isPeriodOpen(ctx, tx, stockOpnameModel.Pb.GetOpnameDate())
+	if err != nil {
+		tx.Rollback()
+		return &stockOpnameModel.PbVariance, err
+	}
+
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "stock_opname", EntityId: stockOpnameModel.Pb.GetId()}
+	err = auditModel.Begin(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &stockOpnameModel.PbVariance, err
+	}
+
+	err = stockOpnameModel.Approve(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &stockOpnameModel.PbVariance, err
+	}
+
+	journalModel := model.Journal{TransactionID: stockOpnameModel.Pb.GetId()}
+	err = journalModel.Post(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &stockOpnameModel.PbVariance, err
+	}
+
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &stockOpnameModel.PbVariance, err
+	}
+
+	tx.Commit()
+
+	return &stockOpnameModel.PbVariance, nil
+}
+
+// View StockOpname
+func (u *StockOpname) View(ctx context.Context, in *inventories.Id) (*inventories.StockOpname, error) {
+	var stockOpnameModel model.StockOpname
+	var err error
+
+	// basic validation
+	{
+		if len(in.GetId()) == 0 {
+			return &stockOpnameModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid id")
+		}
+		stockOpnameModel.Pb.Id = in.GetId()
+	}
+
+	err = stockOpnameModel.Get(ctx, u.Db)
+	if err != nil {
+		return &stockOpnameModel.Pb, err
+	}
+
+	return &stockOpnameModel.Pb, nil
+}
+
+// List StockOpname
+func (u *StockOpname) List(in *inventories.ListStockOpnameRequest, stream inventories.StockOpnameService_ListServer) error {
+	ctx := stream.Context()
+	var stockOpnameModel model.StockOpname
+	query, paramQueries, paginationResponse, err := stockOpnameModel.ListQuery(ctx, u.Db, in)
+	if err != nil {
+		return err
+	}
+
+	rows, err := u.Db.QueryContext(ctx, query, paramQueries...)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer rows.Close()
+	paginationResponse.Pagination = in.GetPagination()
+
+	for rows.Next() {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return err
+		}
+
+		var pbStockOpname inventories.StockOpname
+		var companyID, warehouseID string
+		var opnameDate, createdAt, updatedAt time.Time
+		err = rows.Scan(&pbStockOpname.Id, &companyID, &pbStockOpname.BranchId, &pbStockOpname.BranchName,
+			&warehouseID, &pbStockOpname.Code, &opnameDate, &pbStockOpname.Status, &pbStockOpname.Remark,
+			&createdAt, &pbStockOpname.CreatedBy, &updatedAt, &pbStockOpname.UpdatedBy)
+		if err != nil {
+			return status.Errorf(codes.Internal, "scan data: %v", err)
+		}
+
+		pbStockOpname.Warehouse = &inventories.Warehouse{Id: warehouseID}
+		pbStockOpname.OpnameDate = opnameDate.String()
+		pbStockOpname.CreatedAt = createdAt.String()
+		pbStockOpname.UpdatedAt = updatedAt.String()
+
+		res := &inventories.ListStockOpnameResponse{
+			Pagination:  paginationResponse,
+			StockOpname: &pbStockOpname,
+		}
+
+		err = stream.Send(res)
+		if err != nil {
+			return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jacky-htg/inventory-service/internal/model"
+	"github.com/lib/pq"
+)
+
+// stockWatchBuffer changes kept for a watcher, a watcher falling further behind is dropped
+const stockWatchBuffer int = 256
+
+// StockWatcher fan out the stock change notifications of postgres to the watching streams
+type StockWatcher struct {
+	Log      map[string]*log.Logger
+	Listener *pq.Listener
+
+	mu       sync.Mutex
+	watchers map[chan model.StockChange]struct{}
+}
+
+// Subscribe a channel of the stock changes, the channel is closed when the watcher falls behind.
+// The returned func ends the subscription.
+func (u *StockWatcher) Subscribe() (<-chan model.StockChange, func()) {
+	ch := make(chan model.StockChange, stockWatchBuffer)
+
+	u.mu.Lock()
+	if u.watchers == nil {
+		u.watchers = make(map[chan model.StockChange]struct{})
+	}
+	u.watchers[ch] = struct{}{}
+	u.mu.Unlock()
+
+	return ch, func() {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+
+		if _, ok := u.watchers[ch]; ok {
+			delete(u.watchers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Run dispatch the notifications of the listener until the context is done
+func (u *StockWatcher) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case n := <-u.Listener.Notify:
+			// a nil notification follows a reconnect, the changes in between are lost
+			if n == nil {
+				u.Log["warning"].Println("stock watch listener reconnected")
+				continue
+			}
+
+			var change model.StockChange
+			err := json.Unmarshal([]byte(n.Extra), &change)
+			if err != nil {
+				u.Log["error"].Printf("unmarshal stock change: %v", err)
+				continue
+			}
+
+			u.dispatch(change)
+
+		case <-time.After(90 * time.Second):
+			go u.Listener.Ping()
+		}
+	}
+}
+
+func (u *StockWatcher) dispatch(change model.StockChange) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for ch := range u.watchers {
+		select {
+		case ch <- change:
+		default:
+			delete(u.watchers, ch)
+			close(ch)
+		}
+	}
+}
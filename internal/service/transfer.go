@@ -0,0 +1,311 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/inventory-service/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Transfer struct
+type Transfer struct {
+	Db           *sql.DB
+	Log          map[string]*log.Logger
+	UserClient   users.UserServiceClient
+	RegionClient users.RegionServiceClient
+	BranchClient users.BranchServiceClient
+	AlertEngine  *StockAlertEngine
+	inventories.UnimplementedTransferServiceServer
+}
+
+// Ship Transfer from the origin branch, the goods become in transit
+func (u *Transfer) Ship(ctx context.Context, in *inventories.Transfer) (*inventories.Transfer, error) {
+	var transferModel model.Transfer
+	var err error
+
+	// basic validation
+	{
+		if len(in.GetBranchId()) == 0 {
+			return &transferModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid branch")
+		}
+
+		if len(in.GetToBranchId()) == 0 || in.GetToBranchId() == in.GetBranchId() {
+			return &transferModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid destination branch")
+		}
+
+		if _, err := time.Parse("2006-01-02T15:04:05.000Z", in.GetTransferDate()); err != nil {
+			return &transferModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid date")
+		}
+
+		if len(in.GetDetails()) == 0 {
+			return &transferModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid details")
+		}
+	}
+
+	for _, detail := range in.GetDetails() {
+		// product validation
+		if len(detail.GetProduct().GetId()) == 0 {
+			return &transferModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid product")
+		}
+
+		productModel := model.Product{}
+		productModel.Pb = inventories.Product{Id: detail.GetProduct().GetId()}
+		err = productModel.Get(ctx, u.Db)
+		if err != nil {
+			return &transferModel.Pb, err
+		}
+
+		if productModel.Pb.GetTrackingMode() == model.TrackingQuantity {
+			return &transferModel.Pb, status.Error(codes.InvalidArgument, "transfer only support serialized product")
+		}
+
+		// shelve validation
+		err = isShelveInBranch(ctx, u.Db, detail.GetFromShelve().GetId(), in.GetBranchId())
+		if err != nil {
+			return &transferModel.Pb, err
+		}
+
+		if len(detail.GetBarcode()) == 0 {
+			return &transferModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid barcode")
+		}
+
+		inventory := model.Inventory{
+			BranchID: in.GetBranchId(),
+			Barcode:  detail.GetBarcode(),
+			ShelveID: detail.GetFromShelve().GetId(),
+		}
+		err = inventory.CheckBarcode(ctx, u.Db)
+		if err != nil {
+			return &transferModel.Pb, err
+		}
+	}
+
+	// only the origin branch can ship the transfer
+	err = isYourBranch(ctx, u.UserClient, u.RegionClient, u.BranchClient, in.GetBranchId())
+	if err != nil {
+		return &transferModel.Pb, err
+	}
+
+	branch, err := getBranch(ctx, u.BranchClient, in.GetBranchId())
+	if err != nil {
+		return &transferModel.Pb, err
+	}
+
+	toBranch, err := getBranch(ctx, u.BranchClient, in.GetToBranchId())
+	if err != nil {
+		return &transferModel.Pb, err
+	}
+
+	transferModel.Pb = inventories.Transfer{
+		BranchId:     in.GetBranchId(),
+		BranchName:   branch.GetName(),
+		ToBranchId:   in.GetToBranchId(),
+		ToBranchName: toBranch.GetName(),
+		TransferDate: in.GetTransferDate(),
+		Remark:       in.GetRemark(),
+		Details:      in.GetDetails(),
+	}
+
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &transferModel.Pb, err
+	}
+
+	// transaction in a closed period is blocked
+	err = isPeriodOpen(ctx, tx, in.GetTransferDate())
+	if err != nil {
+		tx.Rollback()
+		return &transferModel.Pb, err
+	}
+
+	err = transferModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &transferModel.Pb, err
+	}
+
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "transfer", EntityId: transferModel.Pb.GetId()}
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &transferModel.Pb, err
+	}
+
+	tx.Commit()
+
+	productIDs := make([]string, len(in.GetDetails()))
+	for i, detail := range in.GetDetails() {
+		productIDs[i] = detail.GetProduct().GetId()
+	}
+	u.AlertEngine.AfterOutbound(ctx, transferModel.Pb.GetBranchId(), productIDs)
+
+	return &transferModel.Pb, nil
+}
+
+// Receive Transfer on the destination branch
+func (u *Transfer) Receive(ctx context.Context, in *inventories.Transfer) (*inventories.Transfer, error) {
+	var transferModel model.Transfer
+	var err error
+
+	// basic validation
+	{
+		if len(in.GetId()) == 0 {
+			return &transferModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid id")
+		}
+
+		if _, err := time.Parse("2006-01-02T15:04:05.000Z", in.GetReceiveDate()); err != nil {
+			return &transferModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid receive date")
+		}
+		transferModel.Pb.Id = in.GetId()
+	}
+
+	err = transferModel.Get(ctx, u.Db)
+	if err != nil {
+		return &transferModel.Pb, err
+	}
+
+	if transferModel.Pb.GetStatus() != model.TransferInTransit {
+		return &transferModel.Pb, status.Error(codes.FailedPrecondition, "transfer already received")
+	}
+
+	// only the destination branch can confirm the transfer
+	err = isYourBranch(ctx, u.UserClient, u.RegionClient, u.BranchClient, transferModel.Pb.GetToBranchId())
+	if err != nil {
+		return &transferModel.Pb, err
+	}
+
+	// every shipped barcode must be put on a shelve of the destination branch
+	for _, data := range transferModel.Pb.GetDetails() {
+		var toShelveID string
+		for _, detail := range in.GetDetails() {
+			if detail.GetId() == data.GetId() {
+				toShelveID = detail.GetToShelve().GetId()
+				break
+			}
+		}
+
+		err = isShelveInBranch(ctx, u.Db, toShelveID, transferModel.Pb.GetToBranchId())
+		if err != nil {
+			return &transferModel.Pb, err
+		}
+
+		data.ToShelve = &inventories.Shelve{Id: toShelveID}
+	}
+
+	transferModel.Pb.ReceiveDate = in.GetReceiveDate()
+
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &transferModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	// transaction in a closed period is blocked
+	err = isPeriodOpen(ctx, tx, in.GetReceiveDate())
+	if err != nil {
+		tx.Rollback()
+		return &transferModel.Pb, err
+	}
+
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "transfer", EntityId: transferModel.Pb.GetId()}
+	err = auditModel.Begin(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &transferModel.Pb, err
+	}
+
+	err = transferModel.Receive(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &transferModel.Pb, err
+	}
+
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &transferModel.Pb, err
+	}
+
+	tx.Commit()
+
+	return &transferModel.Pb, nil
+}
+
+// View Transfer
+func (u *Transfer) View(ctx context.Context, in *inventories.Id) (*inventories.Transfer, error) {
+	var transferModel model.Transfer
+	var err error
+
+	// basic validation
+	{
+		if len(in.GetId()) == 0 {
+			return &transferModel.Pb, status.Error(codes.InvalidArgument, "Please supply valid id")
+		}
+		transferModel.Pb.Id = in.GetId()
+	}
+
+	err = transferModel.Get(ctx, u.Db)
+	if err != nil {
+		return &transferModel.Pb, err
+	}
+
+	return &transferModel.Pb, nil
+}
+
+// List Transfer
+func (u *Transfer) List(in *inventories.ListTransferRequest, stream inventories.TransferService_ListServer) error {
+	ctx := stream.Context()
+	var transferModel model.Transfer
+	query, paramQueries, paginationResponse, err := transferModel.ListQuery(ctx, u.Db, in)
+	if err != nil {
+		return err
+	}
+
+	rows, err := u.Db.QueryContext(ctx, query, paramQueries...)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer rows.Close()
+	paginationResponse.Pagination = in.GetPagination()
+
+	for rows.Next() {
+		err := app.ContextError(ctx)
+		if err != nil {
+			return err
+		}
+
+		var pbTransfer inventories.Transfer
+		var companyID string
+		var transferDate, createdAt, updatedAt time.Time
+		err = rows.Scan(&pbTransfer.Id, &companyID, &pbTransfer.BranchId, &pbTransfer.BranchName,
+			&pbTransfer.ToBranchId, &pbTransfer.ToBranchName, &pbTransfer.Code, &transferDate,
+			&pbTransfer.ReceiveDate, &pbTransfer.Status, &pbTransfer.Remark,
+			&createdAt, &pbTransfer.CreatedBy, &updatedAt, &pbTransfer.UpdatedBy)
+		if err != nil {
+			return status.Errorf(codes.Internal, "scan data: %v", err)
+		}
+
+		pbTransfer.TransferDate = transferDate.String()
+		pbTransfer.CreatedAt = createdAt.String()
+		pbTransfer.UpdatedAt = updatedAt.String()
+
+		res := &inventories.ListTransferResponse{
+			Pagination: paginationResponse,
+			Transfer:   &pbTransfer,
+		}
+
+		err = stream.Send(res)
+		if err != nil {
+			return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+		}
+	}
+	return nil
+}
@@ -2,10 +2,16 @@ package service
 
 import (
 	"context"
+	"database/sql"
 	"io"
+	"time"
 
 	"github.com/jacky-htg/erp-pkg/app"
+	"github.com/jacky-htg/erp-proto/go/pb/inventories"
+	"github.com/jacky-htg/erp-proto/go/pb/purchases"
+	"github.com/jacky-htg/erp-proto/go/pb/sales"
 	"github.com/jacky-htg/erp-proto/go/pb/users"
+	"github.com/jacky-htg/inventory-service/internal/model"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -64,6 +70,39 @@ func checkYourBranch(branches []*users.Branch, branchID string) error {
 	return nil
 }
 
+// isApprover the user login can decide on a document of the branch under the approver scope of the rule,
+// the user who last changed the document can not decide on it
+func isApprover(
+	ctx context.Context,
+	userClient users.UserServiceClient,
+	regionClient users.RegionServiceClient,
+	branchClient users.BranchServiceClient,
+	branchID string,
+	approverScope string,
+	changedBy string) error {
+	userLogin, err := getUserLogin(ctx, userClient)
+	if err != nil {
+		return err
+	}
+
+	if userLogin.GetId() == changedBy {
+		return status.Error(codes.PermissionDenied, "the document can not be decided by the user who last changed it")
+	}
+
+	switch approverScope {
+	case model.ApproverCompany:
+		if len(userLogin.GetBranchId()) > 0 || len(userLogin.GetRegionId()) > 0 {
+			return status.Error(codes.PermissionDenied, "only company user can decide on the document")
+		}
+	case model.ApproverRegion:
+		if len(userLogin.GetBranchId()) > 0 {
+			return status.Error(codes.PermissionDenied, "only region or company user can decide on the document")
+		}
+	}
+
+	return isYourBranch(ctx, userClient, regionClient, branchClient, branchID)
+}
+
 func getUserLogin(ctx context.Context, userClient users.UserServiceClient) (*users.User, error) {
 	userLogin, err := userClient.View(ctx, &users.Id{Id: ctx.Value(app.Ctx("userID")).(string)})
 
@@ -113,3 +152,178 @@ func getBranch(ctx context.Context, branchClient users.BranchServiceClient, id s
 
 	return branch, nil
 }
+
+func isShelveInBranch(ctx context.Context, db *sql.DB, shelveID string, branchID string) error {
+	if len(shelveID) == 0 {
+		return status.Error(codes.InvalidArgument, "Please supply valid shelve")
+	}
+
+	shelveModel := model.Shelve{}
+	shelveModel.Pb = inventories.Shelve{Id: shelveID}
+	err := shelveModel.Get(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	warehouseModel := model.Warehouse{}
+	warehouseModel.Pb = inventories.Warehouse{Id: shelveModel.Pb.GetWarehouse().GetId()}
+	err = warehouseModel.Get(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	if warehouseModel.Pb.GetBranchId() != branchID {
+		return status.Error(codes.InvalidArgument, "shelve is not in the branch")
+	}
+
+	return nil
+}
+
+// isPeriodOpen check the dates against closed periods, both the layout of request and of stored document are accepted.
+// The check holds until the transaction of the document ends, a closing waits for it.
+func isPeriodOpen(ctx context.Context, tx *sql.Tx, dates ...string) error {
+	closingPeriod := model.ClosingPeriod{}
+	for _, date := range dates {
+		if len(date) < 10 {
+			continue
+		}
+
+		transactionDate, err := time.Parse("2006-01-02", date[:10])
+		if err != nil {
+			return status.Error(codes.InvalidArgument, "Please supply valid date")
+		}
+
+		err = closingPeriod.IsOpen(ctx, tx, transactionDate)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// detailQty normalize qty of a transaction detail, a serialized product is always a single unit
+func detailQty(product *inventories.Product, qty int32) (int32, error) {
+	if product.GetTrackingMode() != model.TrackingQuantity {
+		return 1, nil
+	}
+
+	if qty <= 0 {
+		return 0, status.Error(codes.InvalidArgument, "Please supply valid qty")
+	}
+
+	return qty, nil
+}
+
+// checkOutbound check the stock of the quantity lines leaving the shelves for the sales order, lines of the same product,
+// lot and shelve are summed so the document can not take more than the shelve holds
+func checkOutbound(ctx context.Context, tx *sql.Tx, salesOrderID string, lines []model.Inventory) error {
+	var outbounds []model.Inventory
+	for _, line := range lines {
+		merged := false
+		for i := range outbounds {
+			if outbounds[i].ShelveID == line.ShelveID && outbounds[i].ProductID == line.ProductID && outbounds[i].LotID == line.LotID {
+				outbounds[i].Qty += line.Qty
+				merged = true
+				break
+			}
+		}
+
+		if !merged {
+			outbounds = append(outbounds, line)
+		}
+	}
+
+	for i := range outbounds {
+		err := outbounds[i].CheckQty(ctx, tx, salesOrderID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isLotOfProduct check the lot is registered for the product
+func isLotOfProduct(ctx context.Context, db *sql.DB, lotID string, productID string) error {
+	lotModel := model.Lot{}
+	lotModel.Pb = inventories.Lot{Id: lotID}
+	err := lotModel.Get(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	if lotModel.Pb.GetProductId() != productID {
+		return status.Error(codes.InvalidArgument, "lot is not of the product")
+	}
+
+	return nil
+}
+
+// outstandingByPurchase qty of the purchase not received yet, per product
+func outstandingByPurchase(ctx context.Context, db *sql.DB, purchaseClient purchases.PurchaseServiceClient, purchaseID string) (*inventories.OutstandingResponse, error) {
+	var mPurchase model.Purchase = model.Purchase{Id: purchaseID, PurchaseClient: purchaseClient}
+	output, err := mPurchase.Outstanding(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var mReceiveDetail model.ReceiveDetail
+	return outstanding(ctx, db, output, func(tx *sql.Tx, ids []string) ([]*inventories.OutstandingDetail, error) {
+		return mReceiveDetail.ListByPurchaseId(ctx, tx, purchaseID, ids)
+	})
+}
+
+// outstandingBySalesOrder qty of the sales order not delivered yet, per product
+func outstandingBySalesOrder(ctx context.Context, db *sql.DB, salesOrderClient sales.SalesOrderServiceClient, salesOrderID string) (*inventories.OutstandingResponse, error) {
+	mSalesOrder := model.SalesOrder{Id: salesOrderID, SalesOrderClient: salesOrderClient}
+	output, err := mSalesOrder.Outstanding(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var mDeliveryDetail model.DeliveryDetail
+	return outstanding(ctx, db, output, func(tx *sql.Tx, ids []string) ([]*inventories.OutstandingDetail, error) {
+		return mDeliveryDetail.ListBySalesOrderId(ctx, tx, salesOrderID, ids)
+	})
+}
+
+// outstanding deduct the qty fulfilled on the order from the qty ordered per product,
+// fulfilled over the order leaves nothing outstanding
+func outstanding(ctx context.Context, db *sql.DB, output *inventories.OutstandingResponse,
+	listFulfilled func(tx *sql.Tx, ids []string) ([]*inventories.OutstandingDetail, error)) (*inventories.OutstandingResponse, error) {
+	var ids []string
+	for _, v := range output.Detail {
+		ids = append(ids, v.ProductId)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	out, err := listFulfilled(tx, ids)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	tx.Commit()
+
+	for i, v := range output.Detail {
+		for _, val := range out {
+			if val.ProductId == v.ProductId {
+				if val.Quantity >= v.Quantity {
+					output.Detail[i].Quantity = 0
+				} else {
+					output.Detail[i].Quantity -= val.Quantity
+				}
+				output.Detail[i].ProductName = val.ProductName
+				output.Detail[i].ProductCode = val.ProductCode
+				break
+			}
+		}
+	}
+
+	return output, nil
+}
@@ -82,11 +82,28 @@ func (u *Warehouse) Create(ctx context.Context, in *inventories.Warehouse) (*inv
 		PicName:    in.GetPicName(),
 		PicPhone:   in.GetPicPhone(),
 	}
-	err = warehouseModel.Create(ctx, u.Db)
+
+	tx, err := u.Db.BeginTx(ctx, nil)
 	if err != nil {
+		return &warehouseModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	err = warehouseModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
 		return &warehouseModel.Pb, err
 	}
 
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "warehouse", EntityId: warehouseModel.Pb.GetId()}
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &warehouseModel.Pb, err
+	}
+
+	tx.Commit()
+
 	return &warehouseModel.Pb, nil
 }
 
@@ -120,11 +137,33 @@ func (u *Warehouse) Update(ctx context.Context, in *inventories.Warehouse) (*inv
 		warehouseModel.Pb.PicPhone = in.GetPicPhone()
 	}
 
-	err = warehouseModel.Update(ctx, u.Db)
+	tx, err := u.Db.BeginTx(ctx, nil)
 	if err != nil {
+		return &warehouseModel.Pb, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "warehouse", EntityId: warehouseModel.Pb.GetId()}
+	err = auditModel.Begin(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &warehouseModel.Pb, err
+	}
+
+	err = warehouseModel.Update(ctx, tx)
+	if err != nil {
+		tx.Rollback()
 		return &warehouseModel.Pb, err
 	}
 
+	err = auditModel.Create(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &warehouseModel.Pb, err
+	}
+
+	tx.Commit()
+
 	return &warehouseModel.Pb, nil
 }
 
@@ -170,11 +209,33 @@ func (u *Warehouse) Delete(ctx context.Context, in *inventories.Id) (*inventorie
 		return &output, err
 	}
 
-	err = warehouseModel.Delete(ctx, u.Db)
+	tx, err := u.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return &output, status.Errorf(codes.Internal, "begin transaction: %v", err)
+	}
+
+	auditModel := model.Audit{}
+	auditModel.Pb = inventories.Audit{Entity: "warehouse", EntityId: warehouseModel.Pb.GetId()}
+	err = auditModel.Begin(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &output, err
+	}
+
+	err = warehouseModel.Delete(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return &output, err
+	}
+
+	err = auditModel.Create(ctx, tx)
 	if err != nil {
+		tx.Rollback()
 		return &output, err
 	}
 
+	tx.Commit()
+
 	output.Boolean = true
 	return &output, nil
 }
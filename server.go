@@ -1,16 +1,23 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net"
 	"os"
+	"time"
 
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	"github.com/jacky-htg/erp-pkg/db/postgres"
+	"github.com/jacky-htg/erp-proto/go/pb/ledgers"
 	"github.com/jacky-htg/inventory-service/internal/config"
 	"github.com/jacky-htg/inventory-service/internal/middleware"
+	"github.com/jacky-htg/inventory-service/internal/model"
+	"github.com/jacky-htg/inventory-service/internal/notifier"
+	"github.com/jacky-htg/inventory-service/internal/publisher"
 	"github.com/jacky-htg/inventory-service/internal/route"
-	_ "github.com/lib/pq"
+	"github.com/jacky-htg/inventory-service/internal/service"
+	"github.com/lib/pq"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
@@ -75,8 +82,66 @@ func main() {
 	}
 	defer purchaseConn.Close()
 
+	salesConn, err := grpc.NewClient(os.Getenv("SALES_SERVICE"), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log["info"].Printf("create sales service connection: %v", err)
+	}
+	defer salesConn.Close()
+
+	// low stock alerts, evaluated after outbound transactions and on the interval
+	alertNotifier, err := notifier.New(os.Getenv("ALERT_NOTIFIER"), os.Getenv("ALERT_NOTIFIER_TARGET"))
+	if err != nil {
+		log["error"].Fatalf("create alert notifier: %v", err)
+	}
+	alertEngine := service.StockAlertEngine{Db: db, Log: log, Notifier: alertNotifier}
+	if interval, err := time.ParseDuration(os.Getenv("ALERT_INTERVAL")); err == nil && interval > 0 {
+		go alertEngine.Run(context.Background(), interval)
+	}
+
+	ledgerConn, err := grpc.NewClient(os.Getenv("LEDGER_SERVICE"), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log["info"].Printf("create ledger service connection: %v", err)
+	}
+	defer ledgerConn.Close()
+
+	// journals are written to the outbox with the transactions and relayed to the ledger on the interval
+	journalRelay := service.JournalRelay{
+		Db:     db,
+		Log:    log,
+		Ledger: &model.Ledger{JournalClient: ledgers.NewJournalServiceClient(ledgerConn)},
+	}
+	if interval, err := time.ParseDuration(os.Getenv("JOURNAL_INTERVAL")); err == nil && interval > 0 {
+		go journalRelay.Run(context.Background(), interval)
+	}
+
+	// events are written to the outbox with the stock changes and relayed to the publisher on the interval
+	eventPublisher, err := publisher.New(os.Getenv("EVENT_PUBLISHER"), os.Getenv("EVENT_PUBLISHER_TARGET"))
+	if err != nil {
+		log["error"].Fatalf("create event publisher: %v", err)
+	}
+	if interval, err := time.ParseDuration(os.Getenv("EVENT_INTERVAL")); err == nil && interval > 0 && eventPublisher != nil {
+		eventRelay := service.EventRelay{Db: db, Log: log, Publisher: eventPublisher}
+		go eventRelay.Run(context.Background(), interval)
+	}
+
+	// stock changes are notified by postgres, a failed listen leaves the stock watch disabled
+	listener := pq.NewListener(config.PostgresDSN(), 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log["error"].Printf("stock watch listener: %v", err)
+		}
+	})
+	defer listener.Close()
+
+	var stockWatcher *service.StockWatcher
+	if err := listener.Listen(model.StockChannel); err != nil {
+		log["error"].Printf("listen stock changes: %v", err)
+	} else {
+		stockWatcher = &service.StockWatcher{Log: log, Listener: listener}
+		go stockWatcher.Run(context.Background())
+	}
+
 	// routing grpc services
-	route.GrpcRoute(grpcServer, db, log, userConn, purchaseConn)
+	route.GrpcRoute(grpcServer, db, log, userConn, purchaseConn, salesConn, &alertEngine, stockWatcher)
 
 	if err := grpcServer.Serve(lis); err != nil {
 		log["error"].Fatalf("failed to serve: %s", err)